@@ -11,10 +11,41 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+type blobOpt struct {
+	progressFn func(ProgressEvent)
+	progress   *progress
+}
+
+// BlobOpts define options for the Blob* commands
+type BlobOpts func(*blobOpt)
+
+// BlobWithProgress calls fn as the blob is transferred.
+// Calls to fn are serialized, and totals are tracked separately for each call using the option.
+func BlobWithProgress(fn func(ProgressEvent)) BlobOpts {
+	return func(opts *blobOpt) {
+		opts.progressFn = fn
+	}
+}
+
+// blobOptNew applies the options for a single blob call, including a new progress tracker
+func blobOptNew(opts []BlobOpts) *blobOpt {
+	opt := blobOpt{}
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	opt.progress = newProgress(opt.progressFn)
+	return &opt
+}
+
 // BlobCopy copies a blob between two locations
 // If the blob already exists in the target, the copy is skipped
 // A server side cross repository blob mount is attempted
-func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor) error {
+func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, opts ...BlobOpts) error {
+	return rc.blobCopyOpt(ctx, refSrc, refTgt, d, blobOptNew(opts))
+}
+
+func (rc *RegClient) blobCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, opt *blobOpt) error {
+	opt.progress.start(d)
 	// for the same repository, there's nothing to copy
 	if ref.EqualRepository(refSrc, refTgt) {
 		rc.log.WithFields(logrus.Fields{
@@ -22,6 +53,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"tgt":    refTgt.Reference,
 			"digest": d.Digest,
 		}).Debug("Blob copy skipped, same repo")
+		opt.progress.done(d, ProgressSkipped, 0, nil)
 		return nil
 	}
 	// check if layer already exists
@@ -30,6 +62,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"tgt":    refTgt.Reference,
 			"digest": d,
 		}).Debug("Blob copy skipped, already exists")
+		opt.progress.done(d, ProgressExists, 0, nil)
 		return nil
 	}
 	// try mounting blob from the source repo is the registry is the same
@@ -41,6 +74,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 				"tgt":    refTgt.Reference,
 				"digest": d,
 			}).Debug("Blob copy performed server side with registry mount")
+			opt.progress.done(d, ProgressMounted, 0, nil)
 			return nil
 		}
 		rc.log.WithFields(logrus.Fields{
@@ -57,17 +91,30 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"src":    refSrc.Reference,
 			"digest": d,
 		}).Warn("Failed to retrieve blob")
+		opt.progress.done(d, ProgressFailed, 0, err)
 		return err
 	}
 	defer blobIO.Close()
-	if _, err := rc.BlobPut(ctx, refTgt, blobIO.GetDescriptor(), blobIO); err != nil {
+	var rdr io.Reader = blobIO
+	var pr *progressReader
+	if opt.progress != nil {
+		pr = opt.progress.reader(d, blobIO)
+		rdr = pr.wrap()
+	}
+	if _, err := rc.BlobPut(ctx, refTgt, blobIO.GetDescriptor(), rdr); err != nil {
 		rc.log.WithFields(logrus.Fields{
 			"err": err,
 			"src": refSrc.Reference,
 			"tgt": refTgt.Reference,
 		}).Warn("Failed to push blob")
+		if pr != nil {
+			opt.progress.done(d, ProgressFailed, pr.cur, err)
+		}
 		return err
 	}
+	if pr != nil {
+		opt.progress.done(d, ProgressFinished, pr.cur, nil)
+	}
 	return nil
 }
 
@@ -83,16 +130,26 @@ func (rc *RegClient) BlobDelete(ctx context.Context, r ref.Ref, d types.Descript
 }
 
 // BlobGet retrieves a blob, returning a reader
-func (rc *RegClient) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+func (rc *RegClient) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor, opts ...BlobOpts) (blob.Reader, error) {
+	opt := blobOptNew(opts)
+	var br blob.Reader
 	data, err := d.GetData()
 	if err == nil {
-		return blob.NewReader(blob.WithDesc(d), blob.WithRef(r), blob.WithReader(bytes.NewReader(data))), nil
+		br = blob.NewReader(blob.WithDesc(d), blob.WithRef(r), blob.WithReader(bytes.NewReader(data)))
+	} else {
+		schemeAPI, err := rc.schemeGet(r.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		br, err = schemeAPI.BlobGet(ctx, r, d)
+		if err != nil {
+			return nil, err
+		}
 	}
-	schemeAPI, err := rc.schemeGet(r.Scheme)
-	if err != nil {
-		return nil, err
+	if opt.progress != nil {
+		return newBlobProgressReader(br, opt.progress), nil
 	}
-	return schemeAPI.BlobGet(ctx, r, d)
+	return br, nil
 }
 
 // BlobGetOCIConfig retrieves an OCI config from a blob, automatically extracting the JSON
@@ -126,10 +183,63 @@ func (rc *RegClient) BlobMount(ctx context.Context, refSrc ref.Ref, refTgt ref.R
 // This will attempt an anonymous blob mount first which some registries may support.
 // It will then try doing a full put of the blob without chunking (most widely supported).
 // If the full put fails, it will fall back to a chunked upload (useful for flaky networks).
-func (rc *RegClient) BlobPut(ctx context.Context, ref ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
+func (rc *RegClient) BlobPut(ctx context.Context, ref ref.Ref, d types.Descriptor, rdr io.Reader, opts ...BlobOpts) (types.Descriptor, error) {
+	opt := blobOptNew(opts)
 	schemeAPI, err := rc.schemeGet(ref.Scheme)
 	if err != nil {
 		return types.Descriptor{}, err
 	}
-	return schemeAPI.BlobPut(ctx, ref, d, rdr)
+	if opt.progress == nil {
+		return schemeAPI.BlobPut(ctx, ref, d, rdr)
+	}
+	opt.progress.start(d)
+	pr := opt.progress.reader(d, rdr)
+	dOut, err := schemeAPI.BlobPut(ctx, ref, d, pr.wrap())
+	if err != nil {
+		opt.progress.done(d, ProgressFailed, pr.cur, err)
+		return dOut, err
+	}
+	opt.progress.done(d, ProgressFinished, pr.cur, nil)
+	return dOut, nil
+}
+
+// blobProgressReader reports progress as a blob is read.
+// The progress is finished on EOF, failed on a read error or short blob, and canceled on an early Close.
+type blobProgressReader struct {
+	blob.Reader
+	pr       *progressReader
+	finished bool
+}
+
+func newBlobProgressReader(br blob.Reader, p *progress) *blobProgressReader {
+	d := br.GetDescriptor()
+	p.start(d)
+	return &blobProgressReader{Reader: br, pr: p.reader(d, br)}
+}
+
+func (bpr *blobProgressReader) Read(b []byte) (int, error) {
+	n, err := bpr.pr.Read(b)
+	if err != nil && !bpr.finished {
+		bpr.finished = true
+		if err == io.EOF && bpr.pr.d.Size > 0 && bpr.pr.cur < bpr.pr.d.Size {
+			bpr.pr.p.done(bpr.pr.d, ProgressFailed, bpr.pr.cur, io.ErrUnexpectedEOF)
+		} else if err == io.EOF {
+			bpr.pr.p.done(bpr.pr.d, ProgressFinished, bpr.pr.cur, nil)
+		} else {
+			bpr.pr.p.done(bpr.pr.d, ProgressFailed, bpr.pr.cur, err)
+		}
+	}
+	return n, err
+}
+
+func (bpr *blobProgressReader) Close() error {
+	if !bpr.finished {
+		bpr.finished = true
+		if bpr.pr.d.Size > 0 && bpr.pr.cur < bpr.pr.d.Size {
+			bpr.pr.p.done(bpr.pr.d, ProgressCanceled, bpr.pr.cur, nil)
+		} else {
+			bpr.pr.p.done(bpr.pr.d, ProgressFinished, bpr.pr.cur, nil)
+		}
+	}
+	return bpr.Reader.Close()
 }
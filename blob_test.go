@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -738,3 +739,88 @@ func TestBlobPut(t *testing.T) {
 	})
 
 }
+
+func TestBlobGetProgress(t *testing.T) {
+	ctx := context.Background()
+	rc := New()
+	r, err := ref.New("ocidir://progress:latest")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	data := bytes.Repeat([]byte("regclient progress\n"), 100)
+	d := types.Descriptor{
+		MediaType: types.MediaTypeOCI1Layer,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+		Data:      []byte(base64.StdEncoding.EncodeToString(data)),
+	}
+	tests := []struct {
+		name   string
+		read   int
+		expect ProgressState
+	}{
+		{
+			name:   "finished",
+			read:   len(data),
+			expect: ProgressFinished,
+		},
+		{
+			name:   "canceled",
+			read:   10,
+			expect: ProgressCanceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := []ProgressEvent{}
+			br, err := rc.BlobGet(ctx, r, d, BlobWithProgress(func(e ProgressEvent) {
+				events = append(events, e)
+			}))
+			if err != nil {
+				t.Fatalf("failed to get blob: %v", err)
+			}
+			_, err = io.ReadFull(br, make([]byte, tt.read))
+			if err != nil {
+				t.Errorf("failed to read blob: %v", err)
+			}
+			err = br.Close()
+			if err != nil {
+				t.Errorf("failed to close blob: %v", err)
+			}
+			if len(events) < 2 || events[0].State != ProgressStarted {
+				t.Fatalf("unexpected events: %v", events)
+			}
+			last := events[len(events)-1]
+			if last.State != tt.expect || last.Cur != int64(tt.read) {
+				t.Errorf("unexpected final event, expected %s after %d bytes, received %s after %d bytes", tt.expect, tt.read, last.State, last.Cur)
+			}
+			for _, e := range events[1 : len(events)-1] {
+				if e.State.Done() {
+					t.Errorf("multiple final events: %v", events)
+				}
+			}
+		})
+	}
+	// reusing the option tracks totals for each call
+	var last ProgressEvent
+	progressOpt := BlobWithProgress(func(e ProgressEvent) {
+		last = e
+	})
+	for i := 0; i < 2; i++ {
+		br, err := rc.BlobGet(ctx, r, d, progressOpt)
+		if err != nil {
+			t.Fatalf("failed to get blob: %v", err)
+		}
+		_, err = io.Copy(io.Discard, br)
+		if err != nil {
+			t.Errorf("failed to read blob: %v", err)
+		}
+		err = br.Close()
+		if err != nil {
+			t.Errorf("failed to close blob: %v", err)
+		}
+		if last.Total.Blobs != 1 || last.Total.BytesDone != d.Size {
+			t.Errorf("unexpected totals on call %d: %v", i, last.Total)
+		}
+	}
+}
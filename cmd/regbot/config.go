@@ -21,41 +21,43 @@ type Config struct {
 
 // ConfigCreds allows the registry login to be passed in the config rather than from Docker
 type ConfigCreds struct {
-	Registry   string            `yaml:"registry" json:"registry"`
-	Hostname   string            `yaml:"hostname" json:"hostname"`
-	User       string            `yaml:"user" json:"user"`
-	Pass       string            `yaml:"pass" json:"pass"`
-	Token      string            `yaml:"token" json:"token"`
-	RepoAuth   bool              `yaml:"repoAuth" json:"repoAuth"`
-	TLS        config.TLSConf    `yaml:"tls" json:"tls"`
-	Scheme     string            `yaml:"scheme" json:"scheme"` // TODO: delete
-	RegCert    string            `yaml:"regcert" json:"regcert"`
-	PathPrefix string            `yaml:"pathPrefix" json:"pathPrefix"`
-	Mirrors    []string          `yaml:"mirrors" json:"mirrors"`
-	Priority   uint              `yaml:"priority" json:"priority"`
-	API        string            `yaml:"api" json:"api"`
-	APIOpts    map[string]string `yaml:"apiOpts" json:"apiOpts"`
-	BlobChunk  int64             `yaml:"blobChunk" json:"blobChunk"`
-	BlobMax    int64             `yaml:"blobMax" json:"blobMax"`
+	Registry    string            `yaml:"registry" json:"registry"`
+	Hostname    string            `yaml:"hostname" json:"hostname"`
+	User        string            `yaml:"user" json:"user"`
+	Pass        string            `yaml:"pass" json:"pass"`
+	Token       string            `yaml:"token" json:"token"`
+	RepoAuth    bool              `yaml:"repoAuth" json:"repoAuth"`
+	TLS         config.TLSConf    `yaml:"tls" json:"tls"`
+	Scheme      string            `yaml:"scheme" json:"scheme"` // TODO: delete
+	RegCert     string            `yaml:"regcert" json:"regcert"`
+	PathPrefix  string            `yaml:"pathPrefix" json:"pathPrefix"`
+	Mirrors     []string          `yaml:"mirrors" json:"mirrors"`
+	Priority    uint              `yaml:"priority" json:"priority"`
+	API         string            `yaml:"api" json:"api"`
+	APIOpts     map[string]string `yaml:"apiOpts" json:"apiOpts"`
+	BlobChunk   int64             `yaml:"blobChunk" json:"blobChunk"`
+	BlobMax     int64             `yaml:"blobMax" json:"blobMax"`
+	BlobRecover int               `yaml:"blobRecover" json:"blobRecover"`
 }
 
 func credsToRCHost(c ConfigCreds) config.Host {
 	return config.Host{
-		Name:       c.Registry,
-		Hostname:   c.Hostname,
-		User:       c.User,
-		Pass:       c.Pass,
-		Token:      c.Token,
-		RepoAuth:   c.RepoAuth,
-		TLS:        c.TLS,
-		RegCert:    c.RegCert,
-		PathPrefix: c.PathPrefix,
-		Mirrors:    c.Mirrors,
-		Priority:   c.Priority,
-		API:        c.API,
-		APIOpts:    c.APIOpts,
-		BlobChunk:  c.BlobChunk,
-		BlobMax:    c.BlobMax,
+		Name:        c.Registry,
+		Hostname:    c.Hostname,
+		User:        c.User,
+		Pass:        c.Pass,
+		Token:       c.Token,
+		RepoAuth:    c.RepoAuth,
+		TLS:         c.TLS,
+		RegCert:     c.RegCert,
+		PathPrefix:  c.PathPrefix,
+		Mirrors:     c.Mirrors,
+		Priority:    c.Priority,
+		API:         c.API,
+		APIOpts:     c.APIOpts,
+		BlobChunk:   c.BlobChunk,
+		BlobMax:     c.BlobMax,
+		BlobRecover: c.BlobRecover,
 	}
 }
 
@@ -15,6 +15,8 @@ import (
 
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/pkg/template"
+	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/manifest"
 	v1 "github.com/regclient/regclient/types/oci/v1"
@@ -55,6 +57,16 @@ var artifactGetCmd = &cobra.Command{
 	ValidArgs: []string{}, // do not auto complete repository/tag
 	RunE:      runArtifactGet,
 }
+var artifactListCmd = &cobra.Command{
+	Use:     "list <reference>",
+	Aliases: []string{"ls"},
+	Short:   "list artifacts that have a subject to the given reference",
+	Long: `List artifacts that reference the given manifest with a subject field.
+The referrers API is queried first, falling back to the digest tag schema.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{}, // do not auto complete repository/tag
+	RunE:      runArtifactList,
+}
 var artifactPutCmd = &cobra.Command{
 	Use:       "put <reference>",
 	Aliases:   []string{"push"},
@@ -67,12 +79,16 @@ var artifactPutCmd = &cobra.Command{
 
 var artifactOpts struct {
 	annotations  []string
+	artifactType string
 	artifactFile []string
 	artifactMT   []string
 	configFile   string
 	configMT     string
+	filterAT     string
+	formatList   string
 	outputDir    string
 	stripDirs    bool
+	subject      string
 }
 
 func init() {
@@ -85,7 +101,12 @@ func init() {
 	artifactGetCmd.Flags().StringVarP(&artifactOpts.outputDir, "output", "o", "", "Output directory for multiple artifacts")
 	artifactGetCmd.Flags().BoolVarP(&artifactOpts.stripDirs, "strip-dirs", "", false, "Strip directories from filenames in output dir")
 
+	artifactListCmd.Flags().StringVarP(&artifactOpts.filterAT, "filter-artifact-type", "", "", "Filter descriptors by artifactType")
+	artifactListCmd.Flags().StringVarP(&artifactOpts.formatList, "format", "", "{{printPretty .}}", "Format output with go template syntax")
+	artifactListCmd.RegisterFlagCompletionFunc("format", completeArgNone)
+
 	artifactPutCmd.Flags().StringArrayVarP(&artifactOpts.annotations, "annotation", "", []string{}, "Annotation to include on manifest")
+	artifactPutCmd.Flags().StringVarP(&artifactOpts.artifactType, "artifact-type", "", "", "Artifact type (recommended when using --subject)")
 	artifactPutCmd.Flags().StringArrayVarP(&artifactOpts.artifactFile, "file", "f", []string{}, "Artifact filename")
 	artifactPutCmd.Flags().StringArrayVarP(&artifactOpts.artifactMT, "media-type", "m", []string{}, "Set the artifact media-type")
 	artifactPutCmd.RegisterFlagCompletionFunc("media-type", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -97,8 +118,10 @@ func init() {
 		return configKnownTypes, cobra.ShellCompDirectiveNoFileComp
 	})
 	artifactPutCmd.Flags().BoolVarP(&artifactOpts.stripDirs, "strip-dirs", "", false, "Strip directories from filenames in artifact")
+	artifactPutCmd.Flags().StringVarP(&artifactOpts.subject, "subject", "", "", "Subject reference the artifact refers to, must be in the same repository")
 
 	artifactCmd.AddCommand(artifactGetCmd)
+	artifactCmd.AddCommand(artifactListCmd)
 	artifactCmd.AddCommand(artifactPutCmd)
 	rootCmd.AddCommand(artifactCmd)
 }
@@ -278,7 +301,27 @@ func runArtifactGet(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runArtifactPut(cmd *cobra.Command, args []string) error {
+func runArtifactList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	opts := []scheme.ReferrerOpts{}
+	if artifactOpts.filterAT != "" {
+		opts = append(opts, scheme.WithReferrerAT(artifactOpts.filterAT))
+	}
+	rl, err := rc.ReferrerList(ctx, r, opts...)
+	if err != nil {
+		return err
+	}
+	return template.Writer(os.Stdout, artifactOpts.formatList, rl)
+}
+
+func runArtifactPut(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 
 	// validate inputs
@@ -301,8 +344,9 @@ func runArtifactPut(cmd *cobra.Command, args []string) error {
 
 	// init empty manifest
 	m := v1.Manifest{
-		Layers:      []types.Descriptor{},
-		Annotations: map[string]string{},
+		ArtifactType: artifactOpts.artifactType,
+		Layers:       []types.Descriptor{},
+		Annotations:  map[string]string{},
 	}
 	m.SchemaVersion = 2 // OCI bumped to match docker schema
 	// include annotations
@@ -317,7 +361,38 @@ func runArtifactPut(cmd *cobra.Command, args []string) error {
 
 	// setup regclient
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
+
+	// lookup the subject descriptor
+	if artifactOpts.subject != "" {
+		rSubject, err := ref.New(artifactOpts.subject)
+		if err != nil {
+			return err
+		}
+		if !ref.EqualRepository(r, rSubject) {
+			return fmt.Errorf("subject must be in the same repository as the artifact: %s", rSubject.CommonName())
+		}
+		mSubject, err := rc.ManifestHead(ctx, rSubject)
+		if err != nil {
+			return err
+		}
+		if mSubject.GetDescriptor().Digest == "" {
+			mSubject, err = rc.ManifestGet(ctx, rSubject)
+			if err != nil {
+				return err
+			}
+		}
+		dSubject := mSubject.GetDescriptor()
+		m.Subject = &types.Descriptor{
+			MediaType: dSubject.MediaType,
+			Digest:    dSubject.Digest,
+			Size:      dSubject.Size,
+		}
+	}
 
 	// read config, or initialize to an empty json config
 	configBytes := []byte("{}")
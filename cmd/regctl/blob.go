@@ -9,6 +9,7 @@ import (
 	_ "crypto/sha512"
 
 	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/pkg/template"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/ref"
@@ -44,13 +45,15 @@ is the digest of the blob.`,
 }
 
 var blobOpts struct {
-	format string
-	mt     string
-	digest string
+	format   string
+	mt       string
+	digest   string
+	progress bool
 }
 
 func init() {
 	blobGetCmd.Flags().StringVarP(&blobOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax")
+	blobGetCmd.Flags().BoolVarP(&blobOpts.progress, "progress", "", false, "Display progress of the download on stderr")
 	blobGetCmd.Flags().StringVarP(&blobOpts.mt, "media-type", "", "", "Set the requested mediaType (deprecated)")
 	blobGetCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 	blobGetCmd.RegisterFlagCompletionFunc("media-type", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -62,6 +65,7 @@ func init() {
 
 	blobPutCmd.Flags().StringVarP(&blobOpts.mt, "content-type", "", "", "Set the requested content type (deprecated)")
 	blobPutCmd.Flags().StringVarP(&blobOpts.digest, "digest", "", "", "Set the expected digest")
+	blobPutCmd.Flags().BoolVarP(&blobOpts.progress, "progress", "", false, "Display progress of the upload on stderr")
 	blobPutCmd.RegisterFlagCompletionFunc("content-type", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{
 			"application/octet-stream",
@@ -98,10 +102,17 @@ func runBlobGet(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	blob, err := rc.BlobGet(ctx, r, types.Descriptor{Digest: d})
+	opts := []regclient.BlobOpts{}
+	if blobOpts.progress {
+		pd := newProgressDisplay(os.Stderr)
+		defer pd.Finish()
+		opts = append(opts, regclient.BlobWithProgress(pd.callback))
+	}
+	blob, err := rc.BlobGet(ctx, r, types.Descriptor{Digest: d}, opts...)
 	if err != nil {
 		return err
 	}
+	defer blob.Close()
 
 	switch blobOpts.format {
 	case "raw":
@@ -119,14 +130,18 @@ func runBlobGet(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, blobOpts.format, blob)
 }
 
-func runBlobPut(cmd *cobra.Command, args []string) error {
+func runBlobPut(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
 
 	if blobOpts.mt != "" {
 		log.WithFields(logrus.Fields{
@@ -139,7 +154,13 @@ func runBlobPut(cmd *cobra.Command, args []string) error {
 		"repository": r.Repository,
 		"digest":     blobOpts.digest,
 	}).Debug("Pushing blob")
-	dOut, err := rc.BlobPut(ctx, r, types.Descriptor{Digest: digest.Digest(blobOpts.digest)}, os.Stdin)
+	opts := []regclient.BlobOpts{}
+	if blobOpts.progress {
+		pd := newProgressDisplay(os.Stderr)
+		defer pd.Finish()
+		opts = append(opts, regclient.BlobWithProgress(pd.callback))
+	}
+	dOut, err := rc.BlobPut(ctx, r, types.Descriptor{Digest: digest.Digest(blobOpts.digest)}, os.Stdin, opts...)
 	if err != nil {
 		return err
 	}
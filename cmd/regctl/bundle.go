@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	v1 "github.com/regclient/regclient/types/oci/v1"
+)
+
+// bundleConfig is the subset of the OCI runtime spec config.json generated for a bundle
+type bundleConfig struct {
+	OCIVersion  string            `json:"ociVersion"`
+	Process     bundleProcess     `json:"process"`
+	Root        bundleRoot        `json:"root"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Mounts      []bundleMount     `json:"mounts,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Linux       bundleLinux       `json:"linux"`
+}
+
+type bundleProcess struct {
+	Terminal bool       `json:"terminal,omitempty"`
+	User     bundleUser `json:"user"`
+	Args     []string   `json:"args"`
+	Env      []string   `json:"env,omitempty"`
+	Cwd      string     `json:"cwd"`
+}
+
+type bundleUser struct {
+	UID uint32 `json:"uid"`
+	GID uint32 `json:"gid"`
+}
+
+type bundleRoot struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
+}
+
+type bundleMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type bundleLinux struct {
+	Namespaces []bundleNamespace `json:"namespaces,omitempty"`
+}
+
+type bundleNamespace struct {
+	Type string `json:"type"`
+}
+
+const (
+	bundleDefaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	bundleLinkMax     = 40
+)
+
+// bundleRootFS opens files in an extracted rootfs.
+// Symlinks are resolved as if the directory were the root filesystem, so links cannot reach files outside of the directory.
+type bundleRootFS struct {
+	dir string
+}
+
+// bundleWriteConfig writes a config.json for the rootfs in the bundle directory using the image config.
+// User and group names are resolved with the files in the image filesystem.
+func bundleWriteConfig(dir, rootfs string, img v1.Image, fsys fs.FS) error {
+	conf := bundleConfig{
+		OCIVersion: "1.0.2",
+		Process: bundleProcess{
+			Args: append(append([]string{}, img.Config.Entrypoint...), img.Config.Cmd...),
+			Env:  img.Config.Env,
+			Cwd:  img.Config.WorkingDir,
+		},
+		Root: bundleRoot{
+			Path: rootfs,
+		},
+		Hostname:    "regctl",
+		Annotations: img.Config.Labels,
+		Mounts: []bundleMount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+			{Destination: "/dev/pts", Type: "devpts", Source: "devpts", Options: []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620", "gid=5"}},
+			{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+			{Destination: "/dev/mqueue", Type: "mqueue", Source: "mqueue", Options: []string{"nosuid", "noexec", "nodev"}},
+			{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"nosuid", "noexec", "nodev", "ro"}},
+		},
+		Linux: bundleLinux{
+			Namespaces: []bundleNamespace{
+				{Type: "pid"}, {Type: "network"}, {Type: "ipc"}, {Type: "uts"}, {Type: "mount"},
+			},
+		},
+	}
+	if len(conf.Process.Args) == 0 {
+		conf.Process.Args = []string{"sh"}
+	}
+	if conf.Process.Cwd == "" {
+		conf.Process.Cwd = "/"
+	}
+	hasPath := false
+	for _, e := range conf.Process.Env {
+		if strings.HasPrefix(e, "PATH=") {
+			hasPath = true
+		}
+	}
+	if !hasPath {
+		conf.Process.Env = append(conf.Process.Env, bundleDefaultPath)
+	}
+	user, err := bundleUserLookup(fsys, img.Config.User)
+	if err != nil {
+		return err
+	}
+	conf.Process.User = user
+
+	fh, err := os.Create(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	enc := json.NewEncoder(fh)
+	enc.SetIndent("", "  ")
+	return enc.Encode(conf)
+}
+
+// bundleUserLookup converts the image user ("user[:group]") to a uid and gid, using the passwd and group files for names
+func bundleUserLookup(fsys fs.FS, user string) (bundleUser, error) {
+	bu := bundleUser{}
+	if user == "" {
+		return bu, nil
+	}
+	userName, groupName := user, ""
+	if i := strings.Index(user, ":"); i >= 0 {
+		userName, groupName = user[:i], user[i+1:]
+	}
+	if uid, err := strconv.ParseUint(userName, 10, 32); err == nil {
+		bu.UID = uint32(uid)
+		// use the primary group of a numeric user when found
+		if fields, err := bundleFileLookup(fsys, "etc/passwd", 2, userName); err == nil && len(fields) > 3 {
+			if gid, err := strconv.ParseUint(fields[3], 10, 32); err == nil {
+				bu.GID = uint32(gid)
+			}
+		}
+	} else {
+		fields, err := bundleFileLookup(fsys, "etc/passwd", 0, userName)
+		if err != nil || len(fields) < 4 {
+			return bu, fmt.Errorf("user %s not found in /etc/passwd", userName)
+		}
+		uid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return bu, fmt.Errorf("invalid uid for user %s: %w", userName, err)
+		}
+		gid, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			return bu, fmt.Errorf("invalid gid for user %s: %w", userName, err)
+		}
+		bu.UID, bu.GID = uint32(uid), uint32(gid)
+	}
+	if groupName == "" {
+		return bu, nil
+	}
+	if gid, err := strconv.ParseUint(groupName, 10, 32); err == nil {
+		bu.GID = uint32(gid)
+		return bu, nil
+	}
+	fields, err := bundleFileLookup(fsys, "etc/group", 0, groupName)
+	if err != nil || len(fields) < 3 {
+		return bu, fmt.Errorf("group %s not found in /etc/group", groupName)
+	}
+	gid, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return bu, fmt.Errorf("invalid gid for group %s: %w", groupName, err)
+	}
+	bu.GID = uint32(gid)
+	return bu, nil
+}
+
+// bundleFileLookup returns the fields of the first line in a colon separated file where the field at index matches the value
+func bundleFileLookup(fsys fs.FS, filename string, index int, value string) ([]string, error) {
+	fh, err := fsys.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) > index && fields[index] == value {
+			return fields, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrNotFound
+}
+
+// Open returns a file from the rootfs after resolving any symlinks within the rootfs
+func (b bundleRootFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	resolved, err := b.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.Open(filepath.Join(b.dir, filepath.FromSlash(resolved)))
+}
+
+// resolve follows each symlink in the path, absolute links and ".." are limited to the rootfs
+func (b bundleRootFS) resolve(name string) (string, error) {
+	cur := "."
+	todo := strings.Split(name, "/")
+	links := 0
+	for len(todo) > 0 {
+		part := todo[0]
+		todo = todo[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			cur = path.Dir(cur)
+			continue
+		}
+		next := path.Join(cur, part)
+		fi, err := os.Lstat(filepath.Join(b.dir, filepath.FromSlash(next)))
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		links++
+		if links > bundleLinkMax {
+			return "", fmt.Errorf("too many levels of symbolic links")
+		}
+		target, err := os.Readlink(filepath.Join(b.dir, filepath.FromSlash(next)))
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(target, "/") {
+			cur = "."
+		}
+		todo = append(strings.Split(target, "/"), todo...)
+	}
+	return cur, nil
+}
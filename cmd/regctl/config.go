@@ -32,44 +32,46 @@ type Config struct {
 
 // ConfigHost struct contains host specific settings
 type ConfigHost struct {
-	Name       string            `json:"-"`
-	TLS        config.TLSConf    `json:"tls,omitempty"`
-	RegCert    string            `json:"regcert,omitempty"`
-	ClientCert string            `json:"clientcert,omitempty"`
-	ClientKey  string            `json:"clientkey,omitempty"`
-	Hostname   string            `json:"hostname,omitempty"`
-	User       string            `json:"user,omitempty"`
-	Pass       string            `json:"pass,omitempty"`
-	Token      string            `json:"token,omitempty"`
-	PathPrefix string            `json:"pathPrefix,omitempty"` // used for mirrors defined within a repository namespace
-	Mirrors    []string          `json:"mirrors,omitempty"`    // list of other Host names to use as mirrors
-	Priority   uint              `json:"priority,omitempty"`   // priority when sorting mirrors, higher priority attempted first
-	RepoAuth   bool              `json:"repoAuth,omitempty"`
-	API        string            `json:"api,omitempty"` // registry API to use
-	APIOpts    map[string]string `json:"apiOpts,omitempty"`
-	BlobChunk  int64             `json:"blobChunk,omitempty"` // size of each blob chunk
-	BlobMax    int64             `json:"blobMax,omitempty"`   // threshold to switch to chunked upload, -1 to disable
+	Name        string            `json:"-"`
+	TLS         config.TLSConf    `json:"tls,omitempty"`
+	RegCert     string            `json:"regcert,omitempty"`
+	ClientCert  string            `json:"clientcert,omitempty"`
+	ClientKey   string            `json:"clientkey,omitempty"`
+	Hostname    string            `json:"hostname,omitempty"`
+	User        string            `json:"user,omitempty"`
+	Pass        string            `json:"pass,omitempty"`
+	Token       string            `json:"token,omitempty"`
+	PathPrefix  string            `json:"pathPrefix,omitempty"` // used for mirrors defined within a repository namespace
+	Mirrors     []string          `json:"mirrors,omitempty"`    // list of other Host names to use as mirrors
+	Priority    uint              `json:"priority,omitempty"`   // priority when sorting mirrors, higher priority attempted first
+	RepoAuth    bool              `json:"repoAuth,omitempty"`
+	API         string            `json:"api,omitempty"` // registry API to use
+	APIOpts     map[string]string `json:"apiOpts,omitempty"`
+	BlobChunk   int64             `json:"blobChunk,omitempty"`   // size of each blob chunk
+	BlobMax     int64             `json:"blobMax,omitempty"`     // threshold to switch to chunked upload, -1 to disable
+	BlobRecover int               `json:"blobRecover,omitempty"` // attempts to recover an interrupted chunked upload, -1 to disable
 }
 
 func configHostToRCHost(name string, c config.Host) config.Host {
 	return config.Host{
-		Name:       name,
-		TLS:        c.TLS,
-		RegCert:    c.RegCert,
-		ClientCert: c.ClientCert,
-		ClientKey:  c.ClientKey,
-		Hostname:   c.Hostname,
-		User:       c.User,
-		Pass:       c.Pass,
-		Token:      c.Token,
-		PathPrefix: c.PathPrefix,
-		Mirrors:    c.Mirrors,
-		Priority:   c.Priority,
-		RepoAuth:   c.RepoAuth,
-		API:        c.API,
-		APIOpts:    c.APIOpts,
-		BlobChunk:  c.BlobChunk,
-		BlobMax:    c.BlobMax,
+		Name:        name,
+		TLS:         c.TLS,
+		RegCert:     c.RegCert,
+		ClientCert:  c.ClientCert,
+		ClientKey:   c.ClientKey,
+		Hostname:    c.Hostname,
+		User:        c.User,
+		Pass:        c.Pass,
+		Token:       c.Token,
+		PathPrefix:  c.PathPrefix,
+		Mirrors:     c.Mirrors,
+		Priority:    c.Priority,
+		RepoAuth:    c.RepoAuth,
+		API:         c.API,
+		APIOpts:     c.APIOpts,
+		BlobChunk:   c.BlobChunk,
+		BlobMax:     c.BlobMax,
+		BlobRecover: c.BlobRecover,
 	}
 }
 
@@ -2,6 +2,12 @@ package main
 
 import "errors"
 
+// exitCodeErr is returned by commands that set a specific exit code
+type exitCodeErr struct {
+	code int
+	err  error
+}
+
 var (
 	// ErrCredsNotFound returned when creds needed and cannot be found
 	ErrCredsNotFound = errors.New("auth creds not found")
@@ -17,3 +23,11 @@ var (
 	// ErrUnsupportedConfigVersion happens when config file version is greater than this command supports
 	ErrUnsupportedConfigVersion = errors.New("unsupported config version")
 )
+
+func (e exitCodeErr) Error() string {
+	return e.err.Error()
+}
+
+func (e exitCodeErr) Unwrap() error {
+	return e.err
+}
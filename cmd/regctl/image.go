@@ -1,19 +1,31 @@
 package main
 
 import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/units"
 	"github.com/regclient/regclient/mod"
+	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/pkg/template"
+	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -23,6 +35,19 @@ var imageCmd = &cobra.Command{
 	Use:   "image <cmd>",
 	Short: "manage images",
 }
+var imageCheckBaseCmd = &cobra.Command{
+	Use:   "check-base <image_ref>",
+	Short: "check if the base image has changed",
+	Long: `Checks if the base image used to build an image has been updated. The base image
+is read from the "org.opencontainers.image.base.name" and "base.digest"
+annotations, or specified with "--base" and "--digest". When the base digest is
+not known, the base image layers are compared to the first layers of the image.
+The command exits with 0 when the base is unchanged, 2 when the base image has
+changed and the image should be rebuilt, and 1 on any other error.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageCheckBase,
+}
 var imageCopyCmd = &cobra.Command{
 	Use:     "copy <src_image_ref> <dst_image_ref>",
 	Aliases: []string{"cp"},
@@ -48,6 +73,17 @@ layers (blobs) separately or not at all. See also the "tag delete" command.`,
 	ValidArgs: []string{}, // do not auto complete digests
 	RunE:      runManifestDelete,
 }
+var imageDiffCmd = &cobra.Command{
+	Use:   "diff <old_image_ref> <new_image_ref>",
+	Short: "compare two images",
+	Long: `Compares two images and shows the differences in the manifests, image configs,
+and layers. Entries of a manifest list are compared by platform. Use "--files"
+to also compare the files in the layers, this pulls every layer of both images.
+Use "--format json" for json output.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageDiff,
+}
 var imageDigestCmd = &cobra.Command{
 	Use:               "digest <image_ref>",
 	Short:             "show digest for pinning, same as \"manifest digest\"",
@@ -65,6 +101,29 @@ Example usage: regctl image export registry:5000/yourimg:v1 >yourimg-v1.tar`,
 	ValidArgsFunction: completeArgTag,
 	RunE:              runImageExport,
 }
+var imageExportRootFSCmd = &cobra.Command{
+	Use:   "export-rootfs <image_ref> <dir|file.tar>",
+	Short: "export the root filesystem of an image",
+	Long: `Exports the flattened root filesystem of an image, similar to "docker export".
+Layers are applied in order, removing any files deleted by a later layer.
+When the output ends with ".tar", or is "-" for stdout, a tar file is written.
+Otherwise the files are extracted to the directory, restoring ownership, modes,
+xattrs, and symlinks where possible. Use "--bundle" to extract the filesystem to
+the "rootfs" folder and write an OCI runtime "config.json" in the directory.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeArgList([]completeFunc{completeArgTag, completeArgDefault}),
+	RunE:              runImageExportRootFS,
+}
+var imageGetFileCmd = &cobra.Command{
+	Use:   "get-file <image_ref> <path> [output_file]",
+	Short: "get a file from an image",
+	Long: `Retrieves a single file from the filesystem of an image. Only the layers needed
+to find the file are pulled. Symlinks are followed within the image. The file
+is output to stdout by default.`,
+	Args:              cobra.RangeArgs(2, 3),
+	ValidArgsFunction: completeArgList([]completeFunc{completeArgTag, completeArgNone, completeArgDefault}),
+	RunE:              runImageGetFile,
+}
 var imageImportCmd = &cobra.Command{
 	Use:   "import <image_ref> <filename>",
 	Short: "import image",
@@ -85,6 +144,16 @@ in docker, and inspecting it, but without pulling any of the image layers.`,
 	ValidArgsFunction: completeArgTag,
 	RunE:              runImageInspect,
 }
+var imageLsFilesCmd = &cobra.Command{
+	Use:   "ls-files <image_ref> [path]",
+	Short: "list files in an image",
+	Long: `Lists the files in the filesystem of an image, after applying each layer and
+removing any deleted files. Use "--long" to include the mode, owner, size, and
+link target of each file.`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeArgList([]completeFunc{completeArgTag, completeArgNone}),
+	RunE:              runImageLsFiles,
+}
 var imageManifestCmd = &cobra.Command{
 	Use:               "manifest <image_ref>",
 	Short:             "show manifest or manifest list, same as \"manifest get\"",
@@ -114,40 +183,78 @@ The other values may be 0 if not provided by the registry.`,
 }
 
 var imageOpts struct {
-	create         string
-	forceRecursive bool
-	format         string
-	digestTags     bool
-	list           bool
-	modOpts        []mod.Opts
-	platform       string
-	platforms      []string
-	replace        bool
-	requireList    bool
+	bundle          bool
+	checkBaseDigest string
+	checkBaseRef    string
+	create          string
+	forceRecursive  bool
+	format          string
+	digestTags      bool
+	dryRun          bool
+	files           bool
+	list            bool
+	long            bool
+	modOpts         []mod.Opts
+	parallel        int
+	platform        string
+	platforms       []string
+	progress        bool
+	referrers       bool
+	replace         bool
+	requireList     bool
 }
 
 func init() {
 	imageOpts.modOpts = []mod.Opts{}
 
+	imageCheckBaseCmd.Flags().StringVarP(&imageOpts.checkBaseRef, "base", "", "", "Base image reference, overrides annotations")
+	imageCheckBaseCmd.Flags().StringVarP(&imageOpts.checkBaseDigest, "digest", "", "", "Base image digest, used with --base")
+	imageCheckBaseCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imageCheckBaseCmd.RegisterFlagCompletionFunc("base", completeArgTag)
+	imageCheckBaseCmd.RegisterFlagCompletionFunc("digest", completeArgNone)
+	imageCheckBaseCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
 	imageCopyCmd.Flags().BoolVarP(&imageOpts.forceRecursive, "force-recursive", "", false, "Force recursive copy of image, repairs missing nested blobs and manifests")
+	imageCopyCmd.Flags().IntVarP(&imageOpts.parallel, "parallel", "", 1, "Number of blobs to copy concurrently")
+	imageCopyCmd.Flags().BoolVarP(&imageOpts.progress, "progress", "", false, "Display progress of blob transfers on stderr")
 	imageCopyCmd.Flags().StringArrayVarP(&imageOpts.platforms, "platforms", "", []string{}, "Copy only specific platforms, registry validation must be disabled")
 	imageCopyCmd.Flags().BoolVarP(&imageOpts.digestTags, "digest-tags", "", false, "Include digest tags (\"sha256-<digest>.*\") when copying manifests")
+	imageCopyCmd.Flags().BoolVarP(&imageOpts.referrers, "referrers", "", false, "Include referrers (artifacts with a subject) when copying manifests")
 	// platforms should be treated as experimental since it will break many registries
 	imageCopyCmd.Flags().MarkHidden("platforms")
 
+	imageExportCmd.Flags().BoolVarP(&imageOpts.progress, "progress", "", false, "Display progress of blob transfers on stderr")
+
 	imageDeleteCmd.Flags().BoolVarP(&manifestOpts.forceTagDeref, "force-tag-dereference", "", false, "Dereference the a tag to a digest, this is unsafe")
 
+	imageDiffCmd.Flags().BoolVarP(&imageOpts.files, "files", "", false, "Compare the files in each layer")
+	imageDiffCmd.Flags().StringVarP(&imageOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax (use \"json\" for json output)")
+	imageDiffCmd.Flags().StringArrayVarP(&imageOpts.platforms, "platform", "p", []string{}, "Only compare specific platforms from a manifest list (e.g. linux/amd64)")
+	imageDiffCmd.RegisterFlagCompletionFunc("format", completeArgNone)
+	imageDiffCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
 	imageDigestCmd.Flags().BoolVarP(&manifestOpts.list, "list", "", true, "Do not resolve platform from manifest list (enabled by default)")
 	imageDigestCmd.Flags().StringVarP(&manifestOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
 	imageDigestCmd.Flags().BoolVarP(&manifestOpts.requireList, "require-list", "", false, "Fail if manifest list is not received")
 	imageDigestCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
 	imageDigestCmd.Flags().MarkHidden("list")
 
+	imageExportRootFSCmd.Flags().BoolVarP(&imageOpts.bundle, "bundle", "", false, "Write an OCI runtime bundle with the filesystem in rootfs and a config.json")
+	imageExportRootFSCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imageExportRootFSCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
+	imageGetFileCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imageGetFileCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
 	imageInspectCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
 	imageInspectCmd.Flags().StringVarP(&imageOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax")
 	imageInspectCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
 	imageInspectCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 
+	imageLsFilesCmd.Flags().BoolVarP(&imageOpts.long, "long", "l", false, "Include the mode, owner, size, and link target")
+	imageLsFilesCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imageLsFilesCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
 	imageManifestCmd.Flags().BoolVarP(&manifestOpts.list, "list", "", true, "Output manifest list if available (enabled by default)")
 	imageManifestCmd.Flags().StringVarP(&manifestOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
 	imageManifestCmd.Flags().BoolVarP(&manifestOpts.requireList, "require-list", "", false, "Fail if manifest list is not received")
@@ -158,6 +265,9 @@ func init() {
 
 	imageModCmd.Flags().StringVarP(&imageOpts.create, "create", "", "", "Create tag")
 	imageModCmd.Flags().BoolVarP(&imageOpts.replace, "replace", "", false, "Replace tag (ignored when \"create\" is used)")
+	imageModCmd.Flags().BoolVarP(&imageOpts.dryRun, "dry-run", "", false, "Output the planned changes without pushing anything")
+	imageModCmd.Flags().StringVarP(&imageOpts.format, "format", "", "{{printPretty .}}", "Format dry run output with go template syntax (use \"json\" for json output)")
+	imageModCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "stringArray",
 		f: func(val string) error {
@@ -205,6 +315,13 @@ func init() {
 			return nil
 		},
 	}, "annotation-base", "", `set base image annotations (image/name:tag,sha256:digest)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithCmd(modParseArgs(val, []string{"/bin/sh", "-c"})))
+			return nil
+		},
+	}, "cmd", "", `set the default command (json array, or shell command)`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "string",
 		f: func(val string) error {
@@ -227,6 +344,31 @@ func init() {
 			return nil
 		},
 	}, "data-max", "", `sets or removes descriptor data field (size in bytes)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithEntrypoint(modParseArgs(val, []string{"/bin/sh", "-c"})))
+			return nil
+		},
+	}, "entrypoint", "", `set the entrypoint (json array, or shell command)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "stringArray",
+		f: func(val string) error {
+			vs := strings.SplitN(val, "=", 2)
+			if len(vs) != 2 {
+				return fmt.Errorf("invalid environment variable, expected name=value")
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithEnv(vs[0], vs[1]))
+			return nil
+		},
+	}, "env", "", `set an environment variable (name=value)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "stringArray",
+		f: func(val string) error {
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithEnvRm(val))
+			return nil
+		},
+	}, "env-rm", "", `delete an environment variable`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "stringArray",
 		f: func(val string) error {
@@ -241,6 +383,24 @@ func init() {
 			return nil
 		},
 	}, "expose-rm", "", `delete an exposed port`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			if val == "" {
+				imageOpts.modOpts = append(imageOpts.modOpts, mod.WithHealthcheck(nil))
+			} else if strings.EqualFold(val, "none") {
+				imageOpts.modOpts = append(imageOpts.modOpts, mod.WithHealthcheck(&v1.HealthConfig{Test: []string{"NONE"}}))
+			} else {
+				test := []string{"CMD-SHELL", val}
+				args := []string{}
+				if strings.HasPrefix(val, "[") && json.Unmarshal([]byte(val), &args) == nil {
+					test = append([]string{"CMD"}, args...)
+				}
+				imageOpts.modOpts = append(imageOpts.modOpts, mod.WithHealthcheck(&v1.HealthConfig{Test: test}))
+			}
+			return nil
+		},
+	}, "healthcheck", "", `set the healthcheck command (json array, shell command, or none to disable)`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "stringArray",
 		f: func(val string) error {
@@ -268,6 +428,97 @@ func init() {
 			return nil
 		},
 	}, "label-to-annotation", "", `set annotations from labels`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "stringArray",
+		f: func(val string) error {
+			kvs := map[string]string{}
+			for _, kv := range strings.Split(val, ",") {
+				kvSplit := strings.SplitN(kv, "=", 2)
+				if len(kvSplit) != 2 {
+					return fmt.Errorf("layer add value must be key=value pairs: %s", kv)
+				}
+				kvs[kvSplit[0]] = kvSplit[1]
+			}
+			if kvs["tar"] != "" {
+				file := kvs["tar"]
+				if _, err := os.Stat(file); err != nil {
+					return fmt.Errorf("failed to open tar file %s: %w", file, err)
+				}
+				imageOpts.modOpts = append(imageOpts.modOpts, mod.WithLayerAddTar(func() (io.ReadCloser, error) {
+					return os.Open(file)
+				}))
+				return nil
+			}
+			if kvs["path"] == "" || kvs["dest"] == "" {
+				return fmt.Errorf("layer add requires tar=file.tar, or path=src,dest=dir")
+			}
+			uid, gid, mode := 0, 0, uint64(0)
+			var err error
+			if kvs["uid"] != "" {
+				uid, err = strconv.Atoi(kvs["uid"])
+				if err != nil {
+					return fmt.Errorf("uid invalid: %w", err)
+				}
+			}
+			if kvs["gid"] != "" {
+				gid, err = strconv.Atoi(kvs["gid"])
+				if err != nil {
+					return fmt.Errorf("gid invalid: %w", err)
+				}
+			}
+			if kvs["mode"] != "" {
+				mode, err = strconv.ParseUint(kvs["mode"], 8, 32)
+				if err != nil {
+					return fmt.Errorf("mode invalid: %w", err)
+				}
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithLayerAddPath(kvs["path"], kvs["dest"], uid, gid, fs.FileMode(mode)))
+			return nil
+		},
+	}, "layer-add", "", `add a layer (tar=file.tar, or path=src,dest=dir[,uid=0,gid=0,mode=0644])`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			ct, err := archive.ParseCompressType(val)
+			if err != nil || (ct != archive.CompressNone && ct != archive.CompressGzip && ct != archive.CompressZstd) {
+				return fmt.Errorf("unsupported layer compression %s, use none, gzip, or zstd", val)
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithLayerCompression(ct))
+			return nil
+		},
+	}, "layer-compress", "", `change the layer compression (none, gzip, zstd)`)
+	imageModCmd.Flags().VarPF(&modFlagFunc{
+		t: "bool",
+		f: func(val string) error {
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("unable to parse value %s: %w", val, err)
+			}
+			if b {
+				imageOpts.modOpts = append(imageOpts.modOpts, mod.WithLayerReproducible())
+			}
+			return nil
+		},
+	}, "layer-reproducible", "", `normalize layers so the same content generates the same digest`).NoOptDefVal = "true"
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			vs := strings.SplitN(val, ":", 2)
+			if len(vs) != 2 {
+				return fmt.Errorf("owner must be formatted uid:gid")
+			}
+			uid, err := strconv.Atoi(vs[0])
+			if err != nil || uid < 0 {
+				return fmt.Errorf("uid invalid: %s", vs[0])
+			}
+			gid, err := strconv.Atoi(vs[1])
+			if err != nil || gid < 0 {
+				return fmt.Errorf("gid invalid: %s", vs[1])
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithLayerReproducibleOwner(uid, gid))
+			return nil
+		},
+	}, "layer-reproducible-owner", "", `normalize layers and set the owner of every file (uid:gid)`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "string",
 		f: func(val string) error {
@@ -291,6 +542,25 @@ func init() {
 			return nil
 		},
 	}, "layer-rm-index", "", `delete a layer from an image (index begins at 0)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			vs := strings.Split(val, ",")
+			if len(vs) != 2 {
+				return fmt.Errorf("layer squash requires a start and end index (start,end)")
+			}
+			start, err := strconv.Atoi(vs[0])
+			if err != nil {
+				return fmt.Errorf("start index invalid: %w", err)
+			}
+			end, err := strconv.Atoi(vs[1])
+			if err != nil {
+				return fmt.Errorf("end index invalid: %w", err)
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithLayerSquash(start, end))
+			return nil
+		},
+	}, "layer-squash", "", `squash a range of layers into one layer (start,end index begins at 0)`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "string",
 		f: func(val string) error {
@@ -302,6 +572,91 @@ func init() {
 			return nil
 		},
 	}, "layer-time-max", "", `max timestamp for a layer`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "int",
+		f: func(val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("unable to parse parallel %s: %w", val, err)
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithParallel(n))
+			return nil
+		},
+	}, "parallel", "", `number of layers to process concurrently`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			size, err := units.RAMInBytes(val)
+			if err != nil {
+				return fmt.Errorf("unable to parse temp budget %s: %w", val, err)
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithParallelTempBudget(size))
+			return nil
+		},
+	}, "parallel-temp-budget", "", `limit temp space used by concurrent layers (e.g. 2g)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			platforms := []string{}
+			if val != "" {
+				platforms = strings.Split(val, ",")
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithPlatformFilter(platforms...))
+			return nil
+		},
+	}, "platform-filter", "", `limit the following changes to platforms (e.g. linux/arm64,linux/arm/*), an empty value removes the filter`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			platforms := strings.Split(val, ",")
+			for _, p := range platforms {
+				if p == "" {
+					return fmt.Errorf("platform-rm requires a platform (e.g. windows/*)")
+				}
+				// wildcard entries are matched by component, every other entry must parse
+				if strings.Contains(p, "*") {
+					for _, comp := range strings.Split(p, "/") {
+						if comp == "" {
+							return fmt.Errorf("invalid platform %s", p)
+						}
+					}
+					continue
+				}
+				_, err := platform.Parse(p)
+				if err != nil {
+					return fmt.Errorf("invalid platform %s: %v", p, err)
+				}
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithPlatformRm(platforms...))
+			return nil
+		},
+	}, "platform-rm", "", `remove platforms from an index (e.g. windows/*)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			vs := strings.Split(val, ",")
+			if len(vs) != 2 {
+				return fmt.Errorf("rebase requires an old and new base image (old-base,new-base)")
+			}
+			rOld, err := ref.New(vs[0])
+			if err != nil {
+				return fmt.Errorf("invalid old base image reference: %v", err)
+			}
+			rNew, err := ref.New(vs[1])
+			if err != nil {
+				return fmt.Errorf("invalid new base image reference: %v", err)
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithRebase(rOld, rNew))
+			return nil
+		},
+	}, "rebase", "", `rebase the image from an old base to a new base image (old-base,new-base)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithStopSignal(val))
+			return nil
+		},
+	}, "stop-signal", "", `set the stop signal`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "string",
 		f: func(val string) error {
@@ -315,7 +670,20 @@ func init() {
 			return nil
 		},
 	}, "time-max", "", `max timestamp for both the config and layers`)
-	imageModCmd.Flags().VarP(&modFlagFunc{
+	imageModCmd.Flags().VarPF(&modFlagFunc{
+		t: "bool",
+		f: func(val string) error {
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("unable to parse value %s: %w", val, err)
+			}
+			if b {
+				imageOpts.modOpts = append(imageOpts.modOpts, mod.WithManifestToDocker())
+			}
+			return nil
+		},
+	}, "to-docker", "", `convert to Docker schema2 media types`).NoOptDefVal = "true"
+	imageModCmd.Flags().VarPF(&modFlagFunc{
 		t: "bool",
 		f: func(val string) error {
 			b, err := strconv.ParseBool(val)
@@ -327,7 +695,14 @@ func init() {
 			}
 			return nil
 		},
-	}, "to-oci", "", `convert to OCI media types`)
+	}, "to-oci", "", `convert to OCI media types`).NoOptDefVal = "true"
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithUser(val))
+			return nil
+		},
+	}, "user", "", `set the user (user[:group])`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "stringArray",
 		f: func(val string) error {
@@ -342,23 +717,77 @@ func init() {
 			return nil
 		},
 	}, "volume-rm", "", `delete a volume definition`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithWorkingDir(val))
+			return nil
+		},
+	}, "workdir", "", `set the working directory`)
 
 	imageRateLimitCmd.Flags().StringVarP(&imageOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax")
 	imageRateLimitCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 
+	imageCmd.AddCommand(imageCheckBaseCmd)
 	imageCmd.AddCommand(imageCopyCmd)
 	imageCmd.AddCommand(imageDeleteCmd)
+	imageCmd.AddCommand(imageDiffCmd)
 	imageCmd.AddCommand(imageDigestCmd)
 	imageCmd.AddCommand(imageExportCmd)
+	imageCmd.AddCommand(imageExportRootFSCmd)
+	imageCmd.AddCommand(imageGetFileCmd)
 	imageCmd.AddCommand(imageImportCmd)
 	imageCmd.AddCommand(imageInspectCmd)
+	imageCmd.AddCommand(imageLsFilesCmd)
 	imageCmd.AddCommand(imageManifestCmd)
 	imageCmd.AddCommand(imageModCmd)
 	imageCmd.AddCommand(imageRateLimitCmd)
 	rootCmd.AddCommand(imageCmd)
 }
 
-func runImageCopy(cmd *cobra.Command, args []string) error {
+func runImageCheckBase(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":      r.CommonName(),
+		"base":     imageOpts.checkBaseRef,
+		"digest":   imageOpts.checkBaseDigest,
+		"platform": imageOpts.platform,
+	}).Debug("Image check base")
+	opts := []regclient.ImageOpts{}
+	if imageOpts.checkBaseDigest != "" {
+		if imageOpts.checkBaseRef == "" {
+			return fmt.Errorf("%w: --digest requires --base", ErrMissingInput)
+		}
+		d, err := digest.Parse(imageOpts.checkBaseDigest)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		opts = append(opts, regclient.ImageWithCheckBaseDigest(d))
+	}
+	if imageOpts.checkBaseRef != "" {
+		opts = append(opts, regclient.ImageWithCheckBaseRef(imageOpts.checkBaseRef))
+	}
+	if imageOpts.platform != "" {
+		opts = append(opts, regclient.ImageWithPlatform(imageOpts.platform))
+	}
+	err = rc.ImageCheckBase(ctx, r, opts...)
+	if errors.Is(err, types.ErrMismatch) {
+		return exitCodeErr{code: 2, err: err}
+	} else if err != nil {
+		return err
+	}
+	log.Info("Base image matches")
+	return nil
+}
+
+func runImageCopy(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	rSrc, err := ref.New(args[0])
 	if err != nil {
@@ -370,13 +799,19 @@ func runImageCopy(cmd *cobra.Command, args []string) error {
 	}
 	rc := newRegClient()
 	defer rc.Close(ctx, rSrc)
-	defer rc.Close(ctx, rTgt)
+	defer func() {
+		if errC := rc.Close(ctx, rTgt); errC != nil && err == nil {
+			err = errC
+		}
+	}()
 
 	log.WithFields(logrus.Fields{
 		"source":      rSrc.CommonName(),
 		"target":      rTgt.CommonName(),
 		"recursive":   imageOpts.forceRecursive,
 		"digest-tags": imageOpts.digestTags,
+		"parallel":    imageOpts.parallel,
+		"referrers":   imageOpts.referrers,
 	}).Debug("Image copy")
 	opts := []regclient.ImageOpts{}
 	if imageOpts.forceRecursive {
@@ -385,12 +820,61 @@ func runImageCopy(cmd *cobra.Command, args []string) error {
 	if imageOpts.digestTags {
 		opts = append(opts, regclient.ImageWithDigestTags())
 	}
+	if imageOpts.parallel > 1 {
+		opts = append(opts, regclient.ImageWithParallel(imageOpts.parallel))
+	}
+	if imageOpts.referrers {
+		opts = append(opts, regclient.ImageWithReferrers())
+	}
 	if len(imageOpts.platforms) > 0 {
 		opts = append(opts, regclient.ImageWithPlatforms(imageOpts.platforms))
 	}
+	if imageOpts.progress {
+		pd := newProgressDisplay(os.Stderr)
+		defer pd.Finish()
+		opts = append(opts, regclient.ImageWithProgress(pd.callback))
+	}
 	return rc.ImageCopy(ctx, rSrc, rTgt, opts...)
 }
 
+func runImageDiff(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	rOld, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rNew, err := ref.New(args[1])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, rOld)
+	defer rc.Close(ctx, rNew)
+
+	log.WithFields(logrus.Fields{
+		"old":       rOld.CommonName(),
+		"new":       rNew.CommonName(),
+		"files":     imageOpts.files,
+		"platforms": imageOpts.platforms,
+	}).Debug("Image diff")
+	opts := []regclient.ImageOpts{}
+	if imageOpts.files {
+		opts = append(opts, regclient.ImageWithDiffFiles())
+	}
+	if len(imageOpts.platforms) > 0 {
+		opts = append(opts, regclient.ImageWithPlatforms(imageOpts.platforms))
+	}
+	result, err := rc.ImageDiff(ctx, rOld, rNew, opts...)
+	if err != nil {
+		return err
+	}
+	switch imageOpts.format {
+	case "json":
+		imageOpts.format = "{{jsonPretty .}}"
+	}
+	return template.Writer(os.Stdout, imageOpts.format, result)
+}
+
 func runImageExport(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
@@ -411,10 +895,134 @@ func runImageExport(cmd *cobra.Command, args []string) error {
 	log.WithFields(logrus.Fields{
 		"ref": r.CommonName(),
 	}).Debug("Image export")
-	return rc.ImageExport(ctx, r, w)
+	opts := []regclient.ImageOpts{}
+	if imageOpts.progress {
+		pd := newProgressDisplay(os.Stderr)
+		defer pd.Finish()
+		opts = append(opts, regclient.ImageWithProgress(pd.callback))
+	}
+	return rc.ImageExport(ctx, r, w, opts...)
 }
 
-func runImageImport(cmd *cobra.Command, args []string) error {
+func runImageExportRootFS(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	out := args[1]
+	toTar := out == "-" || strings.HasSuffix(out, ".tar")
+	if toTar && imageOpts.bundle {
+		return fmt.Errorf("%w: bundle output must be a directory", ErrInvalidInput)
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":      r.CommonName(),
+		"output":   out,
+		"bundle":   imageOpts.bundle,
+		"platform": imageOpts.platform,
+	}).Debug("Image export rootfs")
+	opts := []regclient.ImageOpts{regclient.ImageWithPlatform(imageOpts.platform)}
+	if toTar {
+		var w io.Writer = os.Stdout
+		if out != "-" {
+			fh, err := os.Create(out)
+			if err != nil {
+				return err
+			}
+			defer fh.Close()
+			w = fh
+		}
+		return rc.ImageExportRootFS(ctx, r, w, opts...)
+	}
+
+	dir := out
+	if imageOpts.bundle {
+		dir = filepath.Join(out, "rootfs")
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(rc.ImageExportRootFS(ctx, r, pw, opts...))
+	}()
+	err = archive.ExtractRootFS(ctx, dir, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+	if !imageOpts.bundle {
+		return nil
+	}
+	manifestOpts.platform = imageOpts.platform
+	manifestOpts.list = false
+	m, err := getManifest(ctx, rc, r)
+	if err != nil {
+		return err
+	}
+	cd, err := m.GetConfig()
+	if err != nil {
+		return err
+	}
+	blobConfig, err := rc.BlobGetOCIConfig(ctx, r, cd)
+	if err != nil {
+		return err
+	}
+	// resolve users with the extracted rootfs rather than pulling the layers again
+	return bundleWriteConfig(out, "rootfs", blobConfig.GetConfig(), bundleRootFS{dir: dir})
+}
+
+func runImageGetFile(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	filename := imageFSPath(args[1])
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":      r.CommonName(),
+		"path":     filename,
+		"platform": imageOpts.platform,
+	}).Debug("Image get file")
+	fsys, err := rc.ImageFS(ctx, r, regclient.ImageWithPlatform(imageOpts.platform))
+	if err != nil {
+		return err
+	}
+	fh, err := fsys.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	fi, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%w: %s is a directory", ErrInvalidInput, args[1])
+	}
+	var w io.Writer
+	if len(args) == 3 {
+		out, err := os.Create(args[2])
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		w = out
+	} else {
+		w = os.Stdout
+	}
+	_, err = io.Copy(w, fh)
+	return err
+}
+
+func runImageImport(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
@@ -426,7 +1034,11 @@ func runImageImport(cmd *cobra.Command, args []string) error {
 	}
 	defer rs.Close()
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
 	log.WithFields(logrus.Fields{
 		"ref":  r.CommonName(),
 		"file": args[1],
@@ -480,7 +1092,58 @@ func runImageInspect(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, imageOpts.format, blobConfig)
 }
 
-func runImageMod(cmd *cobra.Command, args []string) error {
+func runImageLsFiles(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	root := "."
+	if len(args) == 2 {
+		root = imageFSPath(args[1])
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":      r.CommonName(),
+		"path":     root,
+		"platform": imageOpts.platform,
+	}).Debug("Image list files")
+	fsys, err := rc.ImageFS(ctx, r, regclient.ImageWithPlatform(imageOpts.platform))
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	defer tw.Flush()
+	return fs.WalkDir(fsys, root, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		if !imageOpts.long {
+			fmt.Fprintf(tw, "/%s\n", p)
+			return nil
+		}
+		fi, err := de.Info()
+		if err != nil {
+			return err
+		}
+		owner, link := "", ""
+		if th, ok := fi.Sys().(*tar.Header); ok {
+			owner = fmt.Sprintf("%d:%d", th.Uid, th.Gid)
+			if th.Linkname != "" {
+				link = " -> " + th.Linkname
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t/%s%s\n", fi.Mode().String(), owner, fi.Size(), p, link)
+		return nil
+	})
+}
+
+func runImageMod(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
@@ -510,13 +1173,33 @@ func runImageMod(cmd *cobra.Command, args []string) error {
 		"ref": r.CommonName(),
 	}).Debug("Modifying image")
 
-	defer rc.Close(ctx, r)
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
+	if imageOpts.dryRun {
+		plan := mod.Plan{}
+		_, err = mod.Apply(ctx, rc, r, append(imageOpts.modOpts, mod.WithDryRun(&plan))...)
+		if err != nil {
+			return err
+		}
+		switch imageOpts.format {
+		case "json":
+			imageOpts.format = "{{jsonPretty .}}"
+		}
+		return template.Writer(os.Stdout, imageOpts.format, plan)
+	}
 	rOut, err := mod.Apply(ctx, rc, r, imageOpts.modOpts...)
 	if err != nil {
 		return err
 	}
 	if rNew.Tag != "" {
-		defer rc.Close(ctx, rNew)
+		defer func() {
+			if errC := rc.Close(ctx, rNew); errC != nil && err == nil {
+				err = errC
+			}
+		}()
 		err = rc.ImageCopy(ctx, rOut, rNew)
 		if err != nil {
 			return fmt.Errorf("failed copying image to new name: %w", err)
@@ -556,6 +1239,27 @@ type modFlagFunc struct {
 	t string
 }
 
+// imageFSPath converts a path in the image to an fs.FS path
+func imageFSPath(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// modParseArgs parses a json array of args, or a shell command that is prefixed by the shell args
+func modParseArgs(val string, shell []string) []string {
+	if val == "" {
+		return nil
+	}
+	args := []string{}
+	if strings.HasPrefix(val, "[") && json.Unmarshal([]byte(val), &args) == nil {
+		return args
+	}
+	return append(append(args, shell...), val)
+}
+
 func (m *modFlagFunc) String() string {
 	return ""
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index <cmd>",
+	Short: "manage manifest lists and OCI indexes",
+}
+var indexAddCmd = &cobra.Command{
+	Use:   "add <index_ref> <image_ref> [image_ref...]",
+	Short: "add images to an index",
+	Long: `Add images to an existing manifest list or OCI index. Each image is copied to
+the repository of the index, and entries with the same platform are replaced.
+Source images that are an index add each of their entries, use "--platform"
+to select specific platforms. The digest of the new index is output.`,
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runIndexAdd,
+}
+var indexCreateCmd = &cobra.Command{
+	Use:   "create <index_ref> [image_ref...]",
+	Short: "create an index",
+	Long: `Create a manifest list or OCI index from a list of images. Each image is copied
+to the repository of the index, and the platform is set from the image config.
+Source images that are an index add each of their entries, use "--platform"
+to select specific platforms. The digest of the new index is output.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runIndexCreate,
+}
+var indexRmCmd = &cobra.Command{
+	Use:     "rm <index_ref>",
+	Aliases: []string{"delete", "remove"},
+	Short:   "remove platforms from an index",
+	Long: `Remove platforms from a manifest list or OCI index. The images are not deleted
+from the repository. The digest of the new index is output.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runIndexRm,
+}
+
+var indexOpts struct {
+	annotations []string
+	mediaType   string
+	platforms   []string
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{indexAddCmd, indexCreateCmd, indexRmCmd} {
+		cmd.Flags().StringArrayVarP(&indexOpts.annotations, "annotation", "", []string{}, "Set an annotation on the index (name=value, an empty value deletes)")
+		cmd.Flags().StringVarP(&indexOpts.mediaType, "media-type", "", "", "Media type of the index (OCI index by default)")
+		cmd.Flags().StringArrayVarP(&indexOpts.platforms, "platform", "p", []string{}, "Platforms to include or remove (e.g. linux/amd64)")
+		cmd.RegisterFlagCompletionFunc("annotation", completeArgNone)
+		cmd.RegisterFlagCompletionFunc("media-type", completeArgMediaTypeIndex)
+		cmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+	}
+	indexRmCmd.MarkFlagRequired("platform")
+
+	indexCmd.AddCommand(indexAddCmd)
+	indexCmd.AddCommand(indexCreateCmd)
+	indexCmd.AddCommand(indexRmCmd)
+	rootCmd.AddCommand(indexCmd)
+}
+
+func completeArgMediaTypeIndex(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{
+		types.MediaTypeOCI1ManifestList,
+		types.MediaTypeDocker2ManifestList,
+	}, cobra.ShellCompDirectiveNoFileComp
+}
+
+func runIndexAdd(cmd *cobra.Command, args []string) (err error) {
+	ctx := cmd.Context()
+	r, srcs, err := indexParseArgs(args)
+	if err != nil {
+		return err
+	}
+	opts, err := indexBuildOpts()
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
+	log.WithFields(logrus.Fields{
+		"index":   r.CommonName(),
+		"sources": args[1:],
+	}).Debug("Add to index")
+	m, err := rc.IndexAdd(ctx, r, srcs, opts...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", m.GetDescriptor().Digest.String())
+	return nil
+}
+
+func runIndexCreate(cmd *cobra.Command, args []string) (err error) {
+	ctx := cmd.Context()
+	r, srcs, err := indexParseArgs(args)
+	if err != nil {
+		return err
+	}
+	opts, err := indexBuildOpts()
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
+	log.WithFields(logrus.Fields{
+		"index":   r.CommonName(),
+		"sources": args[1:],
+	}).Debug("Create index")
+	m, err := rc.IndexCreate(ctx, r, srcs, opts...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", m.GetDescriptor().Digest.String())
+	return nil
+}
+
+func runIndexRm(cmd *cobra.Command, args []string) (err error) {
+	ctx := cmd.Context()
+	r, _, err := indexParseArgs(args)
+	if err != nil {
+		return err
+	}
+	opts, err := indexBuildOpts()
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
+	log.WithFields(logrus.Fields{
+		"index":     r.CommonName(),
+		"platforms": indexOpts.platforms,
+	}).Debug("Remove from index")
+	m, err := rc.IndexRm(ctx, r, opts...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", m.GetDescriptor().Digest.String())
+	return nil
+}
+
+// indexParseArgs parses the index reference and the list of source images
+func indexParseArgs(args []string) (ref.Ref, []ref.Ref, error) {
+	r, err := ref.New(args[0])
+	if err != nil {
+		return r, nil, err
+	}
+	srcs := []ref.Ref{}
+	for _, arg := range args[1:] {
+		src, err := ref.New(arg)
+		if err != nil {
+			return r, nil, err
+		}
+		srcs = append(srcs, src)
+	}
+	return r, srcs, nil
+}
+
+func indexBuildOpts() ([]regclient.IndexOpts, error) {
+	opts := []regclient.IndexOpts{}
+	for _, a := range indexOpts.annotations {
+		vs := strings.SplitN(a, "=", 2)
+		if len(vs) != 2 {
+			return nil, fmt.Errorf("invalid annotation %s, expected name=value", a)
+		}
+		opts = append(opts, regclient.IndexWithAnnotation(vs[0], vs[1]))
+	}
+	if indexOpts.mediaType != "" {
+		opts = append(opts, regclient.IndexWithMediaType(indexOpts.mediaType))
+	}
+	if len(indexOpts.platforms) > 0 {
+		opts = append(opts, regclient.IndexWithPlatforms(indexOpts.platforms))
+	}
+	return opts, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 )
@@ -8,6 +9,10 @@ import (
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
+		var ece exitCodeErr
+		if errors.As(err, &ece) {
+			os.Exit(ece.code)
+		}
 		os.Exit(1)
 	}
 	os.Exit(0)
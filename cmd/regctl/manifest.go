@@ -177,14 +177,18 @@ func getPlatformDesc(ctx context.Context, rc *regclient.RegClient, m manifest.Ma
 	return desc, nil
 }
 
-func runManifestDelete(cmd *cobra.Command, args []string) error {
+func runManifestDelete(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
 
 	if r.Digest == "" && manifestOpts.forceTagDeref {
 		m, err := rc.ManifestHead(ctx, r)
@@ -294,14 +298,18 @@ func runManifestGet(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, manifestOpts.format, m)
 }
 
-func runManifestPut(cmd *cobra.Command, args []string) error {
+func runManifestPut(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
 
 	raw, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
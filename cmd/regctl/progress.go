@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/units"
+	"golang.org/x/term"
+)
+
+// progressInterval limits how often the display is refreshed
+const progressInterval = 250 * time.Millisecond
+
+// progressPlainInterval limits how often totals are logged when output is not a terminal
+const progressPlainInterval = 5 * time.Second
+
+// progressDisplay outputs progress events from regclient.
+// On a terminal, active blobs are redrawn in place,
+// otherwise each state change is written as a line for CI logs.
+type progressDisplay struct {
+	mu     sync.Mutex
+	w      io.Writer
+	tty    bool
+	active []string // keys of blobs being transferred, in the order started
+	blobs  map[string]regclient.ProgressEvent
+	total  regclient.ProgressTotal
+	lines  int // number of lines drawn in the last terminal refresh
+	last   time.Time
+}
+
+func newProgressDisplay(f *os.File) *progressDisplay {
+	return &progressDisplay{
+		w:     f,
+		tty:   term.IsTerminal(int(f.Fd())),
+		blobs: map[string]regclient.ProgressEvent{},
+	}
+}
+
+// callback is passed to regclient with the WithProgress options
+func (pd *progressDisplay) callback(e regclient.ProgressEvent) {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	key := e.Desc.Digest.String()
+	if key == "" {
+		key = "blob"
+	}
+	pd.total = e.Total
+	now := time.Now()
+	switch {
+	case e.State == regclient.ProgressStarted:
+		if _, ok := pd.blobs[key]; !ok {
+			pd.active = append(pd.active, key)
+		}
+		pd.blobs[key] = e
+		if !pd.tty {
+			fmt.Fprintf(pd.w, "%s: started %s\n", progressShort(key), progressSize(e.Desc.Size))
+			return
+		}
+	case e.State.Done():
+		delete(pd.blobs, key)
+		for i := range pd.active {
+			if pd.active[i] == key {
+				pd.active = append(pd.active[:i], pd.active[i+1:]...)
+				break
+			}
+		}
+		if pd.tty {
+			pd.clear()
+		}
+		msg := fmt.Sprintf("%s: %s %s", progressShort(key), e.State, progressSize(e.Cur))
+		if e.Err != nil {
+			msg = fmt.Sprintf("%s: %v", msg, e.Err)
+		}
+		fmt.Fprintln(pd.w, msg)
+		if !pd.tty {
+			return
+		}
+	default:
+		pd.blobs[key] = e
+		if !pd.tty {
+			if now.Sub(pd.last) >= progressPlainInterval {
+				pd.last = now
+				fmt.Fprintln(pd.w, pd.totalLine())
+			}
+			return
+		}
+		if now.Sub(pd.last) < progressInterval {
+			return
+		}
+	}
+	pd.last = now
+	pd.draw()
+}
+
+// Finish outputs the final totals
+func (pd *progressDisplay) Finish() {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	if pd.tty {
+		pd.clear()
+	}
+	if pd.total.Blobs > 0 {
+		fmt.Fprintln(pd.w, pd.totalLine())
+	}
+}
+
+// clear removes the lines from the previous terminal refresh
+func (pd *progressDisplay) clear() {
+	for ; pd.lines > 0; pd.lines-- {
+		fmt.Fprint(pd.w, "\033[1A\033[2K")
+	}
+}
+
+// draw refreshes the active blobs and totals on a terminal
+func (pd *progressDisplay) draw() {
+	pd.clear()
+	for _, key := range pd.active {
+		e := pd.blobs[key]
+		fmt.Fprintf(pd.w, "%s: %s\n", progressShort(key), progressBar(e.Cur, e.Desc.Size))
+		pd.lines++
+	}
+	fmt.Fprintln(pd.w, pd.totalLine())
+	pd.lines++
+}
+
+func (pd *progressDisplay) totalLine() string {
+	return fmt.Sprintf("Total: %d/%d blobs, %s", pd.total.BlobsDone, pd.total.Blobs, progressBar(pd.total.BytesDone, pd.total.Bytes))
+}
+
+func progressBar(cur, total int64) string {
+	const width = 30
+	if total <= 0 {
+		return progressSize(cur)
+	}
+	filled := int(cur * width / total)
+	if filled > width {
+		filled = width
+	} else if filled < 0 {
+		filled = 0
+	}
+	return fmt.Sprintf("[%s%s] %s/%s", strings.Repeat("=", filled), strings.Repeat(" ", width-filled), progressSize(cur), progressSize(total))
+}
+
+func progressSize(size int64) string {
+	return units.HumanSize(float64(size))
+}
+
+// progressShort truncates digests for display
+func progressShort(key string) string {
+	if i := strings.Index(key, ":"); i >= 0 && len(key) > i+13 {
+		return key[:i+13]
+	}
+	return key
+}
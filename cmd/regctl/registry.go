@@ -62,6 +62,7 @@ var registryOpts struct {
 	priority             uint
 	repoAuth             bool
 	blobChunk, blobMax   int64
+	blobRecover          int
 	apiOpts              []string
 	scheme               string   // TODO: remove
 	dns                  []string // TODO: remove
@@ -82,6 +83,7 @@ func init() {
 	registrySetCmd.Flags().BoolVarP(&registryOpts.repoAuth, "repo-auth", "", false, "Separate auth requests per repository instead of per registry")
 	registrySetCmd.Flags().Int64VarP(&registryOpts.blobChunk, "blob-chunk", "", 0, "Blob chunk size")
 	registrySetCmd.Flags().Int64VarP(&registryOpts.blobMax, "blob-max", "", 0, "Blob size before switching to chunked push, -1 to disable")
+	registrySetCmd.Flags().IntVarP(&registryOpts.blobRecover, "blob-recover", "", 0, "Attempts to recover an interrupted chunked push, -1 to disable")
 	registrySetCmd.Flags().StringArrayVarP(&registryOpts.apiOpts, "api-opts", "", nil, "List of options (key=value))")
 	registrySetCmd.RegisterFlagCompletionFunc("cacert", completeArgNone)
 	registrySetCmd.RegisterFlagCompletionFunc("tls", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -315,6 +317,9 @@ func runRegistrySet(cmd *cobra.Command, args []string) error {
 	if flagChanged(cmd, "blob-max") {
 		h.BlobMax = registryOpts.blobMax
 	}
+	if flagChanged(cmd, "blob-recover") {
+		h.BlobRecover = registryOpts.blobRecover
+	}
 	if flagChanged(cmd, "api-opts") {
 		if h.APIOpts == nil {
 			h.APIOpts = map[string]string{}
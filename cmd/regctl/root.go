@@ -53,6 +53,8 @@ var rootOpts struct {
 	logopts   []string
 	format    string // for Go template formatting of various commands
 	userAgent string
+	cacheDir  string
+	cacheSize int64
 }
 
 func init() {
@@ -67,11 +69,15 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&rootOpts.verbosity, "verbosity", "v", logrus.WarnLevel.String(), "Log level (debug, info, warn, error, fatal, panic)")
 	rootCmd.PersistentFlags().StringArrayVar(&rootOpts.logopts, "logopt", []string{}, "Log options")
 	rootCmd.PersistentFlags().StringVarP(&rootOpts.userAgent, "user-agent", "", "", "Override user agent")
+	rootCmd.PersistentFlags().StringVarP(&rootOpts.cacheDir, "cache-dir", "", "", "Directory to cache blobs and manifests pulled by digest")
+	rootCmd.PersistentFlags().Int64VarP(&rootOpts.cacheSize, "cache-size", "", 0, "Maximum size of the cache in bytes, 0 for no limit")
 
 	rootCmd.RegisterFlagCompletionFunc("verbosity", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{"debug", "info", "warn", "error", "fatal", "panic"}, cobra.ShellCompDirectiveNoFileComp
 	})
 	rootCmd.RegisterFlagCompletionFunc("logopt", completeArgNone)
+	rootCmd.RegisterFlagCompletionFunc("cache-dir", completeArgDefault)
+	rootCmd.RegisterFlagCompletionFunc("cache-size", completeArgNone)
 
 	versionCmd.Flags().StringVarP(&rootOpts.format, "format", "", "{{jsonPretty .}}", "Format output with go template syntax")
 	versionCmd.RegisterFlagCompletionFunc("format", completeArgNone)
@@ -125,6 +131,9 @@ func newRegClient() *regclient.RegClient {
 	} else {
 		rcOpts = append(rcOpts, regclient.WithUserAgent(UserAgent+" (unknown)"))
 	}
+	if rootOpts.cacheDir != "" {
+		rcOpts = append(rcOpts, regclient.WithCache(rootOpts.cacheDir, rootOpts.cacheSize))
+	}
 	if conf.IncDockerCred == nil || *conf.IncDockerCred {
 		rcOpts = append(rcOpts, regclient.WithDockerCreds())
 	}
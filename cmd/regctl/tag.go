@@ -54,14 +54,18 @@ func init() {
 	rootCmd.AddCommand(tagCmd)
 }
 
-func runTagDelete(cmd *cobra.Command, args []string) error {
+func runTagDelete(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer func() {
+		if errC := rc.Close(ctx, r); errC != nil && err == nil {
+			err = errC
+		}
+	}()
 	log.WithFields(logrus.Fields{
 		"host":       r.Registry,
 		"repository": r.Repository,
@@ -35,41 +35,43 @@ type Config struct {
 
 // ConfigCreds allows the registry login to be passed in the config rather than from Docker
 type ConfigCreds struct {
-	Registry   string            `yaml:"registry" json:"registry"`
-	Hostname   string            `yaml:"hostname" json:"hostname"`
-	User       string            `yaml:"user" json:"user"`
-	Pass       string            `yaml:"pass" json:"pass"`
-	Token      string            `yaml:"token" json:"token"`
-	TLS        config.TLSConf    `yaml:"tls" json:"tls"`
-	Scheme     string            `yaml:"scheme" json:"scheme"` // TODO: eventually delete
-	RegCert    string            `yaml:"regcert" json:"regcert"`
-	PathPrefix string            `yaml:"pathPrefix" json:"pathPrefix"`
-	Mirrors    []string          `yaml:"mirrors" json:"mirrors"`
-	Priority   uint              `yaml:"priority" json:"priority"`
-	RepoAuth   bool              `yaml:"repoAuth" json:"repoAuth"`
-	API        string            `yaml:"api" json:"api"`
-	APIOpts    map[string]string `yaml:"apiOpts" json:"apiOpts"`
-	BlobChunk  int64             `yaml:"blobChunk" json:"blobChunk"`
-	BlobMax    int64             `yaml:"blobMax" json:"blobMax"`
+	Registry    string            `yaml:"registry" json:"registry"`
+	Hostname    string            `yaml:"hostname" json:"hostname"`
+	User        string            `yaml:"user" json:"user"`
+	Pass        string            `yaml:"pass" json:"pass"`
+	Token       string            `yaml:"token" json:"token"`
+	TLS         config.TLSConf    `yaml:"tls" json:"tls"`
+	Scheme      string            `yaml:"scheme" json:"scheme"` // TODO: eventually delete
+	RegCert     string            `yaml:"regcert" json:"regcert"`
+	PathPrefix  string            `yaml:"pathPrefix" json:"pathPrefix"`
+	Mirrors     []string          `yaml:"mirrors" json:"mirrors"`
+	Priority    uint              `yaml:"priority" json:"priority"`
+	RepoAuth    bool              `yaml:"repoAuth" json:"repoAuth"`
+	API         string            `yaml:"api" json:"api"`
+	APIOpts     map[string]string `yaml:"apiOpts" json:"apiOpts"`
+	BlobChunk   int64             `yaml:"blobChunk" json:"blobChunk"`
+	BlobMax     int64             `yaml:"blobMax" json:"blobMax"`
+	BlobRecover int               `yaml:"blobRecover" json:"blobRecover"`
 }
 
 func credsToRCHost(c ConfigCreds) config.Host {
 	return config.Host{
-		Name:       c.Registry,
-		Hostname:   c.Hostname,
-		User:       c.User,
-		Pass:       c.Pass,
-		Token:      c.Token,
-		TLS:        c.TLS,
-		RegCert:    c.RegCert,
-		PathPrefix: c.PathPrefix,
-		Mirrors:    c.Mirrors,
-		Priority:   c.Priority,
-		RepoAuth:   c.RepoAuth,
-		API:        c.API,
-		APIOpts:    c.APIOpts,
-		BlobChunk:  c.BlobChunk,
-		BlobMax:    c.BlobMax,
+		Name:        c.Registry,
+		Hostname:    c.Hostname,
+		User:        c.User,
+		Pass:        c.Pass,
+		Token:       c.Token,
+		TLS:         c.TLS,
+		RegCert:     c.RegCert,
+		PathPrefix:  c.PathPrefix,
+		Mirrors:     c.Mirrors,
+		Priority:    c.Priority,
+		RepoAuth:    c.RepoAuth,
+		API:         c.API,
+		APIOpts:     c.APIOpts,
+		BlobChunk:   c.BlobChunk,
+		BlobMax:     c.BlobMax,
+		BlobRecover: c.BlobRecover,
 	}
 }
 
@@ -82,10 +84,13 @@ type ConfigDefaults struct {
 	Parallel       int             `yaml:"parallel" json:"parallel"`
 	DigestTags     *bool           `yaml:"digestTags" json:"digestTags"`
 	ForceRecursive *bool           `yaml:"forceRecursive" json:"forceRecursive"`
+	Referrers      *bool           `yaml:"referrers" json:"referrers"`
 	MediaTypes     []string        `yaml:"mediaTypes" json:"mediaTypes"`
 	SkipDockerConf bool            `yaml:"skipDockerConfig" json:"skipDockerConfig"`
 	Hooks          ConfigHooks     `yaml:"hooks" json:"hooks"`
 	UserAgent      string          `yaml:"userAgent" json:"userAgent"`
+	CacheDir       string          `yaml:"cacheDir" json:"cacheDir"`
+	CacheSize      int64           `yaml:"cacheSize" json:"cacheSize"`
 }
 
 // ConfigRateLimit is for rate limit settings
@@ -104,6 +109,7 @@ type ConfigSync struct {
 	Platform       string          `yaml:"platform" json:"platform"`
 	Platforms      []string        `yaml:"platforms" json:"platforms"`
 	ForceRecursive *bool           `yaml:"forceRecursive" json:"forceRecursive"`
+	Referrers      *bool           `yaml:"referrers" json:"referrers"`
 	Backup         string          `yaml:"backup" json:"backup"`
 	Interval       time.Duration   `yaml:"interval" json:"interval"`
 	Schedule       string          `yaml:"schedule" json:"schedule"`
@@ -256,6 +262,10 @@ func syncSetDefaults(s *ConfigSync, d ConfigDefaults) {
 		b := (d.ForceRecursive != nil && *d.ForceRecursive)
 		s.ForceRecursive = &b
 	}
+	if s.Referrers == nil {
+		b := (d.Referrers != nil && *d.Referrers)
+		s.Referrers = &b
+	}
 	if s.Hooks.Pre == nil && d.Hooks.Pre != nil {
 		s.Hooks.Pre = d.Hooks.Pre
 	}
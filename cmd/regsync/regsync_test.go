@@ -170,6 +170,25 @@ func TestRegsync(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name: "ImageReferrers",
+			sync: ConfigSync{
+				Source:    "ocidir://testrepo:v3",
+				Target:    "ocidir://test6:v3",
+				Type:      "image",
+				Referrers: &boolTrue,
+			},
+			exists: []string{"ocidir://test6:v3"},
+			desired: []string{
+				"test6/index.json",
+				"test6/oci-layout",
+				"test6/blobs/sha256/a4bdb3dbc74b4fce1d2064f346ddb767cd36e4f959e570c01970036912c2c0fb", // v3
+			},
+			undesired: []string{
+				"test6/blobs/sha256/3fadbd1aeb4e8c0fe8328c4007012b7a6fdbc7c578ad4880b3480706a3432be1", // v2
+			},
+			expErr: nil,
+		},
 		{
 			name: "Backup",
 			sync: ConfigSync{
@@ -324,6 +324,9 @@ func loadConf() error {
 	} else {
 		rcOpts = append(rcOpts, regclient.WithUserAgent(UserAgent+" (unknown)"))
 	}
+	if conf.Defaults.CacheDir != "" {
+		rcOpts = append(rcOpts, regclient.WithCache(conf.Defaults.CacheDir, conf.Defaults.CacheSize))
+	}
 	if !conf.Defaults.SkipDockerConf {
 		rcOpts = append(rcOpts, regclient.WithDockerCreds(), regclient.WithDockerCerts())
 	}
@@ -582,7 +585,9 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 	if err == nil && manifest.GetDigest(mSrc).String() == manifest.GetDigest(mTgt).String() {
 		tgtMatches = true
 	}
-	if tgtMatches && (s.ForceRecursive == nil || !*s.ForceRecursive) {
+	// referrers may change without modifying the image, so matching images are still copied
+	forceCopy := (s.ForceRecursive != nil && *s.ForceRecursive) || (s.Referrers != nil && *s.Referrers)
+	if tgtMatches && !forceCopy {
 		log.WithFields(logrus.Fields{
 			"source": src.CommonName(),
 			"target": tgt.CommonName(),
@@ -619,7 +624,7 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 		if tgtExists && platDigest.String() == manifest.GetDigest(mTgt).String() {
 			tgtMatches = true
 		}
-		if tgtMatches && (s.ForceRecursive == nil || !*s.ForceRecursive) {
+		if tgtMatches && !forceCopy {
 			log.WithFields(logrus.Fields{
 				"source":   src.CommonName(),
 				"platform": s.Platform,
@@ -628,7 +633,12 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 			return nil
 		}
 	}
-	if tgtMatches {
+	if tgtMatches && (s.ForceRecursive == nil || !*s.ForceRecursive) {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"target": tgt.CommonName(),
+		}).Debug("Image matches, checking referrers")
+	} else if tgtMatches {
 		log.WithFields(logrus.Fields{
 			"source": src.CommonName(),
 			"target": tgt.CommonName(),
@@ -758,6 +768,9 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 	if s.ForceRecursive != nil && *s.ForceRecursive {
 		opts = append(opts, regclient.ImageWithForceRecursive())
 	}
+	if s.Referrers != nil && *s.Referrers {
+		opts = append(opts, regclient.ImageWithReferrers())
+	}
 	if len(s.Platforms) > 0 {
 		opts = append(opts, regclient.ImageWithPlatforms(s.Platforms))
 	}
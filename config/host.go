@@ -86,25 +86,26 @@ func (t *TLSConf) UnmarshalText(b []byte) error {
 
 // Host struct contains host specific settings
 type Host struct {
-	Name       string            `json:"-"`
-	Scheme     string            `json:"scheme,omitempty"` // TODO: deprecate, delete
-	TLS        TLSConf           `json:"tls,omitempty"`
-	RegCert    string            `json:"regcert,omitempty"`
-	ClientCert string            `json:"clientcert,omitempty"`
-	ClientKey  string            `json:"clientkey,omitempty"`
-	DNS        []string          `json:"dns,omitempty"`      // TODO: remove slice, single string, or remove entirely?
-	Hostname   string            `json:"hostname,omitempty"` // replaces DNS array with single string
-	User       string            `json:"user,omitempty"`
-	Pass       string            `json:"pass,omitempty"`
-	Token      string            `json:"token,omitempty"`
-	PathPrefix string            `json:"pathPrefix,omitempty"` // used for mirrors defined within a repository namespace
-	Mirrors    []string          `json:"mirrors,omitempty"`    // list of other Host Names to use as mirrors
-	Priority   uint              `json:"priority,omitempty"`   // priority when sorting mirrors, higher priority attempted first
-	RepoAuth   bool              `json:"repoAuth,omitempty"`   // tracks a separate auth per repo
-	API        string            `json:"api,omitempty"`        // experimental: registry API to use
-	APIOpts    map[string]string `json:"apiOpts,omitempty"`    // options for APIs
-	BlobChunk  int64             `json:"blobChunk,omitempty"`  // size of each blob chunk
-	BlobMax    int64             `json:"blobMax,omitempty"`    // threshold to switch to chunked upload, -1 to disable, 0 for regclient.blobMaxPut
+	Name        string            `json:"-"`
+	Scheme      string            `json:"scheme,omitempty"` // TODO: deprecate, delete
+	TLS         TLSConf           `json:"tls,omitempty"`
+	RegCert     string            `json:"regcert,omitempty"`
+	ClientCert  string            `json:"clientcert,omitempty"`
+	ClientKey   string            `json:"clientkey,omitempty"`
+	DNS         []string          `json:"dns,omitempty"`      // TODO: remove slice, single string, or remove entirely?
+	Hostname    string            `json:"hostname,omitempty"` // replaces DNS array with single string
+	User        string            `json:"user,omitempty"`
+	Pass        string            `json:"pass,omitempty"`
+	Token       string            `json:"token,omitempty"`
+	PathPrefix  string            `json:"pathPrefix,omitempty"`  // used for mirrors defined within a repository namespace
+	Mirrors     []string          `json:"mirrors,omitempty"`     // list of other Host Names to use as mirrors
+	Priority    uint              `json:"priority,omitempty"`    // priority when sorting mirrors, higher priority attempted first
+	RepoAuth    bool              `json:"repoAuth,omitempty"`    // tracks a separate auth per repo
+	API         string            `json:"api,omitempty"`         // experimental: registry API to use
+	APIOpts     map[string]string `json:"apiOpts,omitempty"`     // options for APIs
+	BlobChunk   int64             `json:"blobChunk,omitempty"`   // size of each blob chunk
+	BlobMax     int64             `json:"blobMax,omitempty"`     // threshold to switch to chunked upload, -1 to disable, 0 for regclient.blobMaxPut
+	BlobRecover int               `json:"blobRecover,omitempty"` // attempts to recover an interrupted chunked upload, -1 to disable, 0 for the default
 }
 
 // HostNew creates a default Host entry
@@ -322,6 +323,17 @@ func (host *Host) Merge(newHost Host, log *logrus.Logger) error {
 		host.BlobMax = newHost.BlobMax
 	}
 
+	if newHost.BlobRecover != 0 {
+		if host.BlobRecover != 0 && host.BlobRecover != newHost.BlobRecover {
+			log.WithFields(logrus.Fields{
+				"orig": host.BlobRecover,
+				"new":  newHost.BlobRecover,
+				"host": name,
+			}).Warn("Changing blobRecover settings for registry")
+		}
+		host.BlobRecover = newHost.BlobRecover
+	}
+
 	return nil
 }
 
@@ -9,7 +9,9 @@ import (
 	"io"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	// crypto libraries included for go-digest
@@ -20,12 +22,15 @@ import (
 	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/diff"
 	"github.com/regclient/regclient/types/docker/schema2"
 	"github.com/regclient/regclient/types/manifest"
 	v1 "github.com/regclient/regclient/types/oci/v1"
 	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -34,6 +39,8 @@ const (
 	ociIndexFilename       = "index.json"
 	ociLayoutFilename      = "oci-layout"
 	annotationRefName      = "org.opencontainers.image.ref.name"
+	annotationBaseName     = "org.opencontainers.image.base.name"
+	annotationBaseDigest   = "org.opencontainers.image.base.digest"
 	annotationImageName    = "io.containerd.image.name"
 )
 
@@ -71,10 +78,29 @@ type tarWriteData struct {
 }
 
 type imageOpt struct {
-	forceRecursive bool
-	digestTags     bool
-	platforms      []string
-	tagList        []string
+	checkBaseRef    string
+	checkBaseDigest digest.Digest
+	forceRecursive  bool
+	diffFiles       bool
+	digestTags      bool
+	parallel        int
+	platform        string
+	platforms       []string
+	progress        *progress
+	progressFn      func(ProgressEvent)
+	referrers       bool
+	tagList         []string
+	tagListErr      error
+	tagListOnce     sync.Once // tag list is only fetched once, without holding mu
+	mu              sync.Mutex
+	sem             *semaphore.Weighted
+	blobs           map[digest.Digest]*imageBlobCopy
+}
+
+// imageBlobCopy tracks a blob copy that may be shared between platforms
+type imageBlobCopy struct {
+	done chan struct{}
+	err  error
 }
 
 // ImageOpts define options for the Image* commands
@@ -95,6 +121,63 @@ func ImageWithDigestTags() ImageOpts {
 	}
 }
 
+// ImageWithParallel copies child manifests and blobs concurrently.
+// The value limits the number of blobs transferred at the same time.
+// Child manifests are still pushed before their parent.
+func ImageWithParallel(n int) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.parallel = n
+	}
+}
+
+// ImageWithProgress calls fn as blobs are copied or exported.
+// Calls to fn are serialized, and totals include every blob in the image.
+// Totals are tracked separately for each call using the option.
+func ImageWithProgress(fn func(ProgressEvent)) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.progressFn = fn
+	}
+}
+
+// ImageWithReferrers copies artifacts that have a subject pointing to the image.
+// Referrers of platform specific manifests and referrers of referrers are also copied.
+func ImageWithReferrers() ImageOpts {
+	return func(opts *imageOpt) {
+		opts.referrers = true
+	}
+}
+
+// ImageWithCheckBaseRef sets the base image for ImageCheckBase, overriding any annotations.
+func ImageWithCheckBaseRef(r string) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.checkBaseRef = r
+	}
+}
+
+// ImageWithCheckBaseDigest sets the expected digest of the base image for ImageCheckBase.
+// This is used with ImageWithCheckBaseRef, and without it the base layers are compared.
+func ImageWithCheckBaseDigest(d digest.Digest) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.checkBaseDigest = d
+	}
+}
+
+// ImageWithDiffFiles includes a comparison of the files in each layer with ImageDiff.
+// Every layer of both images is pulled when the layers differ.
+func ImageWithDiffFiles() ImageOpts {
+	return func(opts *imageOpt) {
+		opts.diffFiles = true
+	}
+}
+
+// ImageWithPlatform selects a single platform from a manifest list, e.g. "linux/amd64".
+// The local platform is used by default.
+func ImageWithPlatform(p string) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.platform = p
+	}
+}
+
 // ImageWithPlatforms only copies specific platforms from a manifest list.
 // This will result in a failure on many registries that validate manifests.
 // Use the empty string to indicate images without a platform definition should be copied.
@@ -113,6 +196,11 @@ func (rc *RegClient) ImageCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.R
 	for _, optFn := range opts {
 		optFn(&opt)
 	}
+	opt.progress = newProgress(opt.progressFn)
+	if opt.parallel > 1 {
+		opt.sem = semaphore.NewWeighted(int64(opt.parallel))
+		opt.blobs = map[digest.Digest]*imageBlobCopy{}
+	}
 	return rc.imageCopyOpt(ctx, refSrc, refTgt, types.Descriptor{}, false, &opt)
 }
 
@@ -127,7 +215,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 	if err != nil {
 		return fmt.Errorf("failed looking up scheme for %s: %v", refTgt.CommonName(), err)
 	}
-	if tgtSI.ManifestPushFirst {
+	if tgtSI.ManifestPushFirst && !opt.forceRecursive {
 		opt.forceRecursive = true
 	}
 	// check if source and destination already match
@@ -139,6 +227,9 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 			"target": refTgt.Reference,
 			"digest": mdh.GetDescriptor().Digest.String(),
 		}).Info("Copy not needed, target already up to date")
+		if opt.referrers {
+			return rc.imageCopyReferrersTree(ctx, refSrc, refTgt, d, opt)
+		}
 		return nil
 	} else if errD == nil && refTgt.Digest == "" {
 		msh, errS := rc.ManifestHead(ctx, refSrc)
@@ -148,6 +239,9 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 				"target": refTgt.Reference,
 				"digest": mdh.GetDescriptor().Digest.String(),
 			}).Info("Copy not needed, target already up to date")
+			if opt.referrers {
+				return rc.imageCopyReferrersTree(ctx, refSrc, refTgt, d, opt)
+			}
 			return nil
 		}
 	}
@@ -176,6 +270,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 
 	if !ref.EqualRepository(refSrc, refTgt) {
 		// copy components of the image if the repository is different
+		copyFns := []func(context.Context) error{}
 		if m.IsList() {
 			// manifest lists need to recursively copy nested images by digest
 			pd, err := m.GetManifestList()
@@ -196,38 +291,39 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 						continue
 					}
 				}
-				rc.log.WithFields(logrus.Fields{
-					"platform": entry.Platform,
-					"digest":   entry.Digest.String(),
-				}).Debug("Copy platform")
+				entry := entry
 				entrySrc := refSrc
 				entryTgt := refTgt
 				entrySrc.Tag = ""
 				entryTgt.Tag = ""
 				entrySrc.Digest = entry.Digest.String()
 				entryTgt.Digest = entry.Digest.String()
-				switch entry.MediaType {
-				case types.MediaTypeDocker1Manifest, types.MediaTypeDocker1ManifestSigned,
-					types.MediaTypeDocker2Manifest, types.MediaTypeDocker2ManifestList,
-					types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ManifestList:
-					// known manifest media type
-					err = rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
-				case types.MediaTypeDocker2ImageConfig, types.MediaTypeOCI1ImageConfig,
-					types.MediaTypeDocker2Layer, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip,
-					types.MediaTypeBuildkitCacheConfig:
-					// known blob media type
-					err = rc.BlobCopy(ctx, entrySrc, entryTgt, entry)
-				default:
-					// unknown media type, first try an image copy
-					err = rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
-					if err != nil {
-						// fall back to trying to copy a blob
-						err = rc.BlobCopy(ctx, entrySrc, entryTgt, entry)
+				copyFns = append(copyFns, func(ctx context.Context) error {
+					rc.log.WithFields(logrus.Fields{
+						"platform": entry.Platform,
+						"digest":   entry.Digest.String(),
+					}).Debug("Copy platform")
+					switch entry.MediaType {
+					case types.MediaTypeDocker1Manifest, types.MediaTypeDocker1ManifestSigned,
+						types.MediaTypeDocker2Manifest, types.MediaTypeDocker2ManifestList,
+						types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ManifestList:
+						// known manifest media type
+						return rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
+					case types.MediaTypeDocker2ImageConfig, types.MediaTypeOCI1ImageConfig,
+						types.MediaTypeDocker2Layer, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip, types.MediaTypeOCI1LayerZstd,
+						types.MediaTypeBuildkitCacheConfig:
+						// known blob media type
+						return rc.imageCopyBlob(ctx, entrySrc, entryTgt, entry, opt)
+					default:
+						// unknown media type, first try an image copy
+						err := rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
+						if err != nil {
+							// fall back to trying to copy a blob
+							err = rc.imageCopyBlob(ctx, entrySrc, entryTgt, entry, opt)
+						}
+						return err
 					}
-				}
-				if err != nil {
-					return err
-				}
+				})
 			}
 		} else {
 			// copy components of an image
@@ -243,20 +339,23 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 					return fmt.Errorf("failed to get config digest for %s: %w", refSrc.CommonName(), err)
 				}
 			} else {
-				rc.log.WithFields(logrus.Fields{
-					"source": refSrc.Reference,
-					"target": refTgt.Reference,
-					"digest": cd.Digest.String(),
-				}).Info("Copy config")
-				if err := rc.BlobCopy(ctx, refSrc, refTgt, cd); err != nil {
+				copyFns = append(copyFns, func(ctx context.Context) error {
 					rc.log.WithFields(logrus.Fields{
 						"source": refSrc.Reference,
 						"target": refTgt.Reference,
 						"digest": cd.Digest.String(),
-						"err":    err,
-					}).Warn("Failed to copy config")
-					return err
-				}
+					}).Info("Copy config")
+					if err := rc.imageCopyBlob(ctx, refSrc, refTgt, cd, opt); err != nil {
+						rc.log.WithFields(logrus.Fields{
+							"source": refSrc.Reference,
+							"target": refTgt.Reference,
+							"digest": cd.Digest.String(),
+							"err":    err,
+						}).Warn("Failed to copy config")
+						return err
+					}
+					return nil
+				})
 			}
 
 			// copy filesystem layers
@@ -275,22 +374,30 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 					}).Debug("Skipping external layer")
 					continue
 				}
-				rc.log.WithFields(logrus.Fields{
-					"source": refSrc.Reference,
-					"target": refTgt.Reference,
-					"layer":  layerSrc.Digest.String(),
-				}).Info("Copy layer")
-				if err := rc.BlobCopy(ctx, refSrc, refTgt, layerSrc); err != nil {
+				layerSrc := layerSrc
+				copyFns = append(copyFns, func(ctx context.Context) error {
 					rc.log.WithFields(logrus.Fields{
 						"source": refSrc.Reference,
 						"target": refTgt.Reference,
 						"layer":  layerSrc.Digest.String(),
-						"err":    err,
-					}).Warn("Failed to copy layer")
-					return err
-				}
+					}).Info("Copy layer")
+					if err := rc.imageCopyBlob(ctx, refSrc, refTgt, layerSrc, opt); err != nil {
+						rc.log.WithFields(logrus.Fields{
+							"source": refSrc.Reference,
+							"target": refTgt.Reference,
+							"layer":  layerSrc.Digest.String(),
+							"err":    err,
+						}).Warn("Failed to copy layer")
+						return err
+					}
+					return nil
+				})
 			}
 		}
+		err = opt.run(ctx, copyFns)
+		if err != nil {
+			return err
+		}
 	}
 
 	if !tgtSI.ManifestPushFirst {
@@ -305,29 +412,34 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 		}
 	}
 
+	// copy artifacts that refer to the manifest
+	if opt.referrers {
+		err = rc.imageCopyReferrers(ctx, refSrc, refTgt, m.GetDescriptor().Digest, opt)
+		if err != nil {
+			return err
+		}
+	}
+
 	// lookup digest tags to include artifacts with image
 	if opt.digestTags {
-		if len(opt.tagList) == 0 {
+		opt.tagListOnce.Do(func() {
 			tl, err := rc.TagList(ctx, refSrc)
 			if err != nil {
-				rc.log.WithFields(logrus.Fields{
-					"source": refSrc.Reference,
-					"err":    err,
-				}).Warn("Failed to list tags for digest-tag copy")
-				return err
-			}
-			tags, err := tl.GetTags()
-			if err != nil {
-				rc.log.WithFields(logrus.Fields{
-					"source": refSrc.Reference,
-					"err":    err,
-				}).Warn("Failed to list tags for digest-tag copy")
-				return err
+				opt.tagListErr = err
+				return
 			}
-			opt.tagList = tags
+			opt.tagList, opt.tagListErr = tl.GetTags()
+		})
+		if opt.tagListErr != nil {
+			rc.log.WithFields(logrus.Fields{
+				"source": refSrc.Reference,
+				"err":    opt.tagListErr,
+			}).Warn("Failed to list tags for digest-tag copy")
+			return opt.tagListErr
 		}
+		tagList := opt.tagList
 		prefix := fmt.Sprintf("%s-%s", m.GetDescriptor().Digest.Algorithm(), m.GetDescriptor().Digest.Encoded())
-		for _, tag := range opt.tagList {
+		for _, tag := range tagList {
 			if strings.HasPrefix(tag, prefix) {
 				refTagSrc := refSrc
 				refTagSrc.Tag = tag
@@ -351,6 +463,564 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 	return nil
 }
 
+// imageCopyReferrers copies each referrer of the digest from the source to the target repository
+func (rc *RegClient) imageCopyReferrers(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, dig digest.Digest, opt *imageOpt) error {
+	if ref.EqualRepository(refSrc, refTgt) {
+		// referrers are already in the same repository
+		return nil
+	}
+	refSrc.Tag = ""
+	refSrc.Digest = dig.String()
+	rl, err := rc.ReferrerList(ctx, refSrc)
+	if err != nil {
+		rc.log.WithFields(logrus.Fields{
+			"source": refSrc.CommonName(),
+			"err":    err,
+		}).Warn("Failed to list referrers")
+		return err
+	}
+	for _, rDesc := range rl.Descriptors {
+		rDesc := rDesc
+		refRSrc := refSrc
+		refRSrc.Digest = rDesc.Digest.String()
+		refRTgt := refTgt
+		refRTgt.Tag = ""
+		refRTgt.Digest = rDesc.Digest.String()
+		rc.log.WithFields(logrus.Fields{
+			"source":       refRSrc.CommonName(),
+			"target":       refRTgt.CommonName(),
+			"artifactType": rDesc.ArtifactType,
+		}).Info("Copy referrer")
+		err = rc.imageCopyOpt(ctx, refRSrc, refRTgt, rDesc, false, opt)
+		if err != nil {
+			rc.log.WithFields(logrus.Fields{
+				"source": refRSrc.CommonName(),
+				"target": refRTgt.CommonName(),
+				"err":    err,
+			}).Warn("Failed to copy referrer")
+			return err
+		}
+	}
+	return nil
+}
+
+// imageCopyReferrersTree copies referrers for a manifest that already exists in the target, including referrers of any child manifests
+func (rc *RegClient) imageCopyReferrersTree(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, opt *imageOpt) error {
+	m, err := rc.ManifestGet(ctx, refSrc, ManifestWithDesc(d))
+	if err != nil {
+		return err
+	}
+	err = rc.imageCopyReferrers(ctx, refSrc, refTgt, m.GetDescriptor().Digest, opt)
+	if err != nil {
+		return err
+	}
+	if !m.IsList() {
+		return nil
+	}
+	pd, err := m.GetManifestList()
+	if err != nil {
+		return err
+	}
+	for _, entry := range pd {
+		if len(opt.platforms) > 0 {
+			match, err := imagePlatformInList(entry.Platform, opt.platforms)
+			if err != nil {
+				return err
+			}
+			if !match {
+				continue
+			}
+		}
+		entrySrc := refSrc
+		entryTgt := refTgt
+		entrySrc.Tag = ""
+		entryTgt.Tag = ""
+		entrySrc.Digest = entry.Digest.String()
+		entryTgt.Digest = entry.Digest.String()
+		err = rc.imageCopyReferrersTree(ctx, entrySrc, entryTgt, entry, opt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageCopyBlob copies a single blob, waiting for a free slot when running in parallel.
+// Blobs shared between platforms are only transferred once.
+func (rc *RegClient) imageCopyBlob(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, opt *imageOpt) error {
+	bOpt := &blobOpt{progress: opt.progress}
+	if opt.sem == nil {
+		return rc.blobCopyOpt(ctx, refSrc, refTgt, d, bOpt)
+	}
+	opt.mu.Lock()
+	if bc, ok := opt.blobs[d.Digest]; ok {
+		opt.mu.Unlock()
+		select {
+		case <-bc.done:
+			return bc.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	bc := &imageBlobCopy{done: make(chan struct{})}
+	opt.blobs[d.Digest] = bc
+	opt.mu.Unlock()
+	defer close(bc.done)
+	bc.err = opt.sem.Acquire(ctx, 1)
+	if bc.err != nil {
+		return bc.err
+	}
+	defer opt.sem.Release(1)
+	bc.err = rc.blobCopyOpt(ctx, refSrc, refTgt, d, bOpt)
+	return bc.err
+}
+
+// run calls each copy function, concurrently when ImageWithParallel is used.
+// The first error is returned and cancels the context of remaining functions.
+func (opt *imageOpt) run(ctx context.Context, fns []func(context.Context) error) error {
+	if opt.sem == nil || len(fns) < 2 {
+		for _, fn := range fns {
+			err := fn(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	eg, egCtx := errgroup.WithContext(ctx)
+	for _, fn := range fns {
+		fn := fn
+		eg.Go(func() error {
+			return fn(egCtx)
+		})
+	}
+	return eg.Wait()
+}
+
+// ImageCheckBase returns nil if the base image of r is unchanged.
+// The base image is read from the "org.opencontainers.image.base.name" and "base.digest" annotations,
+// or set with ImageWithCheckBaseRef and ImageWithCheckBaseDigest.
+// Without a base digest, the layers of the base image must be the first layers of the image.
+// A types.ErrMismatch error is returned when the base image has changed.
+func (rc *RegClient) ImageCheckBase(ctx context.Context, r ref.Ref, opts ...ImageOpts) error {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest %s: %w", r.CommonName(), err)
+	}
+	baseName, baseDig := opt.checkBaseRef, opt.checkBaseDigest
+	if baseName == "" {
+		baseName, baseDig, err = rc.imageCheckBaseAnnotations(ctx, r, m, opt.platform)
+		if err != nil {
+			return err
+		}
+	}
+	if baseName == "" {
+		return fmt.Errorf("base image not found for %s: %w", r.CommonName(), types.ErrNotFound)
+	}
+	rBase, err := ref.New(baseName)
+	if err != nil {
+		return fmt.Errorf("failed to parse base image %s: %w", baseName, err)
+	}
+	if baseDig != "" {
+		return rc.imageCheckBaseDigest(ctx, rBase, baseDig)
+	}
+	return rc.imageCheckBaseLayers(ctx, r, m, rBase, opt.platform)
+}
+
+// imageCheckBaseAnnotations returns the base annotations, checking the platform manifest when the index has none
+func (rc *RegClient) imageCheckBaseAnnotations(ctx context.Context, r ref.Ref, m manifest.Manifest, p string) (string, digest.Digest, error) {
+	ma, ok := m.(manifest.Annotator)
+	if ok {
+		annot, err := ma.GetAnnotations()
+		if err != nil {
+			return "", "", err
+		}
+		if annot[annotationBaseName] != "" {
+			baseDig := digest.Digest(annot[annotationBaseDigest])
+			if baseDig != "" {
+				if err := baseDig.Validate(); err != nil {
+					return "", "", fmt.Errorf("invalid base digest annotation %s: %w", baseDig, err)
+				}
+			}
+			return annot[annotationBaseName], baseDig, nil
+		}
+	}
+	if !m.IsList() {
+		return "", "", nil
+	}
+	mPlat, err := rc.imageManifestPlatform(ctx, r, p)
+	if err != nil {
+		return "", "", err
+	}
+	return rc.imageCheckBaseAnnotations(ctx, r, mPlat, p)
+}
+
+// imageCheckBaseDigest compares the current base digest to the expected digest, including the platform digests of an index
+func (rc *RegClient) imageCheckBaseDigest(ctx context.Context, rBase ref.Ref, baseDig digest.Digest) error {
+	mBase, err := rc.ManifestHead(ctx, rBase)
+	if err != nil || mBase.GetDescriptor().Digest == "" {
+		mBase, err = rc.ManifestGet(ctx, rBase)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get base image %s: %w", rBase.CommonName(), err)
+	}
+	curDig := mBase.GetDescriptor().Digest
+	if curDig == baseDig {
+		rc.log.WithFields(logrus.Fields{
+			"base":   rBase.CommonName(),
+			"digest": curDig.String(),
+		}).Debug("Base image digest matches")
+		return nil
+	}
+	// the recorded digest may be a platform specific manifest from the base index
+	if mBase.IsList() {
+		if !mBase.IsSet() {
+			mBase, err = rc.ManifestGet(ctx, rBase)
+			if err != nil {
+				return fmt.Errorf("failed to get base image %s: %w", rBase.CommonName(), err)
+			}
+		}
+		dl, err := mBase.GetManifestList()
+		if err != nil {
+			return err
+		}
+		for _, d := range dl {
+			if d.Digest == baseDig {
+				rc.log.WithFields(logrus.Fields{
+					"base":   rBase.CommonName(),
+					"digest": d.Digest.String(),
+				}).Debug("Base image platform digest matches")
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("base image %s digest changed from %s to %s: %w", rBase.CommonName(), baseDig.String(), curDig.String(), types.ErrMismatch)
+}
+
+// imageCheckBaseLayers verifies the base image layers are the first layers of the image for each platform
+func (rc *RegClient) imageCheckBaseLayers(ctx context.Context, r ref.Ref, m manifest.Manifest, rBase ref.Ref, p string) error {
+	mBase, err := rc.ManifestGet(ctx, rBase)
+	if err != nil {
+		return fmt.Errorf("failed to get base image %s: %w", rBase.CommonName(), err)
+	}
+	images := []manifest.Manifest{m}
+	if m.IsList() {
+		images = []manifest.Manifest{}
+		dl, err := m.GetManifestList()
+		if err != nil {
+			return err
+		}
+		for _, d := range dl {
+			if d.Platform == nil || d.Platform.OS == "" || d.Platform.OS == "unknown" {
+				continue
+			}
+			if p != "" {
+				if ok, err := imagePlatformInList(d.Platform, []string{p}); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+			}
+			mPlat, err := rc.ManifestGet(ctx, r, ManifestWithDesc(d))
+			if err != nil {
+				return fmt.Errorf("failed to get manifest %s: %w", d.Digest.String(), err)
+			}
+			images = append(images, mPlat)
+		}
+	}
+	matched := 0
+	for _, mImg := range images {
+		mBasePlat := mBase
+		if mBase.IsList() {
+			plat, err := rc.imageCheckBasePlatform(ctx, r, mImg, p)
+			if err != nil {
+				return err
+			}
+			d, err := manifest.GetPlatformDesc(mBase, &plat)
+			if err != nil {
+				rc.log.WithFields(logrus.Fields{
+					"base":     rBase.CommonName(),
+					"platform": plat.String(),
+				}).Warn("Platform not found in base image")
+				continue
+			}
+			matched++
+			mBasePlat, err = rc.ManifestGet(ctx, rBase, ManifestWithDesc(*d))
+			if err != nil {
+				return fmt.Errorf("failed to get base image %s: %w", rBase.CommonName(), err)
+			}
+		}
+		baseLayers, err := mBasePlat.GetLayers()
+		if err != nil {
+			return err
+		}
+		layers, err := mImg.GetLayers()
+		if err != nil {
+			return err
+		}
+		if len(baseLayers) > len(layers) {
+			return fmt.Errorf("base image %s has more layers than %s: %w", rBase.CommonName(), r.CommonName(), types.ErrMismatch)
+		}
+		for i := range baseLayers {
+			if baseLayers[i].Digest != layers[i].Digest {
+				return fmt.Errorf("base image %s layer %d changed from %s to %s: %w", rBase.CommonName(), i, layers[i].Digest.String(), baseLayers[i].Digest.String(), types.ErrMismatch)
+			}
+		}
+		rc.log.WithFields(logrus.Fields{
+			"base":   rBase.CommonName(),
+			"image":  mImg.GetDescriptor().Digest.String(),
+			"layers": len(baseLayers),
+		}).Debug("Base image layers match")
+	}
+	if mBase.IsList() && matched == 0 {
+		return fmt.Errorf("no platforms from %s found in base image %s: %w", r.CommonName(), rBase.CommonName(), types.ErrNotFound)
+	}
+	return nil
+}
+
+// imageCheckBasePlatform returns the platform of an image from the config, falling back to the requested or local platform
+func (rc *RegClient) imageCheckBasePlatform(ctx context.Context, r ref.Ref, m manifest.Manifest, p string) (platform.Platform, error) {
+	cd, err := m.GetConfig()
+	if err == nil {
+		conf, err := rc.BlobGetOCIConfig(ctx, r, cd)
+		if err == nil && conf.GetConfig().OS != "" {
+			c := conf.GetConfig()
+			return platform.Platform{
+				OS:           c.OS,
+				Architecture: c.Architecture,
+				Variant:      c.Variant,
+				OSVersion:    c.OSVersion,
+			}, nil
+		}
+	}
+	if p != "" && p != "local" {
+		return platform.Parse(p)
+	}
+	return platform.Local(), nil
+}
+
+// ImageDiff compares two images, including the manifests, image configs, and layers.
+// Entries of an index are compared by platform, and ImageWithPlatforms limits the compared platforms.
+// Use ImageWithDiffFiles to also compare the files in the layers.
+func (rc *RegClient) ImageDiff(ctx context.Context, refOld ref.Ref, refNew ref.Ref, opts ...ImageOpts) (diff.Image, error) {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	result := diff.Image{
+		Old:       refOld.CommonName(),
+		New:       refNew.CommonName(),
+		Manifests: []diff.Manifest{},
+	}
+	mOld, err := rc.ManifestGet(ctx, refOld)
+	if err != nil {
+		return result, fmt.Errorf("failed to get manifest %s: %w", refOld.CommonName(), err)
+	}
+	mNew, err := rc.ManifestGet(ctx, refNew)
+	if err != nil {
+		return result, fmt.Errorf("failed to get manifest %s: %w", refNew.CommonName(), err)
+	}
+	err = rc.imageDiffManifest(ctx, refOld, refNew, mOld, mNew, "", &result, &opt)
+	return result, err
+}
+
+func (rc *RegClient) imageDiffManifest(ctx context.Context, refOld ref.Ref, refNew ref.Ref, mOld manifest.Manifest, mNew manifest.Manifest, plat string, result *diff.Image, opt *imageOpt) error {
+	dm := diff.Manifest{
+		Platform: plat,
+		Old:      mOld.GetDescriptor().Digest,
+		New:      mNew.GetDescriptor().Digest,
+		Changes:  []diff.Change{},
+	}
+	dm.Changes = append(dm.Changes, diff.Value("MediaType", mOld.GetDescriptor().MediaType, mNew.GetDescriptor().MediaType)...)
+	annotOld, annotNew := map[string]string{}, map[string]string{}
+	if ma, ok := mOld.(manifest.Annotator); ok {
+		if a, err := ma.GetAnnotations(); err == nil && a != nil {
+			annotOld = a
+		}
+	}
+	if ma, ok := mNew.(manifest.Annotator); ok {
+		if a, err := ma.GetAnnotations(); err == nil && a != nil {
+			annotNew = a
+		}
+	}
+	dm.Changes = append(dm.Changes, diff.Map("Annotations", annotOld, annotNew)...)
+	if dm.Old == dm.New {
+		result.Manifests = append(result.Manifests, dm)
+		return nil
+	}
+	// an index and an image cannot be compared beyond the media type
+	if mOld.IsList() != mNew.IsList() {
+		result.Manifests = append(result.Manifests, dm)
+		return nil
+	}
+
+	if mOld.IsList() {
+		platOld, err := imageDiffPlatforms(mOld)
+		if err != nil {
+			return err
+		}
+		platNew, err := imageDiffPlatforms(mNew)
+		if err != nil {
+			return err
+		}
+		platList := []string{}
+		for p := range platOld {
+			platList = append(platList, p)
+		}
+		for p := range platNew {
+			if _, ok := platOld[p]; !ok {
+				platList = append(platList, p)
+			}
+		}
+		sort.Strings(platList)
+		platMatch := []string{}
+		for _, p := range platList {
+			dOld, okOld := platOld[p]
+			dNew, okNew := platNew[p]
+			if len(opt.platforms) > 0 {
+				d := dOld
+				if !okOld {
+					d = dNew
+				}
+				if ok, err := imagePlatformInList(d.Platform, opt.platforms); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+			}
+			switch {
+			case okOld && !okNew:
+				dm.Changes = append(dm.Changes, diff.Change{Field: "Platforms", Action: diff.Removed, Old: p})
+			case !okOld && okNew:
+				dm.Changes = append(dm.Changes, diff.Change{Field: "Platforms", Action: diff.Added, New: p})
+			case dOld.Digest != dNew.Digest:
+				platMatch = append(platMatch, p)
+			}
+		}
+		result.Manifests = append(result.Manifests, dm)
+		for _, p := range platMatch {
+			rOld := refOld
+			rOld.Tag = ""
+			rOld.Digest = platOld[p].Digest.String()
+			rNew := refNew
+			rNew.Tag = ""
+			rNew.Digest = platNew[p].Digest.String()
+			mOldPlat, err := rc.ManifestGet(ctx, rOld)
+			if err != nil {
+				return fmt.Errorf("failed to get manifest %s: %w", rOld.CommonName(), err)
+			}
+			mNewPlat, err := rc.ManifestGet(ctx, rNew)
+			if err != nil {
+				return fmt.Errorf("failed to get manifest %s: %w", rNew.CommonName(), err)
+			}
+			err = rc.imageDiffManifest(ctx, refOld, refNew, mOldPlat, mNewPlat, p, result, opt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// compare the image config
+	cdOld, err := mOld.GetConfig()
+	if err != nil {
+		return err
+	}
+	cdNew, err := mNew.GetConfig()
+	if err != nil {
+		return err
+	}
+	dm.Changes = append(dm.Changes, diff.Value("Config", cdOld.Digest.String(), cdNew.Digest.String())...)
+	if cdOld.Digest != cdNew.Digest {
+		confOld, err := rc.BlobGetOCIConfig(ctx, refOld, cdOld)
+		if err != nil {
+			return fmt.Errorf("failed to get config %s: %w", cdOld.Digest.String(), err)
+		}
+		confNew, err := rc.BlobGetOCIConfig(ctx, refNew, cdNew)
+		if err != nil {
+			return fmt.Errorf("failed to get config %s: %w", cdNew.Digest.String(), err)
+		}
+		dm.Config = diff.Config(confOld.GetConfig(), confNew.GetConfig())
+	}
+	// compare the layers
+	layersOld, err := mOld.GetLayers()
+	if err != nil {
+		return err
+	}
+	layersNew, err := mNew.GetLayers()
+	if err != nil {
+		return err
+	}
+	dm.Layers = diff.Layers(layersOld, layersNew)
+	if opt.diffFiles && len(dm.Layers) > 0 {
+		flOld, err := rc.imageDiffFileList(ctx, refOld, layersOld)
+		if err != nil {
+			return err
+		}
+		flNew, err := rc.imageDiffFileList(ctx, refNew, layersNew)
+		if err != nil {
+			return err
+		}
+		dm.Files = diff.Files(flOld, flNew)
+	}
+	result.Manifests = append(result.Manifests, dm)
+	return nil
+}
+
+// imageDiffPlatforms returns the descriptors in an index by platform
+func imageDiffPlatforms(m manifest.Manifest) (map[string]types.Descriptor, error) {
+	dl, err := m.GetManifestList()
+	if err != nil {
+		return nil, err
+	}
+	platforms := map[string]types.Descriptor{}
+	for _, d := range dl {
+		p := ""
+		if d.Platform != nil {
+			p = d.Platform.String()
+		}
+		// entries without a unique platform are identified by the digest
+		if _, ok := platforms[p]; ok || p == "" {
+			p = d.Digest.String()
+		}
+		platforms[p] = d
+	}
+	return platforms, nil
+}
+
+// imageDiffFileList returns the files in the image after applying each layer
+func (rc *RegClient) imageDiffFileList(ctx context.Context, r ref.Ref, layers []types.Descriptor) (diff.FileList, error) {
+	fl := diff.FileList{}
+	for _, layer := range layers {
+		err := rc.imageDiffFileListLayer(ctx, r, layer, fl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fl, nil
+}
+
+func (rc *RegClient) imageDiffFileListLayer(ctx context.Context, r ref.Ref, layer types.Descriptor, fl diff.FileList) error {
+	br, err := rc.BlobGet(ctx, r, layer)
+	if err != nil {
+		return fmt.Errorf("failed to get layer %s: %w", layer.Digest.String(), err)
+	}
+	defer br.Close()
+	rdr, err := archive.Decompress(br)
+	if err != nil {
+		return fmt.Errorf("failed to decompress layer %s: %w", layer.Digest.String(), err)
+	}
+	err = fl.AddLayer(rdr)
+	if err != nil {
+		return fmt.Errorf("failed to read layer %s: %w", layer.Digest.String(), err)
+	}
+	return nil
+}
+
 // ImageExport exports an image to an output stream.
 // The format is compatible with "docker load" if a single image is selected and not a manifest list.
 // The ref must include a tag for exporting to docker (defaults to latest), and may also include a digest.
@@ -363,8 +1033,13 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 // index.json: created at top level, single descriptor with org.opencontainers.image.ref.name annotation pointing to the tag
 // manifest.json: created at top level, based on every layer added, only works for a single arch image
 // blobs/$algo/$hash: each content addressable object (manifest, config, or layer), created recursively
-func (rc *RegClient) ImageExport(ctx context.Context, ref ref.Ref, outStream io.Writer) error {
+func (rc *RegClient) ImageExport(ctx context.Context, ref ref.Ref, outStream io.Writer, opts ...ImageOpts) error {
 	var ociIndex v1.Index
+	opt := imageOpt{}
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	opt.progress = newProgress(opt.progressFn)
 
 	// create tar writer object
 	tw := tar.NewWriter(outStream)
@@ -442,7 +1117,7 @@ func (rc *RegClient) ImageExport(ctx context.Context, ref ref.Ref, outStream io.
 	}
 
 	// recursively include manifests and nested blobs
-	err = rc.imageExportDescriptor(ctx, ref, mDesc, twd)
+	err = rc.imageExportDescriptor(ctx, ref, mDesc, twd, &opt)
 	if err != nil {
 		return err
 	}
@@ -451,7 +1126,7 @@ func (rc *RegClient) ImageExport(ctx context.Context, ref ref.Ref, outStream io.
 }
 
 // imageExportDescriptor pulls a manifest or blob, outputs to a tar file, and recursively processes any nested manifests or blobs
-func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, desc types.Descriptor, twd *tarWriteData) error {
+func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, desc types.Descriptor, twd *tarWriteData, opt *imageOpt) error {
 	tarFilename := tarOCILayoutDescPath(desc)
 	if twd.files[tarFilename] {
 		// blob has already been imported into tar, skip
@@ -486,7 +1161,7 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 			return err
 		}
 		if err == nil {
-			err = rc.imageExportDescriptor(ctx, ref, confD, twd)
+			err = rc.imageExportDescriptor(ctx, ref, confD, twd, opt)
 			if err != nil {
 				return err
 			}
@@ -500,7 +1175,7 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 		}
 		if err == nil {
 			for _, layerD := range layerDL {
-				err = rc.imageExportDescriptor(ctx, ref, layerD, twd)
+				err = rc.imageExportDescriptor(ctx, ref, layerD, twd, opt)
 				if err != nil {
 					return err
 				}
@@ -533,7 +1208,7 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 			return err
 		}
 		for _, md := range mdl {
-			err = rc.imageExportDescriptor(ctx, ref, md, twd)
+			err = rc.imageExportDescriptor(ctx, ref, md, twd, opt)
 			if err != nil {
 				return err
 			}
@@ -541,7 +1216,9 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 
 	default:
 		// get blob
-		blobR, err := rc.BlobGet(ctx, ref, desc)
+		blobR, err := rc.BlobGet(ctx, ref, desc, func(bOpt *blobOpt) {
+			bOpt.progress = opt.progress
+		})
 		if err != nil {
 			return err
 		}
@@ -776,7 +1453,7 @@ func (rc *RegClient) imageImportOCIHandleManifest(ctx context.Context, ref ref.R
 					}
 					return rc.imageImportOCIHandleManifest(ctx, ref, md, trd, true)
 				case types.MediaTypeDocker2ImageConfig, types.MediaTypeOCI1ImageConfig,
-					types.MediaTypeDocker2Layer, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip,
+					types.MediaTypeDocker2Layer, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip, types.MediaTypeOCI1LayerZstd,
 					types.MediaTypeBuildkitCacheConfig:
 					// known blob media types
 					return rc.imageImportBlob(ctx, ref, d, trd)
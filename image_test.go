@@ -0,0 +1,898 @@
+package regclient
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/diff"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestImageCopy(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc := New(WithFS(fsMem))
+	// record pushes to verify each blob is copied once, and content is pushed before the manifest when required by the scheme
+	recs := map[string]*testRecordScheme{}
+	for _, name := range []string{"ocidir", "mem"} {
+		recs[name] = &testRecordScheme{API: rc.schemes[name]}
+		rc.schemes[name] = recs[name]
+	}
+	tests := []struct {
+		name string
+		src  string
+		tgt  string
+		opts []ImageOpts
+	}{
+		{
+			name: "image",
+			src:  "ocidir://testrepo:v1",
+			tgt:  "ocidir://testcopy:v1",
+		},
+		{
+			name: "index",
+			src:  "ocidir://testrepo:v3",
+			tgt:  "ocidir://testcopy:v3",
+		},
+		{
+			name: "parallel image",
+			src:  "ocidir://testrepo:v1",
+			tgt:  "ocidir://testparallel:v1",
+			opts: []ImageOpts{ImageWithParallel(3)},
+		},
+		{
+			name: "parallel index",
+			src:  "ocidir://testrepo:v3",
+			tgt:  "ocidir://testparallel:v3",
+			opts: []ImageOpts{ImageWithParallel(3), ImageWithDigestTags()},
+		},
+		{
+			name: "parallel single",
+			src:  "ocidir://testrepo:v2",
+			tgt:  "ocidir://testparallel:v2",
+			opts: []ImageOpts{ImageWithParallel(1)},
+		},
+		{
+			name: "to ocitar",
+			src:  "ocidir://testrepo:v3",
+			tgt:  "ocitar://testtar.tar:v3",
+		},
+		{
+			name: "from ocitar",
+			src:  "ocitar://testtar.tar:v3",
+			tgt:  "ocidir://testfromtar:v3",
+		},
+		{
+			name: "to ocitar gzip",
+			src:  "ocidir://testrepo:v1",
+			tgt:  "ocitar://testtar.tgz:v1",
+		},
+		{
+			name: "to mem",
+			src:  "ocidir://testrepo:v3",
+			tgt:  "mem://test/repo:v3",
+		},
+		{
+			name: "mem mount",
+			src:  "mem://test/repo:v3",
+			tgt:  "mem://test/mount:v3",
+		},
+		{
+			name: "from mem",
+			src:  "mem://test/mount:v3",
+			tgt:  "ocidir://testmem:v3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rSrc, err := ref.New(tt.src)
+			if err != nil {
+				t.Errorf("failed to parse src: %v", err)
+				return
+			}
+			rTgt, err := ref.New(tt.tgt)
+			if err != nil {
+				t.Errorf("failed to parse tgt: %v", err)
+				return
+			}
+			rec, recOK := recs[rTgt.Scheme]
+			if recOK {
+				rec.reset()
+			}
+			err = rc.ImageCopy(ctx, rSrc, rTgt, tt.opts...)
+			if err != nil {
+				t.Errorf("failed to copy: %v", err)
+				return
+			}
+			if recOK {
+				for d, count := range rec.blobs {
+					if count > 1 {
+						t.Errorf("blob %s copied %d times", d, count)
+					}
+				}
+				for _, e := range rec.errs {
+					t.Error(e)
+				}
+			}
+			err = rc.Close(ctx, rTgt)
+			if err != nil {
+				t.Errorf("failed to close target: %v", err)
+				return
+			}
+			mSrc, err := rc.ManifestHead(ctx, rSrc)
+			if err != nil {
+				t.Errorf("failed to head src: %v", err)
+				return
+			}
+			mTgt, err := rc.ManifestHead(ctx, rTgt)
+			if err != nil {
+				t.Errorf("failed to head tgt: %v", err)
+				return
+			}
+			if mSrc.GetDescriptor().Digest != mTgt.GetDescriptor().Digest {
+				t.Errorf("digest mismatch, src %s, tgt %s", mSrc.GetDescriptor().Digest, mTgt.GetDescriptor().Digest)
+			}
+			// export reads every blob, verifying the copy is complete
+			err = rc.ImageExport(ctx, rTgt, io.Discard)
+			if err != nil {
+				t.Errorf("failed to export tgt: %v", err)
+			}
+		})
+	}
+}
+
+// testRecordScheme wraps a scheme to count blob pushes and mounts and verify content is pushed before the manifests that reference it,
+// unless the scheme pushes the manifest first
+type testRecordScheme struct {
+	scheme.API
+	mu        sync.Mutex
+	blobs     map[digest.Digest]int
+	manifests map[digest.Digest]bool
+	errs      []string
+}
+
+func (s *testRecordScheme) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs = map[digest.Digest]int{}
+	s.manifests = map[digest.Digest]bool{}
+	s.errs = []string{}
+}
+
+func (s *testRecordScheme) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
+	d, err := s.API.BlobPut(ctx, r, d, rdr)
+	if err == nil {
+		s.mu.Lock()
+		s.blobs[d.Digest]++
+		s.mu.Unlock()
+	}
+	return d, err
+}
+
+func (s *testRecordScheme) BlobMount(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor) error {
+	err := s.API.BlobMount(ctx, refSrc, refTgt, d)
+	if err == nil {
+		s.mu.Lock()
+		s.blobs[d.Digest]++
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *testRecordScheme) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest, opts ...scheme.ManifestOpts) error {
+	s.mu.Lock()
+	if s.API.Info().ManifestPushFirst {
+		// ordering is not required
+	} else if m.IsList() {
+		dl, _ := m.GetManifestList()
+		for _, d := range dl {
+			if !s.manifests[d.Digest] {
+				s.errs = append(s.errs, fmt.Sprintf("manifest %s pushed before child %s", m.GetDescriptor().Digest, d.Digest))
+			}
+		}
+	} else {
+		dl, _ := m.GetLayers()
+		if cd, err := m.GetConfig(); err == nil {
+			dl = append(dl, cd)
+		}
+		for _, d := range dl {
+			if s.blobs[d.Digest] == 0 {
+				s.errs = append(s.errs, fmt.Sprintf("manifest %s pushed before blob %s", m.GetDescriptor().Digest, d.Digest))
+			}
+		}
+	}
+	s.mu.Unlock()
+	err := s.API.ManifestPut(ctx, r, m, opts...)
+	if err == nil {
+		s.mu.Lock()
+		s.manifests[m.GetDescriptor().Digest] = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *testRecordScheme) Close(ctx context.Context, r ref.Ref) error {
+	if sc, ok := s.API.(scheme.Closer); ok {
+		return sc.Close(ctx, r)
+	}
+	return nil
+}
+
+func TestImageCopyProgress(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc := New(WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Errorf("failed to parse src: %v", err)
+		return
+	}
+	rTgt, err := ref.New("ocidir://testprogress:v3")
+	if err != nil {
+		t.Errorf("failed to parse tgt: %v", err)
+		return
+	}
+	var last ProgressEvent
+	states := map[ProgressState]int{}
+	progressOpt := ImageWithProgress(func(e ProgressEvent) {
+		last = e
+		states[e.State]++
+	})
+	err = rc.ImageCopy(ctx, rSrc, rTgt, progressOpt)
+	if err != nil {
+		t.Errorf("failed to copy: %v", err)
+		return
+	}
+	if last.Total.Blobs == 0 || last.Total.Blobs != last.Total.BlobsDone {
+		t.Errorf("unexpected blob totals: %v", last.Total)
+	}
+	if last.Total.Bytes != last.Total.BytesDone {
+		t.Errorf("unexpected byte totals: %v", last.Total)
+	}
+	if states[ProgressStarted] != last.Total.Blobs || states[ProgressFinished]+states[ProgressExists] != last.Total.Blobs {
+		t.Errorf("unexpected states: %v", states)
+	}
+	// a second copy finds every blob in the target
+	rTgt2, err := ref.New("ocidir://testprogress:v3-copy")
+	if err != nil {
+		t.Errorf("failed to parse tgt: %v", err)
+		return
+	}
+	// reusing the option starts the totals over
+	firstTotal := last.Total
+	states = map[ProgressState]int{}
+	err = rc.ImageCopy(ctx, rSrc, rTgt2, progressOpt)
+	if err != nil {
+		t.Errorf("failed to copy: %v", err)
+		return
+	}
+	if states[ProgressFinished] != 0 || states[ProgressExists] == 0 {
+		t.Errorf("unexpected states on second copy: %v", states)
+	}
+	if last.Total != firstTotal {
+		t.Errorf("unexpected totals on second copy, expected %v, received %v", firstTotal, last.Total)
+	}
+}
+
+func TestImageCopyReferrers(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc := New(WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Errorf("failed to parse src: %v", err)
+		return
+	}
+	rTgt, err := ref.New("ocidir://testreferrers:v3")
+	if err != nil {
+		t.Errorf("failed to parse tgt: %v", err)
+		return
+	}
+	// push an empty config blob used by each artifact
+	emptyConfig := []byte("{}")
+	emptyDesc := types.Descriptor{
+		MediaType: types.MediaTypeOCI1Empty,
+		Digest:    digest.FromBytes(emptyConfig),
+		Size:      int64(len(emptyConfig)),
+	}
+	_, err = rc.BlobPut(ctx, rSrc, emptyDesc, bytes.NewReader(emptyConfig))
+	if err != nil {
+		t.Errorf("failed to put config: %v", err)
+		return
+	}
+	pushArtifact := func(subject types.Descriptor, at string) (types.Descriptor, error) {
+		m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+			Versioned:    v1.ManifestSchemaVersion,
+			MediaType:    types.MediaTypeOCI1Manifest,
+			ArtifactType: at,
+			Config:       emptyDesc,
+			Layers:       []types.Descriptor{},
+			Subject: &types.Descriptor{
+				MediaType: subject.MediaType,
+				Digest:    subject.Digest,
+				Size:      subject.Size,
+			},
+		}))
+		if err != nil {
+			return types.Descriptor{}, err
+		}
+		rPut := rSrc
+		rPut.Tag = ""
+		rPut.Digest = m.GetDescriptor().Digest.String()
+		return m.GetDescriptor(), rc.ManifestPut(ctx, rPut, m)
+	}
+	mSrc, err := rc.ManifestGet(ctx, rSrc)
+	if err != nil {
+		t.Errorf("failed to get src: %v", err)
+		return
+	}
+	pl, err := mSrc.GetManifestList()
+	if err != nil || len(pl) == 0 {
+		t.Errorf("failed to get platforms: %v", err)
+		return
+	}
+	// artifacts attached to the index, a platform, and another artifact
+	descSBOM, err := pushArtifact(mSrc.GetDescriptor(), "application/example.sbom")
+	if err != nil {
+		t.Errorf("failed to push artifact: %v", err)
+		return
+	}
+	descPlat, err := pushArtifact(pl[0], "application/example.sbom")
+	if err != nil {
+		t.Errorf("failed to push artifact: %v", err)
+		return
+	}
+	descSig, err := pushArtifact(descSBOM, "application/example.signature")
+	if err != nil {
+		t.Errorf("failed to push artifact: %v", err)
+		return
+	}
+	err = rc.ImageCopy(ctx, rSrc, rTgt, ImageWithReferrers())
+	if err != nil {
+		t.Errorf("failed to copy: %v", err)
+		return
+	}
+	checks := []struct {
+		subject  digest.Digest
+		referrer digest.Digest
+	}{
+		{subject: mSrc.GetDescriptor().Digest, referrer: descSBOM.Digest},
+		{subject: pl[0].Digest, referrer: descPlat.Digest},
+		{subject: descSBOM.Digest, referrer: descSig.Digest},
+	}
+	for _, c := range checks {
+		rCheck := rTgt
+		rCheck.Tag = ""
+		rCheck.Digest = c.subject.String()
+		rl, err := rc.ReferrerList(ctx, rCheck)
+		if err != nil {
+			t.Errorf("failed to list referrers for %s: %v", c.subject, err)
+			continue
+		}
+		if len(rl.Descriptors) != 1 || rl.Descriptors[0].Digest != c.referrer {
+			t.Errorf("unexpected referrers for %s: %v", c.subject, rl.Descriptors)
+		}
+	}
+	// referrers added after the image was copied are included in the next copy
+	descNew, err := pushArtifact(mSrc.GetDescriptor(), "application/example.new")
+	if err != nil {
+		t.Errorf("failed to push artifact: %v", err)
+		return
+	}
+	err = rc.ImageCopy(ctx, rSrc, rTgt, ImageWithReferrers())
+	if err != nil {
+		t.Errorf("failed to copy: %v", err)
+		return
+	}
+	rCheck := rTgt
+	rCheck.Tag = ""
+	rCheck.Digest = mSrc.GetDescriptor().Digest.String()
+	rl, err := rc.ReferrerList(ctx, rCheck)
+	if err != nil {
+		t.Errorf("failed to list referrers: %v", err)
+		return
+	}
+	if len(rl.Descriptors) != 2 || rl.Descriptors[1].Digest != descNew.Digest {
+		t.Errorf("unexpected referrers after second copy: %v", rl.Descriptors)
+	}
+	// a parallel copy pushes the referrers of each platform concurrently to the same index
+	platReferrers := map[digest.Digest]digest.Digest{pl[0].Digest: descPlat.Digest}
+	for _, d := range pl[1:] {
+		desc, err := pushArtifact(d, "application/example.sbom")
+		if err != nil {
+			t.Errorf("failed to push artifact: %v", err)
+			return
+		}
+		platReferrers[d.Digest] = desc.Digest
+	}
+	rTgtPar, err := ref.New("ocidir://testreferrersparallel:v3")
+	if err != nil {
+		t.Errorf("failed to parse tgt: %v", err)
+		return
+	}
+	// slow writes of the index to overlap concurrent updates
+	rcPar := New(WithFS(testSlowIndexFS{RWFS: fsMem}))
+	err = rcPar.ImageCopy(ctx, rSrc, rTgtPar, ImageWithReferrers(), ImageWithParallel(len(pl)))
+	if err != nil {
+		t.Errorf("failed to copy: %v", err)
+		return
+	}
+	for subject, referrer := range platReferrers {
+		rCheck := rTgtPar
+		rCheck.Tag = ""
+		rCheck.Digest = subject.String()
+		rl, err := rc.ReferrerList(ctx, rCheck)
+		if err != nil {
+			t.Errorf("failed to list referrers for %s: %v", subject, err)
+			continue
+		}
+		if len(rl.Descriptors) != 1 || rl.Descriptors[0].Digest != referrer {
+			t.Errorf("unexpected referrers for %s: %v", subject, rl.Descriptors)
+		}
+	}
+	_, err = rc.ManifestHead(ctx, rTgtPar)
+	if err != nil {
+		t.Errorf("failed to head tgt: %v", err)
+	}
+}
+
+// testSlowIndexFS delays writes to index.json to widen the window between reading and writing the index
+type testSlowIndexFS struct {
+	rwfs.RWFS
+}
+
+func (s testSlowIndexFS) Create(name string) (rwfs.WFile, error) {
+	if path.Base(name) == "index.json" {
+		time.Sleep(time.Millisecond * 5)
+	}
+	return s.RWFS.Create(name)
+}
+
+func TestImageDiff(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc := New(WithFS(fsMem))
+	r1, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	r2, err := ref.New("ocidir://testrepo:v2")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	r3, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+
+	t.Run("Same", func(t *testing.T) {
+		result, err := rc.ImageDiff(ctx, r1, r1)
+		if err != nil {
+			t.Errorf("failed to diff: %v", err)
+			return
+		}
+		if !result.IsEmpty() {
+			t.Errorf("unexpected differences: %v", result)
+		}
+	})
+	t.Run("Platforms", func(t *testing.T) {
+		result, err := rc.ImageDiff(ctx, r1, r3)
+		if err != nil {
+			t.Errorf("failed to diff: %v", err)
+			return
+		}
+		if len(result.Manifests) != 3 {
+			t.Errorf("unexpected number of manifests: %d", len(result.Manifests))
+			return
+		}
+		added := []string{}
+		for _, c := range result.Manifests[0].Changes {
+			if c.Field == "Platforms" && c.Action == diff.Added {
+				added = append(added, c.New)
+			}
+		}
+		if len(added) != 2 || added[0] != "linux/arm/v6" || added[1] != "linux/arm/v7" {
+			t.Errorf("unexpected platforms added: %v", added)
+		}
+	})
+	t.Run("Files", func(t *testing.T) {
+		result, err := rc.ImageDiff(ctx, r1, r2, ImageWithPlatforms([]string{"linux/amd64"}), ImageWithDiffFiles())
+		if err != nil {
+			t.Errorf("failed to diff: %v", err)
+			return
+		}
+		if len(result.Manifests) != 2 {
+			t.Errorf("unexpected number of manifests: %d", len(result.Manifests))
+			return
+		}
+		dm := result.Manifests[1]
+		if dm.Platform != "linux/amd64" {
+			t.Errorf("unexpected platform: %s", dm.Platform)
+		}
+		foundLabel := false
+		for _, c := range dm.Config {
+			if c.Field == "Labels" && c.Key == "version" && c.Old == "1" && c.New == "2" {
+				foundLabel = true
+			}
+		}
+		if !foundLabel {
+			t.Errorf("label change not found: %v", dm.Config)
+		}
+		if len(dm.Layers) != 1 || dm.Layers[0].Action != diff.Added || dm.Layers[0].Index != 1 {
+			t.Errorf("unexpected layers: %v", dm.Layers)
+		}
+		if len(dm.Files) != 1 || dm.Files[0].Path != "/layer2" || dm.Files[0].Action != diff.Added {
+			t.Errorf("unexpected files: %v", dm.Files)
+		}
+	})
+}
+
+func TestImageFS(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc := New(WithFS(fsMem))
+	r, err := ref.New("ocidir://testfs:latest")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	type tarFile struct {
+		name     string
+		typeflag byte
+		content  string
+		linkname string
+	}
+	layers := [][]tarFile{
+		{
+			{name: "etc/", typeflag: tar.TypeDir},
+			{name: "etc/a", typeflag: tar.TypeReg, content: "a"},
+			{name: "etc/b", typeflag: tar.TypeReg, content: "b"},
+			{name: "opt/old/file", typeflag: tar.TypeReg, content: "old"},
+			{name: "usr/bin/app", typeflag: tar.TypeReg, content: "app"},
+			{name: "usr/bin/link", typeflag: tar.TypeLink, linkname: "usr/bin/app"},
+			{name: "usr/bin/tool", typeflag: tar.TypeReg, content: "tool"},
+			{name: "usr/bin/tool-link", typeflag: tar.TypeLink, linkname: "usr/bin/tool"},
+		},
+		{
+			{name: "etc/.wh.b", typeflag: tar.TypeReg},
+			{name: "etc/a", typeflag: tar.TypeReg, content: "changed"},
+			{name: "opt/.wh..wh..opq", typeflag: tar.TypeReg},
+			{name: "opt/new", typeflag: tar.TypeReg, content: "new"},
+			{name: "bin", typeflag: tar.TypeSymlink, linkname: "usr/bin"},
+			{name: "usr/bin/tool", typeflag: tar.TypeReg, content: "tool2"},
+		},
+	}
+	layerDescs := []types.Descriptor{}
+	for _, files := range layers {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, f := range files {
+			mode := int64(0644)
+			if f.typeflag == tar.TypeDir || f.typeflag == tar.TypeSymlink {
+				mode = 0755
+			}
+			err = tw.WriteHeader(&tar.Header{
+				Name:     f.name,
+				Typeflag: f.typeflag,
+				Mode:     mode,
+				Size:     int64(len(f.content)),
+				Linkname: f.linkname,
+			})
+			if err != nil {
+				t.Errorf("failed to write tar header: %v", err)
+				return
+			}
+			_, err = tw.Write([]byte(f.content))
+			if err != nil {
+				t.Errorf("failed to write tar content: %v", err)
+				return
+			}
+		}
+		tw.Close()
+		d := types.Descriptor{
+			MediaType: types.MediaTypeOCI1Layer,
+			Digest:    digest.FromBytes(buf.Bytes()),
+			Size:      int64(buf.Len()),
+		}
+		_, err = rc.BlobPut(ctx, r, d, bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Errorf("failed to put layer: %v", err)
+			return
+		}
+		layerDescs = append(layerDescs, d)
+	}
+	confRaw := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"}}`)
+	confDesc := types.Descriptor{
+		MediaType: types.MediaTypeOCI1ImageConfig,
+		Digest:    digest.FromBytes(confRaw),
+		Size:      int64(len(confRaw)),
+	}
+	_, err = rc.BlobPut(ctx, r, confDesc, bytes.NewReader(confRaw))
+	if err != nil {
+		t.Errorf("failed to put config: %v", err)
+		return
+	}
+	m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: types.MediaTypeOCI1Manifest,
+		Config:    confDesc,
+		Layers:    layerDescs,
+	}))
+	if err != nil {
+		t.Errorf("failed to create manifest: %v", err)
+		return
+	}
+	err = rc.ManifestPut(ctx, r, m)
+	if err != nil {
+		t.Errorf("failed to put manifest: %v", err)
+		return
+	}
+
+	fsys, err := rc.ImageFS(ctx, r)
+	if err != nil {
+		t.Errorf("failed to create image fs: %v", err)
+		return
+	}
+	t.Run("Files", func(t *testing.T) {
+		tests := map[string]string{
+			"etc/a":             "changed",
+			"opt/new":           "new",
+			"usr/bin/app":       "app",
+			"usr/bin/link":      "app",
+			"usr/bin/tool":      "tool2",
+			"usr/bin/tool-link": "tool",
+			"bin/app":           "app",
+			"bin/tool":          "tool2",
+		}
+		for name, expect := range tests {
+			b, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				t.Errorf("failed to read %s: %v", name, err)
+				continue
+			}
+			if string(b) != expect {
+				t.Errorf("unexpected content for %s: %s", name, b)
+			}
+		}
+		for _, name := range []string{"etc/b", "opt/old", "opt/old/file", "missing"} {
+			if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("unexpected result for %s: %v", name, err)
+			}
+		}
+	})
+	t.Run("ReadDir", func(t *testing.T) {
+		tests := map[string][]string{
+			".":   {"bin", "etc", "opt", "usr"},
+			"etc": {"a"},
+			"opt": {"new"},
+			"bin": {"app", "link", "tool", "tool-link"},
+		}
+		for name, expect := range tests {
+			entries, err := fs.ReadDir(fsys, name)
+			if err != nil {
+				t.Errorf("failed to read dir %s: %v", name, err)
+				continue
+			}
+			names := []string{}
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(expect, ",") {
+				t.Errorf("unexpected entries in %s: %v", name, names)
+			}
+		}
+		fi, err := fs.Stat(fsys, "usr/bin/link")
+		if err != nil || fi.Size() != 3 {
+			t.Errorf("unexpected hardlink stat: %v, %v", fi, err)
+		}
+	})
+	t.Run("ExportRootFS", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := rc.ImageExportRootFS(ctx, r, buf)
+		if err != nil {
+			t.Errorf("failed to export rootfs: %v", err)
+			return
+		}
+		expect := map[string]string{
+			"etc/":              "",
+			"etc/a":             "changed",
+			"opt/":              "",
+			"opt/new":           "new",
+			"usr/":              "",
+			"usr/bin/":          "",
+			"usr/bin/app":       "app",
+			"usr/bin/link":      "",
+			"usr/bin/tool":      "tool2",
+			"usr/bin/tool-link": "tool",
+			"bin":               "",
+		}
+		found := map[string]bool{}
+		tr := tar.NewReader(buf)
+		for {
+			th, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("failed to read tar: %v", err)
+				return
+			}
+			content, ok := expect[th.Name]
+			if !ok {
+				t.Errorf("unexpected entry: %s", th.Name)
+				continue
+			}
+			if found[th.Name] {
+				t.Errorf("duplicate entry: %s", th.Name)
+			}
+			found[th.Name] = true
+			b, err := io.ReadAll(tr)
+			if err != nil || string(b) != content {
+				t.Errorf("unexpected content for %s: %s, %v", th.Name, b, err)
+			}
+			if th.Name == "usr/bin/link" && (th.Typeflag != tar.TypeLink || th.Linkname != "usr/bin/app") {
+				t.Errorf("unexpected hardlink: %v", th)
+			}
+			// the hardlink target was replaced in a higher layer
+			if th.Name == "usr/bin/tool-link" && th.Typeflag != tar.TypeReg {
+				t.Errorf("unexpected replaced hardlink: %v", th)
+			}
+		}
+		if len(found) != len(expect) {
+			t.Errorf("missing entries, expected %v, found %v", expect, found)
+		}
+	})
+}
+
+func TestImageCheckBase(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc := New(WithFS(fsMem))
+	r1, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	r2, err := ref.New("ocidir://testrepo:v2")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	rAnnot, err := ref.New("ocidir://testrepo:annotated")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	m1, err := rc.ManifestHead(ctx, r1)
+	if err != nil {
+		t.Errorf("failed to head base: %v", err)
+		return
+	}
+	// create an image with base annotations from the amd64 image in v2
+	m2, err := rc.ManifestGet(ctx, r2)
+	if err != nil {
+		t.Errorf("failed to get image: %v", err)
+		return
+	}
+	plat, err := platform.Parse("linux/amd64")
+	if err != nil {
+		t.Errorf("failed to parse platform: %v", err)
+		return
+	}
+	d2, err := manifest.GetPlatformDesc(m2, &plat)
+	if err != nil {
+		t.Errorf("failed to get platform: %v", err)
+		return
+	}
+	m2Plat, err := rc.ManifestGet(ctx, r2, ManifestWithDesc(*d2))
+	if err != nil {
+		t.Errorf("failed to get image: %v", err)
+		return
+	}
+	ociM, err := manifest.OCIManifestFromAny(m2Plat.GetOrig())
+	if err != nil {
+		t.Errorf("failed to convert manifest: %v", err)
+		return
+	}
+	ociM.Annotations = map[string]string{
+		annotationBaseName:   r1.CommonName(),
+		annotationBaseDigest: m1.GetDescriptor().Digest.String(),
+	}
+	mAnnot, err := manifest.New(manifest.WithOrig(ociM))
+	if err != nil {
+		t.Errorf("failed to create manifest: %v", err)
+		return
+	}
+	err = rc.ManifestPut(ctx, rAnnot, mAnnot)
+	if err != nil {
+		t.Errorf("failed to put manifest: %v", err)
+		return
+	}
+
+	t.Run("Annotations", func(t *testing.T) {
+		err := rc.ImageCheckBase(ctx, rAnnot)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	t.Run("Digest changed", func(t *testing.T) {
+		err := rc.ImageCheckBase(ctx, rAnnot, ImageWithCheckBaseRef(r1.CommonName()), ImageWithCheckBaseDigest(digest.FromString("old base")))
+		if !errors.Is(err, types.ErrMismatch) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	t.Run("Layers", func(t *testing.T) {
+		err := rc.ImageCheckBase(ctx, r2, ImageWithCheckBaseRef(r1.CommonName()))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	t.Run("Layers changed", func(t *testing.T) {
+		err := rc.ImageCheckBase(ctx, r1, ImageWithCheckBaseRef(r2.CommonName()))
+		if !errors.Is(err, types.ErrMismatch) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	t.Run("Missing base", func(t *testing.T) {
+		err := rc.ImageCheckBase(ctx, r1)
+		if !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
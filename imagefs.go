@@ -0,0 +1,724 @@
+package regclient
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/regclient/regclient/internal/whiteout"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+const (
+	imageFSLinkMax = 40
+)
+
+// imageFS is a read-only view of the merged layers of an image
+type imageFS struct {
+	ctx    context.Context
+	rc     *RegClient
+	r      ref.Ref
+	layers []*imageFSLayer
+}
+
+// imageFSLayer is the index of a single layer, loaded on first use
+type imageFSLayer struct {
+	desc      types.Descriptor
+	mu        sync.Mutex
+	loaded    bool
+	entries   map[string]*imageFSEntry
+	children  map[string][]string
+	whiteouts map[string]bool
+	opaque    map[string]bool
+}
+
+// imageFSEntry is a path found in a layer
+type imageFSEntry struct {
+	hdr      *tar.Header
+	implicit bool // parent directory without a header in the layer
+	layer    int
+	pos      int // position of the header in the layer tar
+}
+
+// imageFSExport tracks the paths written when exporting the flattened filesystem from the top layer down
+type imageFSExport struct {
+	ifs      *imageFS
+	tw       *tar.Writer
+	wl       *whiteout.Layers
+	written  map[string]int  // layer of each path written
+	implicit map[string]bool // directories without a header
+	links    []imageFSExportLink
+}
+
+// imageFSExportLink is a hardlink written after the target is found in a lower layer
+type imageFSExportLink struct {
+	hdr   *tar.Header
+	layer int
+}
+
+// imageFSDir is returned when opening a directory
+type imageFSDir struct {
+	ifs     *imageFS
+	name    string
+	entry   *imageFSEntry
+	entries []fs.DirEntry
+	offset  int
+	listed  bool
+}
+
+// imageFSFile is returned when opening any other file, the content is streamed from the layer on the first read
+type imageFSFile struct {
+	ifs    *imageFS
+	name   string
+	entry  *imageFSEntry
+	rdr    io.Reader
+	closer io.Closer
+	closed bool
+}
+
+var (
+	_ fs.ReadDirFS   = (*imageFS)(nil)
+	_ fs.StatFS      = (*imageFS)(nil)
+	_ fs.ReadDirFile = (*imageFSDir)(nil)
+)
+
+// ImageFS returns a read-only filesystem with the merged content of each layer of an image.
+// The platform is selected with ImageWithPlatform when the reference is a manifest list.
+// Layers are only pulled when needed to lookup a path, and file contents are streamed from the blob.
+// The returned filesystem also implements fs.ReadDirFS and fs.StatFS.
+// The Sys method of each fs.FileInfo returns the *tar.Header from the layer.
+func (rc *RegClient) ImageFS(ctx context.Context, r ref.Ref, opts ...ImageOpts) (fs.FS, error) {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	return rc.imageFSNew(ctx, r, &opt)
+}
+
+// ImageExportRootFS writes a tar of the flattened filesystem of an image, similar to "docker export".
+// The platform is selected with ImageWithPlatform when the reference is a manifest list.
+// Files removed by a whiteout or replaced in a later layer are not included.
+// Each layer is read once, starting from the top layer.
+func (rc *RegClient) ImageExportRootFS(ctx context.Context, r ref.Ref, w io.Writer, opts ...ImageOpts) error {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	ifs, err := rc.imageFSNew(ctx, r, &opt)
+	if err != nil {
+		return err
+	}
+	ew := &imageFSExport{
+		ifs:      ifs,
+		tw:       tar.NewWriter(w),
+		wl:       whiteout.NewLayers(),
+		written:  map[string]int{},
+		implicit: map[string]bool{},
+	}
+	for i := len(ifs.layers) - 1; i >= 0; i-- {
+		err = ew.layer(i)
+		if err != nil {
+			return err
+		}
+		ew.wl.Next()
+	}
+	err = ew.finish()
+	if err != nil {
+		return err
+	}
+	return ew.tw.Close()
+}
+
+func (rc *RegClient) imageFSNew(ctx context.Context, r ref.Ref, opt *imageOpt) (*imageFS, error) {
+	m, err := rc.imageManifestPlatform(ctx, r, opt.platform)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := m.GetLayers()
+	if err != nil {
+		return nil, err
+	}
+	ifs := &imageFS{
+		ctx:    ctx,
+		rc:     rc,
+		r:      r,
+		layers: make([]*imageFSLayer, len(layers)),
+	}
+	for i, l := range layers {
+		ifs.layers[i] = &imageFSLayer{desc: l}
+	}
+	return ifs, nil
+}
+
+// imageManifestPlatform returns the manifest for a platform when the reference is a manifest list
+func (rc *RegClient) imageManifestPlatform(ctx context.Context, r ref.Ref, p string) (manifest.Manifest, error) {
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return m, fmt.Errorf("failed to get manifest %s: %w", r.CommonName(), err)
+	}
+	if !m.IsList() {
+		return m, nil
+	}
+	plat := platform.Local()
+	if p != "" && p != "local" {
+		plat, err = platform.Parse(p)
+		if err != nil {
+			return m, fmt.Errorf("failed to parse platform %s: %w", p, err)
+		}
+	}
+	d, err := manifest.GetPlatformDesc(m, &plat)
+	if err != nil {
+		return m, fmt.Errorf("platform %s not found in %s: %w", plat.String(), r.CommonName(), err)
+	}
+	m, err = rc.ManifestGet(ctx, r, ManifestWithDesc(*d))
+	if err != nil {
+		return m, fmt.Errorf("failed to get manifest %s: %w", d.Digest.String(), err)
+	}
+	return m, nil
+}
+
+// Open returns the file, following any symlinks
+func (ifs *imageFS) Open(name string) (fs.File, error) {
+	name, entry, err := ifs.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.hdr.Typeflag == tar.TypeDir {
+		return &imageFSDir{ifs: ifs, name: name, entry: entry}, nil
+	}
+	return &imageFSFile{ifs: ifs, name: name, entry: entry}, nil
+}
+
+// ReadDir returns the sorted list of entries in a directory
+func (ifs *imageFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name, entry, err := ifs.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.hdr.Typeflag != tar.TypeDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return ifs.readDir(name)
+}
+
+// Stat returns the file info, following any symlinks
+func (ifs *imageFS) Stat(name string) (fs.FileInfo, error) {
+	_, entry, err := ifs.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.hdr.FileInfo(), nil
+}
+
+// resolve returns the entry for a path after following any symlinks
+func (ifs *imageFS) resolve(op, name string) (string, *imageFSEntry, error) {
+	if !fs.ValidPath(name) {
+		return name, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	orig := name
+	for links := 0; links <= imageFSLinkMax; {
+		cur := "."
+		parts := []string{}
+		if name != "." {
+			parts = strings.Split(name, "/")
+		}
+		restart := false
+		for i, part := range parts {
+			cur = path.Join(cur, part)
+			entry, err := ifs.lookup(cur)
+			if err != nil {
+				return orig, nil, &fs.PathError{Op: op, Path: orig, Err: err}
+			}
+			if entry.hdr.Typeflag == tar.TypeSymlink {
+				links++
+				target := entry.hdr.Linkname
+				if !path.IsAbs(target) {
+					target = path.Join(path.Dir(cur), target)
+				}
+				target = strings.TrimPrefix(path.Clean("/"+target), "/")
+				if target == "" {
+					target = "."
+				}
+				name = path.Join(append([]string{target}, parts[i+1:]...)...)
+				restart = true
+				break
+			}
+			if i < len(parts)-1 && entry.hdr.Typeflag != tar.TypeDir {
+				return orig, nil, &fs.PathError{Op: op, Path: orig, Err: fs.ErrNotExist}
+			}
+		}
+		if restart {
+			continue
+		}
+		entry, err := ifs.lookup(name)
+		if err != nil {
+			return orig, nil, &fs.PathError{Op: op, Path: orig, Err: err}
+		}
+		return name, entry, nil
+	}
+	return orig, nil, &fs.PathError{Op: op, Path: orig, Err: fmt.Errorf("too many levels of symbolic links")}
+}
+
+// lookup returns the entry for a path from the top most layer without resolving symlinks
+func (ifs *imageFS) lookup(name string) (*imageFSEntry, error) {
+	if name == "." {
+		return imageFSRoot(), nil
+	}
+	var implicit *imageFSEntry
+	for i := len(ifs.layers) - 1; i >= 0; i-- {
+		l, err := ifs.layer(i)
+		if err != nil {
+			return nil, err
+		}
+		if entry, ok := l.entries[name]; ok {
+			if !entry.implicit {
+				return entry, nil
+			}
+			if implicit == nil {
+				implicit = entry
+			}
+		}
+		if l.hides(name) {
+			break
+		}
+	}
+	if implicit != nil {
+		return implicit, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+// readDir merges the children of a directory from each layer
+func (ifs *imageFS) readDir(name string) ([]fs.DirEntry, error) {
+	names := map[string]bool{}
+	for i := len(ifs.layers) - 1; i >= 0; i-- {
+		l, err := ifs.layer(i)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range l.children[name] {
+			names[child] = true
+		}
+		if l.opaque[name] || (name != "." && l.hides(name)) {
+			break
+		}
+	}
+	entries := []fs.DirEntry{}
+	for child := range names {
+		entry, err := ifs.lookup(child)
+		if err != nil {
+			// removed by a whiteout in a higher layer
+			continue
+		}
+		entries = append(entries, imageFSDirEntry{fi: entry.hdr.FileInfo()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// layer returns the index for a layer, reading the layer on first use
+func (ifs *imageFS) layer(i int) (*imageFSLayer, error) {
+	l := ifs.layers[i]
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.loaded {
+		return l, nil
+	}
+	l.entries = map[string]*imageFSEntry{}
+	l.children = map[string][]string{}
+	l.whiteouts = map[string]bool{}
+	l.opaque = map[string]bool{}
+	tr, closer, err := ifs.layerReader(l.desc)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	for pos := 0; ; pos++ {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %s: %w", l.desc.Digest.String(), err)
+		}
+		name := imageFSClean(th.Name)
+		if name == "." {
+			continue
+		}
+		dir := path.Dir(name)
+		if target, opaque, ok := whiteout.Parse(name); ok {
+			if opaque {
+				l.opaque[target] = true
+			} else {
+				l.whiteouts[target] = true
+			}
+			l.addParents(dir, i)
+			continue
+		}
+		hdr := *th
+		hdr.Name = name
+		if hdr.Typeflag == tar.TypeLink {
+			// hardlinks report the size of the target in the same layer
+			if target, ok := l.entries[imageFSClean(hdr.Linkname)]; ok && target.hdr.Typeflag == tar.TypeReg {
+				hdr.Size = target.hdr.Size
+			}
+		}
+		if _, ok := l.entries[name]; !ok {
+			l.children[dir] = append(l.children[dir], name)
+		}
+		l.entries[name] = &imageFSEntry{hdr: &hdr, layer: i, pos: pos}
+		l.addParents(dir, i)
+	}
+	l.loaded = true
+	return l, nil
+}
+
+// layerReader returns a tar reader for the uncompressed layer
+func (ifs *imageFS) layerReader(d types.Descriptor) (*tar.Reader, io.Closer, error) {
+	br, err := ifs.rc.BlobGet(ifs.ctx, ifs.r, d)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get layer %s: %w", d.Digest.String(), err)
+	}
+	rdr, err := archive.Decompress(br)
+	if err != nil {
+		br.Close()
+		return nil, nil, fmt.Errorf("failed to decompress layer %s: %w", d.Digest.String(), err)
+	}
+	return tar.NewReader(rdr), br, nil
+}
+
+// content returns the header and a reader for the file content from the layer
+func (ifs *imageFS) content(entry *imageFSEntry) (*tar.Header, io.Reader, io.Closer, error) {
+	name := entry.hdr.Name
+	for links := 0; links <= imageFSLinkMax; links++ {
+		tr, closer, err := ifs.layerReader(ifs.layers[entry.layer].desc)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for {
+			th, err := tr.Next()
+			if err == io.EOF {
+				closer.Close()
+				return nil, nil, nil, fmt.Errorf("%s not found in layer: %w", name, fs.ErrNotExist)
+			}
+			if err != nil {
+				closer.Close()
+				return nil, nil, nil, err
+			}
+			if imageFSClean(th.Name) != name {
+				continue
+			}
+			if th.Typeflag == tar.TypeLink {
+				// read the hardlink target from the same layer
+				closer.Close()
+				name = imageFSClean(th.Linkname)
+				break
+			}
+			return th, tr, closer, nil
+		}
+	}
+	return nil, nil, nil, fmt.Errorf("too many hardlinks for %s", entry.hdr.Name)
+}
+
+// layer writes the entries from a layer that are not removed or replaced by a higher layer
+func (ew *imageFSExport) layer(i int) error {
+	tr, closer, err := ew.ifs.layerReader(ew.ifs.layers[i].desc)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read layer %s: %w", ew.ifs.layers[i].desc.Digest.String(), err)
+		}
+		name := imageFSClean(th.Name)
+		if name == "." {
+			continue
+		}
+		if target, opaque, ok := whiteout.Parse(name); ok {
+			if !ew.wl.Hidden(target) {
+				ew.wl.AddWhiteout(target, opaque)
+				ew.parents(path.Dir(name))
+			}
+			continue
+		}
+		isDir := th.Typeflag == tar.TypeDir
+		if !ew.wl.Add(name, isDir) {
+			// a directory implied by a higher entry uses the first header found for it
+			if !isDir || !ew.implicit[name] || ew.wl.Hidden(name) {
+				continue
+			}
+			delete(ew.implicit, name)
+		}
+		ew.parents(path.Dir(name))
+		hdr := *th
+		hdr.Name = name
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = imageFSClean(hdr.Linkname)
+			if l, ok := ew.written[hdr.Linkname]; !ok {
+				// the target may be found in a lower layer
+				ew.links = append(ew.links, imageFSExportLink{hdr: &hdr, layer: i})
+				continue
+			} else if l != i {
+				// the hardlink target was replaced, include the content from this layer instead
+				err = ew.linkContent(&hdr, i)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		err = ew.write(&hdr, i, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parents records directories for a path that may not have a header in any layer
+func (ew *imageFSExport) parents(dir string) {
+	for ; dir != "."; dir = path.Dir(dir) {
+		if _, ok := ew.wl.Seen(dir); ok {
+			return
+		}
+		ew.wl.Add(dir, true)
+		ew.implicit[dir] = true
+	}
+}
+
+// finish writes any directories without a header and the remaining hardlinks
+func (ew *imageFSExport) finish() error {
+	dirs := map[string]bool{}
+	for name := range ew.written {
+		for dir := path.Dir(name); dir != "." && ew.implicit[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	dirList := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		dirList = append(dirList, dir)
+	}
+	sort.Strings(dirList)
+	for _, dir := range dirList {
+		err := ew.write(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     dir,
+			Mode:     0755,
+		}, -1, nil)
+		if err != nil {
+			return err
+		}
+	}
+	for _, link := range ew.links {
+		// keep the hardlink if the target is from the same or a lower layer
+		if l, ok := ew.written[link.hdr.Linkname]; ok && l >= 0 && l <= link.layer {
+			err := ew.write(link.hdr, link.layer, nil)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := ew.linkContent(link.hdr, link.layer)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkContent writes a hardlink as a regular file with the content of the target from the same layer
+func (ew *imageFSExport) linkContent(hdr *tar.Header, i int) error {
+	th, content, closer, err := ew.ifs.content(&imageFSEntry{hdr: hdr, layer: i})
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	hdr.Typeflag = tar.TypeReg
+	hdr.Linkname = ""
+	hdr.Size = th.Size
+	return ew.write(hdr, i, content)
+}
+
+// write outputs a header and the content of regular files
+func (ew *imageFSExport) write(hdr *tar.Header, i int, rdr io.Reader) error {
+	ew.written[hdr.Name] = i
+	if hdr.Typeflag == tar.TypeDir {
+		hdr.Name = hdr.Name + "/"
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		hdr.Size = 0
+	}
+	err := ew.tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+		_, err = io.CopyN(ew.tw, rdr, hdr.Size)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+		}
+	}
+	return nil
+}
+
+// addParents adds directories that are not explicitly included in the layer
+func (l *imageFSLayer) addParents(dir string, i int) {
+	for dir != "." {
+		if _, ok := l.entries[dir]; ok {
+			return
+		}
+		l.entries[dir] = &imageFSEntry{
+			hdr: &tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     dir,
+				Mode:     0755,
+			},
+			implicit: true,
+			layer:    i,
+		}
+		parent := path.Dir(dir)
+		l.children[parent] = append(l.children[parent], dir)
+		dir = parent
+	}
+}
+
+// hides reports if the layer removes the path from any lower layer
+func (l *imageFSLayer) hides(name string) bool {
+	if l.whiteouts[name] {
+		return true
+	}
+	if entry, ok := l.entries[name]; ok && entry.hdr.Typeflag != tar.TypeDir {
+		return true
+	}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if l.whiteouts[dir] || l.opaque[dir] {
+			return true
+		}
+		if entry, ok := l.entries[dir]; ok && entry.hdr.Typeflag != tar.TypeDir {
+			return true
+		}
+		if dir == "." {
+			return false
+		}
+	}
+}
+
+// Close releases the directory
+func (d *imageFSDir) Close() error {
+	return nil
+}
+
+// Read returns an error for a directory
+func (d *imageFSDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fmt.Errorf("is a directory")}
+}
+
+// ReadDir returns up to n entries from the directory
+func (d *imageFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.ifs.readDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.listed = true
+	}
+	remain := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remain, nil
+	}
+	if len(remain) == 0 {
+		return []fs.DirEntry{}, io.EOF
+	}
+	if n > len(remain) {
+		n = len(remain)
+	}
+	d.offset += n
+	return remain[:n], nil
+}
+
+// Stat returns the directory info
+func (d *imageFSDir) Stat() (fs.FileInfo, error) {
+	return d.entry.hdr.FileInfo(), nil
+}
+
+// Close releases the layer blob when the file was read
+func (f *imageFSFile) Close() error {
+	f.closed = true
+	if f.closer != nil {
+		return f.closer.Close()
+	}
+	return nil
+}
+
+// Read streams the file content from the layer
+func (f *imageFSFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.entry.hdr.Typeflag != tar.TypeReg && f.entry.hdr.Typeflag != tar.TypeLink {
+		return 0, io.EOF
+	}
+	if f.rdr == nil {
+		_, rdr, closer, err := f.ifs.content(f.entry)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.rdr = rdr
+		f.closer = closer
+	}
+	return f.rdr.Read(b)
+}
+
+// Stat returns the file info
+func (f *imageFSFile) Stat() (fs.FileInfo, error) {
+	return f.entry.hdr.FileInfo(), nil
+}
+
+// imageFSDirEntry returns the directory entry for a file in the image
+type imageFSDirEntry struct {
+	fi fs.FileInfo
+}
+
+func (de imageFSDirEntry) Name() string               { return de.fi.Name() }
+func (de imageFSDirEntry) IsDir() bool                { return de.fi.IsDir() }
+func (de imageFSDirEntry) Type() fs.FileMode          { return de.fi.Mode().Type() }
+func (de imageFSDirEntry) Info() (fs.FileInfo, error) { return de.fi, nil }
+
+// imageFSClean converts a tar filename to an fs.FS path
+func imageFSClean(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func imageFSRoot() *imageFSEntry {
+	return &imageFSEntry{
+		hdr: &tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     ".",
+			Mode:     0755,
+		},
+		implicit: true,
+		layer:    -1,
+	}
+}
@@ -0,0 +1,307 @@
+package regclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/docker/schema2"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+type indexOpt struct {
+	mediaType   string
+	annotations map[string]string
+	platforms   []string
+}
+
+// IndexOpts define options for the Index* commands
+type IndexOpts func(*indexOpt)
+
+// IndexWithAnnotation sets an annotation on the index.
+// An empty value deletes the annotation.
+// Annotations are only supported by OCI indexes.
+func IndexWithAnnotation(name, value string) IndexOpts {
+	return func(opts *indexOpt) {
+		if opts.annotations == nil {
+			opts.annotations = map[string]string{}
+		}
+		opts.annotations[name] = value
+	}
+}
+
+// IndexWithMediaType sets the media type of the index.
+// Supported values are types.MediaTypeOCI1ManifestList and types.MediaTypeDocker2ManifestList.
+// IndexCreate defaults to an OCI index, and other commands preserve the existing media type.
+func IndexWithMediaType(mt string) IndexOpts {
+	return func(opts *indexOpt) {
+		opts.mediaType = mt
+	}
+}
+
+// IndexWithPlatforms selects platforms by name, e.g. "linux/amd64".
+// With IndexCreate and IndexAdd, only these platforms are added from a source index.
+// With IndexRm, these platforms are removed.
+func IndexWithPlatforms(p []string) IndexOpts {
+	return func(opts *indexOpt) {
+		opts.platforms = p
+	}
+}
+
+// IndexCreate creates an index from a list of images and pushes it to r.
+// Each source is copied to the repository of r by digest.
+// The platform of each image is set from its config, and source indexes include each of their entries.
+func (rc *RegClient) IndexCreate(ctx context.Context, r ref.Ref, srcs []ref.Ref, opts ...IndexOpts) (manifest.Manifest, error) {
+	var opt indexOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	if opt.mediaType == "" {
+		opt.mediaType = types.MediaTypeOCI1ManifestList
+	}
+	entries := []types.Descriptor{}
+	for _, src := range srcs {
+		add, err := rc.indexEntries(ctx, r, src, &opt)
+		if err != nil {
+			return nil, err
+		}
+		entries = indexEntriesMerge(entries, add)
+	}
+	return rc.indexPut(ctx, r, entries, nil, &opt)
+}
+
+// IndexAdd adds images to an existing index.
+// Entries in the index with the same platform as an added image are replaced.
+func (rc *RegClient) IndexAdd(ctx context.Context, r ref.Ref, srcs []ref.Ref, opts ...IndexOpts) (manifest.Manifest, error) {
+	var opt indexOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	ociI, err := rc.indexGet(ctx, r, &opt)
+	if err != nil {
+		return nil, err
+	}
+	entries := ociI.Manifests
+	for _, src := range srcs {
+		add, err := rc.indexEntries(ctx, r, src, &opt)
+		if err != nil {
+			return nil, err
+		}
+		entries = indexEntriesMerge(entries, add)
+	}
+	return rc.indexPut(ctx, r, entries, ociI.Annotations, &opt)
+}
+
+// IndexRm removes the platforms selected with IndexWithPlatforms from an existing index.
+// The referenced images are not deleted.
+func (rc *RegClient) IndexRm(ctx context.Context, r ref.Ref, opts ...IndexOpts) (manifest.Manifest, error) {
+	var opt indexOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	if len(opt.platforms) == 0 {
+		return nil, fmt.Errorf("platforms to remove are required")
+	}
+	ociI, err := rc.indexGet(ctx, r, &opt)
+	if err != nil {
+		return nil, err
+	}
+	entries := []types.Descriptor{}
+	for _, entry := range ociI.Manifests {
+		match, err := imagePlatformInList(entry.Platform, opt.platforms)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			rc.log.WithFields(logrus.Fields{
+				"platform": entry.Platform,
+				"digest":   entry.Digest.String(),
+			}).Debug("Removing platform from index")
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == len(ociI.Manifests) {
+		return nil, fmt.Errorf("no matching platforms found in %s: %w", r.CommonName(), types.ErrNotFound)
+	}
+	return rc.indexPut(ctx, r, entries, ociI.Annotations, &opt)
+}
+
+// indexGet returns an existing index, setting the media type in opt if it was not provided
+func (rc *RegClient) indexGet(ctx context.Context, r ref.Ref, opt *indexOpt) (v1.Index, error) {
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return v1.Index{}, err
+	}
+	if !m.IsList() {
+		return v1.Index{}, fmt.Errorf("%s is not an index: %w", r.CommonName(), types.ErrUnsupportedMediaType)
+	}
+	if opt.mediaType == "" {
+		opt.mediaType = m.GetDescriptor().MediaType
+	}
+	return manifest.OCIIndexFromAny(m.GetOrig())
+}
+
+// indexEntries copies an image or index into the repository of r and returns the descriptors to add to the index
+func (rc *RegClient) indexEntries(ctx context.Context, r ref.Ref, src ref.Ref, opt *indexOpt) ([]types.Descriptor, error) {
+	m, err := rc.ManifestGet(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	descs := []types.Descriptor{}
+	if m.IsList() {
+		dl, err := m.GetManifestList()
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dl {
+			if len(opt.platforms) > 0 {
+				match, err := imagePlatformInList(d.Platform, opt.platforms)
+				if err != nil {
+					return nil, err
+				}
+				if !match {
+					continue
+				}
+			}
+			descs = append(descs, d)
+		}
+		if len(descs) == 0 {
+			return nil, fmt.Errorf("no matching platforms found in %s: %w", src.CommonName(), types.ErrNotFound)
+		}
+	} else {
+		d := m.GetDescriptor()
+		d.Platform, err = rc.indexPlatform(ctx, src, m)
+		if err != nil {
+			return nil, err
+		}
+		descs = append(descs, d)
+	}
+	for i, d := range descs {
+		srcD := src
+		srcD.Tag = ""
+		srcD.Digest = d.Digest.String()
+		tgtD := r
+		tgtD.Tag = ""
+		tgtD.Digest = d.Digest.String()
+		rc.log.WithFields(logrus.Fields{
+			"source":   src.CommonName(),
+			"platform": d.Platform,
+			"digest":   d.Digest.String(),
+		}).Debug("Copy image for index")
+		err = rc.imageCopyOpt(ctx, srcD, tgtD, d, true, &imageOpt{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", srcD.CommonName(), err)
+		}
+		// fill in missing platforms from the image config
+		if d.Platform == nil {
+			mChild, err := rc.ManifestGet(ctx, srcD, ManifestWithDesc(d))
+			if err != nil {
+				return nil, err
+			}
+			descs[i].Platform, err = rc.indexPlatform(ctx, srcD, mChild)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return descs, nil
+}
+
+// indexPlatform returns the platform of an image from the config, nil is returned for manifests without a platform
+func (rc *RegClient) indexPlatform(ctx context.Context, r ref.Ref, m manifest.Manifest) (*platform.Platform, error) {
+	if m.IsList() {
+		return nil, nil
+	}
+	cd, err := m.GetConfig()
+	if err != nil {
+		return nil, nil
+	}
+	if cd.MediaType != types.MediaTypeOCI1ImageConfig && cd.MediaType != types.MediaTypeDocker2ImageConfig {
+		return nil, nil
+	}
+	oc, err := rc.BlobGetOCIConfig(ctx, r, cd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for %s: %w", r.CommonName(), err)
+	}
+	c := oc.GetConfig()
+	if c.OS == "" {
+		return nil, nil
+	}
+	return &platform.Platform{
+		OS:           c.OS,
+		Architecture: c.Architecture,
+		Variant:      c.Variant,
+		OSVersion:    c.OSVersion,
+		OSFeatures:   c.OSFeatures,
+	}, nil
+}
+
+// indexEntriesMerge adds entries to the list, replacing entries with the same digest or platform
+func indexEntriesMerge(entries, add []types.Descriptor) []types.Descriptor {
+	result := []types.Descriptor{}
+	for _, entry := range entries {
+		keep := true
+		for _, a := range add {
+			if entry.Digest == a.Digest ||
+				(entry.Platform != nil && a.Platform != nil && platform.Match(*entry.Platform, *a.Platform)) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, entry)
+		}
+	}
+	return append(result, add...)
+}
+
+// indexPut creates and pushes the index
+func (rc *RegClient) indexPut(ctx context.Context, r ref.Ref, entries []types.Descriptor, annotations map[string]string, opt *indexOpt) (manifest.Manifest, error) {
+	for k, v := range opt.annotations {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		if v == "" {
+			delete(annotations, k)
+		} else {
+			annotations[k] = v
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	var orig interface{}
+	switch opt.mediaType {
+	case types.MediaTypeOCI1ManifestList:
+		orig = v1.Index{
+			Versioned:   v1.IndexSchemaVersion,
+			MediaType:   types.MediaTypeOCI1ManifestList,
+			Manifests:   entries,
+			Annotations: annotations,
+		}
+	case types.MediaTypeDocker2ManifestList:
+		if len(annotations) > 0 {
+			return nil, fmt.Errorf("annotations are not supported by %s: %w", opt.mediaType, types.ErrUnsupportedMediaType)
+		}
+		orig = schema2.ManifestList{
+			Versioned: schema2.ManifestListSchemaVersion,
+			Manifests: entries,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported index media type %s: %w", opt.mediaType, types.ErrUnsupportedMediaType)
+	}
+	m, err := manifest.New(manifest.WithOrig(orig))
+	if err != nil {
+		return nil, err
+	}
+	err = rc.ManifestPut(ctx, r, m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,160 @@
+package regclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := New(WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	mSrc, err := rc.ManifestGet(ctx, rSrc)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	// create refs to each platform specific image without the platform in a descriptor
+	srcPlat := map[string]ref.Ref{}
+	for _, p := range []string{"linux/amd64", "linux/arm64", "linux/arm/v7"} {
+		plat, err := platform.Parse(p)
+		if err != nil {
+			t.Fatalf("failed to parse platform %s: %v", p, err)
+		}
+		d, err := manifest.GetPlatformDesc(mSrc, &plat)
+		if err != nil {
+			t.Fatalf("failed to get platform %s: %v", p, err)
+		}
+		r := rSrc
+		r.Tag = ""
+		r.Digest = d.Digest.String()
+		srcPlat[p] = r
+	}
+	rIndex, err := ref.New("ocidir://testindex:latest")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	checkPlatforms := func(t *testing.T, m manifest.Manifest, expect []string) {
+		t.Helper()
+		pl, err := manifest.GetPlatformList(m)
+		if err != nil {
+			t.Fatalf("failed to get platform list: %v", err)
+		}
+		if len(pl) != len(expect) {
+			t.Fatalf("unexpected platforms, expected %v, received %v", expect, pl)
+		}
+		for i := range pl {
+			if pl[i].String() != expect[i] {
+				t.Errorf("unexpected platform %d, expected %s, received %s", i, expect[i], pl[i].String())
+			}
+		}
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		m, err := rc.IndexCreate(ctx, rIndex, []ref.Ref{srcPlat["linux/amd64"], srcPlat["linux/arm64"]},
+			IndexWithAnnotation("org.example.test", "hello"))
+		if err != nil {
+			t.Fatalf("failed to create index: %v", err)
+		}
+		if m.GetDescriptor().MediaType != types.MediaTypeOCI1ManifestList {
+			t.Errorf("unexpected media type: %s", m.GetDescriptor().MediaType)
+		}
+		mGet, err := rc.ManifestGet(ctx, rIndex)
+		if err != nil {
+			t.Fatalf("failed to get index: %v", err)
+		}
+		if mGet.GetDescriptor().Digest != m.GetDescriptor().Digest {
+			t.Errorf("pushed digest mismatch, expected %s, received %s", m.GetDescriptor().Digest, mGet.GetDescriptor().Digest)
+		}
+		checkPlatforms(t, mGet, []string{"linux/amd64", "linux/arm64"})
+		ociI, err := manifest.OCIIndexFromAny(mGet.GetOrig())
+		if err != nil {
+			t.Fatalf("failed to convert index: %v", err)
+		}
+		if ociI.Annotations["org.example.test"] != "hello" {
+			t.Errorf("annotation missing: %v", ociI.Annotations)
+		}
+		// images are copied into the index repository
+		for _, d := range ociI.Manifests {
+			r := rIndex
+			r.Tag = ""
+			r.Digest = d.Digest.String()
+			_, err = rc.ManifestGet(ctx, r)
+			if err != nil {
+				t.Errorf("image not copied %s: %v", r.CommonName(), err)
+			}
+		}
+	})
+	t.Run("Add", func(t *testing.T) {
+		_, err := rc.IndexAdd(ctx, rIndex, []ref.Ref{rSrc}, IndexWithPlatforms([]string{"linux/arm64", "linux/arm/v7"}))
+		if err != nil {
+			t.Fatalf("failed to add to index: %v", err)
+		}
+		mGet, err := rc.ManifestGet(ctx, rIndex)
+		if err != nil {
+			t.Fatalf("failed to get index: %v", err)
+		}
+		checkPlatforms(t, mGet, []string{"linux/amd64", "linux/arm64", "linux/arm/v7"})
+	})
+	t.Run("Add missing platform", func(t *testing.T) {
+		_, err := rc.IndexAdd(ctx, rIndex, []ref.Ref{rSrc}, IndexWithPlatforms([]string{"linux/s390x"}))
+		if !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error, expected %v, received %v", types.ErrNotFound, err)
+		}
+	})
+	t.Run("Rm", func(t *testing.T) {
+		_, err := rc.IndexRm(ctx, rIndex, IndexWithPlatforms([]string{"linux/arm64"}), IndexWithAnnotation("org.example.test", ""))
+		if err != nil {
+			t.Fatalf("failed to remove from index: %v", err)
+		}
+		mGet, err := rc.ManifestGet(ctx, rIndex)
+		if err != nil {
+			t.Fatalf("failed to get index: %v", err)
+		}
+		checkPlatforms(t, mGet, []string{"linux/amd64", "linux/arm/v7"})
+		ociI, err := manifest.OCIIndexFromAny(mGet.GetOrig())
+		if err != nil {
+			t.Fatalf("failed to convert index: %v", err)
+		}
+		if len(ociI.Annotations) > 0 {
+			t.Errorf("annotations not deleted: %v", ociI.Annotations)
+		}
+	})
+	t.Run("Rm missing platform", func(t *testing.T) {
+		_, err := rc.IndexRm(ctx, rIndex, IndexWithPlatforms([]string{"linux/s390x"}))
+		if !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error, expected %v, received %v", types.ErrNotFound, err)
+		}
+	})
+	t.Run("Docker", func(t *testing.T) {
+		rDocker := rIndex
+		rDocker.Tag = "docker"
+		m, err := rc.IndexCreate(ctx, rDocker, []ref.Ref{rSrc}, IndexWithMediaType(types.MediaTypeDocker2ManifestList))
+		if err != nil {
+			t.Fatalf("failed to create index: %v", err)
+		}
+		if m.GetDescriptor().MediaType != types.MediaTypeDocker2ManifestList {
+			t.Errorf("unexpected media type: %s", m.GetDescriptor().MediaType)
+		}
+		checkPlatforms(t, m, []string{"linux/amd64", "linux/arm64", "linux/arm/v7", "linux/arm/v6"})
+		_, err = rc.IndexAdd(ctx, rDocker, []ref.Ref{srcPlat["linux/amd64"]}, IndexWithAnnotation("org.example.test", "hello"))
+		if !errors.Is(err, types.ErrUnsupportedMediaType) {
+			t.Errorf("unexpected error, expected %v, received %v", types.ErrUnsupportedMediaType, err)
+		}
+	})
+}
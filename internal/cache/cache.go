@@ -0,0 +1,468 @@
+// Package cache implements an on-disk content addressable cache for blobs and manifests
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// crypto libraries included for go-digest
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	kindBlob     = "blobs"
+	kindManifest = "manifests"
+	dirTmp       = "tmp"
+	// mediaTypeExt is the suffix of the file containing the media type of a manifest
+	mediaTypeExt = ".mediatype"
+)
+
+// Cache is an on-disk content addressable store with LRU eviction
+type Cache struct {
+	dir     string
+	maxSize int64
+	log     *logrus.Logger
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is the most recently used entry
+	size    int64
+}
+
+type entry struct {
+	name string // relative path, e.g. blobs/sha256/<hex>
+	size int64
+}
+
+// Opts are used to configure the cache
+type Opts func(*Cache)
+
+// WithDir sets the directory used to store the cache
+func WithDir(dir string) Opts {
+	return func(c *Cache) {
+		c.dir = dir
+	}
+}
+
+// WithLog provides a logrus logger
+func WithLog(log *logrus.Logger) Opts {
+	return func(c *Cache) {
+		c.log = log
+	}
+}
+
+// WithMaxSize sets the maximum size of the cache in bytes, 0 disables the limit
+func WithMaxSize(size int64) Opts {
+	return func(c *Cache) {
+		c.maxSize = size
+	}
+}
+
+// New creates a cache, loading any existing entries from the directory
+func New(opts ...Opts) (*Cache, error) {
+	c := &Cache{
+		log:     &logrus.Logger{Out: ioutil.Discard},
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.dir == "" {
+		return nil, fmt.Errorf("cache directory not defined")
+	}
+	for _, dir := range []string{kindBlob, kindManifest, dirTmp} {
+		err := os.MkdirAll(filepath.Join(c.dir, dir), 0700)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+		}
+	}
+	// remove any partial writes from a previous run
+	tmpList, err := os.ReadDir(filepath.Join(c.dir, dirTmp))
+	if err != nil {
+		return nil, err
+	}
+	for _, tmp := range tmpList {
+		_ = os.Remove(filepath.Join(c.dir, dirTmp, tmp.Name()))
+	}
+	err = c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// load scans the directory for existing entries, ordering them by their modified time
+func (c *Cache) load() error {
+	type loadEntry struct {
+		entry
+		mod time.Time
+	}
+	found := []loadEntry{}
+	for _, kind := range []string{kindBlob, kindManifest} {
+		root := filepath.Join(c.dir, kind)
+		err := filepath.WalkDir(root, func(p string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if de.IsDir() || strings.HasSuffix(p, mediaTypeExt) {
+				return nil
+			}
+			fi, err := de.Info()
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(c.dir, p)
+			if err != nil {
+				return err
+			}
+			found = append(found, loadEntry{
+				entry: entry{name: filepath.ToSlash(name), size: fi.Size()},
+				mod:   fi.ModTime(),
+			})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load cache %s: %w", root, err)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].mod.After(found[j].mod)
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, le := range found {
+		e := le.entry
+		c.entries[e.name] = c.lru.PushBack(&e)
+		c.size += e.size
+	}
+	return nil
+}
+
+// BlobGet returns a reader for a cached blob, the digest is verified as the blob is read
+func (c *Cache) BlobGet(d digest.Digest) (io.ReadCloser, int64, error) {
+	name, err := entryName(kindBlob, d)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !c.touch(name) {
+		return nil, 0, types.ErrNotFound
+	}
+	fh, err := os.Open(filepath.Join(c.dir, filepath.FromSlash(name)))
+	if err != nil {
+		c.remove(name)
+		return nil, 0, types.ErrNotFound
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return nil, 0, err
+	}
+	return &verifyReader{
+		c:        c,
+		name:     name,
+		d:        d,
+		fh:       fh,
+		digester: d.Algorithm().Digester(),
+	}, fi.Size(), nil
+}
+
+// BlobTee returns a reader that adds the blob to the cache after it has been fully read and verified.
+// The returned reader closes rdr if it implements io.Closer.
+func (c *Cache) BlobTee(d digest.Digest, size int64, rdr io.Reader) io.ReadCloser {
+	tr := &teeReader{c: c, d: d, rdr: rdr}
+	name, err := entryName(kindBlob, d)
+	if err != nil || (c.maxSize > 0 && size > c.maxSize) {
+		return tr
+	}
+	fh, err := ioutil.TempFile(filepath.Join(c.dir, dirTmp), "blob-")
+	if err != nil {
+		c.log.WithFields(logrus.Fields{
+			"err": err,
+		}).Debug("Failed to create cache file")
+		return tr
+	}
+	tr.name = name
+	tr.fh = fh
+	tr.digester = d.Algorithm().Digester()
+	return tr
+}
+
+// ManifestGet returns the raw body and media type of a cached manifest after verifying the digest
+func (c *Cache) ManifestGet(d digest.Digest) ([]byte, string, error) {
+	name, err := entryName(kindManifest, d)
+	if err != nil {
+		return nil, "", err
+	}
+	if !c.touch(name) {
+		return nil, "", types.ErrNotFound
+	}
+	filename := filepath.Join(c.dir, filepath.FromSlash(name))
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		c.remove(name)
+		return nil, "", types.ErrNotFound
+	}
+	if d.Algorithm().FromBytes(raw) != d {
+		c.log.WithFields(logrus.Fields{
+			"digest": d.String(),
+		}).Warn("Cached manifest digest mismatch, removing entry")
+		c.remove(name)
+		return nil, "", types.ErrNotFound
+	}
+	mt, err := os.ReadFile(filename + mediaTypeExt)
+	if err != nil {
+		c.remove(name)
+		return nil, "", types.ErrNotFound
+	}
+	return raw, string(mt), nil
+}
+
+// ManifestPut adds a manifest to the cache, the raw body must match the digest
+func (c *Cache) ManifestPut(d digest.Digest, mediaType string, raw []byte) error {
+	name, err := entryName(kindManifest, d)
+	if err != nil {
+		return err
+	}
+	if d.Algorithm().FromBytes(raw) != d {
+		return fmt.Errorf("manifest digest mismatch, expected %s: %w", d.String(), types.ErrDigestMismatch)
+	}
+	if c.maxSize > 0 && int64(len(raw)) > c.maxSize {
+		return nil
+	}
+	c.mu.Lock()
+	_, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok {
+		c.touch(name)
+		return nil
+	}
+	filename := filepath.Join(c.dir, filepath.FromSlash(name))
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filename+mediaTypeExt, []byte(mediaType), 0600)
+	if err != nil {
+		return err
+	}
+	fh, err := ioutil.TempFile(filepath.Join(c.dir, dirTmp), "manifest-")
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(raw)
+	if errC := fh.Close(); err == nil {
+		err = errC
+	}
+	if err != nil {
+		os.Remove(fh.Name())
+		return err
+	}
+	return c.commit(fh.Name(), name, int64(len(raw)))
+}
+
+// commit moves a temporary file into the cache and evicts old entries when over the size limit
+func (c *Cache) commit(tmpName, name string, size int64) error {
+	filename := filepath.Join(c.dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	err = os.Rename(tmpName, filename)
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[name]; ok {
+		c.size -= el.Value.(*entry).size
+		c.lru.Remove(el)
+	}
+	c.entries[name] = c.lru.PushFront(&entry{name: name, size: size})
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used entries until the cache is within the size limit, the lock must be held
+func (c *Cache) evict() {
+	if c.maxSize <= 0 {
+		return
+	}
+	for c.size > c.maxSize {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		e := el.Value.(*entry)
+		c.log.WithFields(logrus.Fields{
+			"entry": e.name,
+			"size":  e.size,
+		}).Debug("Evicting cache entry")
+		c.removeLocked(e.name)
+	}
+}
+
+// remove deletes an entry from the cache
+func (c *Cache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(name)
+}
+
+func (c *Cache) removeLocked(name string) {
+	if el, ok := c.entries[name]; ok {
+		c.size -= el.Value.(*entry).size
+		c.lru.Remove(el)
+		delete(c.entries, name)
+	}
+	filename := filepath.Join(c.dir, filepath.FromSlash(name))
+	if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.log.WithFields(logrus.Fields{
+			"entry": name,
+			"err":   err,
+		}).Warn("Failed to remove cache entry")
+	}
+	if strings.HasPrefix(name, kindManifest+"/") {
+		_ = os.Remove(filename + mediaTypeExt)
+	}
+}
+
+// touch marks an entry as recently used, returning false if the entry is not in the cache
+func (c *Cache) touch(name string) bool {
+	c.mu.Lock()
+	el, ok := c.entries[name]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if ok {
+		// update the modified time so the LRU order persists between runs
+		now := time.Now()
+		_ = os.Chtimes(filepath.Join(c.dir, filepath.FromSlash(name)), now, now)
+	}
+	return ok
+}
+
+// entryName returns the relative path of an entry after validating the digest
+func entryName(kind string, d digest.Digest) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	return kind + "/" + d.Algorithm().String() + "/" + d.Encoded(), nil
+}
+
+// verifyReader validates the digest of a cached blob, removing the entry on a mismatch
+type verifyReader struct {
+	c        *Cache
+	name     string
+	d        digest.Digest
+	fh       *os.File
+	digester digest.Digester
+}
+
+func (vr *verifyReader) Read(p []byte) (int, error) {
+	n, err := vr.fh.Read(p)
+	if n > 0 {
+		vr.digester.Hash().Write(p[:n])
+	}
+	if err == io.EOF && vr.digester.Digest() != vr.d {
+		vr.c.log.WithFields(logrus.Fields{
+			"digest": vr.d.String(),
+		}).Warn("Cached blob digest mismatch, removing entry")
+		vr.c.remove(vr.name)
+		return n, fmt.Errorf("cached blob digest mismatch, expected %s, calculated %s: %w", vr.d.String(), vr.digester.Digest().String(), types.ErrDigestMismatch)
+	}
+	return n, err
+}
+
+func (vr *verifyReader) Close() error {
+	return vr.fh.Close()
+}
+
+// teeReader writes a blob to a temporary file as it is read, committing it to the cache when complete
+type teeReader struct {
+	c        *Cache
+	name     string
+	d        digest.Digest
+	rdr      io.Reader
+	fh       *os.File
+	digester digest.Digester
+	size     int64
+}
+
+func (tr *teeReader) Read(p []byte) (int, error) {
+	n, err := tr.rdr.Read(p)
+	if tr.fh != nil && n > 0 {
+		tr.digester.Hash().Write(p[:n])
+		tr.size += int64(n)
+		if _, errW := tr.fh.Write(p[:n]); errW != nil {
+			tr.discard()
+		} else if tr.c.maxSize > 0 && tr.size > tr.c.maxSize {
+			tr.discard()
+		}
+	}
+	if tr.fh != nil && err == io.EOF {
+		tr.finish()
+	} else if err != nil && err != io.EOF {
+		tr.discard()
+	}
+	return n, err
+}
+
+func (tr *teeReader) Close() error {
+	// partially read blobs are not cached
+	tr.discard()
+	if rc, ok := tr.rdr.(io.Closer); ok {
+		return rc.Close()
+	}
+	return nil
+}
+
+func (tr *teeReader) finish() {
+	fh := tr.fh
+	tr.fh = nil
+	if err := fh.Close(); err != nil {
+		os.Remove(fh.Name())
+		return
+	}
+	if tr.digester.Digest() != tr.d {
+		os.Remove(fh.Name())
+		return
+	}
+	err := tr.c.commit(fh.Name(), tr.name, tr.size)
+	if err != nil {
+		tr.c.log.WithFields(logrus.Fields{
+			"digest": tr.d.String(),
+			"err":    err,
+		}).Debug("Failed to add blob to cache")
+	}
+}
+
+func (tr *teeReader) discard() {
+	if tr.fh == nil {
+		return
+	}
+	tr.fh.Close()
+	os.Remove(tr.fh.Name())
+	tr.fh = nil
+}
@@ -0,0 +1,261 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/scheme/ocidir"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(WithDir(dir), WithMaxSize(40))
+	if err != nil {
+		t.Errorf("failed to create cache: %v", err)
+		return
+	}
+	blobA := []byte("blob a content")
+	digA := digest.FromBytes(blobA)
+	blobB := []byte("blob b content")
+	digB := digest.FromBytes(blobB)
+	mRaw := []byte(`{"schemaVersion":2}`)
+	mDig := digest.FromBytes(mRaw)
+
+	t.Run("Miss", func(t *testing.T) {
+		_, _, err := c.BlobGet(digA)
+		if !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		_, _, err = c.ManifestGet(mDig)
+		if !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	t.Run("Blob", func(t *testing.T) {
+		// partial reads are not cached
+		tr := c.BlobTee(digA, int64(len(blobA)), bytes.NewReader(blobA))
+		_, err := tr.Read(make([]byte, 4))
+		if err != nil {
+			t.Errorf("failed to read: %v", err)
+		}
+		tr.Close()
+		if _, _, err := c.BlobGet(digA); err == nil {
+			t.Errorf("partial read was cached")
+		}
+		// full read is cached
+		tr = c.BlobTee(digA, int64(len(blobA)), bytes.NewReader(blobA))
+		_, err = io.ReadAll(tr)
+		if err != nil {
+			t.Errorf("failed to read: %v", err)
+		}
+		tr.Close()
+		rdr, size, err := c.BlobGet(digA)
+		if err != nil {
+			t.Errorf("failed to get blob: %v", err)
+			return
+		}
+		defer rdr.Close()
+		out, err := io.ReadAll(rdr)
+		if err != nil {
+			t.Errorf("failed to read blob: %v", err)
+		}
+		if size != int64(len(blobA)) || !bytes.Equal(out, blobA) {
+			t.Errorf("unexpected blob: %d, %s", size, out)
+		}
+	})
+	t.Run("Blob mismatch", func(t *testing.T) {
+		dig := digest.FromString("other content")
+		tr := c.BlobTee(dig, 0, bytes.NewReader(blobB))
+		_, err := io.ReadAll(tr)
+		if err != nil {
+			t.Errorf("failed to read: %v", err)
+		}
+		tr.Close()
+		if _, _, err := c.BlobGet(dig); err == nil {
+			t.Errorf("blob with a mismatched digest was cached")
+		}
+	})
+	t.Run("Manifest", func(t *testing.T) {
+		err := c.ManifestPut(mDig, types.MediaTypeOCI1Manifest, mRaw)
+		if err != nil {
+			t.Errorf("failed to put manifest: %v", err)
+			return
+		}
+		raw, mt, err := c.ManifestGet(mDig)
+		if err != nil {
+			t.Errorf("failed to get manifest: %v", err)
+			return
+		}
+		if mt != types.MediaTypeOCI1Manifest || !bytes.Equal(raw, mRaw) {
+			t.Errorf("unexpected manifest: %s, %s", mt, raw)
+		}
+		err = c.ManifestPut(digA, types.MediaTypeOCI1Manifest, mRaw)
+		if !errors.Is(err, types.ErrDigestMismatch) {
+			t.Errorf("unexpected error on mismatched put: %v", err)
+		}
+	})
+	t.Run("Evict", func(t *testing.T) {
+		// adding blob b exceeds the limit, the least recently used blob a is removed
+		tr := c.BlobTee(digB, int64(len(blobB)), bytes.NewReader(blobB))
+		_, err := io.ReadAll(tr)
+		if err != nil {
+			t.Errorf("failed to read: %v", err)
+		}
+		tr.Close()
+		if _, _, err := c.BlobGet(digA); err == nil {
+			t.Errorf("blob a was not evicted")
+		}
+		rdr, _, err := c.BlobGet(digB)
+		if err != nil {
+			t.Errorf("blob b missing: %v", err)
+			return
+		}
+		rdr.Close()
+		if c.size > c.maxSize {
+			t.Errorf("cache size %d exceeds max %d", c.size, c.maxSize)
+		}
+		// larger than the max size are never cached
+		large := bytes.Repeat([]byte("x"), 50)
+		tr = c.BlobTee(digest.FromBytes(large), 0, bytes.NewReader(large))
+		_, err = io.ReadAll(tr)
+		if err != nil {
+			t.Errorf("failed to read: %v", err)
+		}
+		tr.Close()
+		if _, _, err := c.BlobGet(digest.FromBytes(large)); err == nil {
+			t.Errorf("large blob was cached")
+		}
+	})
+	t.Run("Corrupt", func(t *testing.T) {
+		filename := filepath.Join(dir, kindBlob, digB.Algorithm().String(), digB.Encoded())
+		err := os.WriteFile(filename, []byte("corrupt blob b"), 0600)
+		if err != nil {
+			t.Errorf("failed to corrupt blob: %v", err)
+			return
+		}
+		rdr, _, err := c.BlobGet(digB)
+		if err != nil {
+			t.Errorf("failed to get blob: %v", err)
+			return
+		}
+		_, err = io.ReadAll(rdr)
+		rdr.Close()
+		if !errors.Is(err, types.ErrDigestMismatch) {
+			t.Errorf("unexpected error reading corrupt blob: %v", err)
+		}
+		if _, _, err := c.BlobGet(digB); err == nil {
+			t.Errorf("corrupt blob was not removed")
+		}
+	})
+	t.Run("Reload", func(t *testing.T) {
+		c2, err := New(WithDir(dir), WithMaxSize(40))
+		if err != nil {
+			t.Errorf("failed to create cache: %v", err)
+			return
+		}
+		raw, _, err := c2.ManifestGet(mDig)
+		if err != nil || !bytes.Equal(raw, mRaw) {
+			t.Errorf("manifest missing after reload: %v", err)
+		}
+	})
+}
+
+func TestScheme(t *testing.T) {
+	ctx := context.Background()
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(rwfs.OSNew(""), "../../scheme/ocidir/testdata", fsMem, "testdata")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	c, err := New(WithDir(t.TempDir()))
+	if err != nil {
+		t.Errorf("failed to create cache: %v", err)
+		return
+	}
+	o := ocidir.New(ocidir.WithFS(fsMem))
+	s := NewScheme(o, c)
+	r, err := ref.New("ocidir://testdata/regctl:latest")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	m, err := s.ManifestGet(ctx, r)
+	if err != nil {
+		t.Errorf("failed to get manifest: %v", err)
+		return
+	}
+	dl, err := m.GetManifestList()
+	if err != nil || len(dl) == 0 {
+		t.Errorf("failed to get manifest list: %v", err)
+		return
+	}
+	rPlat := r
+	rPlat.Tag = ""
+	rPlat.Digest = dl[0].Digest.String()
+	mPlat, err := s.ManifestGet(ctx, rPlat)
+	if err != nil {
+		t.Errorf("failed to get platform manifest: %v", err)
+		return
+	}
+	cd, err := mPlat.GetConfig()
+	if err != nil {
+		t.Errorf("failed to get config: %v", err)
+		return
+	}
+	br, err := s.BlobGet(ctx, r, cd)
+	if err != nil {
+		t.Errorf("failed to get blob: %v", err)
+		return
+	}
+	blobRaw, err := io.ReadAll(br)
+	br.Close()
+	if err != nil {
+		t.Errorf("failed to read blob: %v", err)
+		return
+	}
+	err = fsMem.Remove("testdata/regctl/blobs/" + cd.Digest.Algorithm().String() + "/" + cd.Digest.Encoded())
+	if err != nil {
+		t.Errorf("failed to delete blob: %v", err)
+		return
+	}
+	br, err = s.BlobGet(ctx, r, cd)
+	if err != nil {
+		t.Errorf("failed to get cached blob: %v", err)
+		return
+	}
+	blobCache, err := io.ReadAll(br)
+	br.Close()
+	if err != nil || !bytes.Equal(blobRaw, blobCache) {
+		t.Errorf("unexpected cached blob: %v", err)
+	}
+	rDig := r
+	rDig.Tag = ""
+	rDig.Digest = m.GetDescriptor().Digest.String()
+	// remove the manifest from the underlying scheme, requests by digest are served from the cache
+	err = o.ManifestDelete(ctx, rDig)
+	if err != nil {
+		t.Errorf("failed to delete manifest: %v", err)
+		return
+	}
+	if _, err := s.ManifestGet(ctx, r); err == nil {
+		t.Errorf("tag request returned a cached manifest")
+	}
+	mCache, err := s.ManifestGet(ctx, rDig)
+	if err != nil {
+		t.Errorf("failed to get cached manifest: %v", err)
+		return
+	}
+	if mCache.GetDescriptor().Digest != m.GetDescriptor().Digest || mCache.GetDescriptor().MediaType != m.GetDescriptor().MediaType {
+		t.Errorf("unexpected cached manifest: %v", mCache.GetDescriptor())
+	}
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"context"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/blob"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
+	"github.com/regclient/regclient/types/repo"
+	"github.com/regclient/regclient/types/tag"
+	"github.com/sirupsen/logrus"
+)
+
+// Scheme wraps a scheme.API, returning blobs and manifests requested by digest from the cache.
+// Requests by tag are always sent to the wrapped API.
+type Scheme struct {
+	api   scheme.API
+	cache *Cache
+}
+
+// NewScheme returns a scheme.API that uses the cache in front of api
+func NewScheme(api scheme.API, c *Cache) *Scheme {
+	return &Scheme{api: api, cache: c}
+}
+
+// Info returns the info of the wrapped scheme
+func (s *Scheme) Info() scheme.Info {
+	return s.api.Info()
+}
+
+// BlobDelete removes a blob from the repository
+func (s *Scheme) BlobDelete(ctx context.Context, r ref.Ref, d types.Descriptor) error {
+	return s.api.BlobDelete(ctx, r, d)
+}
+
+// BlobGet retrieves a blob from the cache, falling back to the wrapped scheme and caching the result
+func (s *Scheme) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	if d.Digest == "" {
+		return s.api.BlobGet(ctx, r, d)
+	}
+	rdr, size, err := s.cache.BlobGet(d.Digest)
+	if err == nil {
+		s.cache.log.WithFields(logrus.Fields{
+			"ref":    r.CommonName(),
+			"digest": d.Digest.String(),
+		}).Debug("Blob cache hit")
+		if d.Size == 0 {
+			d.Size = size
+		}
+		return blob.NewReader(
+			blob.WithDesc(d),
+			blob.WithRef(r),
+			blob.WithReader(rdr),
+		), nil
+	}
+	br, err := s.api.BlobGet(ctx, r, d)
+	if err != nil {
+		return br, err
+	}
+	bd := br.GetDescriptor()
+	if bd.Digest == "" {
+		bd.Digest = d.Digest
+	}
+	return blob.NewReader(
+		blob.WithDesc(bd),
+		blob.WithHeader(br.RawHeaders()),
+		blob.WithRef(r),
+		blob.WithReader(s.cache.BlobTee(bd.Digest, bd.Size, br)),
+	), nil
+}
+
+// BlobHead verifies the existence of a blob with the wrapped scheme
+func (s *Scheme) BlobHead(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	return s.api.BlobHead(ctx, r, d)
+}
+
+// BlobMount attempts to perform a server side copy of the blob
+func (s *Scheme) BlobMount(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor) error {
+	return s.api.BlobMount(ctx, refSrc, refTgt, d)
+}
+
+// BlobPut sends a blob to the repository
+func (s *Scheme) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
+	return s.api.BlobPut(ctx, r, d, rdr)
+}
+
+// ManifestDelete removes a manifest from the repository
+func (s *Scheme) ManifestDelete(ctx context.Context, r ref.Ref) error {
+	return s.api.ManifestDelete(ctx, r)
+}
+
+// ManifestGet retrieves a manifest by digest from the cache, falling back to the wrapped scheme and caching the result
+func (s *Scheme) ManifestGet(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	if r.Digest != "" {
+		d, err := digest.Parse(r.Digest)
+		if err == nil {
+			raw, mt, err := s.cache.ManifestGet(d)
+			if err == nil {
+				s.cache.log.WithFields(logrus.Fields{
+					"ref": r.CommonName(),
+				}).Debug("Manifest cache hit")
+				return manifest.New(
+					manifest.WithRef(r),
+					manifest.WithDesc(types.Descriptor{
+						MediaType: mt,
+						Digest:    d,
+						Size:      int64(len(raw)),
+					}),
+					manifest.WithRaw(raw),
+				)
+			}
+		}
+	}
+	m, err := s.api.ManifestGet(ctx, r)
+	if err != nil {
+		return m, err
+	}
+	s.manifestCache(m)
+	return m, nil
+}
+
+// ManifestHead queries the wrapped scheme for the manifest metadata
+func (s *Scheme) ManifestHead(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	return s.api.ManifestHead(ctx, r)
+}
+
+// ManifestPut sends a manifest to the repository and adds it to the cache
+func (s *Scheme) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest, opts ...scheme.ManifestOpts) error {
+	err := s.api.ManifestPut(ctx, r, m, opts...)
+	if err != nil {
+		return err
+	}
+	s.manifestCache(m)
+	return nil
+}
+
+// ReferrerList returns a list of referrers from the wrapped scheme
+func (s *Scheme) ReferrerList(ctx context.Context, r ref.Ref, opts ...scheme.ReferrerOpts) (referrer.ReferrerList, error) {
+	return s.api.ReferrerList(ctx, r, opts...)
+}
+
+// RepoList returns a list of repositories from the wrapped scheme if it supports listing repositories
+func (s *Scheme) RepoList(ctx context.Context, hostname string, opts ...scheme.RepoOpts) (*repo.RepoList, error) {
+	rl, ok := s.api.(interface {
+		RepoList(ctx context.Context, hostname string, opts ...scheme.RepoOpts) (*repo.RepoList, error)
+	})
+	if !ok {
+		return nil, types.ErrNotImplemented
+	}
+	return rl.RepoList(ctx, hostname, opts...)
+}
+
+// TagDelete removes a tag from the repository
+func (s *Scheme) TagDelete(ctx context.Context, r ref.Ref) error {
+	return s.api.TagDelete(ctx, r)
+}
+
+// TagList returns a list of tags from the wrapped scheme
+func (s *Scheme) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts) (*tag.List, error) {
+	return s.api.TagList(ctx, r, opts...)
+}
+
+// Close passes through to the wrapped scheme if it implements scheme.Closer
+func (s *Scheme) Close(ctx context.Context, r ref.Ref) error {
+	if sc, ok := s.api.(scheme.Closer); ok {
+		return sc.Close(ctx, r)
+	}
+	return nil
+}
+
+// manifestCache adds a manifest to the cache, skipping manifests where the digest is not computed from the body
+func (s *Scheme) manifestCache(m manifest.Manifest) {
+	d := m.GetDescriptor()
+	if d.MediaType == types.MediaTypeDocker1ManifestSigned || !m.IsSet() {
+		return
+	}
+	raw, err := m.RawBody()
+	if err != nil {
+		return
+	}
+	err = s.cache.ManifestPut(d.Digest, d.MediaType, raw)
+	if err != nil {
+		s.cache.log.WithFields(logrus.Fields{
+			"digest": d.Digest.String(),
+			"err":    err,
+		}).Debug("Failed to add manifest to cache")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,6 +23,7 @@ type MemChild interface{}
 type MemDir struct {
 	child map[string]MemChild
 	mod   time.Time
+	mu    sync.RWMutex // guards child, allowing concurrent access to separate files
 }
 type MemFile struct {
 	b   []byte
@@ -68,6 +70,8 @@ func (o *MemFS) Mkdir(name string, perm fs.FileMode) error {
 			Err:  err,
 		}
 	}
+	memDir.mu.Lock()
+	defer memDir.mu.Unlock()
 	if _, ok := memDir.child[base]; ok {
 		return &fs.PathError{
 			Op:   "mkdir",
@@ -75,8 +79,7 @@ func (o *MemFS) Mkdir(name string, perm fs.FileMode) error {
 			Err:  fs.ErrExist,
 		}
 	}
-	newDir := MemDir{mod: time.Now(), child: map[string]MemChild{}}
-	memDir.child[base] = &newDir
+	memDir.child[base] = &MemDir{mod: time.Now(), child: map[string]MemChild{}}
 	return nil
 }
 
@@ -90,6 +93,8 @@ func (o *MemFS) OpenFile(name string, flags int, perm fs.FileMode) (RWFile, erro
 			Err:  err,
 		}
 	}
+	memDir.mu.Lock()
+	defer memDir.mu.Unlock()
 	var child MemChild
 	if file == "." || file == "" {
 		child = memDir
@@ -168,6 +173,8 @@ func (o *MemFS) Remove(name string) error {
 			Err:  err,
 		}
 	}
+	memDir.mu.Lock()
+	defer memDir.mu.Unlock()
 	if child, ok := memDir.child[file]; ok {
 		switch v := child.(type) {
 		case *MemFile:
@@ -176,7 +183,10 @@ func (o *MemFS) Remove(name string) error {
 			return nil
 		case *MemDir:
 			// check for contents of directory
-			if len(v.child) > 0 {
+			v.mu.RLock()
+			empty := len(v.child) == 0
+			v.mu.RUnlock()
+			if !empty {
 				return &fs.PathError{
 					Op:   "remove",
 					Path: name,
@@ -201,6 +211,62 @@ func (o *MemFS) Remove(name string) error {
 	}
 }
 
+func (o *MemFS) Rename(oldName, newName string) error {
+	if oldName == "." || newName == "." {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: oldName,
+			Err:  fs.ErrInvalid,
+		}
+	}
+	oldDir, oldFile := path.Split(oldName)
+	newDir, newFile := path.Split(newName)
+	oldMemDir, err := o.getDir(oldDir)
+	if err != nil {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: oldName,
+			Err:  err,
+		}
+	}
+	newMemDir, err := o.getDir(newDir)
+	if err != nil {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: newName,
+			Err:  err,
+		}
+	}
+	oldMemDir.mu.Lock()
+	defer oldMemDir.mu.Unlock()
+	if newMemDir != oldMemDir {
+		newMemDir.mu.Lock()
+		defer newMemDir.mu.Unlock()
+	}
+	child, ok := oldMemDir.child[oldFile]
+	if !ok {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: oldName,
+			Err:  fs.ErrNotExist,
+		}
+	}
+	if existing, ok := newMemDir.child[newFile]; ok {
+		if _, ok := existing.(*MemDir); ok {
+			return &fs.PathError{
+				Op:   "rename",
+				Path: newName,
+				Err:  fs.ErrExist,
+			}
+		}
+	}
+	delete(oldMemDir.child, oldFile)
+	newMemDir.child[newFile] = child
+	oldMemDir.mod = time.Now()
+	newMemDir.mod = time.Now()
+	return nil
+}
+
 func (o *MemFS) Sub(name string) (*MemFS, error) {
 	if name == "." {
 		return o, nil
@@ -240,7 +306,9 @@ func (o *MemFS) getDir(dir string) (*MemDir, error) {
 		if el == "." || el == "" {
 			continue
 		}
+		cur.mu.RLock()
 		next, ok := cur.child[el]
+		cur.mu.RUnlock()
 		if !ok {
 			return nil, fs.ErrNotExist
 		}
@@ -306,6 +374,8 @@ func (mdp *MemDirFP) Read(b []byte) (int, error) {
 // TODO: implement func (mdp *MemDirFP) Seek
 
 func (mdp *MemDirFP) ReadDir(n int) ([]fs.DirEntry, error) {
+	mdp.f.mu.RLock()
+	defer mdp.f.mu.RUnlock()
 	names := mdp.filenames(mdp.cur, n)
 	mdp.cur += len(names)
 	des := make([]fs.DirEntry, len(names))
@@ -319,8 +389,10 @@ func (mdp *MemDirFP) ReadDir(n int) ([]fs.DirEntry, error) {
 			mod = v.mod
 			mode = 0
 		case *MemDir:
+			v.mu.RLock()
 			size = int64(len(v.child))
 			mod = v.mod
+			v.mu.RUnlock()
 			mode = fs.ModeDir
 		default:
 			return des[:0], &fs.PathError{
@@ -341,6 +413,8 @@ func (mdp *MemDirFP) ReadDir(n int) ([]fs.DirEntry, error) {
 }
 
 func (mdp *MemDirFP) Stat() (fs.FileInfo, error) {
+	mdp.f.mu.RLock()
+	defer mdp.f.mu.RUnlock()
 	fi := NewFI(mdp.name, 4096, mdp.f.mod, fs.ModeDir)
 	return fi, nil
 }
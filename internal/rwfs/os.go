@@ -96,6 +96,18 @@ func (o *OSFS) Remove(name string) error {
 	return os.Remove(full)
 }
 
+func (o *OSFS) Rename(oldName, newName string) error {
+	oldFull, err := o.join("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newFull, err := o.join("rename", newName)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldFull, newFull)
+}
+
 func (o *OSFS) Sub(name string) (*OSFS, error) {
 	if name == "." {
 		return o, nil
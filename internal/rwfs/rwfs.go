@@ -42,6 +42,8 @@ type WriteFS interface {
 	OpenFile(string, int, fs.FileMode) (RWFile, error)
 	// Remove removes the named file or (empty) directory.
 	Remove(string) error
+	// Rename moves a file or directory, replacing an existing file with the new name
+	Rename(string, string) error
 }
 
 type WFile interface {
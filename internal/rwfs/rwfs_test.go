@@ -534,6 +534,37 @@ func testRWFS(t *testing.T, rwfs RWFS) {
 		}
 	})
 
+	t.Run("rename", func(t *testing.T) {
+		exRenameFile := path.Join(exSubDir, "rename.txt")
+		err := rwfs.Rename(exSubFile3, exRenameFile)
+		if err != nil {
+			t.Errorf("failed renaming %s: %v", exSubFile3, err)
+			return
+		}
+		_, err = Stat(rwfs, exSubFile3)
+		if err == nil {
+			t.Errorf("stat succeeded after renaming %s", exSubFile3)
+		}
+		b, err := ReadFile(rwfs, exRenameFile)
+		if err != nil || !bytes.Equal(b, exSubTxt3) {
+			t.Errorf("unexpected content in %s: %s, %v", exRenameFile, string(b), err)
+		}
+		// replace an existing file
+		err = rwfs.Rename(exRenameFile, exSubFile1)
+		if err != nil {
+			t.Errorf("failed replacing %s: %v", exSubFile1, err)
+			return
+		}
+		b, err = ReadFile(rwfs, exSubFile1)
+		if err != nil || !bytes.Equal(b, exSubTxt3) {
+			t.Errorf("unexpected content in %s: %s, %v", exSubFile1, string(b), err)
+		}
+		err = rwfs.Rename(exRenameFile, exSubFile2)
+		if err == nil {
+			t.Errorf("did not fail renaming missing file %s", exRenameFile)
+		}
+	})
+
 	t.Run("remove", func(t *testing.T) {
 		err := rwfs.Remove(".")
 		if err == nil {
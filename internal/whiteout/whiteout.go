@@ -0,0 +1,116 @@
+// Package whiteout handles the entries in image layers that remove content from lower layers
+package whiteout
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	// Prefix is added to the base name of an entry to remove that path from lower layers
+	Prefix = ".wh."
+	// Opaque is an entry in a directory that removes the content of that directory from lower layers
+	Opaque = ".wh..wh..opq"
+)
+
+// Parse checks if a cleaned path in a layer is a whiteout.
+// When ok is true, target is the path removed from lower layers.
+// For an opaque whiteout, target is the directory and only the content of that directory is removed.
+func Parse(name string) (target string, opaque bool, ok bool) {
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+	if base == Opaque {
+		return dir, true, true
+	}
+	if strings.HasPrefix(base, Prefix) {
+		return path.Join(dir, strings.TrimPrefix(base, Prefix)), false, true
+	}
+	return "", false, false
+}
+
+// Layers tracks the entries of each layer when processing an image from the top layer down.
+// Whiteouts only apply to lower layers, so they are recorded with Add and applied when Next is called.
+type Layers struct {
+	seen        map[string]bool // entries from this or higher layers, true for directories
+	hidden      map[string]bool // paths removed by higher layers
+	opaque      map[string]bool // directories with content removed by higher layers
+	layerHidden map[string]bool
+	layerOpaque map[string]bool
+}
+
+// NewLayers returns a tracker for processing layers from the top down
+func NewLayers() *Layers {
+	return &Layers{
+		seen:        map[string]bool{},
+		hidden:      map[string]bool{},
+		opaque:      map[string]bool{},
+		layerHidden: map[string]bool{},
+		layerOpaque: map[string]bool{},
+	}
+}
+
+// Add records an entry from the current layer.
+// False is returned if the entry is hidden by a higher layer or was already added, and should be skipped.
+func (l *Layers) Add(name string, isDir bool) bool {
+	if _, ok := l.seen[name]; ok || l.Hidden(name) {
+		return false
+	}
+	l.seen[name] = isDir
+	return true
+}
+
+// AddWhiteout records a whiteout from the current layer.
+// False is returned if the target is already removed by a higher layer or the current layer.
+func (l *Layers) AddWhiteout(target string, opaque bool) bool {
+	if opaque {
+		if l.Hidden(target) || l.opaque[target] || l.layerOpaque[target] {
+			return false
+		}
+		l.layerOpaque[target] = true
+		return true
+	}
+	if l.Hidden(target) || l.layerHidden[target] {
+		return false
+	}
+	l.layerHidden[target] = true
+	return true
+}
+
+// Hidden reports if a path is removed by a whiteout or replaced by a non-directory in a higher layer
+func (l *Layers) Hidden(name string) bool {
+	if l.hidden[name] {
+		return true
+	}
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if l.hidden[dir] || l.opaque[dir] {
+			return true
+		}
+		if isDir, ok := l.seen[dir]; ok && !isDir {
+			return true
+		}
+	}
+	return false
+}
+
+// Opaque reports if the content of a directory is removed by a higher layer
+func (l *Layers) Opaque(dir string) bool {
+	return l.opaque[dir]
+}
+
+// Seen reports if an entry was added by this or a higher layer, and if that entry is a directory
+func (l *Layers) Seen(name string) (isDir bool, ok bool) {
+	isDir, ok = l.seen[name]
+	return isDir, ok
+}
+
+// Next applies the whiteouts of the current layer before processing the next lower layer
+func (l *Layers) Next() {
+	for name := range l.layerHidden {
+		l.hidden[name] = true
+	}
+	for name := range l.layerOpaque {
+		l.opaque[name] = true
+	}
+	l.layerHidden = map[string]bool{}
+	l.layerOpaque = map[string]bool{}
+}
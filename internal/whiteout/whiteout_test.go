@@ -0,0 +1,73 @@
+package whiteout
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		opaque bool
+		ok     bool
+	}{
+		{name: "etc/passwd"},
+		{name: "etc/.wh.passwd", target: "etc/passwd", ok: true},
+		{name: "/etc/.wh.passwd", target: "/etc/passwd", ok: true},
+		{name: ".wh.etc", target: "etc", ok: true},
+		{name: "etc/.wh..wh..opq", target: "etc", opaque: true, ok: true},
+		{name: ".wh..wh..opq", target: ".", opaque: true, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, opaque, ok := Parse(tt.name)
+			if target != tt.target || opaque != tt.opaque || ok != tt.ok {
+				t.Errorf("expected %s, %t, %t, received %s, %t, %t", tt.target, tt.opaque, tt.ok, target, opaque, ok)
+			}
+		})
+	}
+}
+
+func TestLayers(t *testing.T) {
+	wl := NewLayers()
+	// top layer
+	if !wl.Add("etc", true) || !wl.Add("etc/a", false) || !wl.Add("bin", false) {
+		t.Errorf("failed to add entries to the top layer")
+	}
+	if !wl.AddWhiteout("etc/b", false) || !wl.AddWhiteout("opt", true) {
+		t.Errorf("failed to add whiteouts to the top layer")
+	}
+	if wl.AddWhiteout("etc/b", false) {
+		t.Errorf("duplicate whiteout was added")
+	}
+	// whiteouts do not apply to the layer containing them
+	if wl.Hidden("etc/b") || wl.Hidden("opt/c") {
+		t.Errorf("whiteout applied to the current layer")
+	}
+	wl.Next()
+	// lower layer
+	tests := []struct {
+		name  string
+		isDir bool
+		add   bool
+	}{
+		{name: "etc", isDir: true, add: false},
+		{name: "etc/a", add: false},
+		{name: "etc/b", add: false},
+		{name: "etc/c", add: true},
+		{name: "opt", isDir: true, add: true},
+		{name: "opt/c", add: false},
+		{name: "bin/sh", add: false},
+	}
+	for _, tt := range tests {
+		if add := wl.Add(tt.name, tt.isDir); add != tt.add {
+			t.Errorf("add %s, expected %t, received %t", tt.name, tt.add, add)
+		}
+	}
+	if !wl.Opaque("opt") {
+		t.Errorf("opaque directory not reported")
+	}
+	if isDir, ok := wl.Seen("etc"); !ok || !isDir {
+		t.Errorf("directory not seen")
+	}
+}
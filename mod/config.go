@@ -2,13 +2,28 @@ package mod
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/regclient/regclient"
+	v1 "github.com/regclient/regclient/types/oci/v1"
 	"github.com/regclient/regclient/types/ref"
 )
 
+// WithCmd sets the default command in the image config
+func WithCmd(cmd []string) Opts {
+	return withConfigChange(func(oc *v1.Image) string {
+		if strSliceEq(oc.Config.Cmd, cmd) {
+			return ""
+		}
+		oc.Config.Cmd = cmd
+		return "CMD " + historyJSON(cmd)
+	})
+}
+
 // WithConfigTimestampFromLabel sets the max timestamp in the config to match a label value
 func WithConfigTimestampFromLabel(label string) Opts {
 	return func(dc *dagConfig) {
@@ -76,6 +91,49 @@ func WithConfigTimestampMax(t time.Time) Opts {
 	}
 }
 
+// WithEntrypoint sets the entrypoint in the image config
+func WithEntrypoint(entrypoint []string) Opts {
+	return withConfigChange(func(oc *v1.Image) string {
+		if strSliceEq(oc.Config.Entrypoint, entrypoint) {
+			return ""
+		}
+		oc.Config.Entrypoint = entrypoint
+		return "ENTRYPOINT " + historyJSON(entrypoint)
+	})
+}
+
+// WithEnv sets an environment variable in the image config
+func WithEnv(name, value string) Opts {
+	return withConfigChange(func(oc *v1.Image) string {
+		env := name + "=" + value
+		for i, cur := range oc.Config.Env {
+			if strings.SplitN(cur, "=", 2)[0] != name {
+				continue
+			}
+			if cur == env {
+				return ""
+			}
+			oc.Config.Env[i] = env
+			return "ENV " + env
+		}
+		oc.Config.Env = append(oc.Config.Env, env)
+		return "ENV " + env
+	})
+}
+
+// WithEnvRm deletes an environment variable from the image config
+func WithEnvRm(name string) Opts {
+	return withConfigChange(func(oc *v1.Image) string {
+		for i, cur := range oc.Config.Env {
+			if strings.SplitN(cur, "=", 2)[0] == name {
+				oc.Config.Env = append(oc.Config.Env[:i], oc.Config.Env[i+1:]...)
+				return "ENV " + name + " (removed)"
+			}
+		}
+		return ""
+	})
+}
+
 // WithExposeAdd defines an exposed port in the image config
 func WithExposeAdd(port string) Opts {
 	return func(dc *dagConfig) {
@@ -122,6 +180,28 @@ func WithExposeRm(port string) Opts {
 	}
 }
 
+// WithHealthcheck sets the healthcheck in the image config, or deletes it when hc is nil
+func WithHealthcheck(hc *v1.HealthConfig) Opts {
+	return withConfigChange(func(oc *v1.Image) string {
+		if hc == nil {
+			if oc.Config.Healthcheck == nil {
+				return ""
+			}
+			oc.Config.Healthcheck = nil
+			return "HEALTHCHECK (removed)"
+		}
+		if oc.Config.Healthcheck != nil && reflect.DeepEqual(*oc.Config.Healthcheck, *hc) {
+			return ""
+		}
+		hcCopy := *hc
+		oc.Config.Healthcheck = &hcCopy
+		if len(hc.Test) > 0 && hc.Test[0] == "NONE" {
+			return "HEALTHCHECK NONE"
+		}
+		return "HEALTHCHECK " + historyJSON(hc.Test)
+	})
+}
+
 // WithLabel sets or deletes a label from the image config
 func WithLabel(name, value string) Opts {
 	return func(dc *dagConfig) {
@@ -149,6 +229,28 @@ func WithLabel(name, value string) Opts {
 	}
 }
 
+// WithStopSignal sets the stop signal in the image config
+func WithStopSignal(signal string) Opts {
+	return withConfigChange(func(oc *v1.Image) string {
+		if oc.Config.StopSignal == signal {
+			return ""
+		}
+		oc.Config.StopSignal = signal
+		return "STOPSIGNAL " + signal
+	})
+}
+
+// WithUser sets the user in the image config
+func WithUser(user string) Opts {
+	return withConfigChange(func(oc *v1.Image) string {
+		if oc.Config.User == user {
+			return ""
+		}
+		oc.Config.User = user
+		return "USER " + user
+	})
+}
+
 // WithVolumeAdd defines a volume in the image config
 func WithVolumeAdd(volume string) Opts {
 	return func(dc *dagConfig) {
@@ -194,3 +296,61 @@ func WithVolumeRm(volume string) Opts {
 		})
 	}
 }
+
+// WithWorkingDir sets the working directory in the image config
+func WithWorkingDir(dir string) Opts {
+	return withConfigChange(func(oc *v1.Image) string {
+		if oc.Config.WorkingDir == dir {
+			return ""
+		}
+		oc.Config.WorkingDir = dir
+		return "WORKDIR " + dir
+	})
+}
+
+// withConfigChange applies a change to each image config, adding a history entry when the config is modified.
+// The change func returns the created by value for the history, or an empty string when unchanged.
+func withConfigChange(change func(*v1.Image) string) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsOCIConfig = append(dc.stepsOCIConfig, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, doc *dagOCIConfig) error {
+			oc := doc.oc.GetConfig()
+			createdBy := change(&oc)
+			if createdBy == "" {
+				return nil
+			}
+			oc.History = append(oc.History, v1.History{
+				Created:    &timeNow,
+				CreatedBy:  createdBy,
+				Comment:    "regclient",
+				EmptyLayer: true,
+			})
+			doc.oc.SetConfig(oc)
+			doc.modified = true
+			doc.newDesc = doc.oc.GetDescriptor()
+			return nil
+		})
+	}
+}
+
+func historyJSON(args []string) string {
+	if args == nil {
+		args = []string{}
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return strings.Join(args, " ")
+	}
+	return string(b)
+}
+
+func strSliceEq(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
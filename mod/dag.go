@@ -8,15 +8,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/blob"
 	"github.com/regclient/regclient/types/manifest"
 	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 type changes int
@@ -29,16 +34,37 @@ const (
 )
 
 type dagConfig struct {
-	stepsManifest  []func(context.Context, *regclient.RegClient, ref.Ref, *dagManifest) error
-	stepsOCIConfig []func(context.Context, *regclient.RegClient, ref.Ref, *dagOCIConfig) error
-	stepsLayer     []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer) error
-	stepsLayerFile []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer, *tar.Header, *tar.Reader) (*tar.Header, *tar.Reader, changes, error)
-	maxDataSize    int64
+	stepsManifest     []func(context.Context, *regclient.RegClient, ref.Ref, *dagManifest) error
+	stepsOCIConfig    []func(context.Context, *regclient.RegClient, ref.Ref, *dagOCIConfig) error
+	stepsLayer        []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer) error
+	stepsLayerFile    []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer, *tar.Header, io.Reader) (*tar.Header, io.Reader, changes, error)
+	maxDataSize       int64
+	layerCompress     archive.CompressType
+	layerCompressSet  bool
+	layerReproducible []int // indexes of stepsLayerFile that sort and normalize the layer
+	dryRun            *dryRun
+	parallel          int
+	parallelTemp      int64
+	platformFilter    []string // filter applied to steps from following options
+	filterManifest    [][]string
+	filterOCIConfig   [][]string
+	filterLayer       [][]string
+	filterLayerFile   [][]string
+	rebaseBases       map[string]manifest.Manifest // base manifests resolved by this Apply
+	layerAdds         map[int]*dagLayerAdd         // layers generated by this Apply, by the index of the manifest step
+}
+
+// dagLayerAdd is a layer blob generated for a layer add step, and the repository it was pushed to
+type dagLayerAdd struct {
+	desc     types.Descriptor
+	ucDigest digest.Digest
+	r        ref.Ref
 }
 
 type dagManifest struct {
 	mod       changes
 	top       bool // indicates the top level manifest (needed for manifest lists)
+	origDesc  types.Descriptor
 	newDesc   types.Descriptor
 	m         manifest.Manifest
 	config    *dagOCIConfig
@@ -48,15 +74,18 @@ type dagManifest struct {
 
 type dagOCIConfig struct {
 	modified bool
+	origDesc types.Descriptor
 	newDesc  types.Descriptor
 	oc       blob.OCIConfig
 }
 
 type dagLayer struct {
-	mod      changes
-	newDesc  types.Descriptor
-	ucDigest digest.Digest // uncompressed descriptor
-	desc     types.Descriptor
+	mod       changes
+	newDesc   types.Descriptor
+	ucDigest  digest.Digest // uncompressed descriptor
+	createdBy string        // history for added layers
+	desc      types.Descriptor
+	origDesc  types.Descriptor // descriptor before any changes, used by the dry run plan
 }
 
 func dagGet(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor) (*dagManifest, error) {
@@ -70,6 +99,10 @@ func dagGet(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Des
 	if err != nil {
 		return nil, err
 	}
+	dm.origDesc = dm.m.GetDescriptor()
+	if d.Platform != nil {
+		dm.origDesc.Platform = d.Platform
+	}
 	if dm.m.IsList() {
 		dl, err := dm.m.GetManifestList()
 		if err != nil {
@@ -95,6 +128,7 @@ func dagGet(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Des
 			return nil, err
 		}
 		doc.oc = oc
+		doc.origDesc = cd
 		dm.config = &doc
 	}
 	// init layers
@@ -104,7 +138,8 @@ func dagGet(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Des
 	}
 	for _, layer := range layers {
 		dl := dagLayer{
-			desc: layer,
+			desc:     layer,
+			origDesc: layer,
 		}
 		dm.layers = append(dm.layers, &dl)
 	}
@@ -190,10 +225,13 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 			return err
 		}
 		oc := v1.Image{}
+		configChanged := false
 		iConfig := -1
 		if dm.config != nil {
-			iConfig = 0
 			oc = dm.config.oc.GetConfig()
+			if len(oc.History) > 0 {
+				iConfig = 0
+			}
 		}
 
 		// first pass to add/modify layers
@@ -202,11 +240,11 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 				return fmt.Errorf("manifest does not have enough layers")
 			}
 			// keep config index aligned
-			for iConfig >= 0 && oc.History[iConfig].EmptyLayer {
+			for iConfig >= 0 && iConfig < len(oc.History) && oc.History[iConfig].EmptyLayer {
 				iConfig++
-				if iConfig >= len(oc.History) {
-					return fmt.Errorf("config history does not have enough entries")
-				}
+			}
+			if iConfig >= len(oc.History) && layer.mod != added {
+				return fmt.Errorf("config history does not have enough entries")
 			}
 			if layer.mod == deleted {
 				iConfig++
@@ -217,14 +255,19 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 			if layer.mod != unchanged && layer.newDesc.Digest != "" {
 				d = layer.newDesc
 			}
+			// docker manifests use their own media type for gzip layers
+			if dm.m.GetDescriptor().MediaType == types.MediaTypeDocker2Manifest && d.MediaType == types.MediaTypeOCI1LayerGzip {
+				d.MediaType = types.MediaTypeDocker2Layer
+			}
 			if d.Size <= mc.maxDataSize || (mc.maxDataSize < 0 && len(d.Data) > 0) {
 				// if data field should be set
 				// retrieve the body
-				br, err := rc.BlobGet(ctx, r, d)
+				br, err := mc.blobGet(ctx, rc, r, d)
 				if err != nil {
 					return err
 				}
 				bBytes, err := io.ReadAll(br)
+				br.Close()
 				if err != nil {
 					return err
 				}
@@ -246,8 +289,9 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 					oc.RootFS.DiffIDs[i] = layer.ucDigest
 				}
 				newHistory := v1.History{
-					Created: &timeNow,
-					Comment: "regclient",
+					Created:   &timeNow,
+					CreatedBy: layer.createdBy,
+					Comment:   "regclient",
 				}
 				if iConfig < 0 {
 					// noop
@@ -258,10 +302,12 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 					oc.History[iConfig] = newHistory
 				}
 				changed = true
+				configChanged = true
 			} else if layer.mod == replaced || !bytes.Equal(ociM.Layers[i].Data, d.Data) {
 				ociM.Layers[i] = d
-				if layer.ucDigest != "" {
+				if layer.ucDigest != "" && oc.RootFS.DiffIDs[i] != layer.ucDigest {
 					oc.RootFS.DiffIDs[i] = layer.ucDigest
+					configChanged = true
 				}
 				changed = true
 			}
@@ -284,9 +330,10 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 				oc.History = append(oc.History[:iConfig], oc.History[iConfig+1:]...)
 			}
 			changed = true
+			configChanged = true
 			iConfig--
 		}
-		if changed && dm.config != nil {
+		if configChanged && dm.config != nil {
 			dm.config.oc.SetConfig(oc)
 			dm.config.modified = true
 		}
@@ -298,7 +345,7 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 			}
 			if dm.config.modified {
 				cRdr := bytes.NewReader(cBytes)
-				_, err = rc.BlobPut(ctx, r, dm.config.newDesc, cRdr)
+				err = mc.blobPut(ctx, rc, r, dm.config.newDesc, cRdr)
 				if err != nil {
 					return err
 				}
@@ -346,7 +393,7 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 		rPut := r
 		rPut.Tag = ""
 		rPut.Digest = dm.newDesc.Digest.String()
-		err = rc.ManifestPut(ctx, rPut, dm.m, mpOpts...)
+		err = mc.manifestPut(ctx, rc, rPut, dm.m, mpOpts...)
 		if err != nil {
 			return err
 		}
@@ -355,6 +402,129 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 	return nil
 }
 
+// dagPlatform returns the platform of a manifest from the parent index or the image config
+func dagPlatform(dm *dagManifest) *platform.Platform {
+	if dm.origDesc.Platform != nil {
+		return dm.origDesc.Platform
+	}
+	if dm.config != nil && dm.config.oc != nil {
+		oc := dm.config.oc.GetConfig()
+		if oc.OS != "" {
+			return &platform.Platform{
+				OS:           oc.OS,
+				Architecture: oc.Architecture,
+				Variant:      oc.Variant,
+				OSVersion:    oc.OSVersion,
+				OSFeatures:   oc.OSFeatures,
+			}
+		}
+	}
+	return nil
+}
+
+// blobGet returns a blob from the repository, or the pending content from a dry run
+func (dc *dagConfig) blobGet(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor) (io.ReadCloser, error) {
+	if dc.dryRun != nil {
+		return dc.dryRun.get(ctx, rc, r, d)
+	}
+	return rc.BlobGet(ctx, r, d)
+}
+
+// blobPut pushes a blob, the push is skipped and added to the plan with a dry run
+func (dc *dagConfig) blobPut(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor, rdr io.Reader) error {
+	if dc.dryRun != nil {
+		return dc.dryRun.put(ctx, rc, r, d, rdr)
+	}
+	_, err := rc.BlobPut(ctx, r, d, rdr)
+	return err
+}
+
+// blobCopy copies a blob between repositories, the copy is skipped and added to the plan with a dry run
+func (dc *dagConfig) blobCopy(ctx context.Context, rc *regclient.RegClient, rSrc, rTgt ref.Ref, d types.Descriptor) error {
+	if dc.dryRun != nil {
+		return dc.dryRun.copy(ctx, rc, rSrc, rTgt, d)
+	}
+	return rc.BlobCopy(ctx, rSrc, rTgt, d)
+}
+
+// manifestPut pushes a manifest, the push is skipped with a dry run
+func (dc *dagConfig) manifestPut(ctx context.Context, rc *regclient.RegClient, r ref.Ref, m manifest.Manifest, opts ...scheme.ManifestOpts) error {
+	if dc.dryRun != nil {
+		return nil
+	}
+	return rc.ManifestPut(ctx, r, m, opts...)
+}
+
+// dagWalkLayersParallel runs fn on layers concurrently, limited by the number of workers and the temp space budget.
+// Layers with the same digest are processed one at a time.
+func dagWalkLayersParallel(ctx context.Context, dm *dagManifest, workers int, tempBudget int64, fn func(context.Context, *dagManifest, *dagLayer) (*dagLayer, error)) error {
+	type layerJob struct {
+		dm *dagManifest
+		i  int
+	}
+	jobs := []layerJob{}
+	var collect func(*dagManifest)
+	collect = func(dm *dagManifest) {
+		for _, child := range dm.manifests {
+			if child.mod != deleted {
+				collect(child)
+			}
+		}
+		for i, layer := range dm.layers {
+			if layer.mod != deleted {
+				jobs = append(jobs, layerJob{dm: dm, i: i})
+			}
+		}
+	}
+	collect(dm)
+
+	semWorkers := semaphore.NewWeighted(int64(workers))
+	var semTemp *semaphore.Weighted
+	if tempBudget > 0 {
+		semTemp = semaphore.NewWeighted(tempBudget)
+	}
+	locks := map[digest.Digest]*sync.Mutex{}
+	eg, egCtx := errgroup.WithContext(ctx)
+	for _, job := range jobs {
+		job := job
+		dl := job.dm.layers[job.i]
+		lock, ok := locks[dl.desc.Digest]
+		if !ok {
+			lock = &sync.Mutex{}
+			locks[dl.desc.Digest] = lock
+		}
+		eg.Go(func() error {
+			lock.Lock()
+			defer lock.Unlock()
+			if semTemp != nil {
+				weight := dl.desc.Size
+				if weight > tempBudget {
+					weight = tempBudget
+				} else if weight < 1 {
+					weight = 1
+				}
+				err := semTemp.Acquire(egCtx, weight)
+				if err != nil {
+					return err
+				}
+				defer semTemp.Release(weight)
+			}
+			err := semWorkers.Acquire(egCtx, 1)
+			if err != nil {
+				return err
+			}
+			defer semWorkers.Release(1)
+			dlNew, err := fn(egCtx, job.dm, dl)
+			if err != nil {
+				return err
+			}
+			job.dm.layers[job.i] = dlNew
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
 func dagWalkManifests(dm *dagManifest, fn func(*dagManifest) (*dagManifest, error)) error {
 	if dm.manifests != nil {
 		for _, child := range dm.manifests {
@@ -372,9 +542,12 @@ func dagWalkManifests(dm *dagManifest, fn func(*dagManifest) (*dagManifest, erro
 	return nil
 }
 
-func dagWalkOCIConfig(dm *dagManifest, fn func(*dagOCIConfig) (*dagOCIConfig, error)) error {
+func dagWalkOCIConfig(dm *dagManifest, fn func(*dagManifest, *dagOCIConfig) (*dagOCIConfig, error)) error {
 	if dm.manifests != nil {
 		for _, child := range dm.manifests {
+			if child.mod == deleted {
+				continue
+			}
 			err := dagWalkOCIConfig(child, fn)
 			if err != nil {
 				return err
@@ -382,7 +555,7 @@ func dagWalkOCIConfig(dm *dagManifest, fn func(*dagOCIConfig) (*dagOCIConfig, er
 		}
 	}
 	if dm.config != nil {
-		docNew, err := fn(dm.config)
+		docNew, err := fn(dm, dm.config)
 		if err != nil {
 			return err
 		}
@@ -391,10 +564,13 @@ func dagWalkOCIConfig(dm *dagManifest, fn func(*dagOCIConfig) (*dagOCIConfig, er
 	return nil
 }
 
-func dagWalkLayers(dm *dagManifest, fn func(*dagLayer) (*dagLayer, error)) error {
+func dagWalkLayers(dm *dagManifest, fn func(*dagManifest, *dagLayer) (*dagLayer, error)) error {
 	var err error
 	if dm.manifests != nil {
 		for _, child := range dm.manifests {
+			if child.mod == deleted {
+				continue
+			}
 			err = dagWalkLayers(child, fn)
 			if err != nil {
 				return err
@@ -406,7 +582,7 @@ func dagWalkLayers(dm *dagManifest, fn func(*dagLayer) (*dagLayer, error)) error
 			if layer.mod == deleted {
 				continue
 			}
-			mlNew, err := fn(layer)
+			mlNew, err := fn(dm, layer)
 			if err != nil {
 				return err
 			}
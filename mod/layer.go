@@ -2,16 +2,96 @@ package mod
 
 import (
 	"archive/tar"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/whiteout"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/ref"
 )
 
+// WithLayerCompression converts the compression of each layer.
+// Supported types are archive.CompressNone, archive.CompressGzip, and archive.CompressZstd.
+// Layers are recompressed without changing the tar content, so the config diff_ids are unchanged.
+func WithLayerCompression(comp archive.CompressType) Opts {
+	return func(dc *dagConfig) {
+		dc.layerCompress = comp
+		dc.layerCompressSet = true
+	}
+}
+
+// WithLayerReproducible normalizes each layer so the same content always generates the same digest.
+// Entries are sorted by name, owner names, access and change times, and non-xattr PAX records are removed,
+// and the layer is recompressed with fixed compression headers.
+// Combine with WithLayerTimestampMax to also normalize the modification times.
+func WithLayerReproducible() Opts {
+	return withLayerReproducible(-1, -1)
+}
+
+// WithLayerReproducibleOwner is WithLayerReproducible with the uid and gid of every file set to the provided values.
+func WithLayerReproducibleOwner(uid, gid int) Opts {
+	return withLayerReproducible(uid, gid)
+}
+
+func withLayerReproducible(uid, gid int) Opts {
+	return func(dc *dagConfig) {
+		dc.layerReproducible = append(dc.layerReproducible, len(dc.stepsLayerFile))
+		dc.stepsLayerFile = append(dc.stepsLayerFile,
+			func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, tr io.Reader) (*tar.Header, io.Reader, changes, error) {
+				if th == nil || tr == nil {
+					return nil, nil, unchanged, fmt.Errorf("missing header or reader")
+				}
+				changed := false
+				if th.Uname != "" || th.Gname != "" {
+					th.Uname, th.Gname = "", ""
+					changed = true
+				}
+				if uid >= 0 && gid >= 0 && (th.Uid != uid || th.Gid != gid) {
+					th.Uid, th.Gid = uid, gid
+					changed = true
+				}
+				if !th.AccessTime.IsZero() || !th.ChangeTime.IsZero() {
+					th.AccessTime, th.ChangeTime = time.Time{}, time.Time{}
+					changed = true
+				}
+				if th.ModTime.Nanosecond() != 0 {
+					th.ModTime = th.ModTime.Truncate(time.Second)
+					changed = true
+				}
+				if th.Typeflag != tar.TypeChar && th.Typeflag != tar.TypeBlock && (th.Devmajor != 0 || th.Devminor != 0) {
+					th.Devmajor, th.Devminor = 0, 0
+					changed = true
+				}
+				for k := range th.PAXRecords {
+					if !strings.HasPrefix(k, "SCHILY.xattr.") {
+						delete(th.PAXRecords, k)
+						changed = true
+					}
+				}
+				// let the tar writer pick the minimal format for the header
+				th.Format = tar.FormatUnknown
+				if changed {
+					return th, tr, replaced, nil
+				}
+				return th, tr, unchanged, nil
+			},
+		)
+	}
+}
+
 // WithLayerRmCreatedBy deletes a layer based on a regex of the created by field
 // in the config history for that layer
 func WithLayerRmCreatedBy(re regexp.Regexp) Opts {
@@ -99,7 +179,7 @@ func WithLayerStripFile(file string) Opts {
 	file = strings.Trim(file, "/")
 	fileRE := regexp.MustCompile("^/?" + regexp.QuoteMeta(file) + "(/.*)?$")
 	return func(dc *dagConfig) {
-		dc.stepsLayerFile = append(dc.stepsLayerFile, func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, tr *tar.Reader) (*tar.Header, *tar.Reader, changes, error) {
+		dc.stepsLayerFile = append(dc.stepsLayerFile, func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, tr io.Reader) (*tar.Header, io.Reader, changes, error) {
 			if fileRE.Match([]byte(th.Name)) {
 				return th, tr, deleted, nil
 			}
@@ -130,7 +210,7 @@ func WithLayerTimestampFromLabel(label string) Opts {
 			return nil
 		})
 		dc.stepsLayerFile = append(dc.stepsLayerFile,
-			func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, tr *tar.Reader) (*tar.Header, *tar.Reader, changes, error) {
+			func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, tr io.Reader) (*tar.Header, io.Reader, changes, error) {
 				if t.IsZero() {
 					return nil, nil, unchanged, fmt.Errorf("timestamp not available")
 				}
@@ -163,7 +243,7 @@ func WithLayerTimestampFromLabel(label string) Opts {
 func WithLayerTimestampMax(t time.Time) Opts {
 	return func(dc *dagConfig) {
 		dc.stepsLayerFile = append(dc.stepsLayerFile,
-			func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, tr *tar.Reader) (*tar.Header, *tar.Reader, changes, error) {
+			func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, tr io.Reader) (*tar.Header, io.Reader, changes, error) {
 				changed := false
 				if th == nil || tr == nil {
 					return nil, nil, unchanged, fmt.Errorf("missing header or reader")
@@ -188,3 +268,545 @@ func WithLayerTimestampMax(t time.Time) Opts {
 		)
 	}
 }
+
+// WithLayerSquash combines a range of layers into a single layer.
+// The start and end indexes are inclusive and begin at 0.
+// Files deleted or replaced by later layers in the range are removed from the squashed layer.
+func WithLayerSquash(start, end int) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if dm.mod == deleted || dm.m.IsList() {
+				return nil
+			}
+			if start < 0 || start >= end {
+				return fmt.Errorf("invalid layer range %d-%d", start, end)
+			}
+			if end >= len(dm.layers) {
+				return fmt.Errorf("layer range %d-%d not found, image has %d layers", start, end, len(dm.layers))
+			}
+			descs := []types.Descriptor{}
+			for i := start; i <= end; i++ {
+				if dm.layers[i].mod != unchanged {
+					return fmt.Errorf("squash cannot be applied to modified layers")
+				}
+				descs = append(descs, dm.layers[i].desc)
+			}
+			d, ucDigest, err := layerSquash(ctx, rc, dc, r, descs, start == 0)
+			if err != nil {
+				return err
+			}
+			dm.layers[start] = &dagLayer{
+				mod:      replaced,
+				desc:     d,
+				newDesc:  d,
+				ucDigest: ucDigest,
+				origDesc: dm.layers[start].origDesc,
+			}
+			for i := start + 1; i <= end; i++ {
+				dm.layers[i].mod = deleted
+			}
+			// merge the history of the squashed layers, other entries are deleted with the layers
+			if dm.config != nil && dm.config.oc != nil {
+				oc := dm.config.oc.GetConfig()
+				iLayer := 0
+				iFirst := -1
+				createdBy := []string{}
+				for i, h := range oc.History {
+					if h.EmptyLayer {
+						continue
+					}
+					if iLayer == start {
+						iFirst = i
+					}
+					if iLayer >= start && iLayer <= end && h.CreatedBy != "" {
+						createdBy = append(createdBy, h.CreatedBy)
+					}
+					iLayer++
+				}
+				if iFirst >= 0 {
+					oc.History[iFirst].CreatedBy = strings.Join(createdBy, " && ")
+					oc.History[iFirst].Comment = "regclient squash"
+					dm.config.oc.SetConfig(oc)
+					dm.config.newDesc = dm.config.oc.GetDescriptor()
+					dm.config.modified = true
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// layerSquash merges the layers into a single blob, processing layers from the top down.
+// Whiteouts are only included when there may be lower layers to delete from.
+func layerSquash(ctx context.Context, rc *regclient.RegClient, dc *dagConfig, r ref.Ref, descs []types.Descriptor, bottom bool) (types.Descriptor, digest.Digest, error) {
+	// wl tracks the files written and the whiteouts from higher layers
+	wl := whiteout.NewLayers()
+
+	fh, err := os.CreateTemp("", "regclient-mod-")
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	defer fh.Close()
+	defer os.Remove(fh.Name())
+	// compress the output to match the first layer
+	digRaw := digest.Canonical.Digester()
+	digUC := digest.Canonical.Digester()
+	d := types.Descriptor{MediaType: descs[0].MediaType}
+	comp, _ := layerCompress(d.MediaType)
+	cw, err := archive.CompressWriter(io.MultiWriter(fh, digRaw.Hash()), comp)
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	tw := tar.NewWriter(io.MultiWriter(cw, digUC.Hash()))
+
+	for i := len(descs) - 1; i >= 0; i-- {
+		err = func() error {
+			br, err := dc.blobGet(ctx, rc, r, descs[i])
+			if err != nil {
+				return err
+			}
+			defer br.Close()
+			dr, err := archive.Decompress(br)
+			if err != nil {
+				return err
+			}
+			tr := tar.NewReader(dr)
+			for {
+				th, err := tr.Next()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				name := path.Clean("/" + th.Name)[1:]
+				if name == "" {
+					continue
+				}
+				if target, opaque, ok := whiteout.Parse(name); ok {
+					if !wl.AddWhiteout(target, opaque) || bottom {
+						continue
+					}
+					if opaque {
+						err = tw.WriteHeader(th)
+						if err != nil {
+							return err
+						}
+						continue
+					}
+					if isDir, ok := wl.Seen(target); ok {
+						// a directory recreated by a higher layer must not merge with the lower layers
+						if isDir && !wl.Opaque(target) {
+							err = tw.WriteHeader(&tar.Header{
+								Typeflag: tar.TypeReg,
+								Name:     path.Join(target, whiteout.Opaque),
+								Mode:     0644,
+								ModTime:  th.ModTime,
+								Format:   th.Format,
+							})
+							if err != nil {
+								return err
+							}
+						}
+						continue
+					}
+					err = tw.WriteHeader(th)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				if !wl.Add(name, th.Typeflag == tar.TypeDir) {
+					continue
+				}
+				err = tw.WriteHeader(th)
+				if err != nil {
+					return err
+				}
+				if th.Typeflag == tar.TypeReg && th.Size > 0 {
+					_, err = io.CopyN(tw, tr, th.Size)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}()
+		if err != nil {
+			return types.Descriptor{}, "", err
+		}
+		wl.Next()
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	err = cw.Close()
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	l, err := fh.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	d.Digest = digRaw.Digest()
+	d.Size = l
+	_, err = fh.Seek(0, io.SeekStart)
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	err = dc.blobPut(ctx, rc, r, d, fh)
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	return d, digUC.Digest(), nil
+}
+
+// WithLayerAddTar appends a layer from a tar file to each image.
+// The tar may be uncompressed or compressed, and is gzip compressed in the image.
+// An open func is used rather than an io.Reader since the tar is read on every Apply using these options,
+// e.g. for a dry run and again for the real run.
+func WithLayerAddTar(open func() (io.ReadCloser, error)) Opts {
+	return withLayerAdd("ADD file", "/", func(tw io.Writer) error {
+		rdr, err := open()
+		if err != nil {
+			return err
+		}
+		defer rdr.Close()
+		dr, err := archive.Decompress(rdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, dr)
+		return err
+	})
+}
+
+// WithLayerAddPath appends a layer with the file or directory from src on the local filesystem.
+// The contents are placed at dest in the image, owned by the uid and gid.
+// The mode is applied to regular files, and the source file mode is used when mode is 0.
+func WithLayerAddPath(src, dest string, uid, gid int, mode fs.FileMode) Opts {
+	dest = path.Clean("/" + dest)[1:]
+	createdBy := "COPY file"
+	if fi, err := os.Stat(src); err == nil && fi.IsDir() {
+		createdBy = "COPY dir"
+	}
+	return withLayerAdd(createdBy, "/"+dest, func(w io.Writer) error {
+		tw := tar.NewWriter(w)
+		err := filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(src, file)
+			if err != nil {
+				return err
+			}
+			name := path.Join(dest, filepath.ToSlash(rel))
+			if name == "" || name == "." {
+				return nil
+			}
+			link := ""
+			if fi.Mode()&fs.ModeSymlink != 0 {
+				link, err = os.Readlink(file)
+				if err != nil {
+					return err
+				}
+			}
+			th, err := tar.FileInfoHeader(fi, link)
+			if err != nil {
+				return err
+			}
+			th.Name = name
+			if fi.IsDir() {
+				th.Name += "/"
+			}
+			th.Format = tar.FormatPAX
+			th.Uid, th.Gid = uid, gid
+			th.Uname, th.Gname = "", ""
+			th.AccessTime, th.ChangeTime = time.Time{}, time.Time{}
+			th.ModTime = th.ModTime.Truncate(time.Second)
+			if mode != 0 && th.Typeflag == tar.TypeReg {
+				th.Mode = int64(mode.Perm())
+			}
+			err = tw.WriteHeader(th)
+			if err != nil {
+				return err
+			}
+			if th.Typeflag == tar.TypeReg && th.Size > 0 {
+				fh, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(tw, fh)
+				fh.Close()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tw.Close()
+	})
+}
+
+// withLayerAdd appends a layer to each image manifest, the layer tar is written once per Apply by the writeTar func.
+// The history of the layer is recorded in the same format as a Dockerfile ADD or COPY, e.g. "ADD file:<diff_id> in /".
+func withLayerAdd(createdBy, dest string, writeTar func(io.Writer) error) Opts {
+	return func(dc *dagConfig) {
+		step := len(dc.stepsManifest)
+		dc.stepsManifest = append(dc.stepsManifest, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if dm.mod == deleted || dm.m.IsList() {
+				return nil
+			}
+			// the blob is generated once per Apply and shared by each image
+			la, ok := dc.layerAdds[step]
+			if !ok {
+				d, ucDigest, err := layerAddBlob(ctx, rc, dc, r, writeTar)
+				if err != nil {
+					return err
+				}
+				la = &dagLayerAdd{desc: d, ucDigest: ucDigest, r: r}
+				if dc.layerAdds == nil {
+					dc.layerAdds = map[int]*dagLayerAdd{}
+				}
+				dc.layerAdds[step] = la
+			} else if !ref.EqualRepository(la.r, r) {
+				err := dc.blobCopy(ctx, rc, la.r, r, la.desc)
+				if err != nil {
+					return err
+				}
+			}
+			d, ucDigest := la.desc, la.ucDigest
+			dl := dagLayer{
+				mod:       added,
+				desc:      d,
+				newDesc:   d,
+				ucDigest:  ucDigest,
+				createdBy: fmt.Sprintf("%s:%s in %s", createdBy, ucDigest.Encoded(), dest),
+			}
+			if dm.m.GetDescriptor().MediaType == types.MediaTypeDocker2Manifest {
+				dl.desc.MediaType = types.MediaTypeDocker2Layer
+				dl.newDesc.MediaType = types.MediaTypeDocker2Layer
+			}
+			dm.layers = append(dm.layers, &dl)
+			return nil
+		})
+	}
+}
+
+// layerAddBlob pushes a gzip compressed blob with the tar output from the writeTar func
+func layerAddBlob(ctx context.Context, rc *regclient.RegClient, dc *dagConfig, r ref.Ref, writeTar func(io.Writer) error) (types.Descriptor, digest.Digest, error) {
+	fh, err := os.CreateTemp("", "regclient-mod-")
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	defer fh.Close()
+	defer os.Remove(fh.Name())
+	digRaw := digest.Canonical.Digester()
+	digUC := digest.Canonical.Digester()
+	gw := gzip.NewWriter(io.MultiWriter(fh, digRaw.Hash()))
+	err = writeTar(io.MultiWriter(gw, digUC.Hash()))
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	err = gw.Close()
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	l, err := fh.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	d := types.Descriptor{
+		MediaType: types.MediaTypeOCI1LayerGzip,
+		Digest:    digRaw.Digest(),
+		Size:      l,
+	}
+	_, err = fh.Seek(0, io.SeekStart)
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	err = dc.blobPut(ctx, rc, r, d, fh)
+	if err != nil {
+		return types.Descriptor{}, "", err
+	}
+	return d, digUC.Digest(), nil
+}
+
+// layerRecompress changes the compression of a layer blob, the uncompressed content is unchanged
+func layerRecompress(ctx context.Context, rc *regclient.RegClient, dc *dagConfig, r ref.Ref, dl *dagLayer, comp archive.CompressType) error {
+	br, err := dc.blobGet(ctx, rc, r, dl.desc)
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+	dr, err := archive.Decompress(br)
+	if err != nil {
+		return err
+	}
+	fh, err := os.CreateTemp("", "regclient-mod-")
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	defer os.Remove(fh.Name())
+	digRaw := digest.Canonical.Digester()
+	cw, err := archive.CompressWriter(io.MultiWriter(fh, digRaw.Hash()), comp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(cw, dr)
+	if err != nil {
+		return err
+	}
+	err = cw.Close()
+	if err != nil {
+		return err
+	}
+	l, err := fh.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	d := dl.desc
+	d.MediaType = layerMediaType(dl.desc.MediaType, comp)
+	d.Digest = digRaw.Digest()
+	d.Size = l
+	d.Data = nil
+	_, err = fh.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = dc.blobPut(ctx, rc, r, d, fh)
+	if err != nil {
+		return err
+	}
+	dl.newDesc = d
+	if dl.mod == unchanged {
+		dl.mod = replaced
+	}
+	return nil
+}
+
+// layerCompress returns the compression for a layer media type, false is returned for unknown media types
+func layerCompress(mt string) (archive.CompressType, bool) {
+	switch mt {
+	case types.MediaTypeDocker2Layer, types.MediaTypeOCI1LayerGzip:
+		return archive.CompressGzip, true
+	case types.MediaTypeOCI1LayerZstd:
+		return archive.CompressZstd, true
+	case types.MediaTypeOCI1Layer:
+		return archive.CompressNone, true
+	}
+	return archive.CompressNone, false
+}
+
+// layerMediaType returns the layer media type for a compression, preserving docker and unknown media types when possible
+func layerMediaType(mt string, comp archive.CompressType) string {
+	if _, ok := layerCompress(mt); !ok {
+		return mt
+	}
+	switch comp {
+	case archive.CompressGzip:
+		if mt == types.MediaTypeDocker2Layer {
+			return mt
+		}
+		return types.MediaTypeOCI1LayerGzip
+	case archive.CompressZstd:
+		return types.MediaTypeOCI1LayerZstd
+	}
+	return types.MediaTypeOCI1Layer
+}
+
+// layerTarSort buffers the entries of a layer and writes them to the tar writer sorted by name
+type layerTarSort struct {
+	tw      *tar.Writer
+	fh      *os.File
+	offset  int64
+	entries []layerTarEntry
+}
+
+type layerTarEntry struct {
+	th     *tar.Header
+	offset int64
+}
+
+func newLayerTarSort(tw *tar.Writer) (*layerTarSort, error) {
+	fh, err := os.CreateTemp("", "regclient-mod-")
+	if err != nil {
+		return nil, err
+	}
+	return &layerTarSort{tw: tw, fh: fh}, nil
+}
+
+// WriteHeader adds a new entry, the content of the entry is passed to Write
+func (ts *layerTarSort) WriteHeader(th *tar.Header) error {
+	thCopy := *th
+	ts.entries = append(ts.entries, layerTarEntry{th: &thCopy, offset: ts.offset})
+	return nil
+}
+
+func (ts *layerTarSort) Write(p []byte) (int, error) {
+	n, err := ts.fh.Write(p)
+	ts.offset += int64(n)
+	return n, err
+}
+
+// Flush writes the sorted entries to the tar writer
+func (ts *layerTarSort) Flush() error {
+	sort.SliceStable(ts.entries, func(i, j int) bool {
+		return path.Clean(ts.entries[i].th.Name) < path.Clean(ts.entries[j].th.Name)
+	})
+	// hard links must follow their target, swap the content into the first entry when sorting changes the order
+	index := map[string]int{}
+	for i, e := range ts.entries {
+		index[path.Clean(e.th.Name)] = i
+	}
+	redirect := map[string]string{}
+	for i, e := range ts.entries {
+		if e.th.Typeflag != tar.TypeLink {
+			continue
+		}
+		target := path.Clean(e.th.Linkname)
+		if name, ok := redirect[target]; ok {
+			e.th.Linkname = name
+			continue
+		}
+		t, ok := index[target]
+		if !ok || t < i {
+			continue
+		}
+		thTarget := *ts.entries[t].th
+		thTarget.Name = e.th.Name
+		thLink := *e.th
+		thLink.Name = ts.entries[t].th.Name
+		thLink.Linkname = e.th.Name
+		ts.entries[i] = layerTarEntry{th: &thTarget, offset: ts.entries[t].offset}
+		ts.entries[t] = layerTarEntry{th: &thLink}
+		redirect[target] = path.Clean(e.th.Name)
+	}
+	for _, e := range ts.entries {
+		err := ts.tw.WriteHeader(e.th)
+		if err != nil {
+			return err
+		}
+		if e.th.Typeflag == tar.TypeReg && e.th.Size > 0 {
+			_, err = io.Copy(ts.tw, io.NewSectionReader(ts.fh, e.offset, e.th.Size))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close removes the temporary file
+func (ts *layerTarSort) Close() error {
+	err := ts.fh.Close()
+	if errRm := os.Remove(ts.fh.Name()); err == nil {
+		err = errRm
+	}
+	return err
+}
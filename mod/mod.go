@@ -3,8 +3,8 @@ package mod
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"time"
@@ -13,6 +13,8 @@ import (
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/blob"
+	"github.com/regclient/regclient/types/docker/schema2"
 	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/ref"
 )
@@ -38,11 +40,24 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 		stepsManifest:  []func(context.Context, *regclient.RegClient, ref.Ref, *dagManifest) error{},
 		stepsOCIConfig: []func(context.Context, *regclient.RegClient, ref.Ref, *dagOCIConfig) error{},
 		stepsLayer:     []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer) error{},
-		stepsLayerFile: []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer, *tar.Header, *tar.Reader) (*tar.Header, *tar.Reader, changes, error){},
+		stepsLayerFile: []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer, *tar.Header, io.Reader) (*tar.Header, io.Reader, changes, error){},
 		maxDataSize:    -1, // unchanged, if a data field exists, preserve it
 	}
 	for _, opt := range opts {
 		opt(&dc)
+		dc.filterSteps()
+	}
+	if dc.dryRun != nil {
+		dir, err := os.MkdirTemp("", "regclient-mod-")
+		if err != nil {
+			return rMod, err
+		}
+		defer os.RemoveAll(dir)
+		dc.dryRun.dir = dir
+		*dc.dryRun.plan = Plan{
+			Manifests: []PlanManifest{},
+			Blobs:     []types.Descriptor{},
+		}
 	}
 
 	// pull the image metadata into a DAG
@@ -55,7 +70,12 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 	// perform manifest changes
 	if len(dc.stepsManifest) > 0 {
 		err = dagWalkManifests(dm, func(dm *dagManifest) (*dagManifest, error) {
-			for _, fn := range dc.stepsManifest {
+			for i, fn := range dc.stepsManifest {
+				if match, err := filterMatch(dc.filterManifest[i], dm); err != nil {
+					return nil, err
+				} else if !match {
+					continue
+				}
 				err := fn(ctx, rc, r, dm)
 				if err != nil {
 					return nil, err
@@ -68,8 +88,13 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 		}
 	}
 	if len(dc.stepsOCIConfig) > 0 {
-		err = dagWalkOCIConfig(dm, func(doc *dagOCIConfig) (*dagOCIConfig, error) {
-			for _, fn := range dc.stepsOCIConfig {
+		err = dagWalkOCIConfig(dm, func(dm *dagManifest, doc *dagOCIConfig) (*dagOCIConfig, error) {
+			for i, fn := range dc.stepsOCIConfig {
+				if match, err := filterMatch(dc.filterOCIConfig[i], dm); err != nil {
+					return nil, err
+				} else if !match {
+					continue
+				}
 				err := fn(ctx, rc, r, doc)
 				if err != nil {
 					return nil, err
@@ -81,23 +106,58 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 			return rMod, err
 		}
 	}
-	if len(dc.stepsLayer) > 0 || len(dc.stepsLayerFile) > 0 {
-		err = dagWalkLayers(dm, func(dl *dagLayer) (*dagLayer, error) {
+	if len(dc.stepsLayer) > 0 || len(dc.stepsLayerFile) > 0 || dc.layerCompressSet {
+		layerFn := func(ctx context.Context, dm *dagManifest, dl *dagLayer) (*dagLayer, error) {
 			if dl.mod == deleted {
 				return dl, nil
 			}
-			br, err := rc.BlobGet(ctx, r, dl.desc)
+			// select the steps matching the platform filters
+			stepsLayer := []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer) error{}
+			for i, sl := range dc.stepsLayer {
+				if match, err := filterMatch(dc.filterLayer[i], dm); err != nil {
+					return nil, err
+				} else if match {
+					stepsLayer = append(stepsLayer, sl)
+				}
+			}
+			stepsLayerFile := []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer, *tar.Header, io.Reader) (*tar.Header, io.Reader, changes, error){}
+			reproducible := false
+			for i, slf := range dc.stepsLayerFile {
+				if match, err := filterMatch(dc.filterLayerFile[i], dm); err != nil {
+					return nil, err
+				} else if match {
+					stepsLayerFile = append(stepsLayerFile, slf)
+					for _, ri := range dc.layerReproducible {
+						if ri == i {
+							reproducible = true
+						}
+					}
+				}
+			}
+			if len(stepsLayer) == 0 && len(stepsLayerFile) == 0 && !dc.layerCompressSet {
+				return dl, nil
+			}
+			// determine the compression of the output
+			inComp, knownComp := layerCompress(dl.desc.MediaType)
+			outComp := inComp
+			if dc.layerCompressSet && knownComp {
+				if dl.desc.MediaType == types.MediaTypeDocker2Layer && dc.layerCompress != archive.CompressGzip {
+					return nil, fmt.Errorf("docker layers only support gzip compression, convert the image to OCI")
+				}
+				outComp = dc.layerCompress
+			}
+			br, err := dc.blobGet(ctx, rc, r, dl.desc)
 			if err != nil {
 				return nil, err
 			}
 			defer br.Close()
-			for _, sl := range dc.stepsLayer {
+			for _, sl := range stepsLayer {
 				err = sl(ctx, rc, r, dl)
 				if err != nil {
 					return nil, err
 				}
 			}
-			if len(dc.stepsLayerFile) > 0 && dl.mod != deleted {
+			if len(stepsLayerFile) > 0 && dl.mod != deleted {
 				changed := false
 				empty := true
 				// setup tar reader to process layer
@@ -114,19 +174,27 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 				defer fh.Close()
 				defer os.Remove(fh.Name())
 				// create tar writer, optional recompress
-				var tw *tar.Writer
-				var gw *gzip.Writer
 				digRaw := digest.Canonical.Digester() // raw/compressed digest
 				digUC := digest.Canonical.Digester()  // uncompressed digest
-				if dl.desc.MediaType == types.MediaTypeDocker2Layer || dl.desc.MediaType == types.MediaTypeOCI1LayerGzip {
-					cw := io.MultiWriter(fh, digRaw.Hash())
-					gw = gzip.NewWriter(cw)
-					defer gw.Close()
-					ucw := io.MultiWriter(gw, digUC.Hash())
-					tw = tar.NewWriter(ucw)
-				} else {
-					dw := io.MultiWriter(fh, digRaw.Hash(), digUC.Hash())
-					tw = tar.NewWriter(dw)
+				cw, err := archive.CompressWriter(io.MultiWriter(fh, digRaw.Hash()), outComp)
+				if err != nil {
+					return nil, err
+				}
+				defer cw.Close()
+				tw := tar.NewWriter(io.MultiWriter(cw, digUC.Hash()))
+				// reproducible layers buffer the entries to sort them
+				var lw interface {
+					io.Writer
+					WriteHeader(*tar.Header) error
+				} = tw
+				var ts *layerTarSort
+				if reproducible {
+					ts, err = newLayerTarSort(tw)
+					if err != nil {
+						return nil, err
+					}
+					defer ts.Close()
+					lw = ts
 				}
 				// iterate over files in the layer
 				for {
@@ -138,9 +206,10 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 						return nil, err
 					}
 					changeFile := unchanged
-					for _, slf := range dc.stepsLayerFile {
+					var rdr io.Reader = tr
+					for _, slf := range stepsLayerFile {
 						var changeCur changes
-						th, tr, changeCur, err = slf(ctx, rc, r, dl, th, tr)
+						th, rdr, changeCur, err = slf(ctx, rc, r, dl, th, rdr)
 						if err != nil {
 							return nil, err
 						}
@@ -152,15 +221,15 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 							break
 						}
 					}
-					// copy th and tr to temp tar writer file
+					// copy th and rdr to temp tar writer file
 					if changeFile != deleted {
 						empty = false
-						err = tw.WriteHeader(th)
+						err = lw.WriteHeader(th)
 						if err != nil {
 							return nil, err
 						}
 						if th.Typeflag == tar.TypeReg && th.Size > 0 {
-							_, err := io.CopyN(tw, tr, th.Size)
+							_, err := io.CopyN(lw, rdr, th.Size)
 							if err != nil {
 								return nil, err
 							}
@@ -173,11 +242,18 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 					dl.mod = deleted
 					return dl, nil
 				}
-				if changed {
+				if changed || reproducible {
+					if ts != nil {
+						err = ts.Flush()
+						if err != nil {
+							return nil, err
+						}
+					}
 					// if modified, push blob
 					tw.Close()
-					if gw != nil {
-						gw.Close()
+					cw.Close()
+					if digRaw.Digest() == dl.desc.Digest {
+						return dl, nil
 					}
 					// get the file size
 					l, err := fh.Seek(0, 1)
@@ -185,6 +261,7 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 						return nil, err
 					}
 					dl.newDesc = dl.desc
+					dl.newDesc.MediaType = layerMediaType(dl.desc.MediaType, outComp)
 					dl.newDesc.Digest = digRaw.Digest()
 					dl.newDesc.Size = l
 					dl.ucDigest = digUC.Digest()
@@ -192,15 +269,35 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 					if err != nil {
 						return nil, err
 					}
-					_, err = rc.BlobPut(ctx, r, dl.newDesc, fh)
+					err = dc.blobPut(ctx, rc, r, dl.newDesc, fh)
 					if err != nil {
 						return nil, err
 					}
-					dl.mod = replaced
+					if dl.mod == unchanged {
+						dl.mod = replaced
+					}
+					return dl, nil
+				}
+			}
+			// recompress without changing the tar to preserve the diff_id
+			if outComp != inComp {
+				if br != nil {
+					br.Close()
+				}
+				err = layerRecompress(ctx, rc, &dc, r, dl, outComp)
+				if err != nil {
+					return nil, err
 				}
 			}
 			return dl, nil
-		})
+		}
+		if dc.parallel > 1 {
+			err = dagWalkLayersParallel(ctx, dm, dc.parallel, dc.parallelTemp, layerFn)
+		} else {
+			err = dagWalkLayers(dm, func(dm *dagManifest, dl *dagLayer) (*dagLayer, error) {
+				return layerFn(ctx, dm, dl)
+			})
+		}
 		if err != nil {
 			return rMod, err
 		}
@@ -210,11 +307,34 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 	if err != nil {
 		return rMod, err
 	}
-	rMod.Digest = string(dm.newDesc.Digest)
-	rMod.Tag = ""
+	if dc.dryRun != nil {
+		dc.dryRun.plan.Manifests = planManifests(dm)
+		planSortBlobs(dc.dryRun.plan)
+	}
+	// an unmodified image returns the original reference
+	if dm.newDesc.Digest != "" {
+		rMod.Digest = string(dm.newDesc.Digest)
+		rMod.Tag = ""
+	}
 	return rMod, nil
 }
 
+// WithParallel processes up to n layers concurrently.
+// Layer and file steps must be safe to call concurrently, and the resulting image is the same as processing layers one at a time.
+func WithParallel(n int) Opts {
+	return func(dc *dagConfig) {
+		dc.parallel = n
+	}
+}
+
+// WithParallelTempBudget limits the temp space used by layers processed concurrently.
+// The space for each layer is estimated from the size of the layer blob, and layers larger than the budget are processed alone.
+func WithParallelTempBudget(size int64) Opts {
+	return func(dc *dagConfig) {
+		dc.parallelTemp = size
+	}
+}
+
 // WithData sets the descriptor data field max size.
 // This also strips the data field off descriptors above the max size.
 func WithData(maxDataSize int64) Opts {
@@ -223,6 +343,78 @@ func WithData(maxDataSize int64) Opts {
 	}
 }
 
+// WithManifestToDocker converts the manifest to Docker schema2 media types.
+// Annotations, artifacts, subjects, and layers other than gzip have no Docker equivalent and return an error.
+// Combine with WithLayerCompression(archive.CompressGzip) to convert the layers.
+func WithManifestToDocker() Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(c context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			mt := dm.m.GetDescriptor().MediaType
+			switch mt {
+			case types.MediaTypeDocker2Manifest, types.MediaTypeDocker2ManifestList:
+				return nil
+			case types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ManifestList:
+			default:
+				return fmt.Errorf("cannot convert %s to docker: %w", mt, types.ErrUnsupportedMediaType)
+			}
+			var orig interface{}
+			if dm.m.IsList() {
+				ociI, err := manifest.OCIIndexFromAny(dm.m.GetOrig())
+				if err != nil {
+					return err
+				}
+				if len(ociI.Annotations) > 0 || ociI.ArtifactType != "" || ociI.Subject != nil {
+					return fmt.Errorf("index %s has annotations, an artifact type, or a subject: %w", dm.m.GetDescriptor().Digest, types.ErrUnsupported)
+				}
+				orig = schema2.ManifestList{
+					Versioned: schema2.ManifestListSchemaVersion,
+					Manifests: ociI.Manifests,
+				}
+			} else {
+				ociM, err := manifest.OCIManifestFromAny(dm.m.GetOrig())
+				if err != nil {
+					return err
+				}
+				if len(ociM.Annotations) > 0 || ociM.ArtifactType != "" || ociM.Subject != nil {
+					return fmt.Errorf("manifest %s has annotations, an artifact type, or a subject: %w", dm.m.GetDescriptor().Digest, types.ErrUnsupported)
+				}
+				if ociM.Config.MediaType != types.MediaTypeOCI1ImageConfig && ociM.Config.MediaType != types.MediaTypeDocker2ImageConfig {
+					return fmt.Errorf("manifest %s config %s is not an image: %w", dm.m.GetDescriptor().Digest, ociM.Config.MediaType, types.ErrUnsupportedMediaType)
+				}
+				recompress := dc.layerCompressSet && dc.layerCompress == archive.CompressGzip
+				for i, l := range ociM.Layers {
+					comp, ok := layerCompress(l.MediaType)
+					if !ok || (comp != archive.CompressGzip && !recompress) {
+						return fmt.Errorf("manifest %s layer %d media type %s: %w", dm.m.GetDescriptor().Digest, i, l.MediaType, types.ErrUnsupportedMediaType)
+					}
+					if l.MediaType == types.MediaTypeOCI1LayerGzip {
+						ociM.Layers[i].MediaType = types.MediaTypeDocker2Layer
+					}
+				}
+				for _, dl := range dm.layers {
+					if dl.desc.MediaType == types.MediaTypeOCI1LayerGzip {
+						dl.desc.MediaType = types.MediaTypeDocker2Layer
+					}
+					if dl.newDesc.MediaType == types.MediaTypeOCI1LayerGzip {
+						dl.newDesc.MediaType = types.MediaTypeDocker2Layer
+					}
+				}
+				ociM.Config.MediaType = types.MediaTypeDocker2ImageConfig
+				err = manifestConfigMediaType(dm, types.MediaTypeDocker2ImageConfig)
+				if err != nil {
+					return err
+				}
+				orig = schema2.Manifest{
+					Versioned: schema2.ManifestSchemaVersion,
+					Config:    ociM.Config,
+					Layers:    ociM.Layers,
+				}
+			}
+			return manifestReplace(dm, orig)
+		})
+	}
+}
+
 // WithManifestToOCI converts the manifest to OCI media types
 func WithManifestToOCI() Opts {
 	return func(dc *dagConfig) {
@@ -231,15 +423,15 @@ func WithManifestToOCI() Opts {
 			case types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ManifestList:
 				return nil
 			}
-			om := dm.m.GetOrig()
+			var orig interface{}
 			if dm.m.IsList() {
-				ociM, err := manifest.OCIIndexFromAny(om)
+				ociI, err := manifest.OCIIndexFromAny(dm.m.GetOrig())
 				if err != nil {
 					return err
 				}
-				om = ociM
+				orig = ociI
 			} else {
-				ociM, err := manifest.OCIManifestFromAny(om)
+				ociM, err := manifest.OCIManifestFromAny(dm.m.GetOrig())
 				if err != nil {
 					return err
 				}
@@ -248,12 +440,54 @@ func WithManifestToOCI() Opts {
 						ociM.Layers[i].MediaType = types.MediaTypeOCI1LayerGzip
 					}
 				}
-				om = ociM
+				for _, dl := range dm.layers {
+					if dl.desc.MediaType == types.MediaTypeDocker2Layer {
+						dl.desc.MediaType = types.MediaTypeOCI1LayerGzip
+					}
+					if dl.newDesc.MediaType == types.MediaTypeDocker2Layer {
+						dl.newDesc.MediaType = types.MediaTypeOCI1LayerGzip
+					}
+				}
+				if ociM.Config.MediaType == types.MediaTypeDocker2ImageConfig {
+					ociM.Config.MediaType = types.MediaTypeOCI1ImageConfig
+					err = manifestConfigMediaType(dm, types.MediaTypeOCI1ImageConfig)
+					if err != nil {
+						return err
+					}
+				}
+				orig = ociM
 			}
-			dm.m.SetOrig(om)
-			dm.newDesc = dm.m.GetDescriptor()
-			dm.mod = replaced
-			return nil
+			return manifestReplace(dm, orig)
 		})
 	}
 }
+
+// manifestConfigMediaType changes the media type of the config descriptor without changing the content
+func manifestConfigMediaType(dm *dagManifest, mt string) error {
+	if dm.config == nil || dm.config.oc == nil {
+		return nil
+	}
+	raw, err := dm.config.oc.RawBody()
+	if err != nil {
+		return err
+	}
+	d := dm.config.oc.GetDescriptor()
+	d.MediaType = mt
+	dm.config.oc = blob.NewOCIConfig(blob.WithDesc(d), blob.WithRawBody(raw))
+	dm.config.newDesc = dm.config.oc.GetDescriptor()
+	return nil
+}
+
+// manifestReplace replaces the manifest with a new manifest that may have a different media type
+func manifestReplace(dm *dagManifest, orig interface{}) error {
+	m, err := manifest.New(manifest.WithOrig(orig), manifest.WithRef(dm.m.GetRef()))
+	if err != nil {
+		return err
+	}
+	dm.m = m
+	dm.newDesc = m.GetDescriptor()
+	if dm.mod == unchanged {
+		dm.mod = replaced
+	}
+	return nil
+}
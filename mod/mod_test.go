@@ -1,16 +1,29 @@
 package mod
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
 	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
 )
@@ -57,6 +70,33 @@ func TestMod(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to parse platform specific descriptor: %v", err)
 	}
+	r1, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+	}
+	rBaseNew, err := Apply(ctx, rc, r1, WithLayerTimestampMax(tTime))
+	if err != nil {
+		t.Errorf("failed to create new base image: %v", err)
+	}
+	layerTar := &bytes.Buffer{}
+	tw := tar.NewWriter(layerTar)
+	err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "etc/added", Mode: 0644, Size: 5})
+	if err != nil {
+		t.Errorf("failed to write tar header: %v", err)
+	}
+	_, err = tw.Write([]byte("added"))
+	if err != nil {
+		t.Errorf("failed to write tar content: %v", err)
+	}
+	tw.Close()
+	layerTarOpen := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(layerTar.Bytes())), nil
+	}
+	addDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(addDir, "ca.pem"), []byte("certificate"), 0600)
+	if err != nil {
+		t.Errorf("failed to create file: %v", err)
+	}
 
 	// define tests
 	tests := []struct {
@@ -64,7 +104,10 @@ func TestMod(t *testing.T) {
 		opts     []Opts
 		ref      string
 		wantErr  error
-		wantSame bool // if the resulting image should be unchanged
+		wantSame bool               // if the resulting image should be unchanged
+		wantAdd  map[string]addFile // content of a layer added to each image
+		wantBy   string             // history created by for the added layer, formatted with the diff_id
+		rebase   []ref.Ref          // old and new base to verify a rebased image
 	}{
 		{
 			name: "To OCI",
@@ -74,6 +117,31 @@ func TestMod(t *testing.T) {
 			ref:      "ocidir://testrepo:v1",
 			wantSame: true,
 		},
+		{
+			name: "To Docker",
+			opts: []Opts{
+				WithManifestToDocker(),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "To Docker with annotations",
+			opts: []Opts{
+				WithAnnotation("org.example.test", "hello"),
+				WithManifestToDocker(),
+			},
+			ref:     "ocidir://testrepo:v1",
+			wantErr: types.ErrUnsupported,
+		},
+		{
+			name: "To Docker with zstd layers",
+			opts: []Opts{
+				WithLayerCompression(archive.CompressZstd),
+				WithManifestToDocker(),
+			},
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("docker layers only support gzip compression, convert the image to OCI"),
+		},
 		{
 			name: "Add Annotation",
 			opts: []Opts{
@@ -200,6 +268,196 @@ func TestMod(t *testing.T) {
 			ref:     r3amd.CommonName(),
 			wantErr: fmt.Errorf("layer not found"),
 		},
+		{
+			name: "Rebase",
+			opts: []Opts{
+				WithRebase(r1, rBaseNew),
+			},
+			ref:    "ocidir://testrepo:v1",
+			rebase: []ref.Ref{r1, rBaseNew},
+		},
+		{
+			name: "Rebase single platform",
+			opts: []Opts{
+				WithRebase(r1, rBaseNew),
+			},
+			ref:    r3amd.CommonName(),
+			rebase: []ref.Ref{r1, rBaseNew},
+		},
+		{
+			name: "Rebase mismatch",
+			opts: []Opts{
+				WithRebase(r3, rBaseNew),
+			},
+			ref:     "ocidir://testrepo:v1",
+			wantErr: types.ErrMismatch,
+		},
+		{
+			name: "Rebase missing platform",
+			opts: []Opts{
+				WithRebase(r1, rBaseNew),
+			},
+			ref:     "ocidir://testrepo:v3",
+			wantErr: types.ErrNotFound,
+		},
+		{
+			name: "Layer Squash",
+			opts: []Opts{
+				WithLayerSquash(1, 2),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Layer Squash missing",
+			opts: []Opts{
+				WithLayerSquash(1, 5),
+			},
+			ref:     r3amd.CommonName(),
+			wantErr: fmt.Errorf("layer range 1-5 not found, image has 3 layers"),
+		},
+		{
+			name: "Layer Add Tar",
+			opts: []Opts{
+				WithLayerAddTar(layerTarOpen),
+			},
+			ref: "ocidir://testrepo:v3",
+			wantAdd: map[string]addFile{
+				"etc/added": {mode: 0644, content: "added"},
+			},
+			wantBy: "ADD file:%s in /",
+		},
+		{
+			name: "Layer Add Path",
+			opts: []Opts{
+				WithLayerAddPath(filepath.Join(addDir, "ca.pem"), "/etc/ssl/certs/ca.pem", 0, 0, 0644),
+			},
+			ref: "ocidir://testrepo:v1",
+			wantAdd: map[string]addFile{
+				"etc/ssl/certs/ca.pem": {mode: 0644, content: "certificate"},
+			},
+			wantBy: "COPY file:%s in /etc/ssl/certs/ca.pem",
+		},
+		{
+			name: "Layer Add Dir",
+			opts: []Opts{
+				WithLayerAddPath(addDir, "/etc/ssl/certs", 1000, 1000, 0),
+			},
+			ref: r3amd.CommonName(),
+			wantAdd: map[string]addFile{
+				"etc/ssl/certs/":       {uid: 1000, gid: 1000, dir: true},
+				"etc/ssl/certs/ca.pem": {uid: 1000, gid: 1000, mode: 0600, content: "certificate"},
+			},
+			wantBy: "COPY dir:%s in /etc/ssl/certs",
+		},
+		{
+			name: "Set env",
+			opts: []Opts{
+				WithEnv("PATH", "/bin"),
+				WithEnv("HELLO", "world"),
+			},
+			ref: "ocidir://testrepo:v1",
+		},
+		{
+			name: "Set env unchanged",
+			opts: []Opts{
+				WithEnv("PATH", "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"),
+			},
+			ref:      "ocidir://testrepo:v1",
+			wantSame: true,
+		},
+		{
+			name: "Rm env",
+			opts: []Opts{
+				WithEnvRm("PATH"),
+			},
+			ref: "ocidir://testrepo:v1",
+		},
+		{
+			name: "Rm env missing",
+			opts: []Opts{
+				WithEnvRm("HELLO"),
+			},
+			ref:      "ocidir://testrepo:v1",
+			wantSame: true,
+		},
+		{
+			name: "Set entrypoint and cmd",
+			opts: []Opts{
+				WithEntrypoint([]string{"/app"}),
+				WithCmd([]string{"--help"}),
+			},
+			ref: "ocidir://testrepo:v1",
+		},
+		{
+			name: "Set user, workdir, and stop signal",
+			opts: []Opts{
+				WithUser("1000:1000"),
+				WithWorkingDir("/app"),
+				WithStopSignal("SIGINT"),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Set workdir unchanged",
+			opts: []Opts{
+				WithWorkingDir("/"),
+			},
+			ref:      "ocidir://testrepo:v1",
+			wantSame: true,
+		},
+		{
+			name: "Set healthcheck",
+			opts: []Opts{
+				WithHealthcheck(&v1.HealthConfig{Test: []string{"CMD", "/app", "health"}, Interval: time.Second * 30}),
+			},
+			ref: "ocidir://testrepo:v1",
+		},
+		{
+			name: "Rm healthcheck missing",
+			opts: []Opts{
+				WithHealthcheck(nil),
+			},
+			ref:      "ocidir://testrepo:v1",
+			wantSame: true,
+		},
+		{
+			name: "Layer Compression zstd",
+			opts: []Opts{
+				WithLayerCompression(archive.CompressZstd),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Layer Compression uncompressed with timestamp",
+			opts: []Opts{
+				WithLayerCompression(archive.CompressNone),
+				WithLayerTimestampMax(tTime),
+			},
+			ref: "ocidir://testrepo:v1",
+		},
+		{
+			name: "Layer Compression unchanged",
+			opts: []Opts{
+				WithLayerCompression(archive.CompressGzip),
+			},
+			ref:      "ocidir://testrepo:v1",
+			wantSame: true,
+		},
+		{
+			name: "Layer Reproducible",
+			opts: []Opts{
+				WithLayerReproducible(),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Layer Reproducible with owner",
+			opts: []Opts{
+				WithLayerReproducibleOwner(1000, 1000),
+				WithLayerTimestampMax(tTime),
+			},
+			ref: "ocidir://testrepo:v1",
+		},
 		{
 			name: "Add volume",
 			opts: []Opts{
@@ -237,6 +495,47 @@ func TestMod(t *testing.T) {
 			},
 			ref: "ocidir://testrepo:v1",
 		},
+		{
+			name: "Platform filter",
+			opts: []Opts{
+				WithPlatformFilter("linux/arm64"),
+				WithLabel("arm64", "only"),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Platform filter missing",
+			opts: []Opts{
+				WithPlatformFilter("linux/s390x"),
+				WithLabel("s390x", "only"),
+			},
+			ref:      "ocidir://testrepo:v3",
+			wantSame: true,
+		},
+		{
+			name: "Platform filter invalid",
+			opts: []Opts{
+				WithPlatformFilter("linux/amd64!"),
+				WithLabel("invalid", "platform"),
+			},
+			ref:     "ocidir://testrepo:v3",
+			wantErr: fmt.Errorf("invalid platform component amd64! in linux/amd64!"),
+		},
+		{
+			name: "Platform rm",
+			opts: []Opts{
+				WithPlatformRm("linux/arm/*"),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Platform rm all",
+			opts: []Opts{
+				WithPlatformRm("linux/*"),
+			},
+			ref:     "ocidir://testrepo:v3",
+			wantErr: fmt.Errorf("cannot remove every platform from ocidir://testrepo:v3"),
+		},
 	}
 
 	// run tests
@@ -247,6 +546,11 @@ func TestMod(t *testing.T) {
 				t.Errorf("failed creating ref: %v", err)
 				return
 			}
+			// the expected rebase is computed before the tags are modified
+			var wantRebase map[string]rebaseExpect
+			if len(tt.rebase) == 2 {
+				wantRebase = rebaseExpected(t, ctx, rc, r, tt.rebase[0], tt.rebase[1])
+			}
 			// run mod with opts
 			rMod, err := Apply(ctx, rc, r, tt.opts...)
 			if tt.wantErr != nil {
@@ -270,6 +574,1099 @@ func TestMod(t *testing.T) {
 					t.Errorf("digest did not change")
 				}
 			}
+			if tt.wantAdd != nil {
+				checkLayerAdd(t, ctx, rc, rMod, tt.wantAdd, tt.wantBy)
+			}
+			if wantRebase != nil {
+				checkRebase(t, ctx, rc, rMod, tt.rebase[1], wantRebase)
+			}
+		})
+	}
+}
+
+// testImage is the manifest and config for a single platform
+type testImage struct {
+	m      manifest.Manifest
+	layers []types.Descriptor
+	conf   v1.Image
+}
+
+// testImages returns the image for each platform, or the single image when r is not an index
+func testImages(t *testing.T, ctx context.Context, rc *regclient.RegClient, r ref.Ref) map[string]testImage {
+	t.Helper()
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	ml := []manifest.Manifest{m}
+	if m.IsList() {
+		ml = []manifest.Manifest{}
+		dl, err := m.GetManifestList()
+		if err != nil {
+			t.Fatalf("failed to get manifest list: %v", err)
+		}
+		for _, d := range dl {
+			mc, err := rc.ManifestGet(ctx, r, regclient.ManifestWithDesc(d))
+			if err != nil {
+				t.Fatalf("failed to get manifest %s: %v", d.Digest.String(), err)
+			}
+			ml = append(ml, mc)
+		}
+	}
+	images := map[string]testImage{}
+	for _, m := range ml {
+		layers, err := m.GetLayers()
+		if err != nil {
+			t.Fatalf("failed to get layers: %v", err)
+		}
+		cd, err := m.GetConfig()
+		if err != nil {
+			t.Fatalf("failed to get config descriptor: %v", err)
+		}
+		oc, err := rc.BlobGetOCIConfig(ctx, r, cd)
+		if err != nil {
+			t.Fatalf("failed to get config: %v", err)
+		}
+		conf := oc.GetConfig()
+		p := platform.Platform{OS: conf.OS, Architecture: conf.Architecture, Variant: conf.Variant}
+		images[p.String()] = testImage{m: m, layers: layers, conf: conf}
+	}
+	return images
+}
+
+// rebaseExpect is the expected content of a rebased image
+type rebaseExpect struct {
+	layers    []digest.Digest
+	diffIDs   []digest.Digest
+	createdBy []string
+	baseDig   digest.Digest // base digest annotation on the top manifest
+}
+
+// rebaseExpected returns the expected result of rebasing each platform of r from rOld to rNew
+func rebaseExpected(t *testing.T, ctx context.Context, rc *regclient.RegClient, r, rOld, rNew ref.Ref) map[string]rebaseExpect {
+	t.Helper()
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	mOld, err := rc.ManifestGet(ctx, rOld)
+	if err != nil {
+		t.Fatalf("failed to get old base: %v", err)
+	}
+	mNew, err := rc.ManifestGet(ctx, rNew)
+	if err != nil {
+		t.Fatalf("failed to get new base: %v", err)
+	}
+	expect := map[string]rebaseExpect{}
+	for p, img := range testImages(t, ctx, rc, r) {
+		plat, err := platform.Parse(p)
+		if err != nil {
+			t.Fatalf("failed to parse platform %s: %v", p, err)
+		}
+		mOldPlat, confOld, err := rebaseGetBase(ctx, rc, rOld, mOld, plat)
+		if err != nil {
+			t.Fatalf("failed to get old base for %s: %v", p, err)
+		}
+		mNewPlat, confNew, err := rebaseGetBase(ctx, rc, rNew, mNew, plat)
+		if err != nil {
+			t.Fatalf("failed to get new base for %s: %v", p, err)
+		}
+		layersOld, err := mOldPlat.GetLayers()
+		if err != nil {
+			t.Fatalf("failed to get old base layers: %v", err)
+		}
+		layersNew, err := mNewPlat.GetLayers()
+		if err != nil {
+			t.Fatalf("failed to get new base layers: %v", err)
+		}
+		re := rebaseExpect{baseDig: mNewPlat.GetDescriptor().Digest}
+		if m.IsList() {
+			re.baseDig = mNew.GetDescriptor().Digest
+		}
+		for _, l := range layersNew {
+			re.layers = append(re.layers, l.Digest)
+		}
+		for _, l := range img.layers[len(layersOld):] {
+			re.layers = append(re.layers, l.Digest)
+		}
+		re.diffIDs = append(append(re.diffIDs, confNew.RootFS.DiffIDs...), img.conf.RootFS.DiffIDs[len(confOld.RootFS.DiffIDs):]...)
+		for _, h := range confNew.History {
+			re.createdBy = append(re.createdBy, h.CreatedBy)
+		}
+		// skip the image history through the last layer of the old base, and any matching empty layer entries that follow
+		iHist, iOld := 0, 0
+		for layers := len(confOld.RootFS.DiffIDs); layers > 0 && iHist < len(img.conf.History); iHist++ {
+			if !img.conf.History[iHist].EmptyLayer {
+				layers--
+			}
+		}
+		for layers := len(confOld.RootFS.DiffIDs); layers > 0 && iOld < len(confOld.History); iOld++ {
+			if !confOld.History[iOld].EmptyLayer {
+				layers--
+			}
+		}
+		for iHist < len(img.conf.History) && iOld < len(confOld.History) && img.conf.History[iHist].CreatedBy == confOld.History[iOld].CreatedBy {
+			iHist++
+			iOld++
+		}
+		for _, h := range img.conf.History[iHist:] {
+			re.createdBy = append(re.createdBy, h.CreatedBy)
+		}
+		expect[p] = re
+	}
+	return expect
+}
+
+// checkRebase verifies the layers, diff_ids, history, and base annotations of a rebased image
+func checkRebase(t *testing.T, ctx context.Context, rc *regclient.RegClient, r, rNew ref.Ref, expect map[string]rebaseExpect) {
+	t.Helper()
+	images := testImages(t, ctx, rc, r)
+	if len(images) != len(expect) {
+		t.Errorf("unexpected platforms, expected %d, received %d", len(expect), len(images))
+	}
+	for p, re := range expect {
+		img, ok := images[p]
+		if !ok {
+			t.Errorf("platform %s missing", p)
+			continue
+		}
+		layers := []digest.Digest{}
+		for _, l := range img.layers {
+			layers = append(layers, l.Digest)
+		}
+		if !reflect.DeepEqual(layers, re.layers) {
+			t.Errorf("unexpected layers for %s, expected %v, received %v", p, re.layers, layers)
+		}
+		if !reflect.DeepEqual(img.conf.RootFS.DiffIDs, re.diffIDs) {
+			t.Errorf("unexpected diff_ids for %s, expected %v, received %v", p, re.diffIDs, img.conf.RootFS.DiffIDs)
+		}
+		createdBy := []string{}
+		for _, h := range img.conf.History {
+			createdBy = append(createdBy, h.CreatedBy)
+		}
+		if !reflect.DeepEqual(createdBy, re.createdBy) {
+			t.Errorf("unexpected history for %s, expected %v, received %v", p, re.createdBy, createdBy)
+		}
+		// the top manifest always has the base annotations
+		m, err := rc.ManifestGet(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		ma, ok := m.(manifest.Annotator)
+		if !ok {
+			t.Fatalf("manifest does not support annotations")
+		}
+		annot, err := ma.GetAnnotations()
+		if err != nil {
+			t.Fatalf("failed to get annotations: %v", err)
+		}
+		if annot[annoBaseName] != rNew.CommonName() || annot[annoBaseDig] != re.baseDig.String() {
+			t.Errorf("unexpected base annotations, expected %s@%s, received %v", rNew.CommonName(), re.baseDig.String(), annot)
+		}
+	}
+}
+
+type addFile struct {
+	uid, gid int
+	mode     int64
+	dir      bool
+	content  string
+}
+
+// checkLayerAdd verifies the last layer of each image matches the expected files, diff_id, and history
+func checkLayerAdd(t *testing.T, ctx context.Context, rc *regclient.RegClient, r ref.Ref, want map[string]addFile, wantBy string) {
+	t.Helper()
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	ml := []manifest.Manifest{m}
+	if m.IsList() {
+		ml = []manifest.Manifest{}
+		dl, err := m.GetManifestList()
+		if err != nil {
+			t.Fatalf("failed to get manifest list: %v", err)
+		}
+		for _, d := range dl {
+			mc, err := rc.ManifestGet(ctx, r, regclient.ManifestWithDesc(d))
+			if err != nil {
+				t.Fatalf("failed to get manifest %s: %v", d.Digest.String(), err)
+			}
+			ml = append(ml, mc)
+		}
+	}
+	for _, m := range ml {
+		layers, err := m.GetLayers()
+		if err != nil || len(layers) == 0 {
+			t.Fatalf("failed to get layers: %v", err)
+		}
+		cd, err := m.GetConfig()
+		if err != nil {
+			t.Fatalf("failed to get config descriptor: %v", err)
+		}
+		oc, err := rc.BlobGetOCIConfig(ctx, r, cd)
+		if err != nil {
+			t.Fatalf("failed to get config: %v", err)
+		}
+		conf := oc.GetConfig()
+		if len(conf.RootFS.DiffIDs) != len(layers) {
+			t.Fatalf("diff_ids do not match layers, %d != %d", len(conf.RootFS.DiffIDs), len(layers))
+		}
+		diffID := conf.RootFS.DiffIDs[len(layers)-1]
+		history := []v1.History{}
+		for _, h := range conf.History {
+			if !h.EmptyLayer {
+				history = append(history, h)
+			}
+		}
+		if len(history) != len(layers) {
+			t.Errorf("history does not match layers, %d != %d", len(history), len(layers))
+		} else if expect := fmt.Sprintf(wantBy, diffID.Encoded()); history[len(history)-1].CreatedBy != expect {
+			t.Errorf("unexpected history, expected %s, received %s", expect, history[len(history)-1].CreatedBy)
+		}
+		br, err := rc.BlobGet(ctx, r, layers[len(layers)-1])
+		if err != nil {
+			t.Fatalf("failed to get layer: %v", err)
+		}
+		dr, err := archive.Decompress(br)
+		if err != nil {
+			t.Fatalf("failed to decompress layer: %v", err)
+		}
+		digUC := digest.Canonical.Digester()
+		tr := tar.NewReader(io.TeeReader(dr, digUC.Hash()))
+		found := map[string]bool{}
+		for {
+			th, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read layer: %v", err)
+			}
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", th.Name, err)
+			}
+			wf, ok := want[th.Name]
+			if !ok {
+				t.Errorf("unexpected file %s", th.Name)
+				continue
+			}
+			found[th.Name] = true
+			if th.Uid != wf.uid || th.Gid != wf.gid || (th.Typeflag == tar.TypeDir) != wf.dir || string(b) != wf.content {
+				t.Errorf("unexpected file %s, uid %d, gid %d, type %c, content %s", th.Name, th.Uid, th.Gid, th.Typeflag, string(b))
+			}
+			if !wf.dir && th.Mode != wf.mode {
+				t.Errorf("unexpected mode for %s, expected %o, received %o", th.Name, wf.mode, th.Mode)
+			}
+		}
+		_, err = io.Copy(io.Discard, tr)
+		if err == nil {
+			_, err = io.Copy(digUC.Hash(), dr)
+		}
+		br.Close()
+		if err != nil {
+			t.Fatalf("failed to read layer: %v", err)
+		}
+		if digUC.Digest() != diffID {
+			t.Errorf("diff_id mismatch, expected %s, received %s", diffID.String(), digUC.Digest().String())
+		}
+		for name := range want {
+			if !found[name] {
+				t.Errorf("missing file %s", name)
+			}
+		}
+	}
+}
+
+func TestLayerSquash(t *testing.T) {
+	ctx := context.Background()
+	rc := regclient.New(regclient.WithFS(rwfs.MemNew()))
+	r, err := ref.New("ocidir://squash:latest")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	type tarFile struct {
+		name     string
+		typeflag byte
+		content  string
+	}
+	layers := [][]tarFile{
+		{
+			{name: "etc/", typeflag: tar.TypeDir},
+			{name: "etc/a", typeflag: tar.TypeReg, content: "a"},
+			{name: "etc/b", typeflag: tar.TypeReg, content: "b"},
+			{name: "opt/old/file", typeflag: tar.TypeReg, content: "old"},
+			{name: "usr/bin/app", typeflag: tar.TypeReg, content: "app"},
+			{name: ".wh.data", typeflag: tar.TypeReg},
+		},
+		{
+			{name: "etc/.wh.b", typeflag: tar.TypeReg},
+			{name: "etc/a", typeflag: tar.TypeReg, content: "changed"},
+			{name: "opt/.wh..wh..opq", typeflag: tar.TypeReg},
+			{name: "opt/new", typeflag: tar.TypeReg, content: "new"},
+			{name: "var/.wh.log", typeflag: tar.TypeReg},
+			{name: "data/", typeflag: tar.TypeDir},
+		},
+	}
+	descs := []types.Descriptor{}
+	for _, files := range layers {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, f := range files {
+			err = tw.WriteHeader(&tar.Header{
+				Typeflag: f.typeflag,
+				Name:     f.name,
+				Mode:     0644,
+				Size:     int64(len(f.content)),
+			})
+			if err != nil {
+				t.Fatalf("failed to write tar header: %v", err)
+			}
+			_, err = tw.Write([]byte(f.content))
+			if err != nil {
+				t.Fatalf("failed to write tar content: %v", err)
+			}
+		}
+		tw.Close()
+		d := types.Descriptor{
+			MediaType: types.MediaTypeOCI1Layer,
+			Digest:    digest.FromBytes(buf.Bytes()),
+			Size:      int64(buf.Len()),
+		}
+		_, err = rc.BlobPut(ctx, r, d, bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("failed to put layer: %v", err)
+		}
+		descs = append(descs, d)
+	}
+
+	tests := []struct {
+		name   string
+		bottom bool
+		expect map[string]string
+	}{
+		{
+			name:   "bottom",
+			bottom: true,
+			expect: map[string]string{
+				"etc/":        "",
+				"etc/a":       "changed",
+				"opt/new":     "new",
+				"usr/bin/app": "app",
+				"data/":       "",
+			},
+		},
+		{
+			name: "middle",
+			expect: map[string]string{
+				"etc/":              "",
+				"etc/a":             "changed",
+				"etc/.wh.b":         "",
+				"opt/.wh..wh..opq":  "",
+				"opt/new":           "new",
+				"usr/bin/app":       "app",
+				"var/.wh.log":       "",
+				"data/":             "",
+				"data/.wh..wh..opq": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ucDigest, err := layerSquash(ctx, rc, &dagConfig{}, r, descs, tt.bottom)
+			if err != nil {
+				t.Fatalf("failed to squash: %v", err)
+			}
+			if d.MediaType != types.MediaTypeOCI1Layer || d.Digest != ucDigest {
+				t.Errorf("unexpected descriptor for uncompressed layer: %v, %s", d, ucDigest.String())
+			}
+			br, err := rc.BlobGet(ctx, r, d)
+			if err != nil {
+				t.Fatalf("failed to get squashed layer: %v", err)
+			}
+			defer br.Close()
+			found := map[string]string{}
+			tr := tar.NewReader(br)
+			for {
+				th, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("failed to read squashed layer: %v", err)
+				}
+				b, err := io.ReadAll(tr)
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", th.Name, err)
+				}
+				if _, ok := found[th.Name]; ok {
+					t.Errorf("duplicate entry %s", th.Name)
+				}
+				found[th.Name] = string(b)
+			}
+			if !reflect.DeepEqual(found, tt.expect) {
+				t.Errorf("unexpected content, expected %v, received %v", tt.expect, found)
+			}
+		})
+	}
+}
+
+func TestLayerAddReuse(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	dir := t.TempDir()
+	file := filepath.Join(dir, "reuse.txt")
+	err = os.WriteFile(file, []byte("first"), 0644)
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	opt := WithLayerAddPath(file, "/reuse.txt", 0, 0, 0644)
+	r1, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	r3, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	// the same options may be used concurrently
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, r := range []ref.Ref{r1, r3} {
+		wg.Add(1)
+		go func(i int, r ref.Ref) {
+			defer wg.Done()
+			_, errs[i] = Apply(ctx, rc, r, opt)
+		}(i, r)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("failed to apply: %v", err)
+		}
+	}
+	// changes to the local file are included when the options are reused
+	err = os.WriteFile(file, []byte("second"), 0644)
+	if err != nil {
+		t.Fatalf("failed to update file: %v", err)
+	}
+	rMod, err := Apply(ctx, rc, r1, opt)
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	checkLayerAdd(t, ctx, rc, rMod, map[string]addFile{
+		"reuse.txt": {mode: 0644, content: "second"},
+	}, "COPY file:%s in /reuse.txt")
+}
+
+func TestLayerReproducible(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	r, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rMod, err := Apply(ctx, rc, r, WithLayerReproducible())
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	if rMod.Digest == "" {
+		t.Fatalf("digest missing")
+	}
+	rRepeat, err := Apply(ctx, rc, rMod, WithLayerReproducible())
+	if err != nil {
+		t.Fatalf("failed to apply again: %v", err)
+	}
+	if rMod.Digest != rRepeat.Digest {
+		t.Errorf("digest changed on second run, expected %s, received %s", rMod.Digest, rRepeat.Digest)
+	}
+}
+
+func TestLayerTarSort(t *testing.T) {
+	files := []*tar.Header{
+		{Typeflag: tar.TypeReg, Name: "usr/bin/b", Size: 1},
+		{Typeflag: tar.TypeDir, Name: "usr/"},
+		{Typeflag: tar.TypeLink, Name: "usr/bin/a", Linkname: "usr/bin/b"},
+		{Typeflag: tar.TypeLink, Name: "usr/bin/a2", Linkname: "usr/bin/b"},
+		{Typeflag: tar.TypeReg, Name: "etc/c", Size: 2},
+		{Typeflag: tar.TypeDir, Name: "usr/bin/"},
+	}
+	content := map[string]string{
+		"usr/bin/b": "b",
+		"etc/c":     "cc",
+	}
+	expect := []struct {
+		name, linkname, content string
+	}{
+		{name: "etc/c", content: "cc"},
+		{name: "usr/"},
+		{name: "usr/bin/"},
+		{name: "usr/bin/a", content: "b"},
+		{name: "usr/bin/a2", linkname: "usr/bin/a"},
+		{name: "usr/bin/b", linkname: "usr/bin/a"},
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	ts, err := newLayerTarSort(tw)
+	if err != nil {
+		t.Fatalf("failed to create sort: %v", err)
+	}
+	defer ts.Close()
+	for _, th := range files {
+		err = ts.WriteHeader(th)
+		if err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		_, err = ts.Write([]byte(content[th.Name]))
+		if err != nil {
+			t.Fatalf("failed to write content: %v", err)
+		}
+	}
+	err = ts.Flush()
+	if err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	tw.Close()
+	tr := tar.NewReader(buf)
+	for i, e := range expect {
+		th, err := tr.Next()
+		if err != nil {
+			t.Fatalf("failed to read entry %d: %v", i, err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", th.Name, err)
+		}
+		if th.Name != e.name || th.Linkname != e.linkname || string(b) != e.content {
+			t.Errorf("entry %d, expected %s/%s/%s, received %s/%s/%s", i, e.name, e.linkname, e.content, th.Name, th.Linkname, string(b))
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("unexpected entries after %d", len(expect))
+	}
+}
+
+func TestManifestToDocker(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	r, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	pAMD, err := platform.Parse("linux/amd64")
+	if err != nil {
+		t.Fatalf("failed to parse platform: %v", err)
+	}
+	getPlatform := func(r ref.Ref) manifest.Manifest {
+		t.Helper()
+		m, err := rc.ManifestGet(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		d, err := manifest.GetPlatformDesc(m, &pAMD)
+		if err != nil {
+			t.Fatalf("failed to get platform: %v", err)
+		}
+		m, err = rc.ManifestGet(ctx, r, regclient.ManifestWithDesc(*d))
+		if err != nil {
+			t.Fatalf("failed to get platform manifest: %v", err)
+		}
+		return m
+	}
+	mOrig := getPlatform(r)
+	rDocker, err := Apply(ctx, rc, r, WithManifestToDocker())
+	if err != nil {
+		t.Fatalf("failed to convert to docker: %v", err)
+	}
+	mDocker, err := rc.ManifestGet(ctx, rDocker)
+	if err != nil {
+		t.Fatalf("failed to get docker manifest: %v", err)
+	}
+	if mDocker.GetDescriptor().MediaType != types.MediaTypeDocker2ManifestList {
+		t.Errorf("unexpected media type: %s", mDocker.GetDescriptor().MediaType)
+	}
+	mDockerAMD := getPlatform(rDocker)
+	if mDockerAMD.GetDescriptor().MediaType != types.MediaTypeDocker2Manifest {
+		t.Errorf("unexpected platform media type: %s", mDockerAMD.GetDescriptor().MediaType)
+	}
+	cd, err := mDockerAMD.GetConfig()
+	if err != nil || cd.MediaType != types.MediaTypeDocker2ImageConfig {
+		t.Errorf("unexpected config: %v, %v", cd, err)
+	}
+	layers, err := mDockerAMD.GetLayers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	for i, l := range layers {
+		if l.MediaType != types.MediaTypeDocker2Layer {
+			t.Errorf("unexpected media type for layer %d: %s", i, l.MediaType)
+		}
+	}
+	// converting back to OCI returns the original content
+	rOCI, err := Apply(ctx, rc, rDocker, WithManifestToOCI())
+	if err != nil {
+		t.Fatalf("failed to convert to OCI: %v", err)
+	}
+	mOCIAMD := getPlatform(rOCI)
+	ociOrig, err := manifest.OCIManifestFromAny(mOrig.GetOrig())
+	if err != nil {
+		t.Fatalf("failed to parse original manifest: %v", err)
+	}
+	ociRound, err := manifest.OCIManifestFromAny(mOCIAMD.GetOrig())
+	if err != nil {
+		t.Fatalf("failed to parse converted manifest: %v", err)
+	}
+	if !reflect.DeepEqual(ociOrig, ociRound) {
+		t.Errorf("round trip changed the manifest, expected %v, received %v", ociOrig, ociRound)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	r, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	content := "replaced by a step\n"
+	manifests, layers := 0, 0
+	rMod, err := Apply(ctx, rc, r,
+		WithManifestStep(func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, m *Manifest) error {
+			manifests++
+			if m.Manifest().IsList() != (m.Config() == nil) {
+				return fmt.Errorf("config should only be set on images")
+			}
+			if m.Top() && len(m.Manifests()) == 0 {
+				return fmt.Errorf("index children missing")
+			}
+			return nil
+		}),
+		WithConfigStep(func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, c *Config) error {
+			image := c.Image()
+			if image.Config.Labels == nil {
+				image.Config.Labels = map[string]string{}
+			}
+			image.Config.Labels["org.example.step"] = "true"
+			c.SetImage(image)
+			return nil
+		}),
+		WithLayerStep(func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, l *Layer) error {
+			layers++
+			return nil
+		}),
+		WithLayerFileStep(func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, l *Layer, th *tar.Header, rdr io.Reader) (*tar.Header, io.Reader, Change, error) {
+			if th.Typeflag != tar.TypeReg {
+				return th, rdr, Unchanged, nil
+			}
+			th.Size = int64(len(content))
+			return th, strings.NewReader(content), Replaced, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	if manifests != 3 || layers != 2 {
+		t.Errorf("unexpected number of steps run, manifests %d, layers %d", manifests, layers)
+	}
+	m, err := rc.ManifestGet(ctx, rMod)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	pAMD, err := platform.Parse("linux/amd64")
+	if err != nil {
+		t.Fatalf("failed to parse platform: %v", err)
+	}
+	d, err := manifest.GetPlatformDesc(m, &pAMD)
+	if err != nil {
+		t.Fatalf("failed to get platform: %v", err)
+	}
+	m, err = rc.ManifestGet(ctx, rMod, regclient.ManifestWithDesc(*d))
+	if err != nil {
+		t.Fatalf("failed to get platform manifest: %v", err)
+	}
+	cd, err := m.GetConfig()
+	if err != nil {
+		t.Fatalf("failed to get config descriptor: %v", err)
+	}
+	oc, err := rc.BlobGetOCIConfig(ctx, rMod, cd)
+	if err != nil {
+		t.Fatalf("failed to get config: %v", err)
+	}
+	if oc.GetConfig().Config.Labels["org.example.step"] != "true" {
+		t.Errorf("label missing from config")
+	}
+	ml, err := m.GetLayers()
+	if err != nil || len(ml) != 1 {
+		t.Fatalf("failed to get layers: %v, %v", ml, err)
+	}
+	br, err := rc.BlobGet(ctx, rMod, ml[0])
+	if err != nil {
+		t.Fatalf("failed to get layer: %v", err)
+	}
+	defer br.Close()
+	dr, err := archive.Decompress(br)
+	if err != nil {
+		t.Fatalf("failed to decompress layer: %v", err)
+	}
+	digUC := digest.Canonical.Digester()
+	tee := io.TeeReader(dr, digUC.Hash())
+	tr := tar.NewReader(tee)
+	found := 0
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read layer: %v", err)
+		}
+		if th.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", th.Name, err)
+		}
+		if string(b) != content {
+			t.Errorf("unexpected content in %s: %s", th.Name, string(b))
+		}
+		found++
+	}
+	_, _ = io.Copy(io.Discard, tee)
+	if found == 0 {
+		t.Errorf("no files found in layer")
+	}
+	if oc.GetConfig().RootFS.DiffIDs[0] != digUC.Digest() {
+		t.Errorf("diff_id mismatch, expected %s, received %s", digUC.Digest(), oc.GetConfig().RootFS.DiffIDs[0])
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	r, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello world\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	mOrig, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	layerTar := &bytes.Buffer{}
+	err = archive.Tar(ctx, dir, layerTar)
+	if err != nil {
+		t.Fatalf("failed to create tar: %v", err)
+	}
+	opts := []Opts{
+		WithLabel("org.example.dry-run", "true"),
+		WithLayerAddPath(dir, "/opt/dry-run", 0, 0, 0),
+		WithLayerAddTar(func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(layerTar.Bytes())), nil
+		}),
+		WithLayerReproducible(),
+		WithLayerCompression(archive.CompressZstd),
+		WithParallel(4),
+	}
+	plan := Plan{}
+	rDry, err := Apply(ctx, rc, r, append(opts, WithDryRun(&plan))...)
+	if err != nil {
+		t.Fatalf("failed to run dry run: %v", err)
+	}
+	if rDry.Digest == "" || rDry.Digest == mOrig.GetDescriptor().Digest.String() {
+		t.Errorf("dry run did not return a new digest: %s", rDry.CommonName())
+	}
+	_, err = rc.ManifestGet(ctx, rDry)
+	if err == nil {
+		t.Errorf("dry run pushed manifest %s", rDry.CommonName())
+	}
+	mCur, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	if mCur.GetDescriptor().Digest != mOrig.GetDescriptor().Digest {
+		t.Errorf("dry run modified the tag")
+	}
+	if len(plan.Manifests) != 5 {
+		t.Fatalf("unexpected number of manifests in plan: %d", len(plan.Manifests))
+	}
+	if plan.Manifests[0].Change != Replaced || plan.Manifests[0].Old.Digest != mOrig.GetDescriptor().Digest || plan.Manifests[0].New.Digest.String() != rDry.Digest {
+		t.Errorf("unexpected top level manifest in plan: %v", plan.Manifests[0])
+	}
+	for _, pm := range plan.Manifests[1:] {
+		if pm.Change != Replaced || pm.Platform == nil {
+			t.Errorf("unexpected manifest in plan: %v", pm)
+			continue
+		}
+		if pm.Config == nil || pm.Config.Change != Replaced {
+			t.Errorf("config not replaced for %s: %v", pm.Platform.String(), pm.Config)
+		}
+		if len(pm.Layers) == 0 || pm.Layers[len(pm.Layers)-1].Change != Added {
+			t.Errorf("layer not added for %s: %v", pm.Platform.String(), pm.Layers)
+			continue
+		}
+		for _, pl := range pm.Layers {
+			if pl.Change == Unchanged || pl.New.MediaType != types.MediaTypeOCI1LayerZstd || pl.SizeDelta != pl.New.Size-pl.Old.Size {
+				t.Errorf("unexpected layer for %s: %v", pm.Platform.String(), pl)
+			}
+		}
+	}
+	if len(plan.Blobs) == 0 || plan.UploadSize() <= 0 {
+		t.Fatalf("no blobs to upload in plan")
+	}
+	// uploads are listed in the order of the manifests and layers, regardless of which layer finished first
+	blobs := []digest.Digest{}
+	uploads := map[digest.Digest]bool{}
+	for _, d := range plan.Blobs {
+		blobs = append(blobs, d.Digest)
+		uploads[d.Digest] = true
+	}
+	expectBlobs := []digest.Digest{}
+	for _, pm := range plan.Manifests {
+		pbs := pm.Layers
+		if pm.Config != nil {
+			pbs = append([]PlanBlob{*pm.Config}, pbs...)
+		}
+		for _, pb := range pbs {
+			if uploads[pb.New.Digest] {
+				expectBlobs = append(expectBlobs, pb.New.Digest)
+				delete(uploads, pb.New.Digest)
+			}
+		}
+	}
+	// intermediate blobs replaced by a later step follow in digest order
+	remain := []digest.Digest{}
+	for dig := range uploads {
+		remain = append(remain, dig)
+	}
+	sort.Slice(remain, func(i, j int) bool {
+		return remain[i] < remain[j]
+	})
+	expectBlobs = append(expectBlobs, remain...)
+	if !reflect.DeepEqual(blobs, expectBlobs) {
+		t.Errorf("unexpected blob order, expected %v, received %v", expectBlobs, blobs)
+	}
+	for _, d := range plan.Blobs {
+		_, err = rc.BlobHead(ctx, r, d)
+		if err == nil {
+			t.Errorf("dry run pushed blob %s", d.Digest.String())
+		}
+	}
+	// the same changes without a dry run push the planned image
+	rMod, err := Apply(ctx, rc, r, opts...)
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	if rMod.Digest != rDry.Digest {
+		t.Errorf("digest mismatch, dry run %s, applied %s", rDry.Digest, rMod.Digest)
+	}
+	for _, d := range plan.Blobs {
+		br, err := rc.BlobHead(ctx, r, d)
+		if err != nil {
+			t.Errorf("planned blob missing %s: %v", d.Digest.String(), err)
+			continue
+		}
+		br.Close()
+	}
+}
+
+func TestPlatformFilter(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	r, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	getPlatforms := func(r ref.Ref) map[string]types.Descriptor {
+		t.Helper()
+		m, err := rc.ManifestGet(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		dl, err := m.GetManifestList()
+		if err != nil {
+			t.Fatalf("failed to get manifest list: %v", err)
+		}
+		result := map[string]types.Descriptor{}
+		for _, d := range dl {
+			result[d.Platform.String()] = d
+		}
+		return result
+	}
+	getLabels := func(r ref.Ref, d types.Descriptor) map[string]string {
+		t.Helper()
+		m, err := rc.ManifestGet(ctx, r, regclient.ManifestWithDesc(d))
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		cd, err := m.GetConfig()
+		if err != nil {
+			t.Fatalf("failed to get config: %v", err)
+		}
+		oc, err := rc.BlobGetOCIConfig(ctx, r, cd)
+		if err != nil {
+			t.Fatalf("failed to get config: %v", err)
+		}
+		return oc.GetConfig().Config.Labels
+	}
+	platOrig := getPlatforms(r)
+	rMod, err := Apply(ctx, rc, r,
+		WithPlatformRm("linux/arm/*"),
+		WithPlatformFilter("linux/arm64"),
+		WithLabel("org.example.filter", "arm64"),
+		WithPlatformFilter(),
+		WithLabel("org.example.all", "true"),
+	)
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	platMod := getPlatforms(rMod)
+	if len(platMod) != 2 {
+		t.Fatalf("unexpected platforms: %v", platMod)
+	}
+	for p, d := range platMod {
+		if p != "linux/amd64" && p != "linux/arm64" {
+			t.Errorf("unexpected platform %s", p)
+			continue
+		}
+		if d.Digest == platOrig[p].Digest {
+			t.Errorf("platform %s not modified", p)
+		}
+		labels := getLabels(rMod, d)
+		if labels["org.example.all"] != "true" {
+			t.Errorf("label missing on %s: %v", p, labels)
+		}
+		if _, ok := labels["org.example.filter"]; ok != (p == "linux/arm64") {
+			t.Errorf("filtered label on %s: %v", p, labels)
+		}
+	}
+	// reproducible layers are only generated for the filtered platforms
+	rRepro, err := Apply(ctx, rc, r,
+		WithPlatformFilter("linux/arm64"),
+		WithLayerReproducible(),
+		WithPlatformFilter(),
+		WithLayerStripFile("/missing"),
+	)
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	platRepro := getPlatforms(rRepro)
+	for p, d := range platRepro {
+		if (d.Digest != platOrig[p].Digest) != (p == "linux/arm64") {
+			t.Errorf("platform %s, original %s, received %s", p, platOrig[p].Digest, d.Digest)
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	ctx := context.Background()
+	tTime, err := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("failed to parse test time: %v", err)
+	}
+	tests := []struct {
+		name string
+		opts []Opts
+	}{
+		{
+			name: "layer timestamp",
+			opts: []Opts{
+				WithLayerTimestampMax(tTime),
+			},
+		},
+		{
+			name: "reproducible zstd",
+			opts: []Opts{
+				WithLayerReproducible(),
+				WithLayerCompression(archive.CompressZstd),
+			},
+		},
+		{
+			name: "strip file on arm",
+			opts: []Opts{
+				WithPlatformFilter("linux/arm/*"),
+				WithLayerStripFile("/layer2"),
+			},
+		},
+	}
+	fsOS := rwfs.OSNew("")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := []ref.Ref{}
+			for _, optsParallel := range [][]Opts{
+				{},
+				{WithParallel(4)},
+				{WithParallel(3), WithParallelTempBudget(256)},
+			} {
+				fsMem := rwfs.MemNew()
+				err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+				if err != nil {
+					t.Fatalf("failed to setup memfs copy: %v", err)
+				}
+				rc := regclient.New(regclient.WithFS(fsMem))
+				r, err := ref.New("ocidir://testrepo:v3")
+				if err != nil {
+					t.Fatalf("failed to parse ref: %v", err)
+				}
+				rMod, err := Apply(ctx, rc, r, append(optsParallel, tt.opts...)...)
+				if err != nil {
+					t.Fatalf("failed to apply: %v", err)
+				}
+				if rMod.Digest == "" {
+					t.Fatalf("image was not modified")
+				}
+				_, err = rc.ManifestGet(ctx, rMod)
+				if err != nil {
+					t.Errorf("failed to get modified image: %v", err)
+				}
+				results = append(results, rMod)
+			}
+			for _, rMod := range results[1:] {
+				if rMod.Digest != results[0].Digest {
+					t.Errorf("parallel result mismatch, expected %s, received %s", results[0].Digest, rMod.Digest)
+				}
+			}
 		})
 	}
 }
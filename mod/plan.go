@@ -0,0 +1,316 @@
+package mod
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/units"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// Plan describes the changes that Apply would make when run with WithDryRun
+type Plan struct {
+	Manifests []PlanManifest     `json:"manifests"` // the top level manifest followed by any child manifests
+	Blobs     []types.Descriptor `json:"blobs"`     // blobs that would be uploaded to the repository
+}
+
+// PlanManifest describes the change to a manifest, along with the config and layers of an image
+type PlanManifest struct {
+	Change    Change             `json:"change"`
+	Platform  *platform.Platform `json:"platform,omitempty"`
+	Old       types.Descriptor   `json:"old"`
+	New       types.Descriptor   `json:"new"`
+	SizeDelta int64              `json:"sizeDelta"`
+	Config    *PlanBlob          `json:"config,omitempty"`
+	Layers    []PlanBlob         `json:"layers,omitempty"`
+}
+
+// PlanBlob describes the change to a config or layer blob
+type PlanBlob struct {
+	Change    Change           `json:"change"`
+	Old       types.Descriptor `json:"old"`
+	New       types.Descriptor `json:"new"`
+	SizeDelta int64            `json:"sizeDelta"`
+}
+
+// dryRun tracks the blobs that would have been pushed so later steps can read them
+type dryRun struct {
+	mu     sync.Mutex
+	plan   *Plan
+	dir    string
+	blobs  map[digest.Digest]string  // temp files with the content of blobs that were not pushed
+	copies map[digest.Digest]ref.Ref // source of blobs that were not copied
+}
+
+// WithDryRun runs all modifications without pushing anything to the registry.
+// The changes that would be made are output to plan, and Apply returns the reference that would have been pushed.
+// Custom steps must avoid pushing content themselves.
+func WithDryRun(plan *Plan) Opts {
+	if plan == nil {
+		plan = &Plan{}
+	}
+	return func(dc *dagConfig) {
+		dc.dryRun = &dryRun{
+			plan:   plan,
+			blobs:  map[digest.Digest]string{},
+			copies: map[digest.Digest]ref.Ref{},
+		}
+	}
+}
+
+// UploadSize returns the total size of the blobs that would be uploaded
+func (p Plan) UploadSize() int64 {
+	var total int64
+	for _, d := range p.Blobs {
+		total += d.Size
+	}
+	return total
+}
+
+// MarshalPretty outputs a human readable summary of the plan
+func (p Plan) MarshalPretty() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 1, ' ', 0)
+	for i, pm := range p.Manifests {
+		if i > 0 {
+			fmt.Fprintf(tw, "\t\n")
+		}
+		name := "Manifest"
+		if pm.Platform != nil {
+			name = fmt.Sprintf("Manifest %s", pm.Platform.String())
+		}
+		fmt.Fprintf(tw, "%s:\t%s\n", name, pm.Change)
+		planPrettyTW(tw, "  ", pm.Old, pm.New, pm.SizeDelta)
+		if pm.Config != nil {
+			fmt.Fprintf(tw, "  Config:\t%s\n", pm.Config.Change)
+			planPrettyTW(tw, "    ", pm.Config.Old, pm.Config.New, pm.Config.SizeDelta)
+		}
+		for j, pl := range pm.Layers {
+			fmt.Fprintf(tw, "  Layer %d:\t%s\n", j, pl.Change)
+			planPrettyTW(tw, "    ", pl.Old, pl.New, pl.SizeDelta)
+		}
+	}
+	fmt.Fprintf(tw, "\t\n")
+	fmt.Fprintf(tw, "Uploads:\t%d blobs, %s\n", len(p.Blobs), units.HumanSize(float64(p.UploadSize())))
+	for _, d := range p.Blobs {
+		fmt.Fprintf(tw, "  Blob:\t%s (%s)\n", d.Digest.String(), units.HumanSize(float64(d.Size)))
+	}
+	err := tw.Flush()
+	if err != nil {
+		return []byte{}, err
+	}
+	return buf.Bytes(), nil
+}
+
+func planPrettyTW(tw *tabwriter.Writer, prefix string, dOld, dNew types.Descriptor, delta int64) {
+	if dOld.Digest != "" && dOld.Digest == dNew.Digest {
+		fmt.Fprintf(tw, "%sDigest:\t%s\n", prefix, dOld.Digest.String())
+	} else {
+		if dOld.Digest != "" {
+			fmt.Fprintf(tw, "%sOld:\t%s\n", prefix, dOld.Digest.String())
+		}
+		if dNew.Digest != "" {
+			fmt.Fprintf(tw, "%sNew:\t%s\n", prefix, dNew.Digest.String())
+		}
+	}
+	if dOld.MediaType != "" && dNew.MediaType != "" && dOld.MediaType != dNew.MediaType {
+		fmt.Fprintf(tw, "%sMediaType:\t%s -> %s\n", prefix, dOld.MediaType, dNew.MediaType)
+	}
+	if delta != 0 {
+		fmt.Fprintf(tw, "%sSize Delta:\t%+d\n", prefix, delta)
+	}
+}
+
+// String returns the name of the change
+func (c Change) String() string {
+	switch c {
+	case Unchanged:
+		return "unchanged"
+	case Added:
+		return "added"
+	case Replaced:
+		return "replaced"
+	case Deleted:
+		return "deleted"
+	}
+	return fmt.Sprintf("unknown(%d)", int(c))
+}
+
+// MarshalText outputs the change as a string
+func (c Change) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// get returns a blob, including blobs that would have been pushed
+func (dr *dryRun) get(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor) (io.ReadCloser, error) {
+	dr.mu.Lock()
+	file, okFile := dr.blobs[d.Digest]
+	rSrc, okCopy := dr.copies[d.Digest]
+	dr.mu.Unlock()
+	if okFile {
+		return os.Open(file)
+	}
+	if okCopy {
+		return rc.BlobGet(ctx, rSrc, d)
+	}
+	return rc.BlobGet(ctx, r, d)
+}
+
+// put saves the blob to a temp file and adds it to the plan
+func (dr *dryRun) put(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor, rdr io.Reader) error {
+	dr.mu.Lock()
+	_, ok := dr.blobs[d.Digest]
+	dr.mu.Unlock()
+	if !ok {
+		fh, err := os.CreateTemp(dr.dir, "blob-")
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fh, rdr)
+		errC := fh.Close()
+		if err != nil {
+			return err
+		}
+		if errC != nil {
+			return errC
+		}
+		dr.mu.Lock()
+		if _, ok := dr.blobs[d.Digest]; ok {
+			// another layer saved the same content
+			os.Remove(fh.Name())
+		} else {
+			dr.blobs[d.Digest] = fh.Name()
+		}
+		dr.mu.Unlock()
+	}
+	return dr.upload(ctx, rc, r, d)
+}
+
+// copy tracks the source of the blob and adds it to the plan
+func (dr *dryRun) copy(ctx context.Context, rc *regclient.RegClient, rSrc, rTgt ref.Ref, d types.Descriptor) error {
+	dr.mu.Lock()
+	if _, ok := dr.blobs[d.Digest]; !ok {
+		if _, ok := dr.copies[d.Digest]; !ok {
+			dr.copies[d.Digest] = rSrc
+		}
+	}
+	dr.mu.Unlock()
+	return dr.upload(ctx, rc, rTgt, d)
+}
+
+// upload adds a blob to the plan if it is not already in the repository
+func (dr *dryRun) upload(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor) error {
+	br, err := rc.BlobHead(ctx, r, d)
+	if err == nil {
+		br.Close()
+		return nil
+	}
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	for _, cur := range dr.plan.Blobs {
+		if cur.Digest == d.Digest {
+			return nil
+		}
+	}
+	dr.plan.Blobs = append(dr.plan.Blobs, planDesc(d))
+	return nil
+}
+
+// planSortBlobs orders the uploads by the first config or layer in the plan using each blob.
+// Layers processed in parallel finish in any order, so this keeps the plan the same on every run.
+func planSortBlobs(p *Plan) {
+	pos := map[digest.Digest]int{}
+	add := func(d types.Descriptor) {
+		if _, ok := pos[d.Digest]; !ok && d.Digest != "" {
+			pos[d.Digest] = len(pos)
+		}
+	}
+	for _, pm := range p.Manifests {
+		if pm.Config != nil {
+			add(pm.Config.New)
+		}
+		for _, pl := range pm.Layers {
+			add(pl.New)
+		}
+	}
+	sort.SliceStable(p.Blobs, func(i, j int) bool {
+		posI, okI := pos[p.Blobs[i].Digest]
+		posJ, okJ := pos[p.Blobs[j].Digest]
+		if okI && okJ {
+			return posI < posJ
+		}
+		if okI != okJ {
+			return okI
+		}
+		return p.Blobs[i].Digest < p.Blobs[j].Digest
+	})
+}
+
+// planManifests adds the manifest and any children to the plan
+func planManifests(dm *dagManifest) []PlanManifest {
+	pm := PlanManifest{
+		Platform: dagPlatform(dm),
+		Old:      planDesc(dm.origDesc),
+	}
+	if dm.mod != deleted {
+		pm.New = planDesc(dm.m.GetDescriptor())
+	}
+	pm.Change = planChange(dm.mod, pm.Old, pm.New)
+	pm.SizeDelta = pm.New.Size - pm.Old.Size
+	if dm.mod != deleted && !dm.m.IsList() {
+		if dm.config != nil {
+			pb := PlanBlob{Old: planDesc(dm.config.origDesc)}
+			if cd, err := dm.m.GetConfig(); err == nil {
+				pb.New = planDesc(cd)
+			}
+			pb.Change = planChange(unchanged, pb.Old, pb.New)
+			pb.SizeDelta = pb.New.Size - pb.Old.Size
+			pm.Config = &pb
+		}
+		layers, _ := dm.m.GetLayers()
+		i := 0
+		for _, dl := range dm.layers {
+			pb := PlanBlob{Old: planDesc(dl.origDesc)}
+			if dl.mod != deleted && i < len(layers) {
+				pb.New = planDesc(layers[i])
+				i++
+			}
+			pb.Change = planChange(dl.mod, pb.Old, pb.New)
+			pb.SizeDelta = pb.New.Size - pb.Old.Size
+			pm.Layers = append(pm.Layers, pb)
+		}
+	}
+	result := []PlanManifest{pm}
+	for _, child := range dm.manifests {
+		result = append(result, planManifests(child)...)
+	}
+	return result
+}
+
+func planChange(mod changes, dOld, dNew types.Descriptor) Change {
+	switch {
+	case mod == deleted:
+		return Deleted
+	case dOld.Digest == "":
+		return Added
+	case dOld.Digest != dNew.Digest || dOld.MediaType != dNew.MediaType:
+		return Replaced
+	}
+	return Unchanged
+}
+
+// planDesc strips the data field from descriptors in the plan
+func planDesc(d types.Descriptor) types.Descriptor {
+	d.Data = nil
+	return d
+}
@@ -0,0 +1,113 @@
+package mod
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// WithPlatformFilter limits the steps from any following options to manifests matching one of the platforms.
+// Platforms may include a "*" to match any value for a component, e.g. "linux/*".
+// Manifests without a platform, including the index, are skipped by filtered steps.
+// Calling WithPlatformFilter without any platforms removes the filter for following options.
+// Settings that apply to the whole image, like WithData and WithLayerCompression, are not filtered.
+func WithPlatformFilter(platforms ...string) Opts {
+	return func(dc *dagConfig) {
+		dc.platformFilter = platforms
+	}
+}
+
+// WithPlatformRm removes child manifests matching any of the platforms from an index.
+// Platforms may include a "*" to match any value for a component, e.g. "windows/*".
+func WithPlatformRm(platforms ...string) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if dm.mod == deleted || !dm.m.IsList() {
+				return nil
+			}
+			remain := 0
+			for _, child := range dm.manifests {
+				if child.mod == deleted {
+					continue
+				}
+				match, err := platformMatch(dagPlatform(child), platforms)
+				if err != nil {
+					return err
+				}
+				if match {
+					child.mod = deleted
+				} else {
+					remain++
+				}
+			}
+			if remain == 0 {
+				return fmt.Errorf("cannot remove every platform from %s", r.CommonName())
+			}
+			return nil
+		})
+	}
+}
+
+// filterSteps records the platform filter for steps added by the last option
+func (dc *dagConfig) filterSteps() {
+	for len(dc.filterManifest) < len(dc.stepsManifest) {
+		dc.filterManifest = append(dc.filterManifest, dc.platformFilter)
+	}
+	for len(dc.filterOCIConfig) < len(dc.stepsOCIConfig) {
+		dc.filterOCIConfig = append(dc.filterOCIConfig, dc.platformFilter)
+	}
+	for len(dc.filterLayer) < len(dc.stepsLayer) {
+		dc.filterLayer = append(dc.filterLayer, dc.platformFilter)
+	}
+	for len(dc.filterLayerFile) < len(dc.stepsLayerFile) {
+		dc.filterLayerFile = append(dc.filterLayerFile, dc.platformFilter)
+	}
+}
+
+// filterMatch returns true when a step with the filter should run on the manifest
+func filterMatch(filter []string, dm *dagManifest) (bool, error) {
+	if len(filter) == 0 {
+		return true, nil
+	}
+	return platformMatch(dagPlatform(dm), filter)
+}
+
+// platformMatch returns true if the platform matches any entry in the list
+func platformMatch(p *platform.Platform, list []string) (bool, error) {
+	if p == nil || p.OS == "" {
+		return false, nil
+	}
+	for _, entry := range list {
+		if !strings.Contains(entry, "*") {
+			plat, err := platform.Parse(entry)
+			if err != nil {
+				return false, err
+			}
+			if platform.Match(*p, plat) {
+				return true, nil
+			}
+			continue
+		}
+		// wildcards are compared to each component, missing components match any value
+		pComp := strings.Split(p.String(), "/")
+		eComp := strings.Split(entry, "/")
+		if len(eComp) > len(pComp) {
+			continue
+		}
+		match := true
+		for i := range eComp {
+			if eComp[i] != "*" && !strings.EqualFold(eComp[i], pComp[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,264 @@
+package mod
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+const (
+	annoBaseDig  = "org.opencontainers.image.base.digest"
+	annoBaseName = "org.opencontainers.image.base.name"
+)
+
+// WithRebase replaces the old base image layers with the layers from a new base image.
+// The leading layers, diff_ids, and history of each image must match the old base.
+// Manifest lists are rebased per platform, and the base image annotations are updated.
+func WithRebase(rOld, rNew ref.Ref) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if dm.mod == deleted {
+				return nil
+			}
+			mOld, err := rebaseManifest(ctx, rc, dc, rOld)
+			if err != nil {
+				return fmt.Errorf("failed to get old base %s: %w", rOld.CommonName(), err)
+			}
+			mNew, err := rebaseManifest(ctx, rc, dc, rNew)
+			if err != nil {
+				return fmt.Errorf("failed to get new base %s: %w", rNew.CommonName(), err)
+			}
+			if dm.m.IsList() {
+				if !dm.top {
+					return nil
+				}
+				return rebaseAnnotations(dm, rNew, mNew.GetDescriptor(), true)
+			}
+			if dm.config == nil || dm.config.oc == nil {
+				return fmt.Errorf("rebase requires an image config")
+			}
+			oc := dm.config.oc.GetConfig()
+			plat := platform.Platform{
+				OS:           oc.OS,
+				Architecture: oc.Architecture,
+				Variant:      oc.Variant,
+				OSVersion:    oc.OSVersion,
+			}
+			// get the platform specific manifests and configs from each base
+			mOldPlat, ocOld, err := rebaseGetBase(ctx, rc, rOld, mOld, plat)
+			if err != nil {
+				return err
+			}
+			mNewPlat, ocNew, err := rebaseGetBase(ctx, rc, rNew, mNew, plat)
+			if err != nil {
+				return err
+			}
+			layersOld, err := mOldPlat.GetLayers()
+			if err != nil {
+				return err
+			}
+			layersNew, err := mNewPlat.GetLayers()
+			if err != nil {
+				return err
+			}
+
+			// verify the image starts with the old base
+			if len(layersOld) > len(dm.layers) || len(ocOld.RootFS.DiffIDs) > len(oc.RootFS.DiffIDs) {
+				return fmt.Errorf("old base %s has more layers than the image: %w", rOld.CommonName(), types.ErrMismatch)
+			}
+			for i := range layersOld {
+				if dm.layers[i].mod != unchanged {
+					return fmt.Errorf("rebase cannot be applied to modified layers")
+				}
+				if dm.layers[i].desc.Digest != layersOld[i].Digest {
+					return fmt.Errorf("layer %d does not match old base %s: %w", i, rOld.CommonName(), types.ErrMismatch)
+				}
+			}
+			for i := range ocOld.RootFS.DiffIDs {
+				if oc.RootFS.DiffIDs[i] != ocOld.RootFS.DiffIDs[i] {
+					return fmt.Errorf("diff_id %d does not match old base %s: %w", i, rOld.CommonName(), types.ErrMismatch)
+				}
+			}
+			iHistory, err := rebaseHistoryPrefix(oc.History, ocOld.History)
+			if err != nil {
+				return fmt.Errorf("history does not match old base %s: %w", rOld.CommonName(), err)
+			}
+
+			// copy the new base layers into the repository
+			for _, l := range layersNew {
+				err = dc.blobCopy(ctx, rc, rNew, r, l)
+				if err != nil {
+					return fmt.Errorf("failed to copy layer %s from %s: %w", l.Digest.String(), rNew.CommonName(), err)
+				}
+			}
+
+			// replace the layers in the manifest
+			om := dm.m.GetOrig()
+			ociM, err := manifest.OCIManifestFromAny(om)
+			if err != nil {
+				return err
+			}
+			isDocker := dm.m.GetDescriptor().MediaType == types.MediaTypeDocker2Manifest
+			layers := []types.Descriptor{}
+			dagLayers := []*dagLayer{}
+			for i, l := range layersNew {
+				if isDocker && l.MediaType == types.MediaTypeOCI1LayerGzip {
+					l.MediaType = types.MediaTypeDocker2Layer
+				} else if !isDocker && l.MediaType == types.MediaTypeDocker2Layer {
+					l.MediaType = types.MediaTypeOCI1LayerGzip
+				}
+				layers = append(layers, l)
+				dl := dagLayer{desc: l}
+				if i < len(layersOld) {
+					dl.origDesc = dm.layers[i].origDesc
+				}
+				dagLayers = append(dagLayers, &dl)
+			}
+			ociM.Layers = append(layers, ociM.Layers[len(layersOld):]...)
+			dm.layers = append(dagLayers, dm.layers[len(layersOld):]...)
+			err = manifest.OCIManifestToAny(ociM, &om)
+			if err != nil {
+				return err
+			}
+			err = dm.m.SetOrig(om)
+			if err != nil {
+				return err
+			}
+
+			// replace the diff_ids and history in the config
+			oc.RootFS.DiffIDs = append(append([]digest.Digest{}, ocNew.RootFS.DiffIDs...), oc.RootFS.DiffIDs[len(ocOld.RootFS.DiffIDs):]...)
+			oc.History = append(append([]v1.History{}, ocNew.History...), oc.History[iHistory:]...)
+			dm.config.oc.SetConfig(oc)
+			dm.config.newDesc = dm.config.oc.GetDescriptor()
+			dm.config.modified = true
+			dm.mod = replaced
+			dm.newDesc = dm.m.GetDescriptor()
+
+			return rebaseAnnotations(dm, rNew, mNewPlat.GetDescriptor(), dm.top)
+		})
+	}
+}
+
+// rebaseManifest returns the manifest for a base image, each base is only pulled once per Apply
+func rebaseManifest(ctx context.Context, rc *regclient.RegClient, dc *dagConfig, rBase ref.Ref) (manifest.Manifest, error) {
+	if m, ok := dc.rebaseBases[rBase.CommonName()]; ok {
+		return m, nil
+	}
+	m, err := rc.ManifestGet(ctx, rBase)
+	if err != nil {
+		return nil, err
+	}
+	if dc.rebaseBases == nil {
+		dc.rebaseBases = map[string]manifest.Manifest{}
+	}
+	dc.rebaseBases[rBase.CommonName()] = m
+	return m, nil
+}
+
+// rebaseGetBase returns the platform specific manifest and config for a base image
+func rebaseGetBase(ctx context.Context, rc *regclient.RegClient, rBase ref.Ref, mBase manifest.Manifest, plat platform.Platform) (manifest.Manifest, v1.Image, error) {
+	m := mBase
+	if mBase.IsList() {
+		d, err := manifest.GetPlatformDesc(mBase, &plat)
+		if err != nil {
+			return nil, v1.Image{}, fmt.Errorf("platform %s not found in base %s: %w", plat.String(), rBase.CommonName(), err)
+		}
+		m, err = rc.ManifestGet(ctx, rBase, regclient.ManifestWithDesc(*d))
+		if err != nil {
+			return nil, v1.Image{}, fmt.Errorf("failed to get base %s: %w", rBase.CommonName(), err)
+		}
+	}
+	cd, err := m.GetConfig()
+	if err != nil {
+		return nil, v1.Image{}, err
+	}
+	oc, err := rc.BlobGetOCIConfig(ctx, rBase, cd)
+	if err != nil {
+		return nil, v1.Image{}, fmt.Errorf("failed to get config for base %s: %w", rBase.CommonName(), err)
+	}
+	return m, oc.GetConfig(), nil
+}
+
+// rebaseHistoryPrefix returns the number of history entries in the image that come from the base.
+// Empty layer entries at the end of the base history may be missing from the image.
+func rebaseHistoryPrefix(history, baseHistory []v1.History) (int, error) {
+	i := 0
+	for _, bh := range baseHistory {
+		if i < len(history) && history[i].CreatedBy == bh.CreatedBy && history[i].Comment == bh.Comment && history[i].EmptyLayer == bh.EmptyLayer {
+			i++
+			continue
+		}
+		if bh.EmptyLayer {
+			continue
+		}
+		return 0, fmt.Errorf("history entry %d, \"%s\": %w", i, bh.CreatedBy, types.ErrMismatch)
+	}
+	return i, nil
+}
+
+// rebaseAnnotations updates the base image annotations.
+// Unless force is set, only existing annotations are updated.
+func rebaseAnnotations(dm *dagManifest, rBase ref.Ref, dBase types.Descriptor, force bool) error {
+	om := dm.m.GetOrig()
+	changed := false
+	setAnnotations := func(annotations map[string]string) map[string]string {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		_, okName := annotations[annoBaseName]
+		_, okDig := annotations[annoBaseDig]
+		if !force && !okName && !okDig {
+			return annotations
+		}
+		if annotations[annoBaseName] != rBase.CommonName() {
+			annotations[annoBaseName] = rBase.CommonName()
+			changed = true
+		}
+		if annotations[annoBaseDig] != dBase.Digest.String() {
+			annotations[annoBaseDig] = dBase.Digest.String()
+			changed = true
+		}
+		return annotations
+	}
+	if dm.m.IsList() {
+		ociI, err := manifest.OCIIndexFromAny(om)
+		if err != nil {
+			return err
+		}
+		ociI.Annotations = setAnnotations(ociI.Annotations)
+		if !changed {
+			return nil
+		}
+		err = manifest.OCIIndexToAny(ociI, &om)
+		if err != nil {
+			return err
+		}
+	} else {
+		ociM, err := manifest.OCIManifestFromAny(om)
+		if err != nil {
+			return err
+		}
+		ociM.Annotations = setAnnotations(ociM.Annotations)
+		if !changed {
+			return nil
+		}
+		err = manifest.OCIManifestToAny(ociM, &om)
+		if err != nil {
+			return err
+		}
+	}
+	err := dm.m.SetOrig(om)
+	if err != nil {
+		return err
+	}
+	dm.mod = replaced
+	dm.newDesc = dm.m.GetDescriptor()
+	return nil
+}
@@ -0,0 +1,189 @@
+package mod
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// Change indicates how a step modified a file in a layer
+type Change int
+
+const (
+	// Unchanged leaves the file as is
+	Unchanged = Change(unchanged)
+	// Added indicates a new manifest or layer in a Plan
+	Added = Change(added)
+	// Replaced indicates the header or content was modified
+	Replaced = Change(replaced)
+	// Deleted removes the file from the layer
+	Deleted = Change(deleted)
+)
+
+// Manifest is a manifest in the image being modified.
+// Changes are pushed after all steps have run, updating the digests in any parent index.
+type Manifest struct {
+	dm *dagManifest
+}
+
+// Config is the image config of a manifest being modified
+type Config struct {
+	doc *dagOCIConfig
+}
+
+// Layer is a layer of a manifest being modified
+type Layer struct {
+	dl *dagLayer
+}
+
+// WithManifestStep runs fn on each manifest, children of an index are processed before their parent.
+func WithManifestStep(fn func(context.Context, *regclient.RegClient, ref.Ref, *Manifest) error) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if dm.mod == deleted {
+				return nil
+			}
+			return fn(ctx, rc, r, &Manifest{dm: dm})
+		})
+	}
+}
+
+// WithConfigStep runs fn on the config of each image.
+// Config steps run after all manifest steps.
+func WithConfigStep(fn func(context.Context, *regclient.RegClient, ref.Ref, *Config) error) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsOCIConfig = append(dc.stepsOCIConfig, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, doc *dagOCIConfig) error {
+			return fn(ctx, rc, r, &Config{doc: doc})
+		})
+	}
+}
+
+// WithLayerStep runs fn on each layer that has not been deleted.
+// Layer steps run after the config steps, and before any file steps on the same layer.
+// With WithParallel, fn is called concurrently for different layers and must be safe for concurrent use.
+func WithLayerStep(fn func(context.Context, *regclient.RegClient, ref.Ref, *Layer) error) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsLayer = append(dc.stepsLayer, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer) error {
+			return fn(ctx, rc, r, &Layer{dl: dl})
+		})
+	}
+}
+
+// WithLayerFileStep runs fn on each file in every layer.
+// The returned header and reader are passed to the next step and written to the new layer.
+// When the content is replaced, the header size must match the new content.
+// The layer is only rewritten when a step returns a change.
+// With WithParallel, fn is called concurrently for files in different layers and must be safe for concurrent use.
+func WithLayerFileStep(fn func(context.Context, *regclient.RegClient, ref.Ref, *Layer, *tar.Header, io.Reader) (*tar.Header, io.Reader, Change, error)) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsLayerFile = append(dc.stepsLayerFile, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, rdr io.Reader) (*tar.Header, io.Reader, changes, error) {
+			th, rdr, change, err := fn(ctx, rc, r, &Layer{dl: dl}, th, rdr)
+			return th, rdr, changes(change), err
+		})
+	}
+}
+
+// Top returns true for the manifest referenced by Apply
+func (m *Manifest) Top() bool {
+	return m.dm.top
+}
+
+// Manifest returns the current manifest
+func (m *Manifest) Manifest() manifest.Manifest {
+	return m.dm.m
+}
+
+// SetOrig replaces the manifest, e.g. with a modified v1.Manifest or schema2.Manifest.
+// The list of layers or child manifests must not be changed, use the Layer and Manifest methods instead.
+func (m *Manifest) SetOrig(orig interface{}) error {
+	return manifestReplace(m.dm, orig)
+}
+
+// Delete removes the manifest from the parent index
+func (m *Manifest) Delete() {
+	m.dm.mod = deleted
+}
+
+// Config returns the image config, or nil for an index or manifest without an image config
+func (m *Manifest) Config() *Config {
+	if m.dm.config == nil || m.dm.config.oc == nil {
+		return nil
+	}
+	return &Config{doc: m.dm.config}
+}
+
+// Manifests returns the child manifests of an index
+func (m *Manifest) Manifests() []*Manifest {
+	ml := make([]*Manifest, 0, len(m.dm.manifests))
+	for _, dm := range m.dm.manifests {
+		ml = append(ml, &Manifest{dm: dm})
+	}
+	return ml
+}
+
+// Layers returns the layers of an image, including deleted layers
+func (m *Manifest) Layers() []*Layer {
+	ll := make([]*Layer, 0, len(m.dm.layers))
+	for _, dl := range m.dm.layers {
+		ll = append(ll, &Layer{dl: dl})
+	}
+	return ll
+}
+
+// LayerAdd appends a layer to the image with the uncompressed digest used for the diff_id.
+// The blob must already be pushed to the repository.
+func (m *Manifest) LayerAdd(d types.Descriptor, diffID digest.Digest) {
+	m.dm.layers = append(m.dm.layers, &dagLayer{
+		mod:      added,
+		desc:     d,
+		newDesc:  d,
+		ucDigest: diffID,
+	})
+}
+
+// Image returns the current image config
+func (c *Config) Image() v1.Image {
+	return c.doc.oc.GetConfig()
+}
+
+// SetImage replaces the image config
+func (c *Config) SetImage(image v1.Image) {
+	c.doc.oc.SetConfig(image)
+	c.doc.newDesc = c.doc.oc.GetDescriptor()
+	c.doc.modified = true
+}
+
+// Descriptor returns the current descriptor of the layer
+func (l *Layer) Descriptor() types.Descriptor {
+	if l.dl.mod != unchanged && l.dl.newDesc.Digest != "" {
+		return l.dl.newDesc
+	}
+	return l.dl.desc
+}
+
+// Deleted returns true when the layer has been deleted
+func (l *Layer) Deleted() bool {
+	return l.dl.mod == deleted
+}
+
+// Delete removes the layer from the image along with the diff_id and history entry
+func (l *Layer) Delete() {
+	l.dl.mod = deleted
+}
+
+// Replace changes the layer to a new blob with the uncompressed digest used for the diff_id.
+// The blob must already be pushed to the repository.
+func (l *Layer) Replace(d types.Descriptor, diffID digest.Digest) {
+	l.dl.newDesc = d
+	l.dl.ucDigest = diffID
+	if l.dl.mod == unchanged {
+		l.dl.mod = replaced
+	}
+}
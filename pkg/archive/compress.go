@@ -6,6 +6,9 @@ import (
 	"compress/bzip2"
 	"compress/gzip"
 	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 // CompressType identifies the detected compression type
@@ -20,6 +23,8 @@ const (
 	CompressGzip
 	// CompressXz compression
 	CompressXz
+	// CompressZstd compression
+	CompressZstd
 )
 
 // compressHeaders are used to detect the compression type
@@ -27,12 +32,49 @@ var compressHeaders = map[CompressType][]byte{
 	CompressBzip2: []byte("\x42\x5A\x68"),
 	CompressGzip:  []byte("\x1F\x8B\x08"),
 	CompressXz:    []byte("\xFD\x37\x7A\x58\x5A\x00"),
+	CompressZstd:  []byte("\x28\xB5\x2F\xFD"),
+}
+
+// String returns the name of the compression type
+func (ct CompressType) String() string {
+	switch ct {
+	case CompressNone:
+		return "none"
+	case CompressBzip2:
+		return "bzip2"
+	case CompressGzip:
+		return "gzip"
+	case CompressXz:
+		return "xz"
+	case CompressZstd:
+		return "zstd"
+	}
+	return "unknown"
 }
 
+// ParseCompressType converts a name to a compression type
+func ParseCompressType(name string) (CompressType, error) {
+	switch name {
+	case "none", "uncompressed":
+		return CompressNone, nil
+	case "bzip2":
+		return CompressBzip2, nil
+	case "gzip":
+		return CompressGzip, nil
+	case "xz":
+		return CompressXz, nil
+	case "zstd":
+		return CompressZstd, nil
+	}
+	return CompressNone, ErrUnknownType
+}
+
+// Compress converts the reader to the requested compression type.
+// Compressed input is first decompressed, gzip and zstd output is supported.
 func Compress(r io.Reader, oComp CompressType) (io.Reader, error) {
 	br := bufio.NewReader(r)
 	head, err := br.Peek(10)
-	if err != nil {
+	if err != nil && err != io.EOF {
 		return br, err
 	}
 	rComp := DetectCompression(head)
@@ -40,30 +82,61 @@ func Compress(r io.Reader, oComp CompressType) (io.Reader, error) {
 		return br, nil
 	}
 	switch oComp {
-	case CompressGzip:
-		switch rComp {
-		case CompressNone:
-			return compressGzip(br)
-		case CompressBzip2:
-			return compressGzip(bzip2.NewReader(br))
+	case CompressNone, CompressGzip, CompressZstd:
+	default:
+		// No other types currently supported
+		return nil, ErrUnknownType
+	}
+	var dr io.Reader = br
+	if rComp != CompressNone {
+		dr, err = Decompress(br)
+		if err != nil {
+			return nil, err
 		}
 	}
-	// No other types currently supported
-	return nil, ErrUnknownType
-}
-
-func compressGzip(src io.Reader) (io.Reader, error) {
+	if oComp == CompressNone {
+		return dr, nil
+	}
 	pipeR, pipeW := io.Pipe()
 	go func() {
-		defer pipeW.Close()
-		gzipW := gzip.NewWriter(pipeW)
-		defer gzipW.Close()
-		_, _ = io.Copy(gzipW, src)
+		cw, err := CompressWriter(pipeW, oComp)
+		if err != nil {
+			pipeW.CloseWithError(err)
+			return
+		}
+		_, err = io.Copy(cw, dr)
+		if err != nil {
+			pipeW.CloseWithError(err)
+			return
+		}
+		pipeW.CloseWithError(cw.Close())
 	}()
 	return pipeR, nil
 }
 
-// Decompress extracts gzip and bzip streams
+// CompressWriter returns a writer that compresses content to w.
+// The returned writer must be closed to flush the compressed content, w is not closed.
+func CompressWriter(w io.Writer, oComp CompressType) (io.WriteCloser, error) {
+	switch oComp {
+	case CompressNone:
+		return nopWriteCloser{w}, nil
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, ErrUnknownType
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Decompress extracts bzip2, gzip, xz, and zstd streams
 func Decompress(r io.Reader) (io.Reader, error) {
 	// create bufio to peak on first few bytes
 	br := bufio.NewReader(r)
@@ -79,7 +152,10 @@ func Decompress(r io.Reader) (io.Reader, error) {
 	case CompressGzip:
 		return gzip.NewReader(br)
 	case CompressXz:
-		return br, ErrXzUnsupported
+		return xz.NewReader(br)
+	case CompressZstd:
+		// a single goroutine decodes synchronously and does not need to be closed
+		return zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
 	default:
 		return br, nil
 	}
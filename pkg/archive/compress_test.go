@@ -0,0 +1,94 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestCompress(t *testing.T) {
+	content := bytes.Repeat([]byte("hello world\n"), 1000)
+	xzBuf := &bytes.Buffer{}
+	xw, err := xz.NewWriter(xzBuf)
+	if err != nil {
+		t.Fatalf("failed to create xz writer: %v", err)
+	}
+	_, err = xw.Write(content)
+	if err != nil {
+		t.Fatalf("failed to write xz content: %v", err)
+	}
+	xw.Close()
+
+	tests := []struct {
+		name  string
+		in    func() io.Reader
+		comp  CompressType
+		check CompressType
+	}{
+		{
+			name:  "none to gzip",
+			in:    func() io.Reader { return bytes.NewReader(content) },
+			comp:  CompressGzip,
+			check: CompressGzip,
+		},
+		{
+			name:  "none to zstd",
+			in:    func() io.Reader { return bytes.NewReader(content) },
+			comp:  CompressZstd,
+			check: CompressZstd,
+		},
+		{
+			name:  "xz to zstd",
+			in:    func() io.Reader { return bytes.NewReader(xzBuf.Bytes()) },
+			comp:  CompressZstd,
+			check: CompressZstd,
+		},
+		{
+			name:  "xz to none",
+			in:    func() io.Reader { return bytes.NewReader(xzBuf.Bytes()) },
+			comp:  CompressNone,
+			check: CompressNone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr, err := Compress(tt.in(), tt.comp)
+			if err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+			cBytes, err := io.ReadAll(cr)
+			if err != nil {
+				t.Fatalf("failed to read compressed content: %v", err)
+			}
+			if ct := DetectCompression(cBytes); ct != tt.check {
+				t.Errorf("unexpected compression, expected %s, received %s", tt.check, ct)
+			}
+			// round trip through each compression type
+			for _, ct := range []CompressType{CompressGzip, CompressZstd} {
+				rc, err := Compress(bytes.NewReader(cBytes), ct)
+				if err != nil {
+					t.Fatalf("failed to compress to %s: %v", ct, err)
+				}
+				dr, err := Decompress(rc)
+				if err != nil {
+					t.Fatalf("failed to decompress %s: %v", ct, err)
+				}
+				out, err := io.ReadAll(dr)
+				if err != nil {
+					t.Fatalf("failed to read decompressed %s: %v", ct, err)
+				}
+				if !bytes.Equal(out, content) {
+					t.Errorf("content mismatch after %s round trip", ct)
+				}
+			}
+		})
+	}
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := Compress(bytes.NewReader(content), CompressXz)
+		if err != ErrUnknownType {
+			t.Errorf("unexpected error, expected %v, received %v", ErrUnknownType, err)
+		}
+	})
+}
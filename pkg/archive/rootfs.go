@@ -0,0 +1,214 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const paxXattrPrefix = "SCHILY.xattr."
+
+// ErrPathTraversal is returned when a tar entry would be written outside of the target directory
+var ErrPathTraversal = errors.New("path traversal rejected")
+
+// ExtractRootFS extracts a tar of a root filesystem into a directory.
+// Ownership, modes, timestamps, xattrs, symlinks, hardlinks, and device files are restored where possible.
+// Errors setting ownership, xattrs, or creating devices are ignored when running without privileges.
+// Entries that would be written through a symlink or outside of the directory are rejected.
+func ExtractRootFS(ctx context.Context, path string, r io.Reader) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("extract path must be a directory: \"%s\"", path)
+	}
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rd, err := Decompress(r)
+	if err != nil {
+		return err
+	}
+	// directory modes and times are set after the content is extracted
+	dirs := []*tar.Header{}
+	rt := tar.NewReader(rd)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := rt.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rel := filepath.Clean(string(filepath.Separator) + filepath.FromSlash(hdr.Name))
+		if rel == string(filepath.Separator) {
+			continue
+		}
+		fn := filepath.Join(root, rel)
+		err = rootfsCheckParents(root, fn)
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+		// remove any existing entry unless both are directories
+		if cur, err := os.Lstat(fn); err == nil && !(cur.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			err = os.RemoveAll(fn)
+			if err != nil {
+				return err
+			}
+		}
+		mode := fs.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.Mkdir(fn, 0700)
+			if err != nil && !errors.Is(err, fs.ErrExist) {
+				return err
+			}
+			dirs = append(dirs, hdr)
+		case tar.TypeReg, tar.TypeRegA:
+			fh, err := os.OpenFile(fn, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(fh, rt)
+			fh.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, fn)
+			if err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			target := filepath.Join(root, filepath.Clean(string(filepath.Separator)+filepath.FromSlash(hdr.Linkname)))
+			err = rootfsCheckParents(root, target)
+			if err != nil {
+				return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+			}
+			err = os.Link(target, fn)
+			if err != nil {
+				return err
+			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			err = rootfsMknod(fn, hdr)
+			if err != nil {
+				if rootfsIgnoreErr(err) {
+					continue
+				}
+				return err
+			}
+		default:
+			// unsupported types, e.g. pax global headers, are skipped
+			continue
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			continue
+		}
+		err = os.Lchown(fn, hdr.Uid, hdr.Gid)
+		if err != nil && !rootfsIgnoreErr(err) {
+			return err
+		}
+		for k, v := range hdr.PAXRecords {
+			if !strings.HasPrefix(k, paxXattrPrefix) {
+				continue
+			}
+			err = rootfsSetXattr(fn, strings.TrimPrefix(k, paxXattrPrefix), []byte(v))
+			if err != nil && !rootfsIgnoreErr(err) {
+				return err
+			}
+		}
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		// chmod after chown since chown may clear the setuid bits
+		err = os.Chmod(fn, mode|rootfsSpecialMode(hdr.Mode))
+		if err != nil {
+			return err
+		}
+		err = os.Chtimes(fn, rootfsTime(hdr.AccessTime, hdr.ModTime), hdr.ModTime)
+		if err != nil {
+			return err
+		}
+	}
+	// apply directory permissions in reverse order so parents are changed last
+	for i := len(dirs) - 1; i >= 0; i-- {
+		hdr := dirs[i]
+		fn := filepath.Join(root, filepath.Clean(string(filepath.Separator)+filepath.FromSlash(hdr.Name)))
+		err = os.Chmod(fn, fs.FileMode(hdr.Mode).Perm()|rootfsSpecialMode(hdr.Mode))
+		if err != nil {
+			return err
+		}
+		err = os.Chtimes(fn, rootfsTime(hdr.AccessTime, hdr.ModTime), hdr.ModTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rootfsCheckParents verifies each parent of the file is a directory inside of root, creating any missing directories
+func rootfsCheckParents(root, fn string) error {
+	rel, err := filepath.Rel(root, fn)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ErrPathTraversal
+	}
+	parts := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	cur := root
+	for _, part := range parts {
+		if part == "." || part == "" {
+			continue
+		}
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = os.Mkdir(cur, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: parent %s is a symlink", ErrPathTraversal, cur)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("parent %s is not a directory", cur)
+		}
+	}
+	return nil
+}
+
+// rootfsSpecialMode converts the setuid, setgid, and sticky bits from a tar header
+func rootfsSpecialMode(mode int64) fs.FileMode {
+	m := fs.FileMode(0)
+	if mode&04000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+func rootfsTime(t, def time.Time) time.Time {
+	if t.IsZero() {
+		return def
+	}
+	return t
+}
@@ -0,0 +1,33 @@
+//go:build linux
+// +build linux
+
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+func rootfsMknod(fn string, hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	}
+	return unix.Mknod(fn, mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+}
+
+func rootfsSetXattr(fn, name string, value []byte) error {
+	return unix.Lsetxattr(fn, name, value, 0)
+}
+
+// rootfsIgnoreErr reports errors from operations that require privileges or filesystem support
+func rootfsIgnoreErr(err error) bool {
+	return errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EINVAL)
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+)
+
+var errRootfsUnsupported = errors.New("unsupported on this platform")
+
+func rootfsMknod(fn string, hdr *tar.Header) error {
+	return errRootfsUnsupported
+}
+
+func rootfsSetXattr(fn, name string, value []byte) error {
+	return errRootfsUnsupported
+}
+
+// rootfsIgnoreErr treats ownership, xattrs, and devices as best effort on other platforms
+func rootfsIgnoreErr(err error) bool {
+	return true
+}
@@ -0,0 +1,94 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractRootFS(t *testing.T) {
+	ctx := context.Background()
+	type tarFile struct {
+		name     string
+		typeflag byte
+		mode     int64
+		content  string
+		linkname string
+	}
+	tarBuild := func(files []tarFile) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, f := range files {
+			tw.WriteHeader(&tar.Header{
+				Name:     f.name,
+				Typeflag: f.typeflag,
+				Mode:     f.mode,
+				Size:     int64(len(f.content)),
+				Linkname: f.linkname,
+				Uid:      os.Getuid(),
+				Gid:      os.Getgid(),
+			})
+			tw.Write([]byte(f.content))
+		}
+		tw.Close()
+		return buf
+	}
+	t.Run("Extract", func(t *testing.T) {
+		dir := t.TempDir()
+		err := ExtractRootFS(ctx, dir, tarBuild([]tarFile{
+			{name: "etc/", typeflag: tar.TypeDir, mode: 0750},
+			{name: "etc/hosts", typeflag: tar.TypeReg, mode: 0640, content: "hosts"},
+			{name: "bin/app", typeflag: tar.TypeReg, mode: 0755, content: "app"},
+			{name: "bin/link", typeflag: tar.TypeLink, linkname: "bin/app"},
+			{name: "lib", typeflag: tar.TypeSymlink, linkname: "/usr/lib"},
+		}))
+		if err != nil {
+			t.Errorf("failed to extract: %v", err)
+			return
+		}
+		fi, err := os.Stat(filepath.Join(dir, "etc"))
+		if err != nil || fi.Mode().Perm() != 0750 || !fi.IsDir() {
+			t.Errorf("unexpected dir: %v, %v", fi, err)
+		}
+		fi, err = os.Stat(filepath.Join(dir, "etc", "hosts"))
+		if err != nil || fi.Mode().Perm() != 0640 {
+			t.Errorf("unexpected file: %v, %v", fi, err)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, "bin", "link"))
+		if err != nil || string(b) != "app" {
+			t.Errorf("unexpected hardlink content: %s, %v", b, err)
+		}
+		link, err := os.Readlink(filepath.Join(dir, "lib"))
+		if err != nil || link != "/usr/lib" {
+			t.Errorf("unexpected symlink: %s, %v", link, err)
+		}
+	})
+	t.Run("Traversal", func(t *testing.T) {
+		outside := t.TempDir()
+		dir := t.TempDir()
+		err := ExtractRootFS(ctx, dir, tarBuild([]tarFile{
+			{name: "escape", typeflag: tar.TypeSymlink, linkname: outside},
+			{name: "escape/file", typeflag: tar.TypeReg, mode: 0644, content: "bad"},
+		}))
+		if !errors.Is(err, ErrPathTraversal) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "file")); err == nil {
+			t.Errorf("file written outside of the target directory")
+		}
+		// relative paths are contained to the target directory
+		err = ExtractRootFS(ctx, dir, tarBuild([]tarFile{
+			{name: "../../relative", typeflag: tar.TypeReg, mode: 0644, content: "contained"},
+		}))
+		if err != nil {
+			t.Errorf("failed to extract: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "relative")); err != nil {
+			t.Errorf("relative file not found in target directory: %v", err)
+		}
+	})
+}
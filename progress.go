@@ -0,0 +1,178 @@
+package regclient
+
+import (
+	"io"
+	"sync"
+
+	"github.com/regclient/regclient/types"
+)
+
+// ProgressState indicates the state of a blob transfer
+type ProgressState int
+
+const (
+	// ProgressStarted is reported before the first bytes of a blob are transferred
+	ProgressStarted ProgressState = iota
+	// ProgressActive is reported as bytes of a blob are transferred
+	ProgressActive
+	// ProgressFinished is reported when all bytes of a blob have been transferred
+	ProgressFinished
+	// ProgressSkipped is reported when a blob does not need to be copied, e.g. same repository
+	ProgressSkipped
+	// ProgressExists is reported when a blob already exists in the target
+	ProgressExists
+	// ProgressMounted is reported when a blob was mounted server side from the source repository
+	ProgressMounted
+	// ProgressFailed is reported when a transfer fails, see Err for details
+	ProgressFailed
+	// ProgressCanceled is reported when a blob reader is closed before all bytes are read
+	ProgressCanceled
+)
+
+// String returns a human readable description of the state
+func (s ProgressState) String() string {
+	switch s {
+	case ProgressStarted:
+		return "started"
+	case ProgressActive:
+		return "active"
+	case ProgressFinished:
+		return "finished"
+	case ProgressSkipped:
+		return "skipped"
+	case ProgressExists:
+		return "exists"
+	case ProgressMounted:
+		return "mounted"
+	case ProgressFailed:
+		return "failed"
+	case ProgressCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// Done returns true when no more events will be reported for the blob
+func (s ProgressState) Done() bool {
+	return s != ProgressStarted && s != ProgressActive
+}
+
+// ProgressEvent reports the state of a single blob along with totals for the running operation
+type ProgressEvent struct {
+	Desc  types.Descriptor // descriptor of the blob
+	State ProgressState    // state of the blob transfer
+	Cur   int64            // bytes of the blob transferred so far
+	Err   error            // error when the State is ProgressFailed
+	Total ProgressTotal    // totals for every blob seen in the operation
+}
+
+// ProgressTotal summarizes every blob seen by an operation.
+// Totals grow as an image is walked, the final values are only known once the operation finishes.
+type ProgressTotal struct {
+	Blobs     int   // number of blobs seen
+	BlobsDone int   // number of blobs that are finished, skipped, mounted, exist, or failed
+	Bytes     int64 // size of all blobs seen
+	BytesDone int64 // bytes transferred, including the size of blobs that did not need to be transferred
+}
+
+// progress tracks totals and serializes calls to the callback, methods are safe to call on a nil progress
+type progress struct {
+	fn    func(ProgressEvent)
+	mu    sync.Mutex
+	total ProgressTotal
+}
+
+func newProgress(fn func(ProgressEvent)) *progress {
+	if fn == nil {
+		return nil
+	}
+	return &progress{fn: fn}
+}
+
+// start adds a blob to the totals
+func (p *progress) start(d types.Descriptor) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total.Blobs++
+	p.total.Bytes += d.Size
+	p.fn(ProgressEvent{Desc: d, State: ProgressStarted, Total: p.total})
+}
+
+// update reports a change in transferred bytes
+func (p *progress) update(d types.Descriptor, prev, cur int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total.BytesDone += cur - prev
+	p.fn(ProgressEvent{Desc: d, State: ProgressActive, Cur: cur, Total: p.total})
+}
+
+// done reports the final state of a blob, cur is the number of bytes transferred by the progress reader
+func (p *progress) done(d types.Descriptor, state ProgressState, cur int64, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total.BlobsDone++
+	switch state {
+	case ProgressSkipped, ProgressExists, ProgressMounted:
+		p.total.BytesDone += d.Size - cur
+		cur = d.Size
+	case ProgressFinished:
+		// descriptors without a size are counted once the transfer completes
+		if d.Size <= 0 {
+			p.total.Bytes += cur
+		}
+	}
+	p.fn(ProgressEvent{Desc: d, State: state, Cur: cur, Err: err, Total: p.total})
+}
+
+// reader wraps rdr to report bytes read from the blob
+func (p *progress) reader(d types.Descriptor, rdr io.Reader) *progressReader {
+	return &progressReader{p: p, d: d, rdr: rdr}
+}
+
+type progressReader struct {
+	p   *progress
+	d   types.Descriptor
+	rdr io.Reader
+	cur int64
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.rdr.Read(b)
+	if n > 0 {
+		pr.p.update(pr.d, pr.cur, pr.cur+int64(n))
+		pr.cur += int64(n)
+	}
+	return n, err
+}
+
+// progressReadSeeker is used when the wrapped reader supports seeking, allowing uploads to be retried
+type progressReadSeeker struct {
+	*progressReader
+}
+
+func (prs progressReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	rs := prs.rdr.(io.Seeker)
+	pos, err := rs.Seek(offset, whence)
+	if err == nil && pos != prs.cur {
+		prs.p.update(prs.d, prs.cur, pos)
+		prs.cur = pos
+	}
+	return pos, err
+}
+
+// wrap returns a reader that reports progress, preserving the io.Seeker interface when available
+func (pr *progressReader) wrap() io.Reader {
+	if _, ok := pr.rdr.(io.Seeker); ok {
+		return progressReadSeeker{progressReader: pr}
+	}
+	return pr
+}
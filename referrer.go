@@ -0,0 +1,20 @@
+package regclient
+
+import (
+	"context"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
+)
+
+// ReferrerList retrieves a list of referrers to a manifest.
+// The reference should include a digest, otherwise the tag is resolved first.
+// Registries without the referrers API fall back to the "sha256-<digest>" tag schema.
+func (rc *RegClient) ReferrerList(ctx context.Context, r ref.Ref, opts ...scheme.ReferrerOpts) (referrer.ReferrerList, error) {
+	schemeAPI, err := rc.schemeGet(r.Scheme)
+	if err != nil {
+		return referrer.ReferrerList{}, err
+	}
+	return schemeAPI.ReferrerList(ctx, r, opts...)
+}
@@ -15,9 +15,12 @@ import (
 
 	dockercfg "github.com/docker/cli/cli/config"
 	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/cache"
 	"github.com/regclient/regclient/internal/rwfs"
 	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/scheme/mem"
 	"github.com/regclient/regclient/scheme/ocidir"
+	"github.com/regclient/regclient/scheme/ocitar"
 	"github.com/regclient/regclient/scheme/reg"
 	"github.com/sirupsen/logrus"
 )
@@ -51,8 +54,10 @@ func init() {
 
 // RegClient is used to access OCI distribution-spec registries
 type RegClient struct {
-	hosts map[string]*config.Host
-	log   *logrus.Logger
+	cacheDir  string
+	cacheSize int64
+	hosts     map[string]*config.Host
+	log       *logrus.Logger
 	// mu        sync.Mutex
 	regOpts   []reg.Opts
 	schemes   map[string]scheme.API
@@ -104,16 +109,49 @@ func New(opts ...Opt) *RegClient {
 
 	// setup scheme's
 	rc.schemes["reg"] = reg.New(rc.regOpts...)
+	if rc.cacheDir != "" {
+		c, err := cache.New(
+			cache.WithDir(rc.cacheDir),
+			cache.WithMaxSize(rc.cacheSize),
+			cache.WithLog(rc.log),
+		)
+		if err != nil {
+			rc.log.WithFields(logrus.Fields{
+				"dir": rc.cacheDir,
+				"err": err,
+			}).Warn("Failed to setup cache")
+		} else {
+			rc.schemes["reg"] = cache.NewScheme(rc.schemes["reg"], c)
+		}
+	}
 	rc.schemes["ocidir"] = ocidir.New(
 		ocidir.WithLog(rc.log),
 		ocidir.WithFS(rc.fs),
 	)
+	rc.schemes["ocitar"] = ocitar.New(
+		ocitar.WithLog(rc.log),
+		ocitar.WithFS(rc.fs),
+	)
+	rc.schemes["mem"] = mem.New(
+		mem.WithLog(rc.log),
+	)
 
 	rc.log.Debug("regclient initialized")
 
 	return &rc
 }
 
+// WithCache stores blobs and manifests pulled by digest in a local directory.
+// The least recently used entries are removed when the cache exceeds maxSize bytes, 0 disables the limit.
+// Content is verified against the digest when read from the cache.
+// Tags are always resolved with the registry.
+func WithCache(dir string, maxSize int64) Opt {
+	return func(rc *RegClient) {
+		rc.cacheDir = dir
+		rc.cacheSize = maxSize
+	}
+}
+
 // WithCertDir adds a path of certificates to trust similar to Docker's /etc/docker/certs.d
 func WithCertDir(path ...string) Opt {
 	return func(rc *RegClient) {
@@ -158,16 +196,17 @@ func WithConfigHosts(configHosts []config.Host) Opt {
 			}
 			tls, _ := configHost.TLS.MarshalText()
 			rc.log.WithFields(logrus.Fields{
-				"name":       configHost.Name,
-				"user":       configHost.User,
-				"hostname":   configHost.Hostname,
-				"repoAuth":   configHost.RepoAuth,
-				"tls":        string(tls),
-				"pathPrefix": configHost.PathPrefix,
-				"mirrors":    configHost.Mirrors,
-				"api":        configHost.API,
-				"blobMax":    configHost.BlobMax,
-				"blobChunk":  configHost.BlobChunk,
+				"name":        configHost.Name,
+				"user":        configHost.User,
+				"hostname":    configHost.Hostname,
+				"repoAuth":    configHost.RepoAuth,
+				"tls":         string(tls),
+				"pathPrefix":  configHost.PathPrefix,
+				"mirrors":     configHost.Mirrors,
+				"api":         configHost.API,
+				"blobMax":     configHost.BlobMax,
+				"blobChunk":   configHost.BlobChunk,
+				"blobRecover": configHost.BlobRecover,
 			}).Debug("Loading host config")
 			err := rc.hostSet(configHost)
 			if err != nil {
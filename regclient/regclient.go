@@ -17,6 +17,7 @@ import (
 const (
 	DefaultBlobChunk   = reg.DefaultBlobChunk
 	DefaultBlobMax     = reg.DefaultBlobMax
+	DefaultBlobRecover = reg.DefaultBlobRecover
 	DefaultRetryLimit  = reghttp.DefaultRetryLimit
 	DefaultUserAgent   = rcTop.DefaultUserAgent
 	DockerCertDir      = rcTop.DockerCertDir
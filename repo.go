@@ -2,6 +2,7 @@ package regclient
 
 import (
 	"context"
+	"strings"
 
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
@@ -14,8 +15,14 @@ type repoLister interface {
 
 // RepoList returns a list of repositories on a registry
 // Note the underlying "_catalog" API is not supported on many cloud registries
+// The hostname may include a scheme prefix, e.g. "mem://name" lists the repositories of an in-memory registry
 func (rc *RegClient) RepoList(ctx context.Context, hostname string, opts ...scheme.RepoOpts) (*repo.RepoList, error) {
-	schemeAPI, err := rc.schemeGet("reg")
+	schemeName := "reg"
+	if i := strings.Index(hostname, "://"); i > 0 {
+		schemeName = hostname[:i]
+		hostname = hostname[i+3:]
+	}
+	schemeAPI, err := rc.schemeGet(schemeName)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,90 @@
+package regclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/reqresp"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRepoList(t *testing.T) {
+	ctx := context.Background()
+	rrs := []reqresp.ReqResp{
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "List",
+				Method: "GET",
+				Path:   "/v2/_catalog",
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Body:   []byte(`{"repositories":["library/alpine","library/busybox"]}`),
+				Headers: http.Header{
+					"Content-Type": {"application/json"},
+				},
+			},
+		},
+	}
+	rrs = append(rrs, reqresp.BaseEntries...)
+	ts := httptest.NewServer(reqresp.NewHandler(t, rrs))
+	defer ts.Close()
+	tsURL, _ := url.Parse(ts.URL)
+	tsHost := tsURL.Host
+	rcHosts := []config.Host{
+		{
+			Name:     tsHost,
+			Hostname: tsHost,
+			TLS:      config.TLSDisabled,
+		},
+	}
+	log := &logrus.Logger{
+		Out:       os.Stderr,
+		Formatter: new(logrus.TextFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.WarnLevel,
+	}
+	delayInit, _ := time.ParseDuration("0.05s")
+	delayMax, _ := time.ParseDuration("0.10s")
+	tests := []struct {
+		name string
+		opts []Opt
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "cache",
+			opts: []Opt{WithCache(t.TempDir(), 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Opt{
+				WithConfigHosts(rcHosts),
+				WithLog(log),
+				WithRetryDelay(delayInit, delayMax),
+			}, tt.opts...)
+			rc := New(opts...)
+			rl, err := rc.RepoList(ctx, tsHost)
+			if err != nil {
+				t.Errorf("failed to list repositories: %v", err)
+				return
+			}
+			repos, err := rl.GetRepos()
+			if err != nil {
+				t.Errorf("failed to get repositories: %v", err)
+				return
+			}
+			if len(repos) != 2 || repos[0] != "library/alpine" || repos[1] != "library/busybox" {
+				t.Errorf("unexpected repositories: %v", repos)
+			}
+		})
+	}
+}
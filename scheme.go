@@ -27,6 +27,7 @@ func (rc *RegClient) schemeInfo(r ref.Ref) (scheme.Info, error) {
 
 // Close is used to free resources associated with a reference
 // With ocidir, this may trigger a garbage collection process
+// With ocitar, a modified archive is written when closed
 func (rc *RegClient) Close(ctx context.Context, r ref.Ref) error {
 	schemeAPI, err := rc.schemeGet(r.Scheme)
 	if err != nil {
@@ -0,0 +1,138 @@
+package mem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	// crypto libraries included for go-digest
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/blob"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// BlobDelete removes a blob from the repository
+func (mem *Mem) BlobDelete(ctx context.Context, r ref.Ref, d types.Descriptor) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	repo := mem.repoGet(r, false)
+	if repo == nil {
+		return fmt.Errorf("blob %s not found in %s: %w", d.Digest.String(), r.CommonName(), types.ErrNotFound)
+	}
+	if _, ok := repo.blobs[d.Digest]; !ok {
+		return fmt.Errorf("blob %s not found in %s: %w", d.Digest.String(), r.CommonName(), types.ErrNotFound)
+	}
+	delete(repo.blobs, d.Digest)
+	return nil
+}
+
+// BlobGet retrieves a blob, returning a reader
+func (mem *Mem) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	b, err := mem.blobBytes(r, d)
+	if err != nil {
+		return nil, err
+	}
+	if d.Size <= 0 {
+		d.Size = int64(len(b))
+	}
+	br := blob.NewReader(
+		blob.WithRef(r),
+		blob.WithReader(bytes.NewReader(b)),
+		blob.WithDesc(d),
+	)
+	mem.log.WithFields(logrus.Fields{
+		"ref":    r.CommonName(),
+		"digest": d.Digest.String(),
+	}).Debug("retrieved blob")
+	return br, nil
+}
+
+// BlobHead verifies the existence of a blob, the reader contains the headers but no body to read
+func (mem *Mem) BlobHead(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	b, err := mem.blobBytes(r, d)
+	if err != nil {
+		return nil, err
+	}
+	if d.Size <= 0 {
+		d.Size = int64(len(b))
+	}
+	br := blob.NewReader(
+		blob.WithRef(r),
+		blob.WithDesc(d),
+	)
+	return br, nil
+}
+
+// BlobMount copies the blob between repositories without transferring the content
+func (mem *Mem) BlobMount(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	repoSrc := mem.repoGet(refSrc, false)
+	if repoSrc == nil {
+		return fmt.Errorf("blob %s not found in %s: %w", d.Digest.String(), refSrc.CommonName(), types.ErrNotFound)
+	}
+	b, ok := repoSrc.blobs[d.Digest]
+	if !ok {
+		return fmt.Errorf("blob %s not found in %s: %w", d.Digest.String(), refSrc.CommonName(), types.ErrNotFound)
+	}
+	// blob content is never modified, so the slice is shared between repositories
+	mem.repoGet(refTgt, true).blobs[d.Digest] = b
+	mem.log.WithFields(logrus.Fields{
+		"source": refSrc.CommonName(),
+		"target": refTgt.CommonName(),
+		"digest": d.Digest.String(),
+	}).Debug("mounted blob")
+	return nil
+}
+
+// BlobPut sends a blob to the repository, returns the digest and size when successful
+func (mem *Mem) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
+	b, err := io.ReadAll(rdr)
+	if err != nil {
+		return d, err
+	}
+	if d.Digest == "" {
+		d.Digest = digest.Canonical.FromBytes(b)
+	} else {
+		if err := d.Digest.Validate(); err != nil {
+			return d, err
+		}
+		if dig := d.Digest.Algorithm().FromBytes(b); dig != d.Digest {
+			return d, fmt.Errorf("unexpected digest, expected %s, computed %s: %w", d.Digest, dig, types.ErrDigestMismatch)
+		}
+	}
+	if d.Size <= 0 {
+		d.Size = int64(len(b))
+	} else if d.Size != int64(len(b)) {
+		return d, fmt.Errorf("unexpected blob length, expected %d, received %d", d.Size, int64(len(b)))
+	}
+	mem.mu.Lock()
+	mem.repoGet(r, true).blobs[d.Digest] = b
+	mem.mu.Unlock()
+	mem.log.WithFields(logrus.Fields{
+		"ref":    r.CommonName(),
+		"digest": d.Digest.String(),
+	}).Debug("pushed blob")
+	return d, nil
+}
+
+// blobBytes returns the content of a blob
+func (mem *Mem) blobBytes(r ref.Ref, d types.Descriptor) ([]byte, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+	repo := mem.repoGet(r, false)
+	if repo == nil {
+		return nil, fmt.Errorf("blob %s not found in %s: %w", d.Digest.String(), r.CommonName(), types.ErrNotFound)
+	}
+	b, ok := repo.blobs[d.Digest]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found in %s: %w", d.Digest.String(), r.CommonName(), types.ErrNotFound)
+	}
+	return b, nil
+}
@@ -0,0 +1,105 @@
+package mem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestBlob(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	r, err := ref.New("mem://test/repo")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	rMount, err := ref.New("mem://test/mount")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	content := []byte("hello world")
+	d := types.Descriptor{
+		MediaType: types.MediaTypeOCI1LayerGzip,
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := m.BlobGet(ctx, r, d)
+		if err == nil || !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error on missing blob: %v", err)
+		}
+	})
+	t.Run("Put", func(t *testing.T) {
+		_, err := m.BlobPut(ctx, r, types.Descriptor{Digest: digest.FromString("other")}, bytes.NewReader(content))
+		if err == nil || !errors.Is(err, types.ErrDigestMismatch) {
+			t.Errorf("put with the wrong digest did not fail: %v", err)
+		}
+		dPut, err := m.BlobPut(ctx, r, types.Descriptor{}, bytes.NewReader(content))
+		if err != nil {
+			t.Errorf("failed to put blob: %v", err)
+			return
+		}
+		if dPut.Digest != d.Digest || dPut.Size != d.Size {
+			t.Errorf("unexpected descriptor, expected %v, received %v", d, dPut)
+		}
+	})
+	t.Run("Get", func(t *testing.T) {
+		br, err := m.BlobGet(ctx, r, types.Descriptor{Digest: d.Digest})
+		if err != nil {
+			t.Errorf("failed to get blob: %v", err)
+			return
+		}
+		defer br.Close()
+		if br.GetDescriptor().Size != d.Size {
+			t.Errorf("unexpected size, expected %d, received %d", d.Size, br.GetDescriptor().Size)
+		}
+		b, err := io.ReadAll(br)
+		if err != nil {
+			t.Errorf("failed to read blob: %v", err)
+			return
+		}
+		if !bytes.Equal(b, content) {
+			t.Errorf("unexpected content: %s", string(b))
+		}
+	})
+	t.Run("Mount", func(t *testing.T) {
+		err := m.BlobMount(ctx, r, rMount, d)
+		if err != nil {
+			t.Errorf("failed to mount blob: %v", err)
+			return
+		}
+		br, err := m.BlobHead(ctx, rMount, d)
+		if err != nil {
+			t.Errorf("failed to head mounted blob: %v", err)
+			return
+		}
+		br.Close()
+	})
+	t.Run("Delete", func(t *testing.T) {
+		err := m.BlobDelete(ctx, r, d)
+		if err != nil {
+			t.Errorf("failed to delete blob: %v", err)
+			return
+		}
+		_, err = m.BlobHead(ctx, r, d)
+		if err == nil || !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error on deleted blob: %v", err)
+		}
+		// the mounted copy is not removed
+		br, err := m.BlobHead(ctx, rMount, d)
+		if err != nil {
+			t.Errorf("failed to head mounted blob: %v", err)
+			return
+		}
+		br.Close()
+	})
+}
@@ -0,0 +1,169 @@
+package mem
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/wraperr"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// ManifestDelete removes a manifest, including all tags that point to that manifest
+func (mem *Mem) ManifestDelete(ctx context.Context, r ref.Ref) error {
+	if r.Digest == "" {
+		return wraperr.New(fmt.Errorf("digest required to delete manifest, reference %s", r.CommonName()), types.ErrMissingDigest)
+	}
+	dig := digest.Digest(r.Digest)
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	repo := mem.repoGet(r, false)
+	if repo == nil {
+		return fmt.Errorf("manifest %s not found: %w", r.CommonName(), types.ErrNotFound)
+	}
+	if _, ok := repo.manifests[dig]; !ok {
+		return fmt.Errorf("manifest %s not found: %w", r.CommonName(), types.ErrNotFound)
+	}
+	delete(repo.manifests, dig)
+	for t, tDig := range repo.tags {
+		if tDig == dig {
+			delete(repo.tags, t)
+		}
+	}
+	// remove the manifest from the referrers of its subject
+	for subject, dl := range repo.referrers {
+		for i := len(dl) - 1; i >= 0; i-- {
+			if dl[i] == dig {
+				dl = append(dl[:i], dl[i+1:]...)
+			}
+		}
+		if len(dl) == 0 {
+			delete(repo.referrers, subject)
+		} else {
+			repo.referrers[subject] = dl
+		}
+	}
+	mem.log.WithFields(logrus.Fields{
+		"ref": r.CommonName(),
+	}).Debug("deleted manifest")
+	return nil
+}
+
+// ManifestGet retrieves a manifest from a repository
+func (mem *Mem) ManifestGet(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	desc, raw, err := mem.manifestLookup(r)
+	if err != nil {
+		return nil, err
+	}
+	mem.log.WithFields(logrus.Fields{
+		"ref": r.CommonName(),
+	}).Debug("retrieved manifest")
+	return manifest.New(
+		manifest.WithRef(r),
+		manifest.WithDesc(desc),
+		manifest.WithRaw(raw),
+	)
+}
+
+// ManifestHead gets metadata about the manifest (existence, digest, mediatype, size)
+func (mem *Mem) ManifestHead(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	desc, _, err := mem.manifestLookup(r)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.New(
+		manifest.WithRef(r),
+		manifest.WithDesc(desc),
+	)
+}
+
+// ManifestPut sends a manifest to the repository
+func (mem *Mem) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest, opts ...scheme.ManifestOpts) error {
+	config := scheme.ManifestConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if !config.Child && r.Digest == "" && r.Tag == "" {
+		r.Tag = "latest"
+	}
+	desc := m.GetDescriptor()
+	raw, err := m.RawBody()
+	if err != nil {
+		return fmt.Errorf("could not serialize manifest: %w", err)
+	}
+	if r.Digest != "" && r.Digest != desc.Digest.String() {
+		return fmt.Errorf("manifest digest %s does not match reference %s: %w", desc.Digest.String(), r.CommonName(), types.ErrDigestMismatch)
+	}
+	var subject *types.Descriptor
+	if ms, ok := m.(manifest.Subjecter); ok {
+		subject, err = ms.GetSubject()
+		if err != nil {
+			return err
+		}
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	repo := mem.repoGet(r, true)
+	repo.manifests[desc.Digest] = memManifest{
+		mt:  desc.MediaType,
+		raw: raw,
+	}
+	if !config.Child && r.Tag != "" {
+		repo.tags[r.Tag] = desc.Digest
+	}
+	// track the manifest as a referrer of the subject
+	if subject != nil {
+		found := false
+		for _, dig := range repo.referrers[subject.Digest] {
+			if dig == desc.Digest {
+				found = true
+				break
+			}
+		}
+		if !found {
+			repo.referrers[subject.Digest] = append(repo.referrers[subject.Digest], desc.Digest)
+		}
+	}
+	mem.log.WithFields(logrus.Fields{
+		"ref":    r.CommonName(),
+		"digest": desc.Digest.String(),
+	}).Debug("pushed manifest")
+	return nil
+}
+
+// manifestLookup resolves the reference to a descriptor and returns the raw manifest
+func (mem *Mem) manifestLookup(r ref.Ref) (types.Descriptor, []byte, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+	repo := mem.repoGet(r, false)
+	if repo == nil {
+		return types.Descriptor{}, nil, fmt.Errorf("manifest %s not found: %w", r.CommonName(), types.ErrNotFound)
+	}
+	dig := digest.Digest(r.Digest)
+	if dig == "" {
+		tag := r.Tag
+		if tag == "" {
+			tag = "latest"
+		}
+		tDig, ok := repo.tags[tag]
+		if !ok {
+			return types.Descriptor{}, nil, fmt.Errorf("manifest %s not found: %w", r.CommonName(), types.ErrNotFound)
+		}
+		dig = tDig
+	}
+	mm, ok := repo.manifests[dig]
+	if !ok {
+		return types.Descriptor{}, nil, fmt.Errorf("manifest %s not found: %w", r.CommonName(), types.ErrNotFound)
+	}
+	desc := types.Descriptor{
+		MediaType: mm.mt,
+		Digest:    dig,
+		Size:      int64(len(mm.raw)),
+	}
+	return desc, mm.raw, nil
+}
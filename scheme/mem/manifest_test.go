@@ -0,0 +1,105 @@
+package mem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestManifest(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	r, err := ref.New("mem://test/repo:v1")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	mImage, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: types.MediaTypeOCI1Manifest,
+		Config: types.Descriptor{
+			MediaType: types.MediaTypeOCI1ImageConfig,
+			Digest:    digest.FromString("{}"),
+			Size:      2,
+		},
+		Layers: []types.Descriptor{},
+	}))
+	if err != nil {
+		t.Errorf("failed to create manifest: %v", err)
+		return
+	}
+	dig := mImage.GetDescriptor().Digest
+	rDig := r
+	rDig.Tag = ""
+	rDig.Digest = dig.String()
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := m.ManifestHead(ctx, r)
+		if err == nil || !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error on missing manifest: %v", err)
+		}
+	})
+	t.Run("Put", func(t *testing.T) {
+		rBad := rDig
+		rBad.Digest = digest.FromString("other").String()
+		err := m.ManifestPut(ctx, rBad, mImage)
+		if err == nil || !errors.Is(err, types.ErrDigestMismatch) {
+			t.Errorf("put with the wrong digest did not fail: %v", err)
+		}
+		err = m.ManifestPut(ctx, r, mImage)
+		if err != nil {
+			t.Errorf("failed to put manifest: %v", err)
+			return
+		}
+		// child manifests are not tagged
+		rChild := r
+		rChild.Tag = "child"
+		err = m.ManifestPut(ctx, rChild, mImage, scheme.WithManifestChild())
+		if err != nil {
+			t.Errorf("failed to put child manifest: %v", err)
+			return
+		}
+		_, err = m.ManifestHead(ctx, rChild)
+		if err == nil || !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("child manifest was tagged: %v", err)
+		}
+	})
+	t.Run("Get", func(t *testing.T) {
+		for _, rGet := range []ref.Ref{r, rDig} {
+			mGet, err := m.ManifestGet(ctx, rGet)
+			if err != nil {
+				t.Errorf("failed to get %s: %v", rGet.CommonName(), err)
+				return
+			}
+			if mGet.GetDescriptor().Digest != dig || mGet.GetDescriptor().MediaType != types.MediaTypeOCI1Manifest {
+				t.Errorf("unexpected descriptor for %s: %v", rGet.CommonName(), mGet.GetDescriptor())
+			}
+			if _, ok := mGet.GetOrig().(v1.Manifest); !ok {
+				t.Errorf("unexpected manifest type %T", mGet.GetOrig())
+			}
+		}
+	})
+	t.Run("Delete", func(t *testing.T) {
+		err := m.ManifestDelete(ctx, r)
+		if err == nil || !errors.Is(err, types.ErrMissingDigest) {
+			t.Errorf("delete by tag did not fail: %v", err)
+		}
+		err = m.ManifestDelete(ctx, rDig)
+		if err != nil {
+			t.Errorf("failed to delete manifest: %v", err)
+			return
+		}
+		// tags to the deleted manifest are removed
+		_, err = m.ManifestHead(ctx, r)
+		if err == nil || !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error on deleted manifest: %v", err)
+		}
+	})
+}
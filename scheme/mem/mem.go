@@ -0,0 +1,84 @@
+// Package mem implements an in-memory registry scheme
+// Content is shared by every reference using the same name within a RegClient and is lost when the RegClient is released
+package mem
+
+import (
+	"io/ioutil"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// Mem is used for accessing in-memory registries, referenced as mem://name/repo:tag
+type Mem struct {
+	log   *logrus.Logger
+	mu    sync.RWMutex
+	repos map[string]*memRepo
+}
+
+// memRepo contains the content of a single repository
+type memRepo struct {
+	blobs     map[digest.Digest][]byte
+	manifests map[digest.Digest]memManifest
+	tags      map[string]digest.Digest
+	referrers map[digest.Digest][]digest.Digest // subject digest to a list of referrer manifests
+}
+
+type memManifest struct {
+	mt  string
+	raw []byte
+}
+
+type config struct {
+	log *logrus.Logger
+}
+
+// Opts are used for passing options to mem
+type Opts func(*config)
+
+// New creates a new Mem with options
+func New(opts ...Opts) *Mem {
+	conf := config{
+		log: &logrus.Logger{Out: ioutil.Discard},
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	return &Mem{
+		log:   conf.log,
+		repos: map[string]*memRepo{},
+	}
+}
+
+// WithLog provides a logrus logger
+// By default logging is disabled
+func WithLog(log *logrus.Logger) Opts {
+	return func(c *config) {
+		c.log = log
+	}
+}
+
+// Info is experimental, do not use
+func (mem *Mem) Info() scheme.Info {
+	return scheme.Info{}
+}
+
+// repoGet returns the repository for a reference, the caller must hold the lock
+// When create is false, nil is returned for a missing repository
+func (mem *Mem) repoGet(r ref.Ref, create bool) *memRepo {
+	key := r.Registry + "/" + r.Repository
+	repo, ok := mem.repos[key]
+	if !ok && create {
+		repo = &memRepo{
+			blobs:     map[digest.Digest][]byte{},
+			manifests: map[digest.Digest]memManifest{},
+			tags:      map[string]digest.Digest{},
+			referrers: map[digest.Digest][]digest.Digest{},
+		}
+		mem.repos[key] = repo
+	}
+	return repo
+}
@@ -0,0 +1,61 @@
+package mem
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
+)
+
+// ReferrerList returns a list of referrers to a given reference.
+// Referrers are tracked when manifests with a subject are pushed, the digest tag schema is not used.
+func (mem *Mem) ReferrerList(ctx context.Context, r ref.Ref, opts ...scheme.ReferrerOpts) (referrer.ReferrerList, error) {
+	config := scheme.ReferrerConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	// resolve the tag to a digest
+	if r.Digest == "" {
+		m, err := mem.ManifestHead(ctx, r)
+		if err != nil {
+			return referrer.ReferrerList{Subject: r}, err
+		}
+		r.Digest = m.GetDescriptor().Digest.String()
+	}
+	rl := referrer.ReferrerList{
+		Subject:     r,
+		Descriptors: []types.Descriptor{},
+	}
+	// copy the referrers before parsing them outside of the lock
+	mem.mu.RLock()
+	descs := []types.Descriptor{}
+	raws := [][]byte{}
+	if repo := mem.repoGet(r, false); repo != nil {
+		for _, dig := range repo.referrers[digest.Digest(r.Digest)] {
+			if mm, ok := repo.manifests[dig]; ok {
+				descs = append(descs, types.Descriptor{MediaType: mm.mt, Digest: dig, Size: int64(len(mm.raw))})
+				raws = append(raws, mm.raw)
+			}
+		}
+	}
+	mem.mu.RUnlock()
+	for i := range descs {
+		m, err := manifest.New(
+			manifest.WithDesc(descs[i]),
+			manifest.WithRaw(raws[i]),
+		)
+		if err != nil {
+			return rl, fmt.Errorf("failed to parse referrer: %w", err)
+		}
+		err = rl.Add(m)
+		if err != nil {
+			return rl, err
+		}
+	}
+	return rl.FilterArtifactType(config.FilterArtifactType), nil
+}
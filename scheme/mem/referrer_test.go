@@ -0,0 +1,141 @@
+package mem
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestReferrer(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	atSBOM := "application/example.sbom"
+	atSig := "application/example.signature"
+	r, err := ref.New("mem://test/repo:latest")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	mSubject, err := manifest.New(manifest.WithOrig(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{},
+	}))
+	if err != nil {
+		t.Errorf("failed to create subject: %v", err)
+		return
+	}
+	err = m.ManifestPut(ctx, r, mSubject)
+	if err != nil {
+		t.Errorf("failed to put subject: %v", err)
+		return
+	}
+	subjectDesc := mSubject.GetDescriptor()
+	artifacts := []manifest.Manifest{}
+	for _, at := range []string{atSBOM, atSig} {
+		am, err := manifest.New(manifest.WithOrig(v1.Manifest{
+			Versioned:    v1.ManifestSchemaVersion,
+			MediaType:    types.MediaTypeOCI1Manifest,
+			ArtifactType: at,
+			Config: types.Descriptor{
+				MediaType: types.MediaTypeOCI1Empty,
+				Digest:    digest.FromString("{}"),
+				Size:      2,
+			},
+			Layers: []types.Descriptor{},
+			Subject: &types.Descriptor{
+				MediaType: subjectDesc.MediaType,
+				Digest:    subjectDesc.Digest,
+				Size:      subjectDesc.Size,
+			},
+			Annotations: map[string]string{
+				"type": at,
+			},
+		}))
+		if err != nil {
+			t.Errorf("failed to create artifact: %v", err)
+			return
+		}
+		artifacts = append(artifacts, am)
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		rl, err := m.ReferrerList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if !rl.IsEmpty() {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+	})
+	t.Run("Put", func(t *testing.T) {
+		// push the first artifact twice to verify duplicates are not listed
+		for _, am := range append(artifacts, artifacts[0]) {
+			rPut := r
+			rPut.Tag = ""
+			rPut.Digest = am.GetDescriptor().Digest.String()
+			err = m.ManifestPut(ctx, rPut, am)
+			if err != nil {
+				t.Errorf("failed to put artifact: %v", err)
+				return
+			}
+		}
+	})
+	t.Run("List", func(t *testing.T) {
+		rl, err := m.ReferrerList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 2 {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+			return
+		}
+		for i, am := range artifacts {
+			if rl.Descriptors[i].Digest != am.GetDescriptor().Digest {
+				t.Errorf("descriptor %d digest mismatch, expected %s, received %s", i, am.GetDescriptor().Digest, rl.Descriptors[i].Digest)
+			}
+			if rl.Descriptors[i].Annotations["type"] != rl.Descriptors[i].ArtifactType {
+				t.Errorf("descriptor %d missing annotations: %v", i, rl.Descriptors[i])
+			}
+		}
+		if len(rl.Tags) != 0 {
+			t.Errorf("unexpected tags: %v", rl.Tags)
+		}
+	})
+	t.Run("Filter", func(t *testing.T) {
+		rl, err := m.ReferrerList(ctx, r, scheme.WithReferrerAT(atSig))
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 1 || rl.Descriptors[0].ArtifactType != atSig {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+	})
+	t.Run("Delete", func(t *testing.T) {
+		rDel := r
+		rDel.Tag = ""
+		rDel.Digest = artifacts[0].GetDescriptor().Digest.String()
+		err := m.ManifestDelete(ctx, rDel)
+		if err != nil {
+			t.Errorf("failed to delete artifact: %v", err)
+			return
+		}
+		rl, err := m.ReferrerList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 1 || rl.Descriptors[0].Digest != artifacts[1].GetDescriptor().Digest {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+	})
+}
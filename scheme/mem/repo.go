@@ -0,0 +1,47 @@
+package mem
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/repo"
+)
+
+// RepoList returns a list of repositories in the named in-memory registry
+func (mem *Mem) RepoList(ctx context.Context, hostname string, opts ...scheme.RepoOpts) (*repo.RepoList, error) {
+	config := scheme.RepoConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	prefix := hostname + "/"
+	rl := []string{}
+	mem.mu.RLock()
+	for key := range mem.repos {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, prefix)
+		if config.Last == "" || name > config.Last {
+			rl = append(rl, name)
+		}
+	}
+	mem.mu.RUnlock()
+	sort.Strings(rl)
+	if config.Limit > 0 && len(rl) > config.Limit {
+		rl = rl[:config.Limit]
+	}
+	raw, err := json.Marshal(repo.RepoRegistryList{
+		Repositories: rl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo.New(
+		repo.WithHost(hostname),
+		repo.WithMT("application/json"),
+		repo.WithRaw(raw),
+	)
+}
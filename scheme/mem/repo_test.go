@@ -0,0 +1,73 @@
+package mem
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestRepoList(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	for _, name := range []string{"mem://test/b", "mem://test/a/nested", "mem://test/a", "mem://other/c"} {
+		r, err := ref.New(name)
+		if err != nil {
+			t.Errorf("failed to parse ref %s: %v", name, err)
+			return
+		}
+		_, err = m.BlobPut(ctx, r, types.Descriptor{}, bytes.NewReader([]byte(name)))
+		if err != nil {
+			t.Errorf("failed to put blob to %s: %v", name, err)
+			return
+		}
+	}
+	tests := []struct {
+		name   string
+		host   string
+		opts   []scheme.RepoOpts
+		expect []string
+	}{
+		{
+			name:   "all",
+			host:   "test",
+			expect: []string{"a", "a/nested", "b"},
+		},
+		{
+			name:   "other",
+			host:   "other",
+			expect: []string{"c"},
+		},
+		{
+			name:   "page",
+			host:   "test",
+			opts:   []scheme.RepoOpts{scheme.WithRepoLast("a"), scheme.WithRepoLimit(1)},
+			expect: []string{"a/nested"},
+		},
+		{
+			name:   "empty",
+			host:   "missing",
+			expect: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl, err := m.RepoList(ctx, tt.host, tt.opts...)
+			if err != nil {
+				t.Errorf("failed to list repositories: %v", err)
+				return
+			}
+			repos, err := rl.GetRepos()
+			if err != nil {
+				t.Errorf("failed to get repos: %v", err)
+				return
+			}
+			if !cmpSliceString(tt.expect, repos) {
+				t.Errorf("unexpected repo list, expected %v, received %v", tt.expect, repos)
+			}
+		})
+	}
+}
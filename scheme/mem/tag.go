@@ -0,0 +1,68 @@
+package mem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/tag"
+)
+
+// TagDelete removes a tag from the repository
+func (mem *Mem) TagDelete(ctx context.Context, r ref.Ref) error {
+	if r.Tag == "" {
+		return types.ErrMissingTag
+	}
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	repo := mem.repoGet(r, false)
+	if repo == nil {
+		return fmt.Errorf("failed deleting %s: %w", r.CommonName(), types.ErrNotFound)
+	}
+	if _, ok := repo.tags[r.Tag]; !ok {
+		return fmt.Errorf("failed deleting %s: %w", r.CommonName(), types.ErrNotFound)
+	}
+	delete(repo.tags, r.Tag)
+	return nil
+}
+
+// TagList returns a list of tags from the repository
+func (mem *Mem) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts) (*tag.List, error) {
+	config := scheme.TagConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	mem.mu.RLock()
+	repo := mem.repoGet(r, false)
+	if repo == nil {
+		mem.mu.RUnlock()
+		return nil, fmt.Errorf("repository %s not found: %w", r.CommonName(), types.ErrNotFound)
+	}
+	tl := make([]string, 0, len(repo.tags))
+	for t := range repo.tags {
+		if config.Last == "" || t > config.Last {
+			tl = append(tl, t)
+		}
+	}
+	mem.mu.RUnlock()
+	sort.Strings(tl)
+	if config.Limit > 0 && len(tl) > config.Limit {
+		tl = tl[:config.Limit]
+	}
+	raw, err := json.Marshal(tag.DockerList{
+		Name: r.Repository,
+		Tags: tl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tag.New(
+		tag.WithRaw(raw),
+		tag.WithRef(r),
+		tag.WithTags(tl),
+	)
+}
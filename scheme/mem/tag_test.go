@@ -0,0 +1,122 @@
+package mem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestTag(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	r, err := ref.New("mem://test/repo")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	mIndex, err := manifest.New(manifest.WithOrig(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{},
+	}))
+	if err != nil {
+		t.Errorf("failed to create manifest: %v", err)
+		return
+	}
+	for _, tag := range []string{"v1", "latest", "v2", "v1.1"} {
+		rTag := r
+		rTag.Tag = tag
+		err = m.ManifestPut(ctx, rTag, mIndex)
+		if err != nil {
+			t.Errorf("failed to put %s: %v", rTag.CommonName(), err)
+			return
+		}
+	}
+
+	t.Run("TagList", func(t *testing.T) {
+		exTags := []string{"latest", "v1", "v1.1", "v2"}
+		tl, err := m.TagList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to retrieve tag list: %v", err)
+			return
+		}
+		tlTags, err := tl.GetTags()
+		if err != nil {
+			t.Errorf("failed to get tags: %v", err)
+		}
+		if !cmpSliceString(exTags, tlTags) {
+			t.Errorf("unexpected tag list, expected %v, received %v", exTags, tlTags)
+		}
+	})
+
+	t.Run("TagListPage", func(t *testing.T) {
+		exTags := []string{"v1", "v1.1"}
+		tl, err := m.TagList(ctx, r, scheme.WithTagLast("latest"), scheme.WithTagLimit(2))
+		if err != nil {
+			t.Errorf("failed to retrieve tag list: %v", err)
+			return
+		}
+		tlTags, err := tl.GetTags()
+		if err != nil {
+			t.Errorf("failed to get tags: %v", err)
+		}
+		if !cmpSliceString(exTags, tlTags) {
+			t.Errorf("unexpected tag list, expected %v, received %v", exTags, tlTags)
+		}
+	})
+
+	t.Run("TagDelete", func(t *testing.T) {
+		exTags := []string{"latest", "v2"}
+		rCp := r
+		rCp.Tag = "missing"
+		err := m.TagDelete(ctx, rCp)
+		if err == nil || !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("deleting missing tag %s: %v", rCp.CommonName(), err)
+		}
+		for _, tag := range []string{"v1", "v1.1"} {
+			rCp.Tag = tag
+			err = m.TagDelete(ctx, rCp)
+			if err != nil {
+				t.Errorf("failed to delete tag %s: %v", rCp.CommonName(), err)
+			}
+		}
+		tl, err := m.TagList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to retrieve tag list: %v", err)
+			return
+		}
+		tlTags, err := tl.GetTags()
+		if err != nil {
+			t.Errorf("failed to get tags: %v", err)
+		}
+		if !cmpSliceString(exTags, tlTags) {
+			t.Errorf("unexpected tag list, expected %v, received %v", exTags, tlTags)
+		}
+		// the manifest remains available by digest
+		rDig := r
+		rDig.Tag = ""
+		rDig.Digest = mIndex.GetDescriptor().Digest.String()
+		_, err = m.ManifestHead(ctx, rDig)
+		if err != nil {
+			t.Errorf("failed to head manifest after deleting tags: %v", err)
+		}
+	})
+}
+
+func cmpSliceString(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
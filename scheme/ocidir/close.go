@@ -85,7 +85,7 @@ func (o *OCIDir) closeProcManifest(ctx context.Context, r ref.Ref, m manifest.Ma
 			cr.Tag = ""
 			cr.Digest = cur.Digest.String()
 			(*dl)[cr.Digest] = true
-			cm, err := o.ManifestGet(ctx, cr)
+			cm, err := o.manifestGet(ctx, cr)
 			if err != nil {
 				// ignore errors in case a manifest has been deleted or sparse copy
 				o.log.WithFields(logrus.Fields{
@@ -27,6 +27,8 @@ func (o *OCIDir) ManifestDelete(ctx context.Context, r ref.Ref) error {
 	if r.Digest == "" {
 		return wraperr.New(fmt.Errorf("digest required to delete manifest, reference %s", r.CommonName()), types.ErrMissingDigest)
 	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
 
 	// get index
 	changed := false
@@ -56,12 +58,18 @@ func (o *OCIDir) ManifestDelete(ctx context.Context, r ref.Ref) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete manifest: %w", err)
 	}
-	o.refMod(r)
+	o.modRefs[r.Path] = r
 	return nil
 }
 
 // ManifestGet retrieves a manifest from a repository
 func (o *OCIDir) ManifestGet(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.manifestGet(ctx, r)
+}
+
+func (o *OCIDir) manifestGet(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
 	index, err := o.readIndex(r)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read oci index: %w", err)
@@ -106,6 +114,12 @@ func (o *OCIDir) ManifestGet(ctx context.Context, r ref.Ref) (manifest.Manifest,
 
 // ManifestHead gets metadata about the manifest (existence, digest, mediatype, size)
 func (o *OCIDir) ManifestHead(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.manifestHead(ctx, r)
+}
+
+func (o *OCIDir) manifestHead(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
 	index, err := o.readIndex(r)
 	if err != nil {
 		return nil, err
@@ -133,11 +147,18 @@ func (o *OCIDir) ManifestHead(ctx context.Context, r ref.Ref) (manifest.Manifest
 }
 
 // ManifestPut sends a manifest to the repository
+// The lock is held for the full update since parallel pushes of referrers modify the same index
 func (o *OCIDir) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest, opts ...scheme.ManifestOpts) error {
 	config := scheme.ManifestConfig{}
 	for _, opt := range opts {
 		opt(&config)
 	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.manifestPut(ctx, r, m, config)
+}
+
+func (o *OCIDir) manifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest, config scheme.ManifestConfig) error {
 	if !config.Child && r.Digest == "" && r.Tag == "" {
 		r.Tag = "latest"
 	}
@@ -187,10 +208,16 @@ func (o *OCIDir) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest
 			return fmt.Errorf("failed to write index: %w", err)
 		}
 	}
-	o.refMod(r)
+	o.modRefs[r.Path] = r
 	o.log.WithFields(logrus.Fields{
 		"ref":  r.CommonName(),
 		"file": file,
 	}).Debug("pushed manifest")
+
+	// update the digest tag when the manifest has a subject
+	err = o.referrerPut(ctx, r, m)
+	if err != nil {
+		return fmt.Errorf("failed to update referrers: %w", err)
+	}
 	return nil
 }
@@ -28,7 +28,7 @@ type OCIDir struct {
 	log     *logrus.Logger
 	gc      bool
 	modRefs map[string]ref.Ref
-	mu      sync.Mutex
+	mu      sync.Mutex // guards modRefs and the read-modify-write of index.json
 }
 
 type config struct {
@@ -170,6 +170,7 @@ func (o *OCIDir) valid(dir string) error {
 	return nil
 }
 
+// refMod records a modified ref for GC, callers must not hold the lock
 func (o *OCIDir) refMod(r ref.Ref) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
@@ -0,0 +1,90 @@
+package ocidir
+
+import (
+	"context"
+	"errors"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
+)
+
+// ReferrerList returns a list of referrers to a given reference.
+// OCI Layouts do not have a referrers API, the digest tag schema is always used.
+func (o *OCIDir) ReferrerList(ctx context.Context, r ref.Ref, opts ...scheme.ReferrerOpts) (referrer.ReferrerList, error) {
+	config := scheme.ReferrerConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// resolve the tag to a digest
+	if r.Digest == "" {
+		m, err := o.manifestHead(ctx, r)
+		if err != nil {
+			return referrer.ReferrerList{Subject: r}, err
+		}
+		r.Digest = m.GetDescriptor().Digest.String()
+	}
+	rl, err := o.referrerListTag(ctx, r)
+	if err != nil {
+		return rl, err
+	}
+	return rl.FilterArtifactType(config.FilterArtifactType), nil
+}
+
+// referrerListTag retrieves referrers from the digest tag, an empty list is returned if the tag does not exist, the caller must hold the lock
+func (o *OCIDir) referrerListTag(ctx context.Context, r ref.Ref) (referrer.ReferrerList, error) {
+	rl := referrer.ReferrerList{
+		Subject: r,
+		Tags:    []string{},
+	}
+	rlTag, err := referrer.FallbackTag(r)
+	if err != nil {
+		return rl, err
+	}
+	m, err := o.manifestGet(ctx, rlTag)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			// empty list
+			return rl, nil
+		}
+		return rl, err
+	}
+	rl, err = referrer.FromManifest(r, m)
+	if err != nil {
+		return rl, err
+	}
+	rl.Tags = append(rl.Tags, rlTag.Tag)
+	return rl, nil
+}
+
+// referrerPut adds a manifest to the digest tag of its subject, the caller must hold the lock
+func (o *OCIDir) referrerPut(ctx context.Context, r ref.Ref, m manifest.Manifest) error {
+	ms, ok := m.(manifest.Subjecter)
+	if !ok {
+		return nil
+	}
+	subject, err := ms.GetSubject()
+	if err != nil || subject == nil {
+		return err
+	}
+	rSubject := r
+	rSubject.Tag = ""
+	rSubject.Digest = subject.Digest.String()
+	rl, err := o.referrerListTag(ctx, rSubject)
+	if err != nil {
+		return err
+	}
+	err = rl.Add(m)
+	if err != nil {
+		return err
+	}
+	rlTag, err := referrer.FallbackTag(rSubject)
+	if err != nil {
+		return err
+	}
+	return o.manifestPut(ctx, rlTag, rl.Manifest, scheme.ManifestConfig{})
+}
@@ -0,0 +1,138 @@
+package ocidir
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestReferrer(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, "testdata")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	o := New(WithFS(fsMem))
+	atSBOM := "application/example.sbom"
+	atSig := "application/example.signature"
+	r, err := ref.New("ocidir://testdata/regctl:latest")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	mSubject, err := o.ManifestHead(ctx, r)
+	if err != nil {
+		t.Errorf("failed to head subject: %v", err)
+		return
+	}
+	subjectDesc := mSubject.GetDescriptor()
+	artifacts := []manifest.Manifest{}
+	for _, at := range []string{atSBOM, atSig} {
+		m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+			Versioned:    v1.ManifestSchemaVersion,
+			MediaType:    types.MediaTypeOCI1Manifest,
+			ArtifactType: at,
+			Config: types.Descriptor{
+				MediaType: types.MediaTypeOCI1Empty,
+				Digest:    digest.FromString("{}"),
+				Size:      2,
+			},
+			Layers: []types.Descriptor{},
+			Subject: &types.Descriptor{
+				MediaType: subjectDesc.MediaType,
+				Digest:    subjectDesc.Digest,
+				Size:      subjectDesc.Size,
+			},
+			Annotations: map[string]string{
+				"type": at,
+			},
+		}))
+		if err != nil {
+			t.Errorf("failed to create artifact: %v", err)
+			return
+		}
+		artifacts = append(artifacts, m)
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		rl, err := o.ReferrerList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if !rl.IsEmpty() {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+	})
+	t.Run("Put", func(t *testing.T) {
+		for _, m := range artifacts {
+			rPut := r
+			rPut.Tag = ""
+			rPut.Digest = m.GetDescriptor().Digest.String()
+			err = o.ManifestPut(ctx, rPut, m)
+			if err != nil {
+				t.Errorf("failed to put artifact: %v", err)
+				return
+			}
+		}
+		// pushing the same artifact again should not create a duplicate entry
+		rPut := r
+		rPut.Tag = ""
+		rPut.Digest = artifacts[0].GetDescriptor().Digest.String()
+		err = o.ManifestPut(ctx, rPut, artifacts[0])
+		if err != nil {
+			t.Errorf("failed to put artifact: %v", err)
+			return
+		}
+	})
+	t.Run("List", func(t *testing.T) {
+		rl, err := o.ReferrerList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 2 {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+			return
+		}
+		for i, m := range artifacts {
+			if rl.Descriptors[i].Digest != m.GetDescriptor().Digest {
+				t.Errorf("descriptor %d digest mismatch, expected %s, received %s", i, m.GetDescriptor().Digest, rl.Descriptors[i].Digest)
+			}
+			if rl.Descriptors[i].Annotations["type"] != rl.Descriptors[i].ArtifactType {
+				t.Errorf("descriptor %d missing annotations: %v", i, rl.Descriptors[i])
+			}
+		}
+		if len(rl.Tags) != 1 || rl.Tags[0] != subjectDesc.Digest.Algorithm().String()+"-"+subjectDesc.Digest.Encoded() {
+			t.Errorf("unexpected tags: %v", rl.Tags)
+		}
+	})
+	t.Run("Filter", func(t *testing.T) {
+		rl, err := o.ReferrerList(ctx, r, scheme.WithReferrerAT(atSig))
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 1 || rl.Descriptors[0].ArtifactType != atSig {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+		rl, err = o.ReferrerList(ctx, r, scheme.WithReferrerAT("application/example.missing"))
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if !rl.IsEmpty() {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+	})
+}
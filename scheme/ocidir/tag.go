@@ -18,6 +18,8 @@ func (o *OCIDir) TagDelete(ctx context.Context, r ref.Ref) error {
 	if r.Tag == "" {
 		return types.ErrMissingTag
 	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	// get index
 	index, err := o.readIndex(r)
 	if err != nil {
@@ -39,12 +41,14 @@ func (o *OCIDir) TagDelete(ctx context.Context, r ref.Ref) error {
 	if err != nil {
 		return fmt.Errorf("failed to write index: %w", err)
 	}
-	o.refMod(r)
+	o.modRefs[r.Path] = r
 	return nil
 }
 
 // TagList returns a list of tags from the repository
 func (o *OCIDir) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts) (*tag.List, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	// get index
 	index, err := o.readIndex(r)
 	if err != nil {
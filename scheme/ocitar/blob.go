@@ -0,0 +1,47 @@
+package ocitar
+
+import (
+	"context"
+	"io"
+
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/blob"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// BlobDelete removes a blob from the repository
+func (o *OCITar) BlobDelete(ctx context.Context, r ref.Ref, d types.Descriptor) error {
+	return types.ErrNotImplemented
+}
+
+// BlobGet retrieves a blob, returning a reader
+func (o *OCITar) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	od, err := o.layout(r, false)
+	if err != nil {
+		return nil, err
+	}
+	return od.BlobGet(ctx, r, d)
+}
+
+// BlobHead verifies the existence of a blob, the reader contains the headers but no body to read
+func (o *OCITar) BlobHead(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	od, err := o.layout(r, false)
+	if err != nil {
+		return nil, err
+	}
+	return od.BlobHead(ctx, r, d)
+}
+
+// BlobMount attempts to perform a server side copy of the blob
+func (o *OCITar) BlobMount(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor) error {
+	return types.ErrUnsupported
+}
+
+// BlobPut sends a blob to the repository, returns the digest and size when successful
+func (o *OCITar) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
+	od, err := o.layout(r, true)
+	if err != nil {
+		return d, err
+	}
+	return od.BlobPut(ctx, r, d, rdr)
+}
@@ -0,0 +1,153 @@
+package ocitar
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// Close writes the archive if it was modified, and removes the extracted content
+// Unreferenced blobs are removed from the archive before it is written
+func (o *OCITar) Close(ctx context.Context, r ref.Ref) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := path.Clean(r.Path)
+	tl, ok := o.tars[key]
+	if !ok {
+		return nil
+	}
+	delete(o.tars, key)
+	defer os.RemoveAll(tl.tmp)
+	if !tl.mod {
+		return nil
+	}
+	// garbage collect the extracted layout
+	err := tl.dir.Close(ctx, r)
+	if err != nil {
+		return err
+	}
+	return o.write(key, tl.fs)
+}
+
+// write packs the extracted layout into the archive, files named *.gz, *.tgz, or *.zst are compressed
+// The archive is written to a temp file in the same directory and renamed to replace the original
+func (o *OCITar) write(file string, stage rwfs.RWFS) error {
+	if dir := path.Dir(file); dir != "." {
+		err := rwfs.MkdirAll(o.fs, dir, 0777)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("failed creating %s: %w", dir, err)
+		}
+	}
+	tmpFile := path.Join(path.Dir(file), fmt.Sprintf(".%s.%d.tmp", path.Base(file), time.Now().UnixNano()))
+	fh, err := o.fs.OpenFile(tmpFile, rwfs.O_WRONLY|rwfs.O_CREATE|rwfs.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpFile, err)
+	}
+	err = o.writeTar(file, fh, stage)
+	errC := fh.Close()
+	if err == nil {
+		err = errC
+	}
+	if err == nil {
+		err = o.fs.Rename(tmpFile, file)
+	}
+	if err != nil {
+		o.fs.Remove(tmpFile)
+		return err
+	}
+	o.log.WithFields(logrus.Fields{
+		"file": file,
+	}).Debug("wrote oci layout")
+	return nil
+}
+
+// writeTar packs the extracted layout into w
+func (o *OCITar) writeTar(file string, w io.Writer, stage rwfs.RWFS) error {
+	comp := archive.CompressNone
+	switch {
+	case strings.HasSuffix(file, ".gz"), strings.HasSuffix(file, ".tgz"):
+		comp = archive.CompressGzip
+	case strings.HasSuffix(file, ".zst"):
+		comp = archive.CompressZstd
+	}
+	cw, err := archive.CompressWriter(w, comp)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	// the layout and index are written first so readers can find them without buffering blobs
+	names := []string{}
+	for _, name := range []string{"oci-layout", "index.json"} {
+		if _, err := rwfs.Stat(stage, name); err == nil {
+			names = append(names, name)
+		}
+	}
+	err = fs.WalkDir(stage, ".", func(name string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." || name == "oci-layout" || name == "index.json" {
+			return nil
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read layout for %s: %w", file, err)
+	}
+	for _, name := range names {
+		err = tarAdd(tw, stage, name)
+		if err != nil {
+			return fmt.Errorf("failed to write %s to %s: %w", name, file, err)
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+func tarAdd(tw *tar.Writer, stage rwfs.RWFS, name string) error {
+	fi, err := rwfs.Stat(stage, name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return tw.WriteHeader(&tar.Header{
+			Format:   tar.FormatPAX,
+			Typeflag: tar.TypeDir,
+			Name:     name + "/",
+			Mode:     0755,
+		})
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Format:   tar.FormatPAX,
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     fi.Size(),
+		Mode:     0644,
+	})
+	if err != nil {
+		return err
+	}
+	fh, err := stage.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	_, err = io.Copy(tw, fh)
+	return err
+}
@@ -0,0 +1,49 @@
+package ocitar
+
+import (
+	"io/fs"
+	"strings"
+
+	"github.com/regclient/regclient/internal/rwfs"
+)
+
+// stageFS maps the paths used by ocidir for a reference to the root of the extracted archive
+type stageFS struct {
+	fs     rwfs.RWFS
+	prefix string
+}
+
+func (s stageFS) name(name string) string {
+	if name == s.prefix {
+		return "."
+	}
+	if !strings.HasPrefix(name, s.prefix+"/") {
+		// parent directories of the archive are treated as the root
+		return "."
+	}
+	return strings.TrimPrefix(name, s.prefix+"/")
+}
+
+func (s stageFS) Create(name string) (rwfs.WFile, error) {
+	return s.fs.Create(s.name(name))
+}
+
+func (s stageFS) Mkdir(name string, perm fs.FileMode) error {
+	return s.fs.Mkdir(s.name(name), perm)
+}
+
+func (s stageFS) Open(name string) (fs.File, error) {
+	return s.fs.Open(s.name(name))
+}
+
+func (s stageFS) OpenFile(name string, flags int, perm fs.FileMode) (rwfs.RWFile, error) {
+	return s.fs.OpenFile(s.name(name), flags, perm)
+}
+
+func (s stageFS) Remove(name string) error {
+	return s.fs.Remove(s.name(name))
+}
+
+func (s stageFS) Rename(oldName, newName string) error {
+	return s.fs.Rename(s.name(oldName), s.name(newName))
+}
@@ -0,0 +1,45 @@
+package ocitar
+
+import (
+	"context"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// ManifestDelete removes a manifest, including all tags that point to that manifest
+func (o *OCITar) ManifestDelete(ctx context.Context, r ref.Ref) error {
+	od, err := o.layout(r, true)
+	if err != nil {
+		return err
+	}
+	return od.ManifestDelete(ctx, r)
+}
+
+// ManifestGet retrieves a manifest from a repository
+func (o *OCITar) ManifestGet(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	od, err := o.layout(r, false)
+	if err != nil {
+		return nil, err
+	}
+	return od.ManifestGet(ctx, r)
+}
+
+// ManifestHead gets metadata about the manifest (existence, digest, mediatype, size)
+func (o *OCITar) ManifestHead(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	od, err := o.layout(r, false)
+	if err != nil {
+		return nil, err
+	}
+	return od.ManifestHead(ctx, r)
+}
+
+// ManifestPut sends a manifest to the repository
+func (o *OCITar) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest, opts ...scheme.ManifestOpts) error {
+	od, err := o.layout(r, true)
+	if err != nil {
+		return err
+	}
+	return od.ManifestPut(ctx, r, m, opts...)
+}
@@ -0,0 +1,182 @@
+// Package ocitar implements the OCI Image Layout scheme with a tar archive
+// The archive is extracted into a temporary directory when first accessed, and written back when the reference is closed
+package ocitar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/scheme/ocidir"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// OCITar is used for accessing OCI Image Layouts packed in a tar file
+type OCITar struct {
+	fs   rwfs.RWFS
+	log  *logrus.Logger
+	mu   sync.Mutex
+	tars map[string]*tarLayout
+}
+
+// tarLayout is an archive extracted into an ocidir in a temporary directory
+type tarLayout struct {
+	tmp string
+	fs  rwfs.RWFS
+	dir *ocidir.OCIDir
+	mod bool
+}
+
+type config struct {
+	fs  rwfs.RWFS
+	log *logrus.Logger
+}
+
+// Opts are used for passing options to ocitar
+type Opts func(*config)
+
+// New creates a new OCITar with options
+func New(opts ...Opts) *OCITar {
+	conf := config{
+		fs:  rwfs.OSNew(""),
+		log: &logrus.Logger{Out: ioutil.Discard},
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	return &OCITar{
+		fs:   conf.fs,
+		log:  conf.log,
+		tars: map[string]*tarLayout{},
+	}
+}
+
+// WithFS allows the rwfs to be replaced
+// The default is to use the OS, this can be used to sandbox within a folder
+// This can also be used to pass an in-memory filesystem for testing or special use cases
+func WithFS(fs rwfs.RWFS) Opts {
+	return func(c *config) {
+		c.fs = fs
+	}
+}
+
+// WithLog provides a logrus logger
+// By default logging is disabled
+func WithLog(log *logrus.Logger) Opts {
+	return func(c *config) {
+		c.log = log
+	}
+}
+
+// Info is experimental, do not use
+func (o *OCITar) Info() scheme.Info {
+	return scheme.Info{ManifestPushFirst: true}
+}
+
+// layout returns the extracted archive for a reference, loading it on first access
+// Setting mod indicates the archive will be modified and must be written when closed
+func (o *OCITar) layout(r ref.Ref, mod bool) (*ocidir.OCIDir, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := path.Clean(r.Path)
+	tl, ok := o.tars[key]
+	if !ok {
+		tmp, err := os.MkdirTemp("", "regclient-ocitar-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp dir for %s: %w", key, err)
+		}
+		tmpFS := rwfs.OSNew(tmp)
+		err = o.extract(key, tmpFS)
+		if err != nil {
+			os.RemoveAll(tmp)
+			return nil, err
+		}
+		tl = &tarLayout{
+			tmp: tmp,
+			fs:  tmpFS,
+			dir: ocidir.New(
+				ocidir.WithFS(stageFS{fs: tmpFS, prefix: key}),
+				ocidir.WithLog(o.log),
+			),
+		}
+		o.tars[key] = tl
+	}
+	if mod {
+		tl.mod = true
+	}
+	return tl.dir, nil
+}
+
+// extract unpacks the archive into the staging filesystem, a missing archive is left empty
+func (o *OCITar) extract(file string, stage rwfs.RWFS) error {
+	fh, err := o.fs.Open(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer fh.Close()
+	rdr, err := archive.Decompress(fh)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	tr := tar.NewReader(rdr)
+	for {
+		th, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		name := strings.TrimPrefix(path.Clean("/"+th.Name), "/")
+		if name == "" || !fs.ValidPath(name) {
+			continue
+		}
+		switch th.Typeflag {
+		case tar.TypeDir:
+			err = rwfs.MkdirAll(stage, name, 0777)
+		case tar.TypeReg:
+			err = rwfs.MkdirAll(stage, path.Dir(name), 0777)
+			if err == nil {
+				err = extractFile(stage, name, tr)
+			}
+		default:
+			o.log.WithFields(logrus.Fields{
+				"file": file,
+				"name": th.Name,
+			}).Debug("skipping unsupported tar entry")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s from %s: %w", th.Name, file, err)
+		}
+	}
+	o.log.WithFields(logrus.Fields{
+		"file": file,
+	}).Debug("extracted oci layout")
+	return nil
+}
+
+func extractFile(stage rwfs.RWFS, name string, rdr io.Reader) error {
+	fh, err := stage.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fh, rdr)
+	errC := fh.Close()
+	if err != nil {
+		return err
+	}
+	return errC
+}
@@ -0,0 +1,176 @@
+package ocitar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestOCITar(t *testing.T) {
+	ctx := context.Background()
+	fsMem := rwfs.MemNew()
+	for file, opts := range map[string][]archive.TarOpts{
+		"testrepo.tar": {},
+		"testrepo.tgz": {archive.TarCompressGzip},
+	} {
+		buf := &bytes.Buffer{}
+		err := archive.Tar(ctx, "../../testdata/testrepo", buf, opts...)
+		if err != nil {
+			t.Errorf("failed to create %s: %v", file, err)
+			return
+		}
+		err = rwfs.WriteFile(fsMem, file, buf.Bytes(), 0644)
+		if err != nil {
+			t.Errorf("failed to write %s: %v", file, err)
+			return
+		}
+	}
+	o := New(WithFS(fsMem))
+
+	for _, file := range []string{"testrepo.tar", "testrepo.tgz"} {
+		t.Run("Read "+file, func(t *testing.T) {
+			r, err := ref.New("ocitar://" + file + ":v1")
+			if err != nil {
+				t.Errorf("failed to parse ref: %v", err)
+				return
+			}
+			m, err := o.ManifestGet(ctx, r)
+			if err != nil {
+				t.Errorf("failed to get manifest: %v", err)
+				return
+			}
+			ml, err := m.GetManifestList()
+			if err != nil || len(ml) == 0 {
+				t.Errorf("failed to get manifest list: %v", err)
+				return
+			}
+			br, err := o.BlobGet(ctx, r, ml[0])
+			if err != nil {
+				t.Errorf("failed to get blob: %v", err)
+				return
+			}
+			br.Close()
+			tl, err := o.TagList(ctx, r)
+			if err != nil {
+				t.Errorf("failed to list tags: %v", err)
+				return
+			}
+			tags, err := tl.GetTags()
+			if err != nil {
+				t.Errorf("failed to get tags: %v", err)
+				return
+			}
+			for _, exTag := range []string{"v1", "v2", "v3"} {
+				found := false
+				for _, tag := range tags {
+					if tag == exTag {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("tag %s missing from %v", exTag, tags)
+				}
+			}
+			err = o.Close(ctx, r)
+			if err != nil {
+				t.Errorf("failed to close: %v", err)
+			}
+		})
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		r, err := ref.New("ocitar://missing.tar:v1")
+		if err != nil {
+			t.Errorf("failed to parse ref: %v", err)
+			return
+		}
+		_, err = o.ManifestHead(ctx, r)
+		if err == nil {
+			t.Errorf("head on missing archive did not fail")
+		}
+		err = o.Close(ctx, r)
+		if err != nil {
+			t.Errorf("failed to close: %v", err)
+		}
+		_, err = rwfs.Stat(fsMem, "missing.tar")
+		if err == nil {
+			t.Errorf("unmodified archive was created")
+		}
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		r, err := ref.New("ocitar://testrepo.tar:v2")
+		if err != nil {
+			t.Errorf("failed to parse ref: %v", err)
+			return
+		}
+		m, err := o.ManifestGet(ctx, r)
+		if err != nil {
+			t.Errorf("failed to get manifest: %v", err)
+			return
+		}
+		// copy the manifest to a new archive, and delete the tag from the source
+		rNew, err := ref.New("ocitar://out/new.tar:copy")
+		if err != nil {
+			t.Errorf("failed to parse ref: %v", err)
+			return
+		}
+		err = o.ManifestPut(ctx, rNew, m)
+		if err != nil {
+			t.Errorf("failed to put manifest: %v", err)
+			return
+		}
+		err = o.TagDelete(ctx, r)
+		if err != nil {
+			t.Errorf("failed to delete tag: %v", err)
+			return
+		}
+		tmpDirs := []string{}
+		for _, tl := range o.tars {
+			tmpDirs = append(tmpDirs, tl.tmp)
+		}
+		for _, rClose := range []ref.Ref{r, rNew} {
+			err = o.Close(ctx, rClose)
+			if err != nil {
+				t.Errorf("failed to close %s: %v", rClose.CommonName(), err)
+				return
+			}
+		}
+		// staged content and temp archives are removed
+		for _, tmp := range tmpDirs {
+			if _, err := os.Stat(tmp); err == nil {
+				t.Errorf("temp dir was not removed: %s", tmp)
+			}
+		}
+		des, err := fs.ReadDir(fsMem, "out")
+		if err != nil || len(des) != 1 || des[0].Name() != "new.tar" {
+			t.Errorf("unexpected files in out: %v, %v", des, err)
+		}
+		// verify the changes after reloading each archive
+		_, err = o.ManifestHead(ctx, r)
+		if err == nil || !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("deleted tag was found: %v", err)
+		}
+		mNew, err := o.ManifestHead(ctx, rNew)
+		if err != nil {
+			t.Errorf("failed to head new manifest: %v", err)
+			return
+		}
+		if mNew.GetDescriptor().Digest != m.GetDescriptor().Digest {
+			t.Errorf("digest mismatch, expected %s, received %s", m.GetDescriptor().Digest, mNew.GetDescriptor().Digest)
+		}
+		r.Tag = "v3"
+		_, err = o.ManifestHead(ctx, r)
+		if err != nil {
+			t.Errorf("failed to head remaining tag: %v", err)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package ocitar
+
+import (
+	"context"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
+)
+
+// ReferrerList returns a list of referrers to a given reference.
+// Like ocidir, the digest tag schema is always used.
+func (o *OCITar) ReferrerList(ctx context.Context, r ref.Ref, opts ...scheme.ReferrerOpts) (referrer.ReferrerList, error) {
+	od, err := o.layout(r, false)
+	if err != nil {
+		return referrer.ReferrerList{Subject: r}, err
+	}
+	return od.ReferrerList(ctx, r, opts...)
+}
@@ -0,0 +1,27 @@
+package ocitar
+
+import (
+	"context"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/tag"
+)
+
+// TagDelete removes a tag from the repository
+func (o *OCITar) TagDelete(ctx context.Context, r ref.Ref) error {
+	od, err := o.layout(r, true)
+	if err != nil {
+		return err
+	}
+	return od.TagDelete(ctx, r)
+}
+
+// TagList returns a list of tags from the repository
+func (o *OCITar) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts) (*tag.List, error) {
+	od, err := o.layout(r, false)
+	if err != nil {
+		return nil, err
+	}
+	return od.TagList(ctx, r, opts...)
+}
@@ -3,11 +3,14 @@ package reg
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	// crypto libraries included for go-digest
 	_ "crypto/sha256"
@@ -43,9 +46,41 @@ func (reg *Reg) BlobDelete(ctx context.Context, r ref.Ref, d types.Descriptor) e
 	return nil
 }
 
-// BlobGet retrieves a blob from the repository, returning a blob reader
+// BlobGet retrieves a blob from the repository, returning a blob reader.
+// Interrupted downloads are resumed with a range request, or restarted when ranges are not supported.
 func (reg *Reg) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
-	// build/send request
+	resp, err := reg.blobGetOffset(ctx, r, d, 0)
+	if err != nil {
+		return nil, err
+	}
+	size := d.Size
+	if size <= 0 && resp.HTTPResponse().ContentLength > 0 {
+		size = resp.HTTPResponse().ContentLength
+	}
+	b := blob.NewReader(
+		blob.WithRef(r),
+		blob.WithReader(&blobGetReader{
+			ctx:  ctx,
+			reg:  reg,
+			r:    r,
+			d:    d,
+			resp: resp,
+			size: size,
+		}),
+		blob.WithDesc(types.Descriptor{
+			Digest: d.Digest,
+		}),
+		blob.WithResp(resp.HTTPResponse()),
+	)
+	return b, nil
+}
+
+// blobGetOffset requests a blob starting from the offset, using a range request when the offset is non-zero
+func (reg *Reg) blobGetOffset(ctx context.Context, r ref.Ref, d types.Descriptor, offset int64) (reghttp.Resp, error) {
+	headers := http.Header{}
+	if offset > 0 {
+		headers.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 	req := &reghttp.Req{
 		Host: r.Registry,
 		APIs: map[string]reghttp.ReqAPI{
@@ -53,6 +88,7 @@ func (reg *Reg) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blo
 				Method:     "GET",
 				Repository: r.Repository,
 				Path:       "blobs/" + d.Digest.String(),
+				Headers:    headers,
 			},
 		},
 	}
@@ -60,19 +96,87 @@ func (reg *Reg) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blo
 	if err != nil {
 		return nil, fmt.Errorf("failed to get blob, digest %s, ref %s: %w", d.Digest.String(), r.CommonName(), err)
 	}
-	if resp.HTTPResponse().StatusCode != 200 {
+	expStatus := http.StatusOK
+	if offset > 0 {
+		expStatus = http.StatusPartialContent
+	}
+	if resp.HTTPResponse().StatusCode != expStatus {
+		resp.Close()
 		return nil, fmt.Errorf("failed to get blob, digest %s, ref %s: %w", d.Digest.String(), r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
 	}
+	if offset > 0 && !strings.HasPrefix(resp.HTTPResponse().Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+		resp.Close()
+		return nil, fmt.Errorf("failed to get blob, digest %s, ref %s: unexpected content range %s", d.Digest.String(), r.CommonName(), resp.HTTPResponse().Header.Get("Content-Range"))
+	}
+	return resp, nil
+}
 
-	b := blob.NewReader(
-		blob.WithRef(r),
-		blob.WithReader(resp),
-		blob.WithDesc(types.Descriptor{
-			Digest: d.Digest,
-		}),
-		blob.WithResp(resp.HTTPResponse()),
-	)
-	return b, nil
+// blobGetReader tracks the offset of a blob download to resume after a failure
+type blobGetReader struct {
+	ctx     context.Context
+	reg     *Reg
+	r       ref.Ref
+	d       types.Descriptor
+	resp    reghttp.Resp
+	offset  int64
+	size    int64
+	resumes int
+}
+
+func (br *blobGetReader) Read(p []byte) (int, error) {
+	n, err := br.resp.Read(p)
+	br.offset += int64(n)
+	if err == nil || (err == io.EOF && (br.size <= 0 || br.offset >= br.size)) {
+		return n, err
+	}
+	// digest mismatches and canceled requests are not retried
+	if errors.Is(err, types.ErrDigestMismatch) || br.ctx.Err() != nil || br.resumes >= br.reg.retryLimit {
+		return n, err
+	}
+	br.resumes++
+	br.reg.log.WithFields(logrus.Fields{
+		"digest": br.d.Digest.String(),
+		"offset": br.offset,
+		"err":    err,
+	}).Info("Blob download interrupted, resuming")
+	if errR := br.resume(); errR != nil {
+		br.reg.log.WithFields(logrus.Fields{
+			"digest": br.d.Digest.String(),
+			"err":    errR,
+		}).Warn("Failed to resume blob download")
+		return n, err
+	}
+	return n, nil
+}
+
+// resume requests the remainder of the blob, restarting the download when range requests are not supported
+func (br *blobGetReader) resume() error {
+	br.resp.Close()
+	resp, err := br.reg.blobGetOffset(br.ctx, br.r, br.d, br.offset)
+	if err == nil {
+		br.resp = resp
+		return nil
+	}
+	br.reg.log.WithFields(logrus.Fields{
+		"digest": br.d.Digest.String(),
+		"err":    err,
+	}).Debug("Range request failed, restarting blob download")
+	resp, err = br.reg.blobGetOffset(br.ctx, br.r, br.d, 0)
+	if err != nil {
+		return err
+	}
+	// skip the content that has already been returned
+	_, err = io.CopyN(ioutil.Discard, resp, br.offset)
+	if err != nil {
+		resp.Close()
+		return err
+	}
+	br.resp = resp
+	return nil
+}
+
+func (br *blobGetReader) Close() error {
+	return br.resp.Close()
 }
 
 // BlobHead is used to verify if a blob exists and is accessible
@@ -334,106 +438,172 @@ func (reg *Reg) blobPutUploadChunked(ctx context.Context, r ref.Ref, putURL *url
 	if bufSize <= 0 {
 		bufSize = reg.blobChunkSize
 	}
-	bufBytes := make([]byte, bufSize)
-	bufRdr := bytes.NewReader(bufBytes)
-	lenChange := false
+	recoverMax := host.BlobRecover
+	if recoverMax == 0 {
+		recoverMax = DefaultBlobRecover
+	}
+	bufBytes := make([]byte, 0, bufSize)
+	bufOffset := int64(0)
 
 	// setup buffer and digest pipe
 	digester := digest.Canonical.Digester()
 	digestRdr := io.TeeReader(rdr, digester.Hash())
 	finalChunk := false
 	chunkStart := int64(0)
-	bodyFunc := func() (io.ReadCloser, error) {
-		// reset to the start on every new read
-		_, err := bufRdr.Seek(0, io.SeekStart)
-		if err != nil {
-			return nil, err
-		}
-		return ioutil.NopCloser(bufRdr), nil
-	}
 	chunkURL := *putURL
+	recoverCount := 0
 
-	for !finalChunk {
-		lenChange = false
-		// reset length if previous read was short
-		if cap(bufBytes) != len(bufBytes) {
-			bufBytes = bufBytes[:cap(bufBytes)]
-			lenChange = true
+	// uploadRecover queries the upload session and repositions the upload to the accepted offset.
+	// errOrig is returned when recovery is not possible.
+	uploadRecover := func(errOrig error) error {
+		if recoverMax < 0 || recoverCount >= recoverMax {
+			return errOrig
 		}
-		// read a chunk into an input buffer, computing the digest
-		chunkSize, err := io.ReadFull(digestRdr, bufBytes)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			finalChunk = true
-		} else if err != nil {
-			return types.Descriptor{}, fmt.Errorf("failed to send blob chunk, ref %s: %w", r.CommonName(), err)
+		recoverCount++
+		accepted, err := reg.blobUploadStatus(ctx, r, &chunkURL)
+		if err != nil {
+			reg.log.WithFields(logrus.Fields{
+				"ref": r.CommonName(),
+				"err": err,
+			}).Warn("Failed to query upload status")
+			return errOrig
 		}
-		// update length on partial read
-		if chunkSize != len(bufBytes) {
-			bufBytes = bufBytes[:chunkSize]
-			lenChange = true
+		reg.log.WithFields(logrus.Fields{
+			"ref":      r.CommonName(),
+			"accepted": accepted,
+			"sent":     chunkStart + bufOffset,
+			"err":      errOrig,
+		}).Info("Recovering interrupted chunked upload")
+		if accepted >= chunkStart && accepted <= chunkStart+int64(len(bufBytes)) {
+			// the remaining content is still in the buffer
+			bufOffset = accepted - chunkStart
+			return nil
 		}
-		if lenChange {
-			// need to recreate the reader on a change to the slice length,
-			// old reader is looking at the old slice metadata
-			bufRdr = bytes.NewReader(bufBytes)
+		if accepted > chunkStart {
+			return errOrig
 		}
-
-		if chunkSize > 0 {
-			// write chunk
-			header := http.Header{
-				"Content-Type":  {"application/octet-stream"},
-				"Content-Range": {fmt.Sprintf("%d-%d", chunkStart, chunkStart+int64(chunkSize))},
-			}
-			req := &reghttp.Req{
-				Host: r.Registry,
-				APIs: map[string]reghttp.ReqAPI{
-					"": {
-						Method:     "PATCH",
-						Repository: r.Repository,
-						DirectURL:  &chunkURL,
-						BodyFunc:   bodyFunc,
-						BodyLen:    int64(chunkSize),
-						Headers:    header,
-					},
-				},
-				NoMirrors: true,
+		// restart from an earlier offset by seeking the source reader
+		rdrSeek, ok := rdr.(io.Seeker)
+		if !ok {
+			return errOrig
+		}
+		_, err = rdrSeek.Seek(0, io.SeekStart)
+		if err != nil {
+			return errOrig
+		}
+		digester = digest.Canonical.Digester()
+		digestRdr = io.TeeReader(rdr, digester.Hash())
+		_, err = io.CopyN(ioutil.Discard, digestRdr, accepted)
+		if err != nil {
+			return errOrig
+		}
+		chunkStart = accepted
+		bufBytes = bufBytes[:0]
+		bufOffset = 0
+		finalChunk = false
+		return nil
+	}
+
+	for {
+		for {
+			// send any content remaining in the buffer
+			if bufOffset < int64(len(bufBytes)) {
+				err := reg.blobUploadChunk(ctx, r, &chunkURL, bufBytes[bufOffset:], chunkStart+bufOffset)
+				if err != nil {
+					if errR := uploadRecover(err); errR != nil {
+						return types.Descriptor{}, errR
+					}
+					continue
+				}
 			}
-			resp, err := reg.reghttp.Do(ctx, req)
-			if err != nil {
-				return types.Descriptor{}, fmt.Errorf("failed to send blob (chunk), ref %s: %w", r.CommonName(), err)
+			chunkStart += int64(len(bufBytes))
+			bufBytes = bufBytes[:0]
+			bufOffset = 0
+			if finalChunk {
+				break
 			}
-			resp.Close()
-
-			// distribution-spec is 202, AWS ECR returns a 201 and rejects the put
-			if resp.HTTPResponse().StatusCode == 201 {
-				reg.log.WithFields(logrus.Fields{
-					"ref":        r.CommonName(),
-					"chunkStart": chunkStart,
-					"chunkSize":  chunkSize,
-				}).Debug("Early accept of chunk in PATCH before PUT request")
-			} else if resp.HTTPResponse().StatusCode != 202 {
-				return types.Descriptor{}, fmt.Errorf("failed to send blob (chunk), ref %s: %w", r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+			// read a chunk into an input buffer, computing the digest
+			chunkSize, err := io.ReadFull(digestRdr, bufBytes[:cap(bufBytes)])
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				finalChunk = true
+			} else if err != nil {
+				return types.Descriptor{}, fmt.Errorf("failed to send blob chunk, ref %s: %w", r.CommonName(), err)
 			}
-			chunkStart += int64(chunkSize)
-			location := resp.HTTPResponse().Header.Get("Location")
-			if location != "" {
-				reg.log.WithFields(logrus.Fields{
-					"location": location,
-				}).Debug("Next chunk upload location received")
-				prevURL := resp.HTTPResponse().Request.URL
-				parseURL, err := prevURL.Parse(location)
-				if err != nil {
-					return types.Descriptor{}, fmt.Errorf("failed to send blob (parse next chunk location), ref %s: %w", r.CommonName(), err)
-				}
-				chunkURL = *parseURL
+			bufBytes = bufBytes[:chunkSize]
+		}
+
+		// compute digest
+		d := digester.Digest()
+
+		// send the final put
+		err := reg.blobUploadFinal(ctx, r, chunkURL, d, chunkStart)
+		if err != nil {
+			if errR := uploadRecover(err); errR != nil {
+				return types.Descriptor{}, errR
 			}
+			continue
 		}
+		return types.Descriptor{Digest: d, Size: chunkStart}, nil
+	}
+}
+
+// blobUploadChunk sends a PATCH with a single chunk, updating chunkURL with the next location
+func (reg *Reg) blobUploadChunk(ctx context.Context, r ref.Ref, chunkURL *url.URL, chunk []byte, chunkStart int64) error {
+	bodyFunc := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(chunk)), nil
+	}
+	header := http.Header{
+		"Content-Type":  {"application/octet-stream"},
+		"Content-Range": {fmt.Sprintf("%d-%d", chunkStart, chunkStart+int64(len(chunk)))},
+	}
+	reqURL := *chunkURL
+	req := &reghttp.Req{
+		Host: r.Registry,
+		APIs: map[string]reghttp.ReqAPI{
+			"": {
+				Method:     "PATCH",
+				Repository: r.Repository,
+				DirectURL:  &reqURL,
+				BodyFunc:   bodyFunc,
+				BodyLen:    int64(len(chunk)),
+				Headers:    header,
+			},
+		},
+		NoMirrors: true,
 	}
+	resp, err := reg.reghttp.Do(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to send blob (chunk), ref %s: %w", r.CommonName(), err)
+	}
+	resp.Close()
 
-	// compute digest
-	d := digester.Digest()
+	// distribution-spec is 202, AWS ECR returns a 201 and rejects the put
+	if resp.HTTPResponse().StatusCode == 201 {
+		reg.log.WithFields(logrus.Fields{
+			"ref":        r.CommonName(),
+			"chunkStart": chunkStart,
+			"chunkSize":  len(chunk),
+		}).Debug("Early accept of chunk in PATCH before PUT request")
+	} else if resp.HTTPResponse().StatusCode != 202 {
+		return fmt.Errorf("failed to send blob (chunk), ref %s: %w", r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+	}
+	location := resp.HTTPResponse().Header.Get("Location")
+	if location != "" {
+		reg.log.WithFields(logrus.Fields{
+			"location": location,
+		}).Debug("Next chunk upload location received")
+		prevURL := resp.HTTPResponse().Request.URL
+		parseURL, err := prevURL.Parse(location)
+		if err != nil {
+			return fmt.Errorf("failed to send blob (parse next chunk location), ref %s: %w", r.CommonName(), err)
+		}
+		*chunkURL = *parseURL
+	}
+	return nil
+}
 
-	// send the final put
+// blobUploadFinal sends the PUT with the digest to complete a chunked upload
+func (reg *Reg) blobUploadFinal(ctx context.Context, r ref.Ref, chunkURL url.URL, d digest.Digest, size int64) error {
 	// append digest to request to use the monolithic upload option
 	if chunkURL.RawQuery != "" {
 		chunkURL.RawQuery = chunkURL.RawQuery + "&digest=" + url.QueryEscape(d.String())
@@ -443,7 +613,7 @@ func (reg *Reg) blobPutUploadChunked(ctx context.Context, r ref.Ref, putURL *url
 
 	header := http.Header{
 		"Content-Type":  {"application/octet-stream"},
-		"Content-Range": {fmt.Sprintf("%d-%d", chunkStart, chunkStart)},
+		"Content-Range": {fmt.Sprintf("%d-%d", size, size)},
 	}
 	req := &reghttp.Req{
 		Host: r.Registry,
@@ -460,15 +630,14 @@ func (reg *Reg) blobPutUploadChunked(ctx context.Context, r ref.Ref, putURL *url
 	}
 	resp, err := reg.reghttp.Do(ctx, req)
 	if err != nil {
-		return types.Descriptor{}, fmt.Errorf("failed to send blob (chunk digest), digest %s, ref %s: %w", d, r.CommonName(), err)
+		return fmt.Errorf("failed to send blob (chunk digest), digest %s, ref %s: %w", d, r.CommonName(), err)
 	}
 	defer resp.Close()
 	// 201 follows distribution-spec, 204 is listed as possible in the Docker registry spec
 	if resp.HTTPResponse().StatusCode != 201 && resp.HTTPResponse().StatusCode != 204 {
-		return types.Descriptor{}, fmt.Errorf("failed to send blob (chunk digest), digest %s, ref %s: %w", d, r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+		return fmt.Errorf("failed to send blob (chunk digest), digest %s, ref %s: %w", d, r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
 	}
-
-	return types.Descriptor{Digest: d, Size: chunkStart}, nil
+	return nil
 }
 
 // TODO: just take a putURL rather than the uuid and call a delete on that url
@@ -498,41 +667,60 @@ func (reg *Reg) blobUploadCancel(ctx context.Context, r ref.Ref, uuid string) er
 	return nil
 }
 
-// // blobUploadStatus provides a response with headers indicating the progress of an upload
-// func (reg *Reg) blobUploadStatus(ctx context.Context, r ref.Ref, putURL *url.URL) (*http.Response, error) {
-// 	req := &reghttp.Req{
-// 		Host: r.Registry,
-// 		APIs: map[string]reghttp.ReqAPI{
-// 			"": {
-// 				Method:     "GET",
-// 				Repository: r.Repository,
-// 				DirectURL:  putURL,
-// 			},
-// 		},
-// 		NoMirrors: true,
-// 	}
-// 	resp, err := reg.reghttp.Do(ctx, req)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("failed to get upload status: %v", err)
-// 	}
-// 	defer resp.Close()
-// 	if resp.HTTPResponse().StatusCode != 204 {
-// 		return resp.HTTPResponse(), fmt.Errorf("failed to get upload status: %v", reghttp.HttpError(resp.HTTPResponse().StatusCode))
-// 	}
-// 	return resp.HTTPResponse(), nil
-// }
-
-// func blobUploadCurBytes(resp *http.Response) (int64, error) {
-// 	if resp == nil {
-// 		return 0, fmt.Errorf("Missing response")
-// 	}
-// 	r := resp.Header.Get("Range")
-// 	if r == "" {
-// 		return 0, fmt.Errorf("Missing range header")
-// 	}
-// 	rSplit := strings.SplitN(r, "-", 2)
-// 	if len(rSplit) < 2 {
-// 		return 0, fmt.Errorf("Missing offset in range header")
-// 	}
-// 	return strconv.ParseInt(rSplit[2], 10, 64)
-// }
+// blobUploadStatus queries an upload session, returning the number of bytes accepted by the registry.
+// The upload location is updated when the registry returns a new location.
+func (reg *Reg) blobUploadStatus(ctx context.Context, r ref.Ref, putURL *url.URL) (int64, error) {
+	reqURL := *putURL
+	req := &reghttp.Req{
+		Host: r.Registry,
+		APIs: map[string]reghttp.ReqAPI{
+			"": {
+				Method:     "GET",
+				Repository: r.Repository,
+				DirectURL:  &reqURL,
+			},
+		},
+		NoMirrors: true,
+	}
+	resp, err := reg.reghttp.Do(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get upload status, ref %s: %w", r.CommonName(), err)
+	}
+	defer resp.Close()
+	if resp.HTTPResponse().StatusCode != 204 && resp.HTTPResponse().StatusCode != 202 {
+		return 0, fmt.Errorf("failed to get upload status, ref %s: %w", r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+	}
+	location := resp.HTTPResponse().Header.Get("Location")
+	if location != "" {
+		parseURL, err := resp.HTTPResponse().Request.URL.Parse(location)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse upload location %s, ref %s: %w", location, r.CommonName(), err)
+		}
+		*putURL = *parseURL
+	}
+	return blobUploadCurBytes(resp.HTTPResponse())
+}
+
+// blobUploadCurBytes parses the Range header of an upload status response.
+// The range end is inclusive, a range of "0-0" is treated as no content received.
+func blobUploadCurBytes(resp *http.Response) (int64, error) {
+	if resp == nil {
+		return 0, fmt.Errorf("missing response")
+	}
+	rh := strings.TrimPrefix(resp.Header.Get("Range"), "bytes=")
+	if rh == "" {
+		return 0, nil
+	}
+	rSplit := strings.SplitN(rh, "-", 2)
+	if len(rSplit) < 2 {
+		return 0, fmt.Errorf("missing offset in range header %s", rh)
+	}
+	end, err := strconv.ParseInt(rSplit[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse range header %s: %w", rh, err)
+	}
+	if end <= 0 {
+		return 0, nil
+	}
+	return end + 1, nil
+}
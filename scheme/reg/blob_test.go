@@ -33,6 +33,8 @@ func TestBlobGet(t *testing.T) {
 	blobLen := 1024 // must be greater than 512 for retry test
 	d1, blob1 := reqresp.NewRandomBlob(blobLen, seed)
 	d2, blob2 := reqresp.NewRandomBlob(blobLen, seed+1)
+	d3, blob3 := reqresp.NewRandomBlob(blobLen, seed+2)
+	d4, blob4 := reqresp.NewRandomBlob(blobLen, seed+3)
 	dMissing := digest.FromBytes([]byte("missing"))
 	// define req/resp entries
 	rrs := []reqresp.ReqResp{
@@ -137,6 +139,78 @@ func TestBlobGet(t *testing.T) {
 				},
 			},
 		},
+		// get range for d3 with an open ended range
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET for d3, range for second part",
+				Method: "GET",
+				Path:   "/v2" + blobRepo + "/blobs/" + d3.String(),
+				Headers: http.Header{
+					"Range": {"bytes=512-"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusPartialContent,
+				Body:   blob3[512:],
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", blobLen-512)},
+					"Content-Range":         {fmt.Sprintf("bytes %d-%d/%d", 512, blobLen-1, blobLen)},
+					"Content-Type":          {"application/octet-stream"},
+					"Docker-Content-Digest": {d3.String()},
+				},
+			},
+		},
+		// get that stops early for d3
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET for d3, short read",
+				Method: "GET",
+				Path:   "/v2" + blobRepo + "/blobs/" + d3.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Body:   blob3[0:512],
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", blobLen)},
+					"Content-Type":          {"application/octet-stream"},
+					"Docker-Content-Digest": {d3.String()},
+				},
+			},
+		},
+		// get that stops early for d4 once, followed by a server that ignores ranges
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "GET for d4, short read",
+				DelOnUse: true,
+				Method:   "GET",
+				Path:     "/v2" + blobRepo + "/blobs/" + d4.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Body:   blob4[0:512],
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", blobLen)},
+					"Content-Type":          {"application/octet-stream"},
+					"Docker-Content-Digest": {d4.String()},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET for d4, ignore range",
+				Method: "GET",
+				Path:   "/v2" + blobRepo + "/blobs/" + d4.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Body:   blob4,
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", blobLen)},
+					"Content-Type":          {"application/octet-stream"},
+					"Docker-Content-Digest": {d4.String()},
+				},
+			},
+		},
 		// forbidden
 		{
 			ReqEntry: reqresp.ReqEntry{
@@ -252,6 +326,48 @@ func TestBlobGet(t *testing.T) {
 		}
 	})
 
+	t.Run("Resume", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + blobRepo)
+		if err != nil {
+			t.Errorf("Failed creating ref: %v", err)
+		}
+		br, err := reg.BlobGet(ctx, r, types.Descriptor{Digest: d3})
+		if err != nil {
+			t.Errorf("Failed running BlobGet: %v", err)
+			return
+		}
+		defer br.Close()
+		brBlob, err := ioutil.ReadAll(br)
+		if err != nil {
+			t.Errorf("Failed reading blob: %v", err)
+			return
+		}
+		if !bytes.Equal(blob3, brBlob) {
+			t.Errorf("Blob does not match")
+		}
+	})
+
+	t.Run("Restart", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + blobRepo)
+		if err != nil {
+			t.Errorf("Failed creating ref: %v", err)
+		}
+		br, err := reg.BlobGet(ctx, r, types.Descriptor{Digest: d4})
+		if err != nil {
+			t.Errorf("Failed running BlobGet: %v", err)
+			return
+		}
+		defer br.Close()
+		brBlob, err := ioutil.ReadAll(br)
+		if err != nil {
+			t.Errorf("Failed reading blob: %v", err)
+			return
+		}
+		if !bytes.Equal(blob4, brBlob) {
+			t.Errorf("Blob does not match")
+		}
+	})
+
 	t.Run("Forbidden", func(t *testing.T) {
 		r, err := ref.New(tsURL.Host + privateRepo)
 		if err != nil {
@@ -286,6 +402,10 @@ func TestBlobPut(t *testing.T) {
 	uuid2 := uuid.New()
 	d3, blob3 := reqresp.NewRandomBlob(blobLen3, seed+2)
 	uuid3 := uuid.New()
+	d4, blob4 := reqresp.NewRandomBlob(blobLen, seed+3)
+	uuid4 := uuid.New()
+	d5, blob5 := reqresp.NewRandomBlob(blobLen, seed+4)
+	uuid5 := uuid.New()
 	// dMissing := digest.FromBytes([]byte("missing"))
 	user := "testing"
 	pass := "password"
@@ -669,6 +789,267 @@ func TestBlobPut(t *testing.T) {
 				},
 			},
 		},
+
+		// get upload4 location
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "POST for d4",
+				Method: "POST",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/",
+				Query: map[string][]string{
+					"mount": {d4.String()},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid4.String()},
+				},
+			},
+		},
+		// upload put for d4
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PUT for patched d4",
+				Method: "PUT",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid4.String(),
+				Query: map[string][]string{
+					"digest": {d4.String()},
+					"chunk":  {"3"},
+				},
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Content-Range":  {fmt.Sprintf("%d-%d", blobLen, blobLen)},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+				Headers: http.Header{
+					"Content-Length":        {"0"},
+					"Location":              {"/v2" + blobRepo + "/blobs/" + d4.String()},
+					"Docker-Content-Digest": {d4.String()},
+				},
+			},
+		},
+		// upload patch 2 fails once for d4
+		{
+			ReqEntry: reqresp.ReqEntry{
+				DelOnUse: true,
+				Name:     "PATCH 2 fail for d4",
+				Method:   "PATCH",
+				Path:     "/v2" + blobRepo + "/blobs/uploads/" + uuid4.String(),
+				Query: map[string][]string{
+					"chunk": {"2"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusBadGateway,
+			},
+		},
+		// upload status for d4
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET status for d4",
+				Method: "GET",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid4.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNoContent,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Range":          {fmt.Sprintf("0-%d", blobChunk-1)},
+					"Location":       {uuid4.String() + "?chunk=2"},
+				},
+			},
+		},
+		// upload patch 2 for d4
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PATCH 2 for d4",
+				Method: "PATCH",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid4.String(),
+				Query: map[string][]string{
+					"chunk": {"2"},
+				},
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", blobLen-blobChunk)},
+					"Content-Range":  {fmt.Sprintf("%d-%d", blobChunk, blobLen)},
+				},
+				Body: blob4[blobChunk:],
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid4.String() + "?chunk=3"},
+				},
+			},
+		},
+		// upload patch 1 for d4
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PATCH 1 for d4",
+				Method: "PATCH",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid4.String(),
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", blobChunk)},
+					"Content-Range":  {fmt.Sprintf("0-%d", blobChunk)},
+				},
+				Body: blob4[0:blobChunk],
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid4.String() + "?chunk=2"},
+				},
+			},
+		},
+		// upload blob d4 without chunks fails
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PUT for d4",
+				Method: "PUT",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid4.String(),
+				Query: map[string][]string{
+					"digest": {d4.String()},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusBadGateway,
+			},
+		},
+		// get upload5 location
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "POST for d5",
+				Method: "POST",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/",
+				Query: map[string][]string{
+					"mount": {d5.String()},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid5.String()},
+				},
+			},
+		},
+		// upload put for d5
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PUT for patched d5",
+				Method: "PUT",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid5.String(),
+				Query: map[string][]string{
+					"digest": {d5.String()},
+					"chunk":  {"3"},
+				},
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Content-Range":  {fmt.Sprintf("%d-%d", blobLen, blobLen)},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+				Headers: http.Header{
+					"Content-Length":        {"0"},
+					"Location":              {"/v2" + blobRepo + "/blobs/" + d5.String()},
+					"Docker-Content-Digest": {d5.String()},
+				},
+			},
+		},
+		// upload patch 2 fails once for d5
+		{
+			ReqEntry: reqresp.ReqEntry{
+				DelOnUse: true,
+				Name:     "PATCH 2 fail for d5",
+				Method:   "PATCH",
+				Path:     "/v2" + blobRepo + "/blobs/uploads/" + uuid5.String(),
+				Query: map[string][]string{
+					"chunk": {"2"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusBadGateway,
+			},
+		},
+		// upload status for d5
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET status for d5",
+				Method: "GET",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid5.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNoContent,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Range":          {"0-0"},
+					"Location":       {uuid5.String() + "?chunk=2"},
+				},
+			},
+		},
+		// upload patch 2 for d5
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PATCH 2 for d5",
+				Method: "PATCH",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid5.String(),
+				Query: map[string][]string{
+					"chunk": {"2"},
+				},
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", blobLen-blobChunk)},
+					"Content-Range":  {fmt.Sprintf("%d-%d", blobChunk, blobLen)},
+				},
+				Body: blob5[blobChunk:],
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid5.String() + "?chunk=3"},
+				},
+			},
+		},
+		// upload patch 1 for d5
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PATCH 1 for d5",
+				Method: "PATCH",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid5.String(),
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", blobChunk)},
+					"Content-Range":  {fmt.Sprintf("0-%d", blobChunk)},
+				},
+				Body: blob5[0:blobChunk],
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid5.String() + "?chunk=2"},
+				},
+			},
+		},
+		// upload blob d5 without chunks fails
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PUT for d5",
+				Method: "PUT",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid5.String(),
+				Query: map[string][]string{
+					"digest": {d5.String()},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusBadGateway,
+			},
+		},
 	}
 	rrs = append(rrs, reqresp.BaseEntries...)
 	// create a server
@@ -770,4 +1151,44 @@ func TestBlobPut(t *testing.T) {
 
 	})
 
+	// the registry accepted the first chunk before the second chunk failed
+	t.Run("Recover", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + blobRepo)
+		if err != nil {
+			t.Errorf("Failed creating ref: %v", err)
+		}
+		br := bytes.NewReader(blob4)
+		dp, err := reg.BlobPut(ctx, r, types.Descriptor{Digest: d4, Size: int64(len(blob4))}, br)
+		if err != nil {
+			t.Errorf("Failed running BlobPut: %v", err)
+			return
+		}
+		if dp.Digest.String() != d4.String() {
+			t.Errorf("Digest mismatch, expected %s, received %s", d4.String(), dp.Digest.String())
+		}
+		if dp.Size != int64(len(blob4)) {
+			t.Errorf("Content length mismatch, expected %d, received %d", len(blob4), dp.Size)
+		}
+	})
+
+	// the registry lost the upload content, the reader is rewound to the start
+	t.Run("RecoverSeek", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + blobRepo)
+		if err != nil {
+			t.Errorf("Failed creating ref: %v", err)
+		}
+		br := bytes.NewReader(blob5)
+		dp, err := reg.BlobPut(ctx, r, types.Descriptor{Digest: d5, Size: int64(len(blob5))}, br)
+		if err != nil {
+			t.Errorf("Failed running BlobPut: %v", err)
+			return
+		}
+		if dp.Digest.String() != d5.String() {
+			t.Errorf("Digest mismatch, expected %s, received %s", d5.String(), dp.Digest.String())
+		}
+		if dp.Size != int64(len(blob5)) {
+			t.Errorf("Content length mismatch, expected %d, received %d", len(blob5), dp.Size)
+		}
+	})
+
 }
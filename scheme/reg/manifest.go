@@ -201,5 +201,13 @@ func (reg *Reg) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest,
 		return fmt.Errorf("failed to put manifest %s: %w", r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
 	}
 
+	// registries supporting the referrers API return the OCI-Subject header, otherwise update the digest tag
+	if resp.HTTPResponse().Header.Get("OCI-Subject") == "" {
+		err = reg.referrerPut(ctx, r, m)
+		if err != nil {
+			return fmt.Errorf("failed to update referrers for %s: %w", r.CommonName(), err)
+		}
+	}
+
 	return nil
 }
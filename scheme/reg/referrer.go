@@ -0,0 +1,250 @@
+package reg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/regclient/regclient/internal/reghttp"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
+	"github.com/sirupsen/logrus"
+)
+
+// ReferrerList returns a list of referrers to a given reference.
+// The referrers API is queried first, falling back to the digest tag schema when unavailable.
+func (reg *Reg) ReferrerList(ctx context.Context, r ref.Ref, opts ...scheme.ReferrerOpts) (referrer.ReferrerList, error) {
+	config := scheme.ReferrerConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	// resolve the tag to a digest
+	if r.Digest == "" {
+		m, err := reg.ManifestHead(ctx, r)
+		if err != nil {
+			return referrer.ReferrerList{Subject: r}, err
+		}
+		if m.GetDescriptor().Digest == "" {
+			m, err = reg.ManifestGet(ctx, r)
+			if err != nil {
+				return referrer.ReferrerList{Subject: r}, err
+			}
+		}
+		r.Digest = m.GetDescriptor().Digest.String()
+	}
+
+	rl, filtered, err := reg.referrerListAPI(ctx, r, config)
+	if err != nil && errors.Is(err, types.ErrNotFound) {
+		reg.log.WithFields(logrus.Fields{
+			"ref": r.CommonName(),
+		}).Debug("Referrers API unavailable, using fallback tag")
+		rl, err = reg.referrerListTag(ctx, r)
+		filtered = false
+	}
+	if err != nil {
+		return rl, err
+	}
+	if !filtered {
+		rl = rl.FilterArtifactType(config.FilterArtifactType)
+	}
+	return rl, nil
+}
+
+// referrerListAPI queries the referrers API, the returned bool indicates if the registry applied the filter.
+// Pages returned with a Link header are followed and merged into a single list.
+func (reg *Reg) referrerListAPI(ctx context.Context, r ref.Ref, config scheme.ReferrerConfig) (referrer.ReferrerList, bool, error) {
+	rl := referrer.ReferrerList{Subject: r}
+	query := url.Values{}
+	if config.FilterArtifactType != "" {
+		query.Set("artifactType", config.FilterArtifactType)
+	}
+	headers := http.Header{
+		"Accept": []string{types.MediaTypeOCI1ManifestList},
+	}
+	var index v1.Index
+	var nextURL *url.URL
+	filtered := config.FilterArtifactType != ""
+	seen := map[string]bool{}
+	for {
+		api := reghttp.ReqAPI{
+			Method:     "GET",
+			Repository: r.Repository,
+			Path:       "referrers/" + r.Digest,
+			Query:      query,
+			Headers:    headers,
+		}
+		if nextURL != nil {
+			api.DirectURL = nextURL
+		}
+		req := &reghttp.Req{
+			Host: r.Registry,
+			APIs: map[string]reghttp.ReqAPI{
+				"": api,
+			},
+		}
+		resp, err := reg.reghttp.Do(ctx, req)
+		if err != nil {
+			return rl, false, fmt.Errorf("failed to get referrers %s: %w", r.CommonName(), err)
+		}
+		if resp.HTTPResponse().StatusCode != 200 {
+			resp.Close()
+			return rl, false, fmt.Errorf("failed to get referrers %s: %w", r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+		}
+		rawBody, err := io.ReadAll(resp)
+		resp.Close()
+		if err != nil {
+			return rl, false, fmt.Errorf("error reading referrers for %s: %w", r.CommonName(), err)
+		}
+		m, err := manifest.New(
+			manifest.WithRef(r),
+			manifest.WithDesc(types.Descriptor{MediaType: types.MediaTypeOCI1ManifestList}),
+			manifest.WithRaw(rawBody),
+		)
+		if err != nil {
+			return rl, false, err
+		}
+		page, err := referrer.FromManifest(r, m)
+		if err != nil {
+			return rl, false, err
+		}
+		if resp.HTTPResponse().Header.Get("OCI-Filters-Applied") != "artifactType" {
+			filtered = false
+		}
+		if rl.Manifest == nil {
+			rl = page
+			index, _ = m.GetOrig().(v1.Index)
+		} else {
+			rl.Descriptors = append(rl.Descriptors, page.Descriptors...)
+		}
+		nextURL, err = referrerLinkNext(resp.HTTPResponse())
+		if err != nil {
+			return rl, false, fmt.Errorf("failed to parse referrers link for %s: %w", r.CommonName(), err)
+		}
+		if nextURL == nil {
+			break
+		}
+		if seen[nextURL.String()] {
+			return rl, false, fmt.Errorf("referrers link for %s repeats %s: %w", r.CommonName(), nextURL.String(), types.ErrParsingFailed)
+		}
+		seen[nextURL.String()] = true
+	}
+	// merged pages are returned in a single index
+	if len(seen) > 0 {
+		index.Manifests = rl.Descriptors
+		err := rl.Manifest.SetOrig(index)
+		if err != nil {
+			return rl, false, err
+		}
+	}
+	return rl, filtered, nil
+}
+
+// referrerLinkNext returns the url from a Link header with rel="next", or nil when there are no more pages
+func referrerLinkNext(resp *http.Response) (*url.URL, error) {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if len(target) < 2 || target[0] != '<' || target[len(target)-1] != '>' {
+				continue
+			}
+			for _, param := range parts[1:] {
+				param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+				if param == `rel="next"` || param == "rel=next" {
+					return resp.Request.URL.Parse(target[1 : len(target)-1])
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// referrerListTag retrieves referrers from the digest tag, an empty list is returned if the tag does not exist
+func (reg *Reg) referrerListTag(ctx context.Context, r ref.Ref) (referrer.ReferrerList, error) {
+	rl := referrer.ReferrerList{
+		Subject: r,
+		Tags:    []string{},
+	}
+	rlTag, err := referrer.FallbackTag(r)
+	if err != nil {
+		return rl, err
+	}
+	m, err := reg.ManifestGet(ctx, rlTag)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			// empty list
+			return rl, nil
+		}
+		return rl, err
+	}
+	rl, err = referrer.FromManifest(r, m)
+	if err != nil {
+		return rl, err
+	}
+	rl.Tags = append(rl.Tags, rlTag.Tag)
+	return rl, nil
+}
+
+// referrerPutRetries limits the attempts to update the digest tag when other writers modify the tag
+const referrerPutRetries = 3
+
+// referrerPut adds a manifest to the digest tag of its subject, used when the registry does not support the referrers API.
+// The digest tag is updated with a read-modify-write, and the registry offers no way to make that update atomic.
+// After each put the tag is read again, and the update is retried when a concurrent writer replaced the tag without this manifest.
+// A writer that replaces the tag after that verification can still drop the entry.
+func (reg *Reg) referrerPut(ctx context.Context, r ref.Ref, m manifest.Manifest) error {
+	ms, ok := m.(manifest.Subjecter)
+	if !ok {
+		return nil
+	}
+	subject, err := ms.GetSubject()
+	if err != nil || subject == nil {
+		return err
+	}
+	rSubject := r
+	rSubject.Tag = ""
+	rSubject.Digest = subject.Digest.String()
+	rlTag, err := referrer.FallbackTag(rSubject)
+	if err != nil {
+		return err
+	}
+	dig := m.GetDescriptor().Digest
+	for i := 0; i < referrerPutRetries; i++ {
+		rl, err := reg.referrerListTag(ctx, rSubject)
+		if err != nil {
+			return err
+		}
+		err = rl.Add(m)
+		if err != nil {
+			return err
+		}
+		err = reg.ManifestPut(ctx, rlTag, rl.Manifest)
+		if err != nil {
+			return err
+		}
+		// verify a concurrent update did not replace the tag without this manifest
+		rl, err = reg.referrerListTag(ctx, rSubject)
+		if err != nil {
+			return err
+		}
+		for _, d := range rl.Descriptors {
+			if d.Digest == dig {
+				return nil
+			}
+		}
+		reg.log.WithFields(logrus.Fields{
+			"tag":     rlTag.CommonName(),
+			"digest":  dig.String(),
+			"attempt": i + 1,
+		}).Warn("Digest tag was modified by another writer, retrying referrer update")
+	}
+	return fmt.Errorf("failed to add %s to the digest tag %s after %d attempts: %w", dig.String(), rlTag.CommonName(), referrerPutRetries, types.ErrRetryNeeded)
+}
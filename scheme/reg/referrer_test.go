@@ -0,0 +1,505 @@
+package reg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/reqresp"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReferrer(t *testing.T) {
+	ctx := context.Background()
+	repoPath := "/proj"
+	pagedPath := "/paged"
+	racePath := "/race"
+	fallbackPath := "/fallback"
+	atSBOM := "application/example.sbom"
+	atSig := "application/example.signature"
+	subjectDigest := digest.FromString("subject manifest")
+	subjectTag := fmt.Sprintf("%s-%s", subjectDigest.Algorithm().String(), subjectDigest.Encoded())
+	newSubjectDigest := digest.FromString("new subject manifest")
+	newSubjectTag := fmt.Sprintf("%s-%s", newSubjectDigest.Algorithm().String(), newSubjectDigest.Encoded())
+	descSBOM := types.Descriptor{
+		MediaType:    types.MediaTypeOCI1Manifest,
+		Digest:       digest.FromString("sbom manifest"),
+		Size:         1234,
+		ArtifactType: atSBOM,
+	}
+	descSig := types.Descriptor{
+		MediaType:    types.MediaTypeOCI1Manifest,
+		Digest:       digest.FromString("signature manifest"),
+		Size:         1234,
+		ArtifactType: atSig,
+	}
+	referrerBody, err := json.Marshal(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{descSBOM, descSig},
+	})
+	if err != nil {
+		t.Errorf("failed to marshal referrers: %v", err)
+		return
+	}
+	referrerSBOMBody, err := json.Marshal(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{descSBOM},
+	})
+	if err != nil {
+		t.Errorf("failed to marshal referrers: %v", err)
+		return
+	}
+	referrerSigBody, err := json.Marshal(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{descSig},
+	})
+	if err != nil {
+		t.Errorf("failed to marshal referrers: %v", err)
+		return
+	}
+	artifactM, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned:    v1.ManifestSchemaVersion,
+		MediaType:    types.MediaTypeOCI1Manifest,
+		ArtifactType: atSBOM,
+		Config: types.Descriptor{
+			MediaType: types.MediaTypeOCI1Empty,
+			Digest:    digest.FromString("{}"),
+			Size:      2,
+		},
+		Layers: []types.Descriptor{},
+		Subject: &types.Descriptor{
+			MediaType: types.MediaTypeOCI1Manifest,
+			Digest:    newSubjectDigest,
+			Size:      1234,
+		},
+	}))
+	if err != nil {
+		t.Errorf("failed to create artifact: %v", err)
+		return
+	}
+	artifactDigest := artifactM.GetDescriptor().Digest
+	descArtifact := types.Descriptor{
+		MediaType:    types.MediaTypeOCI1Manifest,
+		Digest:       artifactDigest,
+		Size:         artifactM.GetDescriptor().Size,
+		ArtifactType: atSBOM,
+	}
+	referrerArtifactBody, err := json.Marshal(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{descArtifact},
+	})
+	if err != nil {
+		t.Errorf("failed to marshal referrers: %v", err)
+		return
+	}
+	referrerRaceBody, err := json.Marshal(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{descSig, descArtifact},
+	})
+	if err != nil {
+		t.Errorf("failed to marshal referrers: %v", err)
+		return
+	}
+	rrs := []reqresp.ReqResp{
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "referrers filtered",
+				Method: "GET",
+				Path:   "/v2" + repoPath + "/referrers/" + subjectDigest.String(),
+				Query: map[string][]string{
+					"artifactType": {atSig},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length":      {fmt.Sprintf("%d", len(referrerSigBody))},
+					"Content-Type":        {types.MediaTypeOCI1ManifestList},
+					"OCI-Filters-Applied": {"artifactType"},
+				},
+				Body: referrerSigBody,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "referrers",
+				Method: "GET",
+				Path:   "/v2" + repoPath + "/referrers/" + subjectDigest.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", len(referrerBody))},
+					"Content-Type":   {types.MediaTypeOCI1ManifestList},
+				},
+				Body: referrerBody,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "put artifact with referrers API",
+				Method: "PUT",
+				Path:   "/v2" + repoPath + "/manifests/" + artifactDigest.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+				Headers: http.Header{
+					"OCI-Subject": {newSubjectDigest.String()},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "referrers page 2",
+				Method: "GET",
+				Path:   "/v2" + pagedPath + "/referrers/" + subjectDigest.String(),
+				Query: map[string][]string{
+					"last": {descSBOM.Digest.String()},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", len(referrerSigBody))},
+					"Content-Type":   {types.MediaTypeOCI1ManifestList},
+				},
+				Body: referrerSigBody,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "referrers page 1",
+				Method: "GET",
+				Path:   "/v2" + pagedPath + "/referrers/" + subjectDigest.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", len(referrerSBOMBody))},
+					"Content-Type":   {types.MediaTypeOCI1ManifestList},
+					"Link":           {fmt.Sprintf(`<%s/referrers/%s?last=%s>; rel="next"`, "/v2"+pagedPath, subjectDigest.String(), descSBOM.Digest.String())},
+				},
+				Body: referrerSBOMBody,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "referrers unsupported",
+				Method: "GET",
+				Path:   "/v2" + fallbackPath + "/referrers/" + subjectDigest.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNotFound,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "fallback tag",
+				Method: "GET",
+				Path:   "/v2" + fallbackPath + "/manifests/" + subjectTag,
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", len(referrerBody))},
+					"Content-Type":   {types.MediaTypeOCI1ManifestList},
+				},
+				Body: referrerBody,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "put artifact without referrers API",
+				Method: "PUT",
+				Path:   "/v2" + fallbackPath + "/manifests/" + artifactDigest.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "missing fallback tag",
+				DelOnUse: true,
+				Method:   "GET",
+				Path:     "/v2" + fallbackPath + "/manifests/" + newSubjectTag,
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNotFound,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "updated fallback tag",
+				Method: "GET",
+				Path:   "/v2" + fallbackPath + "/manifests/" + newSubjectTag,
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", len(referrerArtifactBody))},
+					"Content-Type":   {types.MediaTypeOCI1ManifestList},
+				},
+				Body: referrerArtifactBody,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "put artifact with concurrent fallback update",
+				Method: "PUT",
+				Path:   "/v2" + racePath + "/manifests/" + artifactDigest.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "missing race tag",
+				DelOnUse: true,
+				Method:   "GET",
+				Path:     "/v2" + racePath + "/manifests/" + newSubjectTag,
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNotFound,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "race tag replaced by another writer",
+				DelOnUse: true,
+				Method:   "GET",
+				Path:     "/v2" + racePath + "/manifests/" + newSubjectTag,
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", len(referrerSigBody))},
+					"Content-Type":   {types.MediaTypeOCI1ManifestList},
+				},
+				Body: referrerSigBody,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "race tag merged",
+				Method: "GET",
+				Path:   "/v2" + racePath + "/manifests/" + newSubjectTag,
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", len(referrerRaceBody))},
+					"Content-Type":   {types.MediaTypeOCI1ManifestList},
+				},
+				Body: referrerRaceBody,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "put race tag",
+				Method: "PUT",
+				Path:   "/v2" + racePath + "/manifests/" + newSubjectTag,
+				Headers: http.Header{
+					"Content-Type": {types.MediaTypeOCI1ManifestList},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "put fallback tag",
+				Method: "PUT",
+				Path:   "/v2" + fallbackPath + "/manifests/" + newSubjectTag,
+				Headers: http.Header{
+					"Content-Type": {types.MediaTypeOCI1ManifestList},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+			},
+		},
+	}
+	rrs = append(rrs, reqresp.BaseEntries...)
+	// create a server
+	ts := httptest.NewServer(reqresp.NewHandler(t, rrs))
+	defer ts.Close()
+	// setup the reg
+	tsURL, _ := url.Parse(ts.URL)
+	tsHost := tsURL.Host
+	rcHosts := []*config.Host{
+		{
+			Name:     tsHost,
+			Hostname: tsHost,
+			TLS:      config.TLSDisabled,
+		},
+	}
+	log := &logrus.Logger{
+		Out:       os.Stderr,
+		Formatter: new(logrus.TextFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.WarnLevel,
+	}
+	delayInit, _ := time.ParseDuration("0.05s")
+	delayMax, _ := time.ParseDuration("0.10s")
+	reg := New(
+		WithConfigHosts(rcHosts),
+		WithLog(log),
+		WithDelay(delayInit, delayMax),
+	)
+
+	t.Run("API", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + repoPath + "@" + subjectDigest.String())
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		rl, err := reg.ReferrerList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 2 || rl.Descriptors[0].Digest != descSBOM.Digest || rl.Descriptors[1].Digest != descSig.Digest {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+		if len(rl.Tags) > 0 {
+			t.Errorf("unexpected tags: %v", rl.Tags)
+		}
+	})
+	t.Run("API paged", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + pagedPath + "@" + subjectDigest.String())
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		rl, err := reg.ReferrerList(ctx, r)
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 2 || rl.Descriptors[0].Digest != descSBOM.Digest || rl.Descriptors[1].Digest != descSig.Digest {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+		ml, err := rl.Manifest.GetManifestList()
+		if err != nil || len(ml) != 2 {
+			t.Errorf("unexpected merged manifest list: %v, %v", ml, err)
+		}
+	})
+	t.Run("API filter client", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + repoPath + "@" + subjectDigest.String())
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		rl, err := reg.ReferrerList(ctx, r, scheme.WithReferrerAT(atSBOM))
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 1 || rl.Descriptors[0].Digest != descSBOM.Digest {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+	})
+	t.Run("API filter server", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + repoPath + "@" + subjectDigest.String())
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		rl, err := reg.ReferrerList(ctx, r, scheme.WithReferrerAT(atSig))
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 1 || rl.Descriptors[0].Digest != descSig.Digest {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+	})
+	t.Run("Fallback", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + fallbackPath + "@" + subjectDigest.String())
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		rl, err := reg.ReferrerList(ctx, r, scheme.WithReferrerAT(atSig))
+		if err != nil {
+			t.Errorf("failed to list referrers: %v", err)
+			return
+		}
+		if len(rl.Descriptors) != 1 || rl.Descriptors[0].Digest != descSig.Digest {
+			t.Errorf("unexpected descriptors: %v", rl.Descriptors)
+		}
+		if len(rl.Tags) != 1 || rl.Tags[0] != subjectTag {
+			t.Errorf("unexpected tags: %v", rl.Tags)
+		}
+	})
+	t.Run("Put with API", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + repoPath + "@" + artifactDigest.String())
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		err = reg.ManifestPut(ctx, r, artifactM)
+		if err != nil {
+			t.Errorf("failed to put artifact: %v", err)
+		}
+	})
+	t.Run("Put with fallback", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + fallbackPath + "@" + artifactDigest.String())
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		err = reg.ManifestPut(ctx, r, artifactM)
+		if err != nil {
+			t.Errorf("failed to put artifact: %v", err)
+		}
+	})
+	t.Run("Put with concurrent fallback update", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + racePath + "@" + artifactDigest.String())
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		err = reg.ManifestPut(ctx, r, artifactM)
+		if err != nil {
+			t.Errorf("failed to put artifact: %v", err)
+			return
+		}
+		// the retried update consumes the replaced tag response
+		rTag, err := ref.New(tsURL.Host + racePath + ":" + newSubjectTag)
+		if err != nil {
+			t.Errorf("failed creating ref: %v", err)
+			return
+		}
+		m, err := reg.ManifestGet(ctx, rTag)
+		if err != nil {
+			t.Errorf("failed to get digest tag: %v", err)
+			return
+		}
+		ml, err := m.GetManifestList()
+		if err != nil || len(ml) != 2 || ml[1].Digest != artifactDigest {
+			t.Errorf("unexpected digest tag: %v, %v", ml, err)
+		}
+	})
+}
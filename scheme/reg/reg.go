@@ -17,6 +17,8 @@ const (
 	DefaultBlobChunk = 1024 * 1024
 	// DefaultBlobMax is disabled to support registries without chunked upload support
 	DefaultBlobMax = -1
+	// DefaultBlobRecover is the number of attempts to recover an interrupted chunked upload
+	DefaultBlobRecover = 3
 )
 
 // Reg is used for interacting with remote registry servers
@@ -27,6 +29,7 @@ type Reg struct {
 	hosts         map[string]*config.Host
 	blobChunkSize int64
 	blobMaxPut    int64
+	retryLimit    int
 	mu            sync.Mutex
 }
 
@@ -39,6 +42,7 @@ func New(opts ...Opts) *Reg {
 		reghttpOpts:   []reghttp.Opts{},
 		blobChunkSize: DefaultBlobChunk,
 		blobMaxPut:    DefaultBlobMax,
+		retryLimit:    reghttp.DefaultRetryLimit,
 		hosts:         map[string]*config.Host{},
 	}
 	for _, opt := range opts {
@@ -133,6 +137,9 @@ func WithLog(log *logrus.Logger) Opts {
 // WithRetryLimit restricts the number of retries (defaults to 5)
 func WithRetryLimit(l int) Opts {
 	return func(r *Reg) {
+		if l > 0 {
+			r.retryLimit = l
+		}
 		r.reghttpOpts = append(r.reghttpOpts, reghttp.WithRetryLimit(l))
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/regclient/regclient/types/blob"
 	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
 	"github.com/regclient/regclient/types/tag"
 )
 
@@ -37,6 +38,9 @@ type API interface {
 	// ManifestPut sends a manifest to the repository
 	ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest, opts ...ManifestOpts) error
 
+	// ReferrerList returns a list of referrers to a given reference
+	ReferrerList(ctx context.Context, r ref.Ref, opts ...ReferrerOpts) (referrer.ReferrerList, error)
+
 	// TagDelete removes a tag from the repository
 	TagDelete(ctx context.Context, r ref.Ref) error
 	// TagList returns a list of tags from the repository
@@ -70,6 +74,21 @@ func WithManifestChild() ManifestOpts {
 	}
 }
 
+// ReferrerConfig is used by schemes to import ReferrerOpts
+type ReferrerConfig struct {
+	FilterArtifactType string
+}
+
+// ReferrerOpts is used to set options on referrer APIs
+type ReferrerOpts func(*ReferrerConfig)
+
+// WithReferrerAT filters by a specific artifactType value
+func WithReferrerAT(at string) ReferrerOpts {
+	return func(config *ReferrerConfig) {
+		config.FilterArtifactType = at
+	}
+}
+
 // RepoConfig is used by schemes to import RepoOpts
 type RepoConfig struct {
 	Limit int
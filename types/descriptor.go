@@ -40,6 +40,9 @@ type Descriptor struct {
 	// Platform describes the platform which the image in the manifest runs on.
 	// This should only be used when referring to a manifest.
 	Platform *platform.Platform `json:"platform,omitempty"`
+
+	// ArtifactType is the media type of the artifact, used when listing referrers.
+	ArtifactType string `json:"artifactType,omitempty"`
 }
 
 var emptyDigest = digest.FromBytes([]byte{})
@@ -70,6 +73,9 @@ func (d Descriptor) GetData() ([]byte, error) {
 func (d Descriptor) MarshalPrettyTW(tw *tabwriter.Writer, prefix string) error {
 	fmt.Fprintf(tw, "%sDigest:\t%s\n", prefix, string(d.Digest))
 	fmt.Fprintf(tw, "%sMediaType:\t%s\n", prefix, d.MediaType)
+	if d.ArtifactType != "" {
+		fmt.Fprintf(tw, "%sArtifactType:\t%s\n", prefix, d.ArtifactType)
+	}
 	switch d.MediaType {
 	case MediaTypeDocker1Manifest, MediaTypeDocker1ManifestSigned,
 		MediaTypeDocker2Manifest, MediaTypeDocker2ManifestList,
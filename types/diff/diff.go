@@ -0,0 +1,578 @@
+// Package diff contains the results of comparing two images
+package diff
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	// crypto libraries included for go-digest
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/units"
+	"github.com/regclient/regclient/internal/whiteout"
+	"github.com/regclient/regclient/types"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+)
+
+// Action describes how an entry differs between the old and new content
+type Action string
+
+const (
+	// Added entries only exist in the new content
+	Added Action = "added"
+	// Removed entries only exist in the old content
+	Removed Action = "removed"
+	// Modified entries exist in both with different values
+	Modified Action = "modified"
+)
+
+// Image contains the differences between two images
+type Image struct {
+	Old       string     `json:"old"`       // reference to the old image
+	New       string     `json:"new"`       // reference to the new image
+	Manifests []Manifest `json:"manifests"` // differences for each compared manifest
+}
+
+// Manifest contains the differences between a pair of manifests
+type Manifest struct {
+	Platform string        `json:"platform,omitempty"` // platform when comparing entries from an index
+	Old      digest.Digest `json:"old"`                // digest of the old manifest
+	New      digest.Digest `json:"new"`                // digest of the new manifest
+	Changes  []Change      `json:"changes,omitempty"`  // media type, annotation, and platform changes
+	Config   []Change      `json:"config,omitempty"`   // image config changes
+	Layers   []Layer       `json:"layers,omitempty"`   // layers that differ by digest
+	Files    []File        `json:"files,omitempty"`    // files that differ, only included when requested
+}
+
+// Change is a single difference in a value
+type Change struct {
+	Field  string `json:"field"`
+	Key    string `json:"key,omitempty"`
+	Action Action `json:"action"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// Layer is a difference in the layer descriptors at a given index
+type Layer struct {
+	Index  int               `json:"index"`
+	Action Action            `json:"action"`
+	Old    *types.Descriptor `json:"old,omitempty"`
+	New    *types.Descriptor `json:"new,omitempty"`
+}
+
+// File is a difference in a path of the image filesystem
+type File struct {
+	Path    string      `json:"path"`
+	Action  Action      `json:"action"`
+	Changes []string    `json:"changes,omitempty"` // list of modified attributes (type, size, mode, owner, link, content)
+	Old     *FileHeader `json:"old,omitempty"`
+	New     *FileHeader `json:"new,omitempty"`
+}
+
+// FileHeader contains the attributes of a file used for comparisons
+type FileHeader struct {
+	Type     byte          `json:"type"`
+	Size     int64         `json:"size"`
+	Mode     os.FileMode   `json:"mode"`
+	UID      int           `json:"uid"`
+	GID      int           `json:"gid"`
+	Linkname string        `json:"linkname,omitempty"`
+	Digest   digest.Digest `json:"digest,omitempty"`
+}
+
+// FileList contains the headers of each path in an image filesystem
+type FileList map[string]FileHeader
+
+// IsEmpty reports if no differences were found
+func (di Image) IsEmpty() bool {
+	for _, dm := range di.Manifests {
+		if !dm.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEmpty reports if no differences were found
+func (dm Manifest) IsEmpty() bool {
+	return len(dm.Changes) == 0 && len(dm.Config) == 0 && len(dm.Layers) == 0 && len(dm.Files) == 0
+}
+
+// MarshalPretty is used for printPretty template formatting
+func (di Image) MarshalPretty() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "Old:\t%s\n", di.Old)
+	fmt.Fprintf(tw, "New:\t%s\n", di.New)
+	if di.IsEmpty() {
+		fmt.Fprintf(tw, "\t\n")
+		fmt.Fprintf(tw, "No differences found\t\n")
+	}
+	for _, dm := range di.Manifests {
+		if dm.IsEmpty() {
+			continue
+		}
+		fmt.Fprintf(tw, "\t\n")
+		if dm.Platform != "" {
+			fmt.Fprintf(tw, "Platform:\t%s\n", dm.Platform)
+		}
+		if dm.Old == dm.New {
+			fmt.Fprintf(tw, "Digest:\t%s\n", dm.Old.String())
+		} else {
+			fmt.Fprintf(tw, "Digest:\t%s -> %s\n", dm.Old.String(), dm.New.String())
+		}
+		if len(dm.Changes) > 0 {
+			fmt.Fprintf(tw, "Manifest:\t\n")
+			for _, c := range dm.Changes {
+				fmt.Fprintf(tw, "  %s\n", c.String())
+			}
+		}
+		if len(dm.Config) > 0 {
+			fmt.Fprintf(tw, "Config:\t\n")
+			for _, c := range dm.Config {
+				fmt.Fprintf(tw, "  %s\n", c.String())
+			}
+		}
+		if len(dm.Layers) > 0 {
+			fmt.Fprintf(tw, "Layers:\t\n")
+			for _, dl := range dm.Layers {
+				fmt.Fprintf(tw, "  %s\n", dl.String())
+			}
+		}
+		if len(dm.Files) > 0 {
+			fmt.Fprintf(tw, "Files:\t\n")
+			for _, df := range dm.Files {
+				fmt.Fprintf(tw, "  %s\n", df.String())
+			}
+		}
+	}
+	tw.Flush()
+	return buf.Bytes(), nil
+}
+
+// String returns a single line description of the change
+func (c Change) String() string {
+	name := c.Field
+	if c.Key != "" {
+		name = fmt.Sprintf("%s[%s]", c.Field, c.Key)
+	}
+	switch c.Action {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", name, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s: %s", name, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", name, c.Old, c.New)
+	}
+}
+
+// String returns a single line description of the layer difference
+func (dl Layer) String() string {
+	switch dl.Action {
+	case Added:
+		return fmt.Sprintf("+ [%d] %s (%s)", dl.Index, dl.New.Digest.String(), units.HumanSize(float64(dl.New.Size)))
+	case Removed:
+		return fmt.Sprintf("- [%d] %s (%s)", dl.Index, dl.Old.Digest.String(), units.HumanSize(float64(dl.Old.Size)))
+	default:
+		return fmt.Sprintf("~ [%d] %s -> %s", dl.Index, dl.Old.Digest.String(), dl.New.Digest.String())
+	}
+}
+
+// String returns a single line description of the file difference
+func (df File) String() string {
+	switch df.Action {
+	case Added:
+		return fmt.Sprintf("+ %s (%s)", df.Path, df.New.String())
+	case Removed:
+		return fmt.Sprintf("- %s (%s)", df.Path, df.Old.String())
+	default:
+		return fmt.Sprintf("~ %s (%s -> %s)", df.Path, df.Old.String(), df.New.String())
+	}
+}
+
+// String returns the mode, owner, and size of the file
+func (fh FileHeader) String() string {
+	s := fmt.Sprintf("%s %d:%d %s", fh.Mode.String(), fh.UID, fh.GID, units.HumanSize(float64(fh.Size)))
+	if fh.Linkname != "" {
+		s = s + " -> " + fh.Linkname
+	}
+	return s
+}
+
+// Value compares a single value
+func Value(field, old, new string) []Change {
+	switch {
+	case old == new:
+		return []Change{}
+	case old == "":
+		return []Change{{Field: field, Action: Added, New: new}}
+	case new == "":
+		return []Change{{Field: field, Action: Removed, Old: old}}
+	default:
+		return []Change{{Field: field, Action: Modified, Old: old, New: new}}
+	}
+}
+
+// Strings compares an ordered list of strings, e.g. an entrypoint
+func Strings(field string, old, new []string) []Change {
+	if strSliceEq(old, new) {
+		return []Change{}
+	}
+	return Value(field, strSliceString(old), strSliceString(new))
+}
+
+// Map compares each key in a map of strings
+func Map(field string, old, new map[string]string) []Change {
+	changes := []Change{}
+	for _, k := range mapKeys(old, new) {
+		vOld, okOld := old[k]
+		vNew, okNew := new[k]
+		switch {
+		case okOld && !okNew:
+			changes = append(changes, Change{Field: field, Key: k, Action: Removed, Old: vOld})
+		case !okOld && okNew:
+			changes = append(changes, Change{Field: field, Key: k, Action: Added, New: vNew})
+		case vOld != vNew:
+			changes = append(changes, Change{Field: field, Key: k, Action: Modified, Old: vOld, New: vNew})
+		}
+	}
+	return changes
+}
+
+// Config compares two image configs
+func Config(old, new v1.Image) []Change {
+	changes := []Change{}
+	changes = append(changes, Value("Architecture", old.Architecture, new.Architecture)...)
+	changes = append(changes, Value("OS", old.OS, new.OS)...)
+	changes = append(changes, Value("Variant", old.Variant, new.Variant)...)
+	changes = append(changes, Value("User", old.Config.User, new.Config.User)...)
+	changes = append(changes, Value("WorkingDir", old.Config.WorkingDir, new.Config.WorkingDir)...)
+	changes = append(changes, Value("StopSignal", old.Config.StopSignal, new.Config.StopSignal)...)
+	changes = append(changes, Strings("Entrypoint", old.Config.Entrypoint, new.Config.Entrypoint)...)
+	changes = append(changes, Strings("Cmd", old.Config.Cmd, new.Config.Cmd)...)
+	changes = append(changes, Map("Env", envMap(old.Config.Env), envMap(new.Config.Env))...)
+	changes = append(changes, Map("Labels", old.Config.Labels, new.Config.Labels)...)
+	changes = append(changes, Map("ExposedPorts", setMap(old.Config.ExposedPorts), setMap(new.Config.ExposedPorts))...)
+	changes = append(changes, Map("Volumes", setMap(old.Config.Volumes), setMap(new.Config.Volumes))...)
+	changes = append(changes, History(old.History, new.History)...)
+	return changes
+}
+
+// History compares the created by value of each history entry.
+// Entries are aligned with the longest common subsequence, so an inserted step is reported as a single addition.
+// The key is the index in the new history, or the old history for removed entries.
+func History(old, new []v1.History) []Change {
+	changes := []Change{}
+	for _, a := range align(len(old), len(new), func(i, j int) bool { return old[i].CreatedBy == new[j].CreatedBy }) {
+		switch a.action {
+		case Removed:
+			changes = append(changes, Change{Field: "History", Key: strconv.Itoa(a.old), Action: Removed, Old: old[a.old].CreatedBy})
+		case Added:
+			changes = append(changes, Change{Field: "History", Key: strconv.Itoa(a.new), Action: Added, New: new[a.new].CreatedBy})
+		default:
+			changes = append(changes, Change{Field: "History", Key: strconv.Itoa(a.new), Action: Modified, Old: old[a.old].CreatedBy, New: new[a.new].CreatedBy})
+		}
+	}
+	return changes
+}
+
+// Layers compares the layer descriptors by digest.
+// Layers are aligned with the longest common subsequence, so an inserted layer is reported as a single addition.
+// The index is the position in the new layers, or the old layers for removed entries.
+func Layers(old, new []types.Descriptor) []Layer {
+	layers := []Layer{}
+	for _, a := range align(len(old), len(new), func(i, j int) bool { return old[i].Digest == new[j].Digest }) {
+		switch a.action {
+		case Removed:
+			d := old[a.old]
+			layers = append(layers, Layer{Index: a.old, Action: Removed, Old: &d})
+		case Added:
+			d := new[a.new]
+			layers = append(layers, Layer{Index: a.new, Action: Added, New: &d})
+		default:
+			dOld, dNew := old[a.old], new[a.new]
+			layers = append(layers, Layer{Index: a.new, Action: Modified, Old: &dOld, New: &dNew})
+		}
+	}
+	return layers
+}
+
+// alignDiff is an entry that differs between two aligned lists, indexes are -1 when the entry is missing from a list
+type alignDiff struct {
+	action Action
+	old    int
+	new    int
+}
+
+// align returns the differences between two lists using the longest common subsequence of matching entries.
+// Unmatched entries between two matches are paired in order as modified, and any remaining entries are removed or added.
+func align(lenOld, lenNew int, eq func(i, j int) bool) []alignDiff {
+	// lcs[i][j] is the length of the longest common subsequence of old[i:] and new[j:]
+	lcs := make([][]int, lenOld+1)
+	for i := range lcs {
+		lcs[i] = make([]int, lenNew+1)
+	}
+	for i := lenOld - 1; i >= 0; i-- {
+		for j := lenNew - 1; j >= 0; j-- {
+			switch {
+			case eq(i, j):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	diffs := []alignDiff{}
+	removed, added := []int{}, []int{}
+	flush := func() {
+		n := 0
+		for ; n < len(removed) && n < len(added); n++ {
+			diffs = append(diffs, alignDiff{action: Modified, old: removed[n], new: added[n]})
+		}
+		for _, i := range removed[n:] {
+			diffs = append(diffs, alignDiff{action: Removed, old: i, new: -1})
+		}
+		for _, j := range added[n:] {
+			diffs = append(diffs, alignDiff{action: Added, old: -1, new: j})
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	i, j := 0, 0
+	for i < lenOld || j < lenNew {
+		switch {
+		case i < lenOld && j < lenNew && eq(i, j):
+			flush()
+			i++
+			j++
+		case j >= lenNew || (i < lenOld && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+	return diffs
+}
+
+// Files compares the headers of each path in two file lists
+func Files(old, new FileList) []File {
+	files := []File{}
+	keys := []string{}
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fhOld, okOld := old[k]
+		fhNew, okNew := new[k]
+		switch {
+		case okOld && !okNew:
+			files = append(files, File{Path: k, Action: Removed, Old: &fhOld})
+		case !okOld && okNew:
+			files = append(files, File{Path: k, Action: Added, New: &fhNew})
+		default:
+			changes := fhOld.compare(fhNew)
+			if len(changes) > 0 {
+				files = append(files, File{Path: k, Action: Modified, Changes: changes, Old: &fhOld, New: &fhNew})
+			}
+		}
+	}
+	return files
+}
+
+// AddLayer applies the content of an uncompressed layer tar to the file list.
+// Whiteout files in the layer remove entries from the lower layers before the entries of this layer are added.
+// Hardlinks are given the content digest of their target so a changed target is reported as a content change.
+func (fl FileList) AddLayer(rdr io.Reader) error {
+	layer := FileList{}
+	order := []string{}
+	hidden := []string{}
+	opaque := []string{}
+	tr := tar.NewReader(rdr)
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read layer: %w", err)
+		}
+		name := path.Clean("/" + th.Name)
+		if target, isOpaque, ok := whiteout.Parse(name); ok {
+			if isOpaque {
+				opaque = append(opaque, target)
+			} else {
+				hidden = append(hidden, target)
+			}
+			continue
+		}
+		if name == "/" {
+			continue
+		}
+		fh := FileHeader{
+			Type:     th.Typeflag,
+			Size:     th.Size,
+			Mode:     th.FileInfo().Mode(),
+			UID:      th.Uid,
+			GID:      th.Gid,
+			Linkname: th.Linkname,
+		}
+		switch th.Typeflag {
+		case tar.TypeReg:
+			fh.Digest, err = digest.Canonical.FromReader(tr)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", th.Name, err)
+			}
+		case tar.TypeLink:
+			// hardlinks share the content of the target from this or a lower layer
+			target := path.Clean("/" + th.Linkname)
+			if fhTarget, ok := layer[target]; ok {
+				fh.Digest = fhTarget.Digest
+			} else if fhTarget, ok := fl[target]; ok {
+				fh.Digest = fhTarget.Digest
+			}
+		}
+		if _, ok := layer[name]; !ok {
+			order = append(order, name)
+		}
+		layer[name] = fh
+	}
+	// whiteouts only apply to the lower layers
+	for _, dir := range opaque {
+		fl.removeChildren(dir)
+	}
+	for _, target := range hidden {
+		delete(fl, target)
+		fl.removeChildren(target)
+	}
+	for _, name := range order {
+		fh := layer[name]
+		// a file replacing a directory removes the content of that directory
+		if prev, ok := fl[name]; ok && prev.Type == tar.TypeDir && fh.Type != tar.TypeDir {
+			fl.removeChildren(name)
+		}
+		fl[name] = fh
+	}
+	return nil
+}
+
+// removeChildren deletes all entries under a directory
+func (fl FileList) removeChildren(dir string) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for k := range fl {
+		if strings.HasPrefix(k, prefix) {
+			delete(fl, k)
+		}
+	}
+}
+
+// compare returns the list of attributes that differ
+func (fh FileHeader) compare(fhNew FileHeader) []string {
+	changes := []string{}
+	if fh.Type != fhNew.Type {
+		changes = append(changes, "type")
+	}
+	if fh.Size != fhNew.Size {
+		changes = append(changes, "size")
+	}
+	if fh.Mode != fhNew.Mode {
+		changes = append(changes, "mode")
+	}
+	if fh.UID != fhNew.UID || fh.GID != fhNew.GID {
+		changes = append(changes, "owner")
+	}
+	if fh.Linkname != fhNew.Linkname {
+		changes = append(changes, "link")
+	}
+	if fh.Digest != fhNew.Digest {
+		changes = append(changes, "content")
+	}
+	return changes
+}
+
+func envMap(env []string) map[string]string {
+	m := map[string]string{}
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			m[kv[0]] = kv[1]
+		} else {
+			m[kv[0]] = ""
+		}
+	}
+	return m
+}
+
+func setMap(set map[string]struct{}) map[string]string {
+	m := map[string]string{}
+	for k := range set {
+		m[k] = k
+	}
+	return m
+}
+
+// mapKeys returns the sorted union of keys, numeric keys are sorted numerically
+func mapKeys(a, b map[string]string) []string {
+	keys := []string{}
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ni, errI := strconv.Atoi(keys[i])
+		nj, errJ := strconv.Atoi(keys[j])
+		if errI == nil && errJ == nil {
+			return ni < nj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func strSliceEq(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func strSliceString(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return strings.Join(s, " ")
+	}
+	return string(b)
+}
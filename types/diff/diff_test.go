@@ -0,0 +1,222 @@
+package diff
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+)
+
+func TestConfig(t *testing.T) {
+	old := v1.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		Config: v1.ImageConfig{
+			Env:        []string{"PATH=/bin", "A=1"},
+			Entrypoint: []string{"/app"},
+			Labels:     map[string]string{"version": "1", "removed": "x"},
+		},
+		History: []v1.History{{CreatedBy: "step 1"}},
+	}
+	new := v1.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		Config: v1.ImageConfig{
+			Env:        []string{"PATH=/bin", "A=2", "B=3"},
+			Entrypoint: []string{"/app", "--debug"},
+			Labels:     map[string]string{"version": "2"},
+			User:       "1000",
+		},
+		History: []v1.History{{CreatedBy: "step 1"}, {CreatedBy: "step 2"}},
+	}
+	expect := []Change{
+		{Field: "User", Action: Added, New: "1000"},
+		{Field: "Entrypoint", Action: Modified, Old: `["/app"]`, New: `["/app","--debug"]`},
+		{Field: "Env", Key: "A", Action: Modified, Old: "1", New: "2"},
+		{Field: "Env", Key: "B", Action: Added, New: "3"},
+		{Field: "Labels", Key: "removed", Action: Removed, Old: "x"},
+		{Field: "Labels", Key: "version", Action: Modified, Old: "1", New: "2"},
+		{Field: "History", Key: "1", Action: Added, New: "step 2"},
+	}
+	changes := Config(old, new)
+	if len(changes) != len(expect) {
+		t.Errorf("unexpected changes, expected %v, received %v", expect, changes)
+		return
+	}
+	for i := range expect {
+		if changes[i] != expect[i] {
+			t.Errorf("change %d, expected %v, received %v", i, expect[i], changes[i])
+		}
+	}
+	if len(Config(old, old)) != 0 {
+		t.Errorf("changes found comparing the same config")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	history := func(steps ...string) []v1.History {
+		h := []v1.History{}
+		for _, s := range steps {
+			h = append(h, v1.History{CreatedBy: s})
+		}
+		return h
+	}
+	tests := []struct {
+		name   string
+		old    []v1.History
+		new    []v1.History
+		expect []Change
+	}{
+		{
+			name:   "same",
+			old:    history("a", "b"),
+			new:    history("a", "b"),
+			expect: []Change{},
+		},
+		{
+			name: "inserted",
+			old:  history("a", "b", "c"),
+			new:  history("new", "a", "b", "c"),
+			expect: []Change{
+				{Field: "History", Key: "0", Action: Added, New: "new"},
+			},
+		},
+		{
+			name: "removed",
+			old:  history("a", "b", "c"),
+			new:  history("a", "c"),
+			expect: []Change{
+				{Field: "History", Key: "1", Action: Removed, Old: "b"},
+			},
+		},
+		{
+			name: "modified and appended",
+			old:  history("a", "b", "c"),
+			new:  history("a", "x", "c", "d"),
+			expect: []Change{
+				{Field: "History", Key: "1", Action: Modified, Old: "b", New: "x"},
+				{Field: "History", Key: "3", Action: Added, New: "d"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := History(tt.old, tt.new)
+			if len(changes) != len(tt.expect) {
+				t.Fatalf("unexpected changes, expected %v, received %v", tt.expect, changes)
+			}
+			for i := range tt.expect {
+				if changes[i] != tt.expect[i] {
+					t.Errorf("change %d, expected %v, received %v", i, tt.expect[i], changes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLayers(t *testing.T) {
+	dA := types.Descriptor{MediaType: types.MediaTypeOCI1LayerGzip, Digest: digest.FromString("a"), Size: 1}
+	dB := types.Descriptor{MediaType: types.MediaTypeOCI1LayerGzip, Digest: digest.FromString("b"), Size: 1}
+	dC := types.Descriptor{MediaType: types.MediaTypeOCI1LayerGzip, Digest: digest.FromString("c"), Size: 1}
+	layers := Layers([]types.Descriptor{dA, dB}, []types.Descriptor{dC, dA, dB})
+	if len(layers) != 1 || layers[0].Action != Added || layers[0].Index != 0 || layers[0].New.Digest != dC.Digest {
+		t.Errorf("unexpected layers for an inserted layer: %v", layers)
+	}
+	layers = Layers([]types.Descriptor{dA, dB}, []types.Descriptor{dA, dC})
+	if len(layers) != 1 || layers[0].Action != Modified || layers[0].Index != 1 || layers[0].Old.Digest != dB.Digest || layers[0].New.Digest != dC.Digest {
+		t.Errorf("unexpected layers for a replaced layer: %v", layers)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	type tarFile struct {
+		name     string
+		typeflag byte
+		mode     int64
+		linkname string
+		content  string
+	}
+	layer := func(files []tarFile) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, f := range files {
+			tw.WriteHeader(&tar.Header{
+				Name:     f.name,
+				Typeflag: f.typeflag,
+				Mode:     f.mode,
+				Linkname: f.linkname,
+				Size:     int64(len(f.content)),
+			})
+			tw.Write([]byte(f.content))
+		}
+		tw.Close()
+		return buf
+	}
+	base := []tarFile{
+		{name: "bin/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "bin/tool", typeflag: tar.TypeReg, mode: 0755, content: "v1"},
+		{name: "bin/link", typeflag: tar.TypeLink, mode: 0755, linkname: "bin/tool"},
+		{name: "etc/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "etc/a", typeflag: tar.TypeReg, mode: 0644, content: "a"},
+		{name: "etc/b", typeflag: tar.TypeReg, mode: 0644, content: "b"},
+		{name: "opt/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "opt/old", typeflag: tar.TypeReg, mode: 0644, content: "old"},
+		{name: "run.sh", typeflag: tar.TypeReg, mode: 0644, content: "run"},
+	}
+	// whiteouts after other entries in the same layer only apply to the lower layers
+	upper := []tarFile{
+		{name: "bin/tool", typeflag: tar.TypeReg, mode: 0755, content: "v2"},
+		{name: "bin/link", typeflag: tar.TypeLink, mode: 0755, linkname: "bin/tool"},
+		{name: "etc/a", typeflag: tar.TypeReg, mode: 0644, content: "changed"},
+		{name: "etc/.wh.b", typeflag: tar.TypeReg, mode: 0644},
+		{name: "opt/new", typeflag: tar.TypeReg, mode: 0644, content: "new"},
+		{name: "opt/.wh..wh..opq", typeflag: tar.TypeReg, mode: 0644},
+		{name: "run.sh", typeflag: tar.TypeReg, mode: 0755, content: "run"},
+	}
+	flOld := FileList{}
+	err := flOld.AddLayer(layer(base))
+	if err != nil {
+		t.Errorf("failed to add layer: %v", err)
+		return
+	}
+	flNew := FileList{}
+	err = flNew.AddLayer(layer(base))
+	if err != nil {
+		t.Errorf("failed to add layer: %v", err)
+		return
+	}
+	err = flNew.AddLayer(layer(upper))
+	if err != nil {
+		t.Errorf("failed to add layer: %v", err)
+		return
+	}
+	if _, ok := flNew["/etc/.wh.b"]; ok {
+		t.Errorf("whiteout file included in the file list")
+	}
+	files := Files(flOld, flNew)
+	expect := []struct {
+		path    string
+		action  Action
+		changes []string
+	}{
+		{path: "/bin/link", action: Modified, changes: []string{"content"}},
+		{path: "/bin/tool", action: Modified, changes: []string{"content"}},
+		{path: "/etc/a", action: Modified, changes: []string{"size", "content"}},
+		{path: "/etc/b", action: Removed},
+		{path: "/opt/new", action: Added},
+		{path: "/opt/old", action: Removed},
+		{path: "/run.sh", action: Modified, changes: []string{"mode"}},
+	}
+	if len(files) != len(expect) {
+		t.Errorf("unexpected files, expected %v, received %v", expect, files)
+		return
+	}
+	for i, e := range expect {
+		if files[i].Path != e.path || files[i].Action != e.action || !strSliceEq(files[i].Changes, e.changes) {
+			t.Errorf("file %d, expected %v, received %v", i, e, files[i])
+		}
+	}
+}
@@ -49,6 +49,17 @@ type Manifest interface {
 	HasRateLimit() bool                                              // TODO: deprecate
 }
 
+// Annotator is used by manifests that support annotations.
+type Annotator interface {
+	GetAnnotations() (map[string]string, error)
+}
+
+// Subjecter is used by manifests that may have a subject field.
+// A nil descriptor is returned when the manifest does not have a subject.
+type Subjecter interface {
+	GetSubject() (*types.Descriptor, error)
+}
+
 type manifestConfig struct {
 	r      ref.Ref
 	desc   types.Descriptor
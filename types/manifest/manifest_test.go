@@ -751,3 +751,77 @@ func TestModify(t *testing.T) {
 		}
 	})
 }
+
+func TestSubject(t *testing.T) {
+	rawArtifact := []byte(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"artifactType": "application/example.sbom",
+		"config": {
+			"mediaType": "application/vnd.oci.empty.v1+json",
+			"digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+			"size": 2
+		},
+		"layers": [],
+		"subject": {
+			"mediaType": "application/vnd.oci.image.manifest.v1+json",
+			"digest": "sha256:10fdcbb8eac53c686023468e307adb6c0da03fc904f6739ee543143a2365be41",
+			"size": 3023
+		},
+		"annotations": {
+			"org.example.type": "sbom"
+		}
+	}`)
+	m, err := New(WithRaw(rawArtifact), WithDesc(types.Descriptor{MediaType: types.MediaTypeOCI1Manifest}))
+	if err != nil {
+		t.Errorf("failed to parse artifact: %v", err)
+		return
+	}
+	ms, ok := m.(Subjecter)
+	if !ok {
+		t.Errorf("OCI manifest does not implement Subjecter")
+		return
+	}
+	subject, err := ms.GetSubject()
+	if err != nil {
+		t.Errorf("failed to get subject: %v", err)
+		return
+	}
+	if subject == nil || subject.Digest.String() != "sha256:10fdcbb8eac53c686023468e307adb6c0da03fc904f6739ee543143a2365be41" {
+		t.Errorf("unexpected subject: %v", subject)
+	}
+	ma, ok := m.(Annotator)
+	if !ok {
+		t.Errorf("OCI manifest does not implement Annotator")
+		return
+	}
+	annotations, err := ma.GetAnnotations()
+	if err != nil || annotations["org.example.type"] != "sbom" {
+		t.Errorf("unexpected annotations: %v, %v", annotations, err)
+	}
+	orig, ok := m.GetOrig().(v1.Manifest)
+	if !ok || orig.ArtifactType != "application/example.sbom" {
+		t.Errorf("unexpected artifactType: %v", orig)
+	}
+
+	// manifests without a subject return nil
+	mImage, err := New(WithOrig(v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: types.MediaTypeOCI1Manifest,
+		Config:    orig.Config,
+		Layers:    []types.Descriptor{},
+	}))
+	if err != nil {
+		t.Errorf("failed to parse image: %v", err)
+		return
+	}
+	ms, ok = mImage.(Subjecter)
+	if !ok {
+		t.Errorf("OCI manifest does not implement Subjecter")
+		return
+	}
+	subject, err = ms.GetSubject()
+	if err != nil || subject != nil {
+		t.Errorf("unexpected subject: %v, %v", subject, err)
+	}
+}
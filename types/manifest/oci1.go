@@ -34,6 +34,19 @@ type oci1Index struct {
 	v1.Index
 }
 
+func (m *oci1Manifest) GetAnnotations() (map[string]string, error) {
+	if !m.manifSet {
+		return nil, wraperr.New(fmt.Errorf("Manifest unavailable, perform a ManifestGet first"), types.ErrUnavailable)
+	}
+	return m.Annotations, nil
+}
+func (m *oci1Index) GetAnnotations() (map[string]string, error) {
+	if !m.manifSet {
+		return nil, wraperr.New(fmt.Errorf("Manifest unavailable, perform a ManifestGet first"), types.ErrUnavailable)
+	}
+	return m.Annotations, nil
+}
+
 func (m *oci1Manifest) GetConfig() (types.Descriptor, error) {
 	return m.Config, nil
 }
@@ -90,6 +103,19 @@ func (m *oci1Index) GetPlatformList() ([]*platform.Platform, error) {
 	return getPlatformList(dl)
 }
 
+func (m *oci1Manifest) GetSubject() (*types.Descriptor, error) {
+	if !m.manifSet {
+		return nil, wraperr.New(fmt.Errorf("Manifest unavailable, perform a ManifestGet first"), types.ErrUnavailable)
+	}
+	return m.Manifest.Subject, nil
+}
+func (m *oci1Index) GetSubject() (*types.Descriptor, error) {
+	if !m.manifSet {
+		return nil, wraperr.New(fmt.Errorf("Manifest unavailable, perform a ManifestGet first"), types.ErrUnavailable)
+	}
+	return m.Index.Subject, nil
+}
+
 func (m *oci1Manifest) MarshalJSON() ([]byte, error) {
 	if !m.manifSet {
 		return []byte{}, wraperr.New(fmt.Errorf("Manifest unavailable, perform a ManifestGet first"), types.ErrUnavailable)
@@ -124,6 +150,15 @@ func (m *oci1Manifest) MarshalPretty() ([]byte, error) {
 	}
 	fmt.Fprintf(tw, "MediaType:\t%s\n", m.desc.MediaType)
 	fmt.Fprintf(tw, "Digest:\t%s\n", m.desc.Digest.String())
+	if m.ArtifactType != "" {
+		fmt.Fprintf(tw, "ArtifactType:\t%s\n", m.ArtifactType)
+	}
+	if m.Annotations != nil && len(m.Annotations) > 0 {
+		fmt.Fprintf(tw, "Annotations:\t\n")
+		for name, val := range m.Annotations {
+			fmt.Fprintf(tw, "  %s:\t%s\n", name, val)
+		}
+	}
 	var total int64
 	for _, d := range m.Layers {
 		total += d.Size
@@ -135,6 +170,14 @@ func (m *oci1Manifest) MarshalPretty() ([]byte, error) {
 	if err != nil {
 		return []byte{}, err
 	}
+	if m.Manifest.Subject != nil {
+		fmt.Fprintf(tw, "\t\n")
+		fmt.Fprintf(tw, "Subject:\t\n")
+		err := m.Manifest.Subject.MarshalPrettyTW(tw, "  ")
+		if err != nil {
+			return []byte{}, err
+		}
+	}
 	fmt.Fprintf(tw, "\t\n")
 	fmt.Fprintf(tw, "Layers:\t\n")
 	for _, d := range m.Layers {
@@ -158,12 +201,23 @@ func (m *oci1Index) MarshalPretty() ([]byte, error) {
 	}
 	fmt.Fprintf(tw, "MediaType:\t%s\n", m.desc.MediaType)
 	fmt.Fprintf(tw, "Digest:\t%s\n", m.desc.Digest.String())
+	if m.ArtifactType != "" {
+		fmt.Fprintf(tw, "ArtifactType:\t%s\n", m.ArtifactType)
+	}
 	if m.Annotations != nil && len(m.Annotations) > 0 {
 		fmt.Fprintf(tw, "Annotations:\t\n")
 		for name, val := range m.Annotations {
 			fmt.Fprintf(tw, "  %s:\t%s\n", name, val)
 		}
 	}
+	if m.Index.Subject != nil {
+		fmt.Fprintf(tw, "\t\n")
+		fmt.Fprintf(tw, "Subject:\t\n")
+		err := m.Index.Subject.MarshalPrettyTW(tw, "  ")
+		if err != nil {
+			return []byte{}, err
+		}
+	}
 	fmt.Fprintf(tw, "\t\n")
 	fmt.Fprintf(tw, "Manifests:\t\n")
 	for _, d := range m.Manifests {
@@ -17,12 +17,16 @@ const (
 	MediaTypeOCI1ManifestList = "application/vnd.oci.image.index.v1+json"
 	// MediaTypeOCI1ImageConfig OCI v1 configuration json object media type
 	MediaTypeOCI1ImageConfig = "application/vnd.oci.image.config.v1+json"
+	// MediaTypeOCI1Empty is used for blobs containing the empty JSON data `{}`
+	MediaTypeOCI1Empty = "application/vnd.oci.empty.v1+json"
 	// MediaTypeDocker2Layer is the default compressed layer for docker schema2
 	MediaTypeDocker2Layer = "application/vnd.docker.image.rootfs.diff.tar.gzip"
 	// MediaTypeOCI1Layer is the uncompressed layer for OCIv1
 	MediaTypeOCI1Layer = "application/vnd.oci.image.layer.v1.tar"
 	// MediaTypeOCI1LayerGzip is the gzip compressed layer for OCI v1
 	MediaTypeOCI1LayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+	// MediaTypeOCI1LayerZstd is the zstd compressed layer for OCI v1
+	MediaTypeOCI1LayerZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
 	// MediaTypeBuildkitCacheConfig is used by buildkit cache images
 	MediaTypeBuildkitCacheConfig = "application/vnd.buildkit.cacheconfig.v0"
 )
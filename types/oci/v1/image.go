@@ -37,6 +37,29 @@ type ImageConfig struct {
 
 	// StopSignal contains the system call signal that will be sent to the container to exit.
 	StopSignal string `json:"StopSignal,omitempty"`
+
+	// Healthcheck describes how to check the container is healthy.
+	// This is a docker extension to the OCI image config.
+	Healthcheck *HealthConfig `json:"Healthcheck,omitempty"`
+}
+
+// HealthConfig defines the healthcheck for a container.
+type HealthConfig struct {
+	// Test is the check to perform, an empty slice inherits the healthcheck.
+	// {"NONE"} disables the healthcheck, {"CMD", args...} runs a command, and {"CMD-SHELL", command} runs a command with the shell.
+	Test []string `json:",omitempty"`
+
+	// Interval is the time to wait between checks.
+	Interval time.Duration `json:",omitempty"`
+
+	// Timeout is the time to wait before considering the check to have hung.
+	Timeout time.Duration `json:",omitempty"`
+
+	// StartPeriod is the time for the container to initialize before failed checks are counted.
+	StartPeriod time.Duration `json:",omitempty"`
+
+	// Retries is the number of consecutive failures needed to consider a container as unhealthy.
+	Retries int `json:",omitempty"`
 }
 
 // RootFS describes a layer content addresses
@@ -36,7 +36,11 @@ var (
 		`(?:` + regexp.QuoteMeta(`:`) + `(` + tagS + `))?` +
 		`(?:` + regexp.QuoteMeta(`@`) + `(` + digestS + `))?$`)
 	schemeRE = regexp.MustCompile(`^([a-z]+)://(.+)$`)
-	pathRE   = regexp.MustCompile(`^(` + pathS + `)` +
+	memRE    = regexp.MustCompile(`^(` + repoPartS + `)` + regexp.QuoteMeta(`/`) +
+		`(` + repoPartS + `(?:` + regexp.QuoteMeta(`/`) + repoPartS + `)*)` +
+		`(?:` + regexp.QuoteMeta(`:`) + `(` + tagS + `))?` +
+		`(?:` + regexp.QuoteMeta(`@`) + `(` + digestS + `))?$`)
+	pathRE = regexp.MustCompile(`^(` + pathS + `)` +
 		`(?:` + regexp.QuoteMeta(`:`) + `(` + tagS + `))?` +
 		`(?:` + regexp.QuoteMeta(`@`) + `(` + digestS + `))?$`)
 )
@@ -101,7 +105,7 @@ func New(parse string) (Ref, error) {
 			ret.Tag = "latest"
 		}
 
-	case "ocidir", "ocifile":
+	case "ocidir", "ocifile", "ocitar":
 		matchPath := pathRE.FindStringSubmatch(path)
 		if matchPath == nil || len(matchPath) < 2 || matchPath[1] == "" {
 			return Ref{}, fmt.Errorf("invalid path for scheme \"%s\": %s", scheme, path)
@@ -114,6 +118,20 @@ func New(parse string) (Ref, error) {
 			ret.Digest = matchPath[3]
 		}
 
+	case "mem":
+		// mem://name/repo:tag, the name of the in-memory registry is stored in the Registry field
+		matchRef := memRE.FindStringSubmatch(path)
+		if matchRef == nil || len(matchRef) < 5 {
+			return Ref{}, fmt.Errorf("invalid reference for scheme \"%s\": %s", scheme, path)
+		}
+		ret.Registry = matchRef[1]
+		ret.Repository = matchRef[2]
+		ret.Tag = matchRef[3]
+		ret.Digest = matchRef[4]
+		if ret.Tag == "" && ret.Digest == "" {
+			ret.Tag = "latest"
+		}
+
 	default:
 		return Ref{}, fmt.Errorf("unhandled reference scheme \"%s\" in \"%s\"", scheme, parse)
 	}
@@ -138,8 +156,19 @@ func (r Ref) CommonName() string {
 		if r.Digest != "" {
 			cn = cn + "@" + r.Digest
 		}
-	case "ocidir":
-		cn = fmt.Sprintf("ocidir://%s", r.Path)
+	case "mem":
+		if r.Registry == "" || r.Repository == "" {
+			return ""
+		}
+		cn = fmt.Sprintf("mem://%s/%s", r.Registry, r.Repository)
+		if r.Tag != "" {
+			cn = cn + ":" + r.Tag
+		}
+		if r.Digest != "" {
+			cn = cn + "@" + r.Digest
+		}
+	case "ocidir", "ocitar":
+		cn = fmt.Sprintf("%s://%s", r.Scheme, r.Path)
 		if r.Tag != "" {
 			cn = cn + ":" + r.Tag
 		}
@@ -156,9 +185,9 @@ func EqualRegistry(a, b Ref) bool {
 		return false
 	}
 	switch a.Scheme {
-	case "reg":
+	case "reg", "mem":
 		return a.Registry == b.Registry
-	case "ocidir":
+	case "ocidir", "ocitar":
 		return a.Path == b.Path
 	default:
 		return false
@@ -171,9 +200,9 @@ func EqualRepository(a, b Ref) bool {
 		return false
 	}
 	switch a.Scheme {
-	case "reg":
+	case "reg", "mem":
 		return a.Registry == b.Registry && a.Repository == b.Repository
-	case "ocidir":
+	case "ocidir", "ocitar":
 		return a.Path == b.Path
 	default:
 		return false
@@ -264,6 +264,60 @@ func TestRef(t *testing.T) {
 			path:       "path/2/dir",
 			wantE:      nil,
 		},
+		{
+			name:       "OCI tar with tag",
+			ref:        "ocitar://path/to/bundle.tar:app-v1",
+			scheme:     "ocitar",
+			registry:   "",
+			repository: "",
+			tag:        "app-v1",
+			digest:     "",
+			path:       "path/to/bundle.tar",
+			wantE:      nil,
+		},
+		{
+			name:       "mem",
+			ref:        "mem://name/repo",
+			scheme:     "mem",
+			registry:   "name",
+			repository: "repo",
+			tag:        "latest",
+			digest:     "",
+			path:       "",
+			wantE:      nil,
+		},
+		{
+			name:       "mem with tag",
+			ref:        "mem://name/path/to/repo:v1.2.3",
+			scheme:     "mem",
+			registry:   "name",
+			repository: "path/to/repo",
+			tag:        "v1.2.3",
+			digest:     "",
+			path:       "",
+			wantE:      nil,
+		},
+		{
+			name:       "mem with digest",
+			ref:        "mem://name/repo@sha256:15f840677a5e245d9ea199eb9b026b1539208a5183621dced7b469f6aa678115",
+			scheme:     "mem",
+			registry:   "name",
+			repository: "repo",
+			tag:        "",
+			digest:     "sha256:15f840677a5e245d9ea199eb9b026b1539208a5183621dced7b469f6aa678115",
+			path:       "",
+			wantE:      nil,
+		},
+		{
+			name:  "invalid mem missing repo",
+			ref:   "mem://name:tag",
+			wantE: fmt.Errorf(`invalid reference for scheme "mem": name:tag`),
+		},
+		{
+			name:  "invalid mem repo case",
+			ref:   "mem://name/Repo:tag",
+			wantE: fmt.Errorf(`invalid reference for scheme "mem": name/Repo:tag`),
+		},
 		{
 			name:  "invalid scheme",
 			ref:   "unknown://repo:tag",
@@ -382,6 +436,18 @@ func TestCommon(t *testing.T) {
 			name: "ref with digest",
 			str:  "docker.io/group/image@sha256:15f840677a5e245d9ea199eb9b026b1539208a5183621dced7b469f6aa678115",
 		},
+		{
+			name: "ocitar with tag",
+			str:  "ocitar://bundle.tar:tag",
+		},
+		{
+			name: "mem with tag",
+			str:  "mem://name/image:tag",
+		},
+		{
+			name: "mem with digest",
+			str:  "mem://name/image@sha256:15f840677a5e245d9ea199eb9b026b1539208a5183621dced7b469f6aa678115",
+		},
 		{
 			name: "ocidir with tag",
 			str:  "ocidir:///tmp/image:tag",
@@ -464,6 +530,55 @@ func TestEqual(t *testing.T) {
 			expectReg:  false,
 			expectRepo: false,
 		},
+		{
+			name: "ocitar eq file",
+			a: Ref{
+				Scheme: "ocitar",
+				Path:   "path/to/file.tar",
+				Tag:    "a",
+			},
+			b: Ref{
+				Scheme: "ocitar",
+				Path:   "path/to/file.tar",
+				Tag:    "b",
+			},
+			expectReg:  true,
+			expectRepo: true,
+		},
+		{
+			name: "mem eq repo",
+			a: Ref{
+				Scheme:     "mem",
+				Registry:   "name",
+				Repository: "repo",
+				Tag:        "a",
+			},
+			b: Ref{
+				Scheme:     "mem",
+				Registry:   "name",
+				Repository: "repo",
+				Tag:        "b",
+			},
+			expectReg:  true,
+			expectRepo: true,
+		},
+		{
+			name: "mem ne name",
+			a: Ref{
+				Scheme:     "mem",
+				Registry:   "name-a",
+				Repository: "repo",
+				Tag:        "a",
+			},
+			b: Ref{
+				Scheme:     "mem",
+				Registry:   "name-b",
+				Repository: "repo",
+				Tag:        "b",
+			},
+			expectReg:  false,
+			expectRepo: false,
+		},
 		{
 			name: "ocidir eq file",
 			a: Ref{
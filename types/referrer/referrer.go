@@ -0,0 +1,190 @@
+// Package referrer is used for responses to the referrers to a manifest
+package referrer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/wraperr"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// ReferrerList contains the response to a request for referrers
+type ReferrerList struct {
+	Subject     ref.Ref            `json:"subject"`               // subject queried
+	Manifest    manifest.Manifest  `json:"-"`                     // returned OCI Index
+	Descriptors []types.Descriptor `json:"descriptors"`           // descriptors found in Index
+	Annotations map[string]string  `json:"annotations,omitempty"` // annotations extracted from Index
+	Tags        []string           `json:"tags,omitempty"`        // tags matched when using the fallback tag schema
+}
+
+// FallbackTag returns the tag used by registries without the referrers API, e.g. "sha256-<hex>"
+func FallbackTag(r ref.Ref) (ref.Ref, error) {
+	if r.Digest == "" {
+		return r, wraperr.New(fmt.Errorf("digest required to lookup referrers, reference %s", r.CommonName()), types.ErrMissingDigest)
+	}
+	dig, err := digest.Parse(r.Digest)
+	if err != nil {
+		return r, err
+	}
+	rOut := r
+	rOut.Digest = ""
+	rOut.Tag = fmt.Sprintf("%s-%s", dig.Algorithm().String(), dig.Encoded())
+	return rOut, nil
+}
+
+// Add appends a descriptor for the manifest to the referrer list.
+// Existing entries with the same digest are replaced.
+func (rl *ReferrerList) Add(m manifest.Manifest) error {
+	d, err := Descriptor(m)
+	if err != nil {
+		return err
+	}
+	for i := range rl.Descriptors {
+		if rl.Descriptors[i].Digest == d.Digest {
+			rl.Descriptors[i] = d
+			return rl.updateManifest()
+		}
+	}
+	rl.Descriptors = append(rl.Descriptors, d)
+	return rl.updateManifest()
+}
+
+// Delete removes the manifest from the referrer list.
+func (rl *ReferrerList) Delete(m manifest.Manifest) error {
+	dig := m.GetDescriptor().Digest
+	found := false
+	for i := len(rl.Descriptors) - 1; i >= 0; i-- {
+		if rl.Descriptors[i].Digest == dig {
+			rl.Descriptors = append(rl.Descriptors[:i], rl.Descriptors[i+1:]...)
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("referrer %s not found in list: %w", dig.String(), types.ErrNotFound)
+	}
+	return rl.updateManifest()
+}
+
+// IsEmpty reports if the returned list contains no descriptors
+func (rl ReferrerList) IsEmpty() bool {
+	return len(rl.Descriptors) == 0
+}
+
+// FilterArtifactType returns a copy of the list containing only descriptors with a matching artifactType
+func (rl ReferrerList) FilterArtifactType(at string) ReferrerList {
+	if at == "" {
+		return rl
+	}
+	dl := []types.Descriptor{}
+	for _, d := range rl.Descriptors {
+		if d.ArtifactType == at {
+			dl = append(dl, d)
+		}
+	}
+	rl.Descriptors = dl
+	return rl
+}
+
+// MarshalPretty is used for printPretty template formatting
+func (rl ReferrerList) MarshalPretty() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 1, ' ', 0)
+	if rl.Subject.CommonName() != "" {
+		fmt.Fprintf(tw, "Subject:\t%s\n", rl.Subject.CommonName())
+	}
+	if len(rl.Tags) > 0 {
+		fmt.Fprintf(tw, "Tags:\t%s\n", strings.Join(rl.Tags, ", "))
+	}
+	fmt.Fprintf(tw, "\t\n")
+	fmt.Fprintf(tw, "Referrers:\t\n")
+	for _, d := range rl.Descriptors {
+		fmt.Fprintf(tw, "\t\n")
+		dRef := rl.Subject
+		if dRef.Reference != "" {
+			dRef.Tag = ""
+			dRef.Digest = d.Digest.String()
+			fmt.Fprintf(tw, "  Name:\t%s\n", dRef.CommonName())
+		}
+		err := d.MarshalPrettyTW(tw, "  ")
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+	if len(rl.Annotations) > 0 {
+		fmt.Fprintf(tw, "\t\n")
+		fmt.Fprintf(tw, "Annotations:\t\n")
+		for k, v := range rl.Annotations {
+			fmt.Fprintf(tw, "  %s:\t%s\n", k, v)
+		}
+	}
+	tw.Flush()
+	return buf.Bytes(), nil
+}
+
+// updateManifest regenerates the OCI Index from the list of descriptors
+func (rl *ReferrerList) updateManifest() error {
+	index := v1.Index{
+		Versioned:   v1.IndexSchemaVersion,
+		MediaType:   types.MediaTypeOCI1ManifestList,
+		Manifests:   rl.Descriptors,
+		Annotations: rl.Annotations,
+	}
+	if rl.Manifest == nil {
+		m, err := manifest.New(manifest.WithOrig(index))
+		if err != nil {
+			return err
+		}
+		rl.Manifest = m
+		return nil
+	}
+	return rl.Manifest.SetOrig(index)
+}
+
+// Descriptor returns the descriptor used in a referrer list for a manifest, including the artifactType and annotations
+func Descriptor(m manifest.Manifest) (types.Descriptor, error) {
+	d := m.GetDescriptor()
+	desc := types.Descriptor{
+		MediaType: d.MediaType,
+		Size:      d.Size,
+		Digest:    d.Digest,
+	}
+	switch orig := m.GetOrig().(type) {
+	case v1.Manifest:
+		desc.ArtifactType = orig.ArtifactType
+		if desc.ArtifactType == "" {
+			desc.ArtifactType = orig.Config.MediaType
+		}
+		desc.Annotations = orig.Annotations
+	case v1.Index:
+		desc.ArtifactType = orig.ArtifactType
+		desc.Annotations = orig.Annotations
+	default:
+		return desc, wraperr.New(fmt.Errorf("referrers are not supported for media type %s", d.MediaType), types.ErrUnsupportedMediaType)
+	}
+	return desc, nil
+}
+
+// FromManifest parses an OCI Index returned by the referrers API or the fallback tag
+func FromManifest(r ref.Ref, m manifest.Manifest) (ReferrerList, error) {
+	rl := ReferrerList{
+		Subject:     r,
+		Manifest:    m,
+		Descriptors: []types.Descriptor{},
+	}
+	index, ok := m.GetOrig().(v1.Index)
+	if !ok {
+		return rl, wraperr.New(fmt.Errorf("referrers must be an OCI Index, received %s", m.GetDescriptor().MediaType), types.ErrUnsupportedMediaType)
+	}
+	if index.Manifests != nil {
+		rl.Descriptors = index.Manifests
+	}
+	rl.Annotations = index.Annotations
+	return rl, nil
+}